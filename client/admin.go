@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// adminRequest returns an admin request to the service bearing an admin token, and an archive's passphrase if it isn't empty
+func (c *Client) adminRequest(ctx context.Context, method, path, adminToken, passphrase string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	if passphrase != "" {
+		req.Header.Set(protocol.ArchivePassphraseHeader, passphrase)
+	}
+
+	return req, nil
+}
+
+// ExportUsers writes an archive of every user of the service, encrypted with a passphrase, to a writer
+// Requests without the service's admin token return a StatusError that unwraps to protocol.ErrNotAdmin
+func (c *Client) ExportUsers(ctx context.Context, adminToken, passphrase string, w io.Writer) error {
+	req, err := c.adminRequest(ctx, http.MethodGet, protocol.ExportPath, adminToken, passphrase, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ImportUsers creates the users in an archive read from a reader, encrypted with a passphrase, in the service
+// Users whose username is taken are skipped, and counted in the response
+// Requests without the service's admin token return a StatusError that unwraps to protocol.ErrNotAdmin
+func (c *Client) ImportUsers(ctx context.Context, adminToken, passphrase string, r io.Reader) (*protocol.ImportResponse, error) {
+	req, err := c.adminRequest(ctx, http.MethodPost, protocol.ImportPath, adminToken, passphrase, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var importResponse protocol.ImportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&importResponse); err != nil {
+		return nil, err
+	}
+
+	return &importResponse, nil
+}
+
+// LogInHistory returns the recent login attempts of a user of the service, oldest first
+// Requests without the service's admin token return a StatusError that unwraps to protocol.ErrNotAdmin
+func (c *Client) LogInHistory(ctx context.Context, adminToken, username string) (*protocol.LogInHistoryResponse, error) {
+	var logInHistoryResponse protocol.LogInHistoryResponse
+	if err := c.sendAdminJSON(ctx, http.MethodGet, protocol.AdminLogInHistoryPath, adminToken, username, nil, &logInHistoryResponse); err != nil {
+		return nil, err
+	}
+
+	return &logInHistoryResponse, nil
+}
+
+// AccountStatus returns the status of the account of a user of the service
+// Requests without the service's admin token return a StatusError that unwraps to protocol.ErrNotAdmin
+func (c *Client) AccountStatus(ctx context.Context, adminToken, username string) (protocol.AccountStatus, error) {
+	var statusResponse protocol.AccountStatusResponse
+	if err := c.sendAdminJSON(ctx, http.MethodGet, protocol.AccountStatusPath, adminToken, username, nil, &statusResponse); err != nil {
+		return "", err
+	}
+
+	return statusResponse.Status, nil
+}
+
+// SetAccountStatus changes the status of the account of a user of the service to active, disabled, or deleted, returning its new status,
+// which is pending verification for activated users who haven't verified their email address
+// Disabled and deleted users can't log in, and their sessions are revoked, until they are activated again
+// Requests without the service's admin token return a StatusError that unwraps to protocol.ErrNotAdmin
+func (c *Client) SetAccountStatus(ctx context.Context, adminToken, username string, status protocol.AccountStatus) (protocol.AccountStatus, error) {
+	var statusResponse protocol.AccountStatusResponse
+	statusRequest := &protocol.AccountStatusRequest{Username: username, Status: status}
+	if err := c.sendAdminJSON(ctx, http.MethodPost, protocol.AccountStatusPath, adminToken, "", statusRequest, &statusResponse); err != nil {
+		return "", err
+	}
+
+	return statusResponse.Status, nil
+}
+
+// UserClaims returns the roles and custom claims attached to a user of the service, without those a ClaimsProvider adds
+// Requests without the service's admin token return a StatusError that unwraps to protocol.ErrNotAdmin
+func (c *Client) UserClaims(ctx context.Context, adminToken, username string) (*protocol.UserClaims, error) {
+	var claims protocol.UserClaims
+	if err := c.sendAdminJSON(ctx, http.MethodGet, protocol.UserClaimsPath, adminToken, username, nil, &claims); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+// SetUserClaims replaces the roles and custom claims attached to a user of the service, which the ID tokens issued for them from then on carry
+// Requests without the service's admin token return a StatusError that unwraps to protocol.ErrNotAdmin
+func (c *Client) SetUserClaims(ctx context.Context, adminToken, username string, roles []string, claims map[string]json.RawMessage) (*protocol.UserClaims, error) {
+	var updated protocol.UserClaims
+	claimsRequest := &protocol.UserClaims{Username: username, Roles: roles, Claims: claims}
+	if err := c.sendAdminJSON(ctx, http.MethodPost, protocol.UserClaimsPath, adminToken, "", claimsRequest, &updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// sendAdminJSON sends an admin request about a user, named by the username query parameter if it isn't empty, with a JSON body if it isn't nil,
+// and decodes its JSON response
+func (c *Client) sendAdminJSON(ctx context.Context, method, path, adminToken, username string, reqBody, respBody any) error {
+	var body io.Reader
+	if reqBody != nil {
+		protocol.StampVersion(reqBody)
+		encoded, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	if username != "" {
+		path += "?" + url.Values{"username": {username}}.Encode()
+	}
+
+	req, err := c.adminRequest(ctx, method, path, adminToken, "", body)
+	if err != nil {
+		return err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(respBody)
+}
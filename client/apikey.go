@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// CreateAPIKey issues a Session's user an API key under a name, granting scopes, which authenticates machines as the user until it expires,
+// where a zero expiry never expires, or is revoked
+// The returned key is the only copy, since the service only stores its hash
+// Recovery sessions return a StatusError
+func (s *Session) CreateAPIKey(ctx context.Context, name string, scopes []string, expiresAt time.Time) (*protocol.APIKey, error) {
+	createRequest := &protocol.CreateAPIKeyRequest{Name: name, Scopes: scopes}
+	if !expiresAt.IsZero() {
+		createRequest.ExpiresAt = &expiresAt
+	}
+
+	var apiKey protocol.APIKey
+	if err := s.sendJSON(ctx, http.MethodPost, protocol.CreateAPIKeyPath, createRequest, &apiKey); err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+// APIKeys returns a Session's user's unexpired API keys, without the keys themselves, ordered by when they were issued
+func (s *Session) APIKeys(ctx context.Context) ([]protocol.APIKeyInfo, error) {
+	var apiKeysResponse protocol.APIKeysResponse
+	if err := s.sendJSON(ctx, http.MethodGet, protocol.APIKeysPath, nil, &apiKeysResponse); err != nil {
+		return nil, err
+	}
+
+	return apiKeysResponse.APIKeys, nil
+}
+
+// RevokeAPIKey revokes one of a Session's user's API keys by the ID APIKeys listed it with, so it no longer authenticates requests
+func (s *Session) RevokeAPIKey(ctx context.Context, id string) error {
+	return s.sendJSON(ctx, http.MethodPost, protocol.RevokeAPIKeyPath, &protocol.RevokeAPIKeyRequest{ID: id}, nil)
+}
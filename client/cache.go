@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+type (
+	// packetCacheEntry is a Packet being or having been derived from a password
+	packetCacheEntry struct {
+		digest [sha256.Size]byte
+		ready  chan struct{}
+		packet crypto.Scheme
+		err    error
+	}
+
+	// packetCache remembers the Packet derived for each username, so repeated logins skip key generation
+	// Entries are keyed by a digest of the password and its KDFParams under a per-cache key, so the cache never holds a reusable password hash
+	packetCache struct {
+		backend crypto.Backend
+		key     []byte
+		entries map[string]*packetCacheEntry
+		mu      sync.Mutex
+	}
+)
+
+// makePacketCache returns an empty packetCache of a Backend's Schemes with a random digest key
+func makePacketCache(backend crypto.Backend) *packetCache {
+	return &packetCache{
+		backend: backend,
+		key:     crypto.MakeRandByteStream().NextBytes(sha256.Size),
+		entries: map[string]*packetCacheEntry{},
+	}
+}
+
+// digest returns the digest identifying a password and its KDFParams
+func (pc *packetCache) digest(password string, params *crypto.KDFParams) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, pc.key)
+	for _, field := range [][]byte{[]byte(password), params.Salt} {
+		mac.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(field))))
+		mac.Write(field)
+	}
+	mac.Write(binary.LittleEndian.AppendUint32(nil, params.Time))
+	mac.Write(binary.LittleEndian.AppendUint32(nil, params.Memory))
+	mac.Write([]byte{params.Threads})
+
+	var digest [sha256.Size]byte
+	copy(digest[:], mac.Sum(nil))
+	return digest
+}
+
+// get returns the Packet derived from a user's password and KDFParams, unless the context is done first
+// Concurrent calls for the same password share one key generation, which finishes in the background after cancellation
+func (pc *packetCache) get(ctx context.Context, username, password string, params *crypto.KDFParams) (crypto.Scheme, error) {
+	digest := pc.digest(password, params)
+
+	pc.mu.Lock()
+	entry, ok := pc.entries[username]
+	if !ok || !hmac.Equal(entry.digest[:], digest[:]) {
+		entry = &packetCacheEntry{
+			digest: digest,
+			ready:  make(chan struct{}),
+		}
+		pc.entries[username] = entry
+
+		go func() {
+			defer close(entry.ready)
+
+			entry.packet, entry.err = makePacket(pc.backend, password, params)
+			if entry.err != nil {
+				pc.forget(username, entry)
+			}
+		}()
+	}
+	pc.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-entry.ready:
+		return entry.packet, entry.err
+	}
+}
+
+// forget removes a user's entry, if it is still the given one, or any entry when none is given
+func (pc *packetCache) forget(username string, entry *packetCacheEntry) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if current, ok := pc.entries[username]; ok && (entry == nil || current == entry) {
+		delete(pc.entries, username)
+	}
+}
+
+// forgetAll removes every entry
+func (pc *packetCache) forgetAll() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.entries = map[string]*packetCacheEntry{}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// defaultPollInterval is how long to wait between polls for a pending challenge when the service doesn't say
+const defaultPollInterval = time.Second
+
+// readChallenge returns the challenge in a response to a first login request
+// Pending challenges of asynchronous requests are polled for until they are computed, unless the context is done first
+func (c *Client) readChallenge(ctx context.Context, resp *http.Response) (*protocol.FirstLogInResponse, error) {
+	first := resp
+	defer func() {
+		if resp != first {
+			resp.Body.Close()
+		}
+	}()
+
+	for resp.StatusCode == http.StatusAccepted {
+		var pending protocol.PendingChallenge
+		if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(retryAfter(resp))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL()+protocol.ChallengeResultPath+pending.ChallengeID, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp != first {
+			resp.Body.Close()
+		}
+		resp = next
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var firstLogInResponse protocol.FirstLogInResponse
+	if err := json.NewDecoder(resp.Body).Decode(&firstLogInResponse); err != nil {
+		return nil, err
+	}
+
+	return &firstLogInResponse, nil
+}
+
+// retryAfter returns the wait a response's Retry-After header asks for in seconds, or defaultPollInterval without one
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return defaultPollInterval
+	}
+
+	return time.Duration(seconds) * time.Second
+}
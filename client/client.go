@@ -0,0 +1,818 @@
+// Package client is a client for the signup and login service
+// It only depends on the standard library's http client, so it also builds for js/wasm
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/crypto/circuit"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// idempotencyKeyByteLen is the length of a sign up request's idempotency key before encoding
+const idempotencyKeyByteLen = 16
+
+// Client is a client for a signup and login service, safe for concurrent use once configured
+// Packets derived from passwords are cached per username until forgotten
+type Client struct {
+	Port uint16
+	// AllowDowngrade permits logins with weaker terms than previously negotiated with the server
+	AllowDowngrade  bool
+	messageByteLen  int
+	url             string
+	scheme          string
+	headers         http.Header
+	progress        ProgressFunc
+	debug           io.Writer
+	httpClient      *http.Client
+	backend         crypto.Backend
+	pins            *pinStore
+	packets         *packetCache
+	pregenerator    *pregenerator
+	asyncChallenges bool
+	webSocketLogIn  bool
+	dialer          Dialer
+	http3           bool
+	stepUp          StepUpFunc
+	captcha         CaptchaFunc
+	passwordPolicy  *PasswordPolicy
+	srp             bool
+	opaque          bool
+	devices         DeviceTokenStore
+	deviceName      string
+	fingerprint     string
+	serverKey       ed25519.PublicKey
+}
+
+// New returns a client to a service given a message length, port, and options
+func New(messageByteLen int, port uint16, opts ...Option) *Client {
+	c := &Client{
+		Port:           port,
+		messageByteLen: messageByteLen,
+		scheme:         "http",
+		headers:        http.Header{},
+		httpClient:     &http.Client{},
+		backend:        crypto.MakeTFHEBackend(gates.DefaultGateBootstrappingParameters(128)),
+		pins:           makePinStore(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.http3 {
+		c.httpClient.Transport = preferHTTP3(c.httpClient.Transport)
+	}
+	c.packets = makePacketCache(c.backend)
+	if c.pregenerator != nil {
+		c.pregenerator.debugf = c.debugf
+		c.pregenerator.derive = func(ctx context.Context, username, password string) error {
+			_, err := c.logInPacket(ctx, username, password)
+			return err
+		}
+	}
+
+	return c
+}
+
+// Pinned returns the strongest terms previously negotiated with the service
+func (c *Client) Pinned() (protocol.Negotiation, bool) {
+	return c.pins.pinned(c.baseURL())
+}
+
+// debugf writes a formatted message to the client's debug writer, if it has one
+func (c *Client) debugf(format string, args ...any) {
+	if c.debug != nil {
+		fmt.Fprintf(c.debug, format, args...)
+	}
+}
+
+// baseURL returns the service's base url
+func (c *Client) baseURL() string {
+	if c.url != "" {
+		return c.url
+	}
+
+	return fmt.Sprintf("%s://localhost:%d", c.scheme, c.Port)
+}
+
+// makeHTTPCall returns the response to an http call for a given context, method, url, and body
+func (c *Client) makeHTTPCall(ctx context.Context, method, url string, body any) (*http.Response, error) {
+	req, err := c.newJSONRequest(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(req)
+}
+
+// newJSONRequest returns an http request for a given context, method, url, and body encoded as JSON, reporting upload progress if the client does
+// Bodies without a protocol version are sent in the current one
+func (c *Client) newJSONRequest(ctx context.Context, method, url string, body any) (*http.Request, error) {
+	protocol.StampVersion(body)
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	newReader := func() io.Reader {
+		var reqReader io.Reader = bytes.NewReader(reqBody)
+		if c.progress != nil {
+			reqReader = &progressReader{
+				reader:   reqReader,
+				endpoint: strings.TrimPrefix(url, c.baseURL()),
+				total:    int64(len(reqBody)),
+				progress: c.progress,
+			}
+		}
+
+		return reqReader
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, newReader())
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(reqBody))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(newReader()), nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// do sends an http request with the client's headers
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	for key, values := range c.headers {
+		req.Header[key] = append(req.Header[key], values...)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// await returns the result of a slow computation, or the context's error if it is done first
+// The computation can't be interrupted, so it finishes in the background after the context is done
+func await[T any](ctx context.Context, f func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case r := <-done:
+		return r.value, r.err
+	}
+}
+
+// makePacket returns the Scheme a Backend derives from a password stretched with KDFParams
+func makePacket(backend crypto.Backend, password string, params *crypto.KDFParams) (crypto.Scheme, error) {
+	seed, err := crypto.MakePasswordSeed([]byte(password), params)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.GenerateKeys(seed)
+}
+
+// destroyPacket wipes the private key of a Packet derived for one call once it returns, such as one from a recovery phrase,
+// unless the context is done, when work using the Packet may still be running in the background
+func destroyPacket(ctx context.Context, packet crypto.Scheme) {
+	if ctx.Err() == nil {
+		crypto.Destroy(packet)
+	}
+}
+
+// Forget removes the cached Packet for a username, such as after its password changes elsewhere
+func (c *Client) Forget(username string) {
+	if c.pregenerator != nil {
+		c.pregenerator.forget(username)
+	}
+	c.packets.forget(username, nil)
+}
+
+// ForgetAll removes every cached Packet
+func (c *Client) ForgetAll() {
+	if c.pregenerator != nil {
+		c.pregenerator.forget("")
+	}
+	c.packets.forgetAll()
+}
+
+// kdfParams returns the parameters that stretch a user's password, or their recovery phrase if recovery is set,
+// refusing with crypto.ErrInvalidKDFParams any the service sends that fail Check
+func (c *Client) kdfParams(ctx context.Context, username string, recovery bool) (*crypto.KDFParams, error) {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+"/kdf", &protocol.KDFRequest{Username: username, Recovery: recovery})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var params crypto.KDFParams
+	if err := json.NewDecoder(resp.Body).Decode(&params); err != nil {
+		return nil, err
+	} else if err := params.Check(); err != nil {
+		return nil, err
+	}
+
+	return &params, nil
+}
+
+// logInPacket returns the Packet derived from a user's password with the parameters the service has for them
+func (c *Client) logInPacket(ctx context.Context, username, password string) (crypto.Scheme, error) {
+	params, err := c.kdfParams(ctx, username, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.packets.get(ctx, username, password, params)
+}
+
+// derivePacket returns the Packet derived from a user's password and KDFParams, through the cache unless it is derived from a recovery phrase
+func (c *Client) derivePacket(ctx context.Context, username, password string, params *crypto.KDFParams, recovery bool) (crypto.Scheme, error) {
+	if recovery {
+		return await(ctx, func() (crypto.Scheme, error) {
+			return makePacket(c.backend, password, params)
+		})
+	}
+
+	return c.packets.get(ctx, username, password, params)
+}
+
+// DerivePacket returns the Packet, or Scheme of another Backend, derived from a user's password with the parameters the service has for them
+// It can be exported and used with LogInWithPacket, so later logins need neither the password nor key generation
+func (c *Client) DerivePacket(username, password string) (crypto.Scheme, error) {
+	return c.DerivePacketCtx(context.Background(), username, password)
+}
+
+// DerivePacketCtx returns the Packet derived from a user's password, unless the context is done first
+func (c *Client) DerivePacketCtx(ctx context.Context, username, password string) (crypto.Scheme, error) {
+	return c.logInPacket(ctx, username, password)
+}
+
+// SignUp signs up a user in the service with a given username and password
+// Rejections return a StatusError that unwraps to protocol.ErrUserExists, ErrBadRequest, or ErrServer,
+// and passwords that break the client's PasswordPolicy return a PasswordPolicyError before anything is sent
+func (c *Client) SignUp(username, password string) (bool, error) {
+	return c.SignUpCtx(context.Background(), username, password)
+}
+
+// SignUpCtx signs up a user in the service with a given username and password, unless the context is done first
+func (c *Client) SignUpCtx(ctx context.Context, username, password string) (bool, error) {
+	return c.SignUpWithEmailCtx(ctx, username, "", password)
+}
+
+// SignUpWithEmailCtx signs up a user with an email address, unless the context is done first
+// Services that verify addresses mail a token to it, and the user can't log in until it is passed to VerifyEmail
+func (c *Client) SignUpWithEmailCtx(ctx context.Context, username, email, password string) (bool, error) {
+	return c.SignUpWithRecoveryCtx(ctx, username, email, password, "")
+}
+
+// SignUpWithRecoveryCtx signs up a user with an email address, which may be empty, and a recovery phrase, such as one from GenerateRecoveryPhrase,
+// unless the context is done first
+// The recovery phrase encrypts a second secret, which LogInWithRecoveryCtx logs in with if the password is lost, and an empty phrase enrolls none
+func (c *Client) SignUpWithRecoveryCtx(ctx context.Context, username, email, password, recoveryPhrase string) (bool, error) {
+	if c.passwordPolicy != nil {
+		if err := c.passwordPolicy.enforce(password, username, email); err != nil {
+			return false, err
+		}
+	}
+
+	if c.opaque {
+		if recoveryPhrase != "" {
+			return false, errOPAQUERecovery
+		}
+
+		enrollment, err := c.enrollOPAQUE(ctx, password)
+		if err != nil {
+			return false, err
+		}
+
+		return c.submitSignUp(ctx, &protocol.SignUpRequest{Username: username, Email: email, OPAQUE: enrollment})
+	} else if c.srp {
+		if recoveryPhrase != "" {
+			return false, errSRPRecovery
+		}
+
+		enrollment, err := enrollSRP(password)
+		if err != nil {
+			return false, err
+		}
+
+		return c.submitSignUp(ctx, &protocol.SignUpRequest{Username: username, Email: email, SRP: enrollment})
+	}
+
+	params, encryptedSecret, secret, err := c.enroll(ctx, username, password, false)
+	if err != nil {
+		return false, err
+	}
+
+	req := &protocol.SignUpRequest{
+		Username:        username,
+		Email:           email,
+		KDFParams:       params,
+		EncryptedSecret: encryptedSecret,
+		Secret:          secret,
+	}
+	c.debugf("Secret:\t\t\t%v\n", req.Secret)
+	defer crypto.Release(req.EncryptedSecret)
+
+	if recoveryPhrase != "" {
+		params, encryptedSecret, secret, err := c.enroll(ctx, username, recoveryPhrase, true)
+		if err != nil {
+			return false, err
+		}
+		defer crypto.Release(encryptedSecret)
+
+		req.Recovery = &protocol.RecoveryEnrollment{
+			KDFParams:       params,
+			EncryptedSecret: encryptedSecret,
+			Secret:          secret,
+		}
+	}
+
+	return c.submitSignUp(ctx, req)
+}
+
+// submitSignUp sends a sign up request, retrying it once with a token from the client's CaptchaFunc if the service requires a CAPTCHA
+func (c *Client) submitSignUp(ctx context.Context, req *protocol.SignUpRequest) (bool, error) {
+	err := c.signUp(ctx, req)
+	if errors.Is(err, protocol.ErrCaptchaRequired) && c.captcha != nil {
+		if req.CaptchaToken, err = c.captcha(ctx); err != nil {
+			return false, err
+		}
+		err = c.signUp(ctx, req)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// signUp sends a sign up request with a fresh idempotency key, so transports that retry it after a lost response get its original outcome
+func (c *Client) signUp(ctx context.Context, req *protocol.SignUpRequest) error {
+	key := make([]byte, idempotencyKeyByteLen)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	httpReq, err := c.newJSONRequest(ctx, http.MethodPut, c.baseURL()+"/sign-up", req)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set(protocol.IdempotencyKeyHeader, hex.EncodeToString(key))
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	return nil
+}
+
+// enroll stretches a password with fresh KDF parameters, and returns them with a random secret and its masked payload encrypted under the password's keys
+// Keys of recovery phrases aren't cached, so they don't replace the keys of the user's password
+func (c *Client) enroll(ctx context.Context, username, password string, recovery bool) (*crypto.KDFParams, gates.Ctxt, []byte, error) {
+	params, err := crypto.MakeKDFParams()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	packet, err := c.derivePacket(ctx, username, password, params, recovery)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if recovery {
+		defer destroyPacket(ctx, packet)
+	}
+	noise := make([]byte, c.messageByteLen) //randCryptoByteStream().nextBytes(c.messageByteLen)
+	secret := crypto.MakeRandByteStream().NextBytes(c.messageByteLen)
+	payload := append(noise, xorBytes(noise, secret)...)
+
+	encryptedPayload, err := packet.Encrypt(payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return params, encryptedPayload, secret, nil
+}
+
+// LogIn logs a user into the service with a username and password, returning a Session for authenticated calls
+// Rejections return a StatusError that unwraps to protocol.ErrUserDoesNotExist, ErrInvalidCredentials, ErrUnverified, ErrBusy, ErrBadRequest, or ErrServer
+// A DowngradeError is returned if the service negotiates weaker terms than it has before, unless AllowDowngrade is set,
+// and a PasskeyRequiredError if the password was accepted but the user must also assert a passkey
+func (c *Client) LogIn(username, password string) (*Session, error) {
+	return c.LogInCtx(context.Background(), username, password)
+}
+
+// LogInCtx logs a user into the service with a username and password, unless the context is done first
+// Clients built WithOPAQUE or WithSRP log in with OPAQUE or SRP, as do others once the service says the user signed up with it
+// Clients built WithRememberDevice log in with the user's device token instead, if they have a valid one, skipping key generation
+// Users whose service requires their secret's rotation have it rotated with Session.RotateSecret before the Session is returned
+func (c *Client) LogInCtx(ctx context.Context, username, password string) (*Session, error) {
+	return c.remembered(ctx, username, func() (*Session, error) {
+		return c.logInPassword(ctx, username, password)
+	})
+}
+
+// logInPassword logs a user into the service with a username and password, with OPAQUE, SRP, or their Packet as the client and service call for
+func (c *Client) logInPassword(ctx context.Context, username, password string) (*Session, error) {
+	var session *Session
+	var err error
+	switch {
+	case c.opaque:
+		session, err = c.logInOPAQUE(ctx, username, password)
+	case c.srp:
+		session, err = c.logInSRP(ctx, username, password)
+	default:
+		var params *crypto.KDFParams
+		if params, err = c.kdfParams(ctx, username, false); err == nil {
+			var packet crypto.Scheme
+			if packet, err = c.packets.get(ctx, username, password, params); err == nil {
+				if session, err = c.logIn(ctx, username, packet, params.Salt, false); err == nil && session.RotationRequired() {
+					// Rotation is best effort, and the Session still says it is required if it fails
+					session.RotateSecret(ctx, password)
+				}
+				return session, err
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(err, protocol.ErrSRPRequired):
+		return c.logInSRP(ctx, username, password)
+	case errors.Is(err, protocol.ErrOPAQUERequired):
+		return c.logInOPAQUE(ctx, username, password)
+	}
+
+	return session, err
+}
+
+// LogInWithPacket logs a user into the service with the Packet derived from their password, such as one imported from disk
+func (c *Client) LogInWithPacket(username string, packet crypto.Scheme) (*Session, error) {
+	return c.LogInWithPacketCtx(context.Background(), username, packet)
+}
+
+// LogInWithPacketCtx logs a user into the service with the Packet derived from their password, unless the context is done first
+func (c *Client) LogInWithPacketCtx(ctx context.Context, username string, packet crypto.Scheme) (*Session, error) {
+	return c.remembered(ctx, username, func() (*Session, error) {
+		return c.logIn(ctx, username, packet, nil, false)
+	})
+}
+
+// LogInWithRecoveryCtx logs a user into the service with the recovery phrase they signed up with, unless the context is done first
+// The Session can reset the user's password with ResetPassword, and services limit how often each user can try
+func (c *Client) LogInWithRecoveryCtx(ctx context.Context, username, recoveryPhrase string) (*Session, error) {
+	params, err := c.kdfParams(ctx, username, true)
+	if err != nil {
+		return nil, err
+	}
+
+	packet, err := c.derivePacket(ctx, username, recoveryPhrase, params, true)
+	if err != nil {
+		return nil, err
+	}
+	defer destroyPacket(ctx, packet)
+
+	return c.logIn(ctx, username, packet, nil, true)
+}
+
+// logIn logs a user into the service with the Packet derived from their password, or their recovery phrase if recovery is set,
+// echoing the salt of the KDFParams it was derived with, if known, so a login begun before the password changed elsewhere can still finish
+func (c *Client) logIn(ctx context.Context, username string, packet crypto.Scheme, kdfSalt []byte, recovery bool) (*Session, error) {
+	firstReq := &protocol.FirstLogInRequest{
+		Username:  username,
+		PublicKey: packet.PublicKey(),
+		KDFSalt:   kdfSalt,
+		Recovery:  recovery,
+	}
+
+	return c.screened(ctx, username, &firstReq.StepUpToken, &firstReq.CaptchaToken, func() (*Session, error) {
+		return c.logInOnce(ctx, firstReq, packet)
+	})
+}
+
+// screened runs a login attempt, retrying it when it is refused with protocol.ErrStepUpRequired or protocol.ErrCaptchaRequired
+// with a token from the client's StepUpFunc or CaptchaFunc, if it has one, which is set in the attempt's request, asking each for at most one token
+func (c *Client) screened(ctx context.Context, username string, stepUpToken, captchaToken *string, attempt func() (*Session, error)) (*Session, error) {
+	session, err := attempt()
+	for err != nil {
+		switch {
+		case errors.Is(err, protocol.ErrStepUpRequired) && c.stepUp != nil && *stepUpToken == "":
+			*stepUpToken, err = c.stepUp(ctx, username)
+		case errors.Is(err, protocol.ErrCaptchaRequired) && c.captcha != nil && *captchaToken == "":
+			*captchaToken, err = c.captcha(ctx)
+		default:
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		session, err = attempt()
+	}
+
+	return session, nil
+}
+
+// logInOnce runs both login steps, starting with a first login request, with the user's packet
+func (c *Client) logInOnce(ctx context.Context, firstReq *protocol.FirstLogInRequest, packet crypto.Scheme) (*Session, error) {
+	if c.dialer != nil {
+		conn, err := c.dialer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		return c.logInStream(ctx, conn, firstReq, packet)
+	} else if c.webSocketLogIn {
+		return c.logInWebSocket(ctx, firstReq, packet)
+	}
+
+	secondReq, err := c.challenge(ctx, firstReq, packet)
+	if err != nil {
+		return nil, err
+	}
+	c.debugf("Decrypted Secret:\t%v\n", secondReq.Secret)
+
+	secondResp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+"/login-2", secondReq)
+	if err != nil {
+		return nil, err
+	}
+	defer secondResp.Body.Close()
+
+	if secondResp.StatusCode != http.StatusOK {
+		return nil, readError(secondResp)
+	}
+
+	var logInResponse protocol.LogInResponse
+	if err := json.NewDecoder(secondResp.Body).Decode(&logInResponse); err != nil {
+		return nil, err
+	}
+
+	return c.logInSession(firstReq.Username, &logInResponse)
+}
+
+// challenge sends a first login request, asynchronously if the client is configured to, returning the second login request that answers it
+// with the secret decrypted with the user's packet
+func (c *Client) challenge(ctx context.Context, firstReq *protocol.FirstLogInRequest, packet crypto.Scheme) (*protocol.SecondLogInRequest, error) {
+	firstReq.Async = c.asyncChallenges
+	firstResp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+"/login-1", firstReq)
+	if err != nil {
+		return nil, err
+	}
+	defer firstResp.Body.Close()
+
+	firstLogInResponse, err := c.readChallenge(ctx, firstResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.answerChallenge(firstReq, firstLogInResponse, packet)
+}
+
+// answerChallenge solves the challenge of a first login response with a user's packet, returning the second login request that answers it,
+// with the transcript of the request, the response, and the secret
+// The request is sent in the protocol version the response negotiated, which is covered by the transcript
+// Clients built WithServerKey return ErrInvalidSignature for responses the key didn't sign
+func (c *Client) answerChallenge(firstReq *protocol.FirstLogInRequest, firstLogInResponse *protocol.FirstLogInResponse, packet crypto.Scheme) (*protocol.SecondLogInRequest, error) {
+	version := firstLogInResponse.ProtocolVersion
+	if version < protocol.MinVersion || version > protocol.Version {
+		crypto.Release(firstLogInResponse.EncryptedMutatedSecret)
+		return nil, fmt.Errorf("%w: server negotiated version %d", protocol.ErrUnsupportedVersion, version)
+	}
+
+	transcript := protocol.NewTranscript(firstReq.Username, firstReq.Recovery).WithPublicKey(firstReq.PublicKey)
+	samplesHash := sha256.New()
+	protocol.HashSamples(samplesHash, firstLogInResponse.EncryptedMutatedSecret)
+	transcript = transcript.WithChallenge(firstLogInResponse, samplesHash.Sum(nil))
+	if c.serverKey != nil && !transcript.Verify(c.serverKey, firstLogInResponse.Signature) {
+		crypto.Release(firstLogInResponse.EncryptedMutatedSecret)
+		return nil, ErrInvalidSignature
+	}
+
+	secret, err := c.solveChallenge(packet, firstLogInResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.SecondLogInRequest{
+		Username:    firstReq.Username,
+		Secret:      secret,
+		Recovery:    firstReq.Recovery,
+		ChallengeID: firstLogInResponse.ChallengeID,
+		Nonce:       firstLogInResponse.Nonce,
+		Transcript:  transcript.WithResponse(secret),
+		Versioned:   protocol.Versioned{Version: version},
+	}, nil
+}
+
+// solveChallenge checks the terms of a first login response, and decrypts its challenge with a user's packet into their secret
+// The secret is as long as the response says the user enrolled, or the client's message length if it doesn't say
+func (c *Client) solveChallenge(packet crypto.Scheme, firstLogInResponse *protocol.FirstLogInResponse) ([]byte, error) {
+	if err := c.pins.check(c.baseURL(), firstLogInResponse.Negotiation, c.AllowDowngrade); err != nil {
+		return nil, err
+	}
+
+	secretByteLen := firstLogInResponse.SecretByteLen
+	if secretByteLen == 0 {
+		secretByteLen = c.messageByteLen
+	}
+	if err := crypto.CheckCtxt(firstLogInResponse.EncryptedMutatedSecret, 16*secretByteLen); err != nil {
+		return nil, fmt.Errorf("%w: %w", errMalformedChallenge, err)
+	}
+
+	mutatedSecret, err := packet.Decrypt(firstLogInResponse.EncryptedMutatedSecret)
+	crypto.Release(firstLogInResponse.EncryptedMutatedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return xorBytes(mutatedSecret[:secretByteLen], mutatedSecret[secretByteLen:]), nil
+}
+
+// ChangePassword changes a user's password without changing or revealing their secret
+// The new password is stretched with a fresh salt
+// The old password proves ownership through the login challenge, then the service re-keys the stored payload with a switching key and re-masks it
+// The user's sessions, remembered devices, and API keys are revoked, so they log in again with the new password
+func (c *Client) ChangePassword(username, oldPassword, newPassword string) (bool, error) {
+	return c.ChangePasswordCtx(context.Background(), username, oldPassword, newPassword)
+}
+
+// ChangePasswordCtx changes a user's password without changing or revealing their secret, unless the context is done first
+func (c *Client) ChangePasswordCtx(ctx context.Context, username, oldPassword, newPassword string) (bool, error) {
+	oldPacket, err := c.logInPacket(ctx, username, oldPassword)
+	if err != nil {
+		return false, err
+	}
+
+	params, err := crypto.MakeKDFParams()
+	if err != nil {
+		return false, err
+	}
+
+	newPacket, err := await(ctx, func() (crypto.Scheme, error) {
+		return makePacket(c.backend, newPassword, params)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer destroyPacket(ctx, newPacket)
+
+	secondReq, err := c.challenge(ctx, &protocol.FirstLogInRequest{Username: username, PublicKey: oldPacket.PublicKey()}, oldPacket)
+	if err != nil {
+		return false, err
+	}
+	secret := secondReq.Secret
+
+	switchingKey, err := await(ctx, func() (*crypto.PublicKey, error) {
+		return oldPacket.SwitchingKey(newPacket), nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	mask := crypto.MakeRandByteStream().NextBytes(len(secret))
+	reMask, err := newPacket.Encrypt(append(mask, mask...))
+	if err != nil {
+		return false, err
+	}
+
+	req := &protocol.ChangePasswordRequest{
+		Username:     username,
+		Secret:       secret,
+		ChallengeID:  secondReq.ChallengeID,
+		Nonce:        secondReq.Nonce,
+		Transcript:   secondReq.Transcript,
+		KDFParams:    params,
+		PublicKey:    newPacket.PublicKey(),
+		SwitchingKey: switchingKey,
+		ReMask:       reMask,
+		Versioned:    secondReq.Versioned,
+	}
+
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+"/change-password", req)
+	crypto.Release(req.ReMask)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, readError(resp)
+	}
+	c.Forget(username)
+
+	return true, nil
+}
+
+// Evaluate evaluates a circuit against a user's encrypted secret, which is bound to the circuit input named "secret"
+// The user is logged in first, since services only evaluate circuits for their sessions' users
+// The remaining circuit inputs are encrypted from plaintext inputs, and the circuit outputs are returned decrypted
+func (c *Client) Evaluate(username, password string, cir *circuit.Circuit, inputs map[string][]byte) (map[string][]byte, error) {
+	return c.EvaluateCtx(context.Background(), username, password, cir, inputs)
+}
+
+// EvaluateCtx evaluates a circuit against a user's encrypted secret, unless the context is done first
+func (c *Client) EvaluateCtx(ctx context.Context, username, password string, cir *circuit.Circuit, inputs map[string][]byte) (map[string][]byte, error) {
+	packet, err := c.logInPacket(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	session, err := c.logIn(ctx, username, packet, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedCircuit, err := json.Marshal(cir)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &protocol.EvaluateRequest{
+		Username:  username,
+		PublicKey: packet.PublicKey(),
+		Circuit:   encodedCircuit,
+		Inputs:    make(map[string]gates.Ctxt, len(inputs)),
+	}
+	for name, input := range inputs {
+		if req.Inputs[name], err = packet.Encrypt(input); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp *http.Response
+	httpReq, err := c.newJSONRequest(ctx, http.MethodPost, c.baseURL()+"/evaluate", req)
+	if err == nil {
+		resp, err = session.Do(httpReq)
+	}
+	for _, input := range req.Inputs {
+		crypto.Release(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var evaluateResponse protocol.EvaluateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&evaluateResponse); err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string][]byte, len(evaluateResponse.Outputs))
+	for name, output := range evaluateResponse.Outputs {
+		if outputs[name], err = packet.Decrypt(output); err != nil {
+			return nil, err
+		}
+	}
+
+	return outputs, nil
+}
+
+// xorBytes returns a slice of bytes that is the XOR of the input values
+func xorBytes(a, b []byte) []byte {
+	if len(a) != len(b) {
+		panic("expected equal number of bytes")
+	}
+
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+
+	return result
+}
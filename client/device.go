@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// ErrNotRemembered is returned by LogInRememberedCtx when the user has no device token the service accepts
+var ErrNotRemembered = errors.New("device not remembered")
+
+// DeviceTokenStore keeps the device token each user is remembered with by each service, such as in a file or the browser's storage
+type DeviceTokenStore interface {
+	// LoadDeviceToken returns a user's device token for the service at a base URL, or nil if there is none
+	LoadDeviceToken(baseURL, username string) (*protocol.DeviceToken, error)
+	// SaveDeviceToken replaces a user's device token for the service at a base URL
+	SaveDeviceToken(baseURL, username string, token *protocol.DeviceToken) error
+	// DeleteDeviceToken removes a user's device token for the service at a base URL, if there is one
+	DeleteDeviceToken(baseURL, username string) error
+}
+
+// LogInWithDeviceTokenCtx logs a user into the service with the token of a device they are remembered on and the fingerprint it was bound to,
+// unless the context is done first
+// Unknown, expired, and revoked tokens return a StatusError that unwraps to protocol.ErrInvalidCredentials
+func (c *Client) LogInWithDeviceTokenCtx(ctx context.Context, username, token, fingerprint string) (*Session, error) {
+	logInReq := &protocol.DeviceLogInRequest{
+		Username:    username,
+		Token:       token,
+		Fingerprint: fingerprint,
+	}
+
+	return c.screened(ctx, username, &logInReq.StepUpToken, &logInReq.CaptchaToken, func() (*Session, error) {
+		var logInResponse protocol.LogInResponse
+		if err := c.postJSON(ctx, protocol.DeviceLogInPath, logInReq, &logInResponse); err != nil {
+			return nil, err
+		}
+
+		return c.logInSession(username, &logInResponse)
+	})
+}
+
+// LogInRememberedCtx logs a user into the service with the device token a client built WithRememberDevice saved for them, unless the context is done first
+// Users without a saved token, or whose token the service rejects, which is then deleted, return ErrNotRemembered
+func (c *Client) LogInRememberedCtx(ctx context.Context, username string) (*Session, error) {
+	if c.devices == nil {
+		return nil, ErrNotRemembered
+	}
+
+	deviceToken, err := c.devices.LoadDeviceToken(c.baseURL(), username)
+	if err != nil {
+		return nil, err
+	} else if deviceToken == nil {
+		return nil, ErrNotRemembered
+	} else if time.Now().After(deviceToken.ExpiresAt) {
+		return nil, errors.Join(ErrNotRemembered, c.devices.DeleteDeviceToken(c.baseURL(), username))
+	}
+
+	session, err := c.LogInWithDeviceTokenCtx(ctx, username, deviceToken.Token, c.fingerprint)
+	if errors.Is(err, protocol.ErrInvalidCredentials) || errors.Is(err, protocol.ErrBadRequest) || errors.Is(err, protocol.ErrUserDoesNotExist) {
+		c.debugf("device token rejected: %v\n", err)
+		return nil, errors.Join(ErrNotRemembered, c.devices.DeleteDeviceToken(c.baseURL(), username))
+	}
+
+	return session, err
+}
+
+// remembered logs a user in with their saved device token if the client remembers devices and they have one the service accepts,
+// or else with a login function, after which the device is remembered for their next login
+// Failing to remember the device doesn't fail the login
+func (c *Client) remembered(ctx context.Context, username string, logIn func() (*Session, error)) (*Session, error) {
+	if c.devices == nil {
+		return logIn()
+	}
+
+	if session, err := c.LogInRememberedCtx(ctx, username); !errors.Is(err, ErrNotRemembered) {
+		return session, err
+	}
+
+	session, err := logIn()
+	if err != nil {
+		return nil, err
+	}
+
+	deviceToken, err := session.RememberDevice(ctx, c.deviceName, c.fingerprint)
+	if err == nil {
+		err = c.devices.SaveDeviceToken(c.baseURL(), username, deviceToken)
+	}
+	if err != nil {
+		c.debugf("device not remembered: %v\n", err)
+	}
+
+	return session, nil
+}
+
+// RememberDevice remembers the device a Session is on under a name, returning a token that logs its user in there until it expires,
+// bound to a fingerprint of the device if one is given
+// Recovery sessions return a StatusError, as do services that don't remember devices
+func (s *Session) RememberDevice(ctx context.Context, name, fingerprint string) (*protocol.DeviceToken, error) {
+	var deviceToken protocol.DeviceToken
+	if err := s.sendJSON(ctx, http.MethodPost, protocol.RememberDevicePath, &protocol.RememberDeviceRequest{Name: name, Fingerprint: fingerprint}, &deviceToken); err != nil {
+		return nil, err
+	}
+
+	return &deviceToken, nil
+}
+
+// Devices returns the devices a Session's user is remembered on, ordered by when they were remembered
+func (s *Session) Devices(ctx context.Context) ([]protocol.DeviceInfo, error) {
+	var devicesResponse protocol.DevicesResponse
+	if err := s.sendJSON(ctx, http.MethodGet, protocol.DevicesPath, nil, &devicesResponse); err != nil {
+		return nil, err
+	}
+
+	return devicesResponse.Devices, nil
+}
+
+// RevokeDevice forgets one of a Session's user's devices by the ID Devices listed it with, so its token no longer logs them in
+func (s *Session) RevokeDevice(ctx context.Context, id string) error {
+	return s.sendJSON(ctx, http.MethodPost, protocol.RevokeDevicePath, &protocol.RevokeDeviceRequest{ID: id}, nil)
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// Dialer opens a connection to the service that carries one login's messages, over any transport, unless the context is done first
+type Dialer func(ctx context.Context) (protocol.MessageConn, error)
+
+// DialStream returns a Dialer that logs in over a raw byte stream to an address on a network, such as tcp or unix, served by server.ServeStreams,
+// over TLS if a TLS configuration is set
+func DialStream(network, address string, tlsConfig *tls.Config) Dialer {
+	return func(ctx context.Context) (protocol.MessageConn, error) {
+		var dialer interface {
+			DialContext(ctx context.Context, network, address string) (net.Conn, error)
+		} = &net.Dialer{}
+		if tlsConfig != nil {
+			dialer = &tls.Dialer{Config: tlsConfig}
+		}
+
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		return protocol.NewStreamConn(conn), nil
+	}
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errMalformedChallenge = errors.New("malformed challenge")
+
+// ErrInvalidSignature is returned by logins whose challenge isn't signed by the key a client was built WithServerKey, such as from a spoofed server
+var ErrInvalidSignature = errors.New("challenge isn't signed by the server's key")
+
+// StatusError is a non 2XX response from a service, which unwraps to one of the protocol package's errors
+type StatusError struct {
+	StatusCode int
+	protocol.ErrorResponse
+}
+
+// readError returns the StatusError for a non 2XX response
+// Bodies that aren't an ErrorResponse are classified by status alone
+func readError(resp *http.Response) error {
+	statusErr := &StatusError{StatusCode: resp.StatusCode}
+	if err := json.NewDecoder(resp.Body).Decode(&statusErr.ErrorResponse); err != nil {
+		statusErr.ErrorResponse = protocol.ErrorResponse{Message: resp.Status}
+	}
+
+	return statusErr
+}
+
+// Error returns a StatusError's status and message
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", se.StatusCode, se.Code, se.Message)
+}
+
+// Unwrap returns the error a StatusError's code or status represents
+func (se *StatusError) Unwrap() error {
+	return protocol.CodeError(se.Code, se.StatusCode)
+}
@@ -0,0 +1,71 @@
+//go:build !js
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+	"google.golang.org/grpc"
+)
+
+type (
+	// jsonCodec is the gRPC codec named protocol.GRPCCodec, which carries messages as JSON
+	jsonCodec struct{}
+
+	// grpcConn is a protocol.MessageConn over a gRPC stream
+	grpcConn struct {
+		stream grpc.ClientStream
+	}
+)
+
+// logInStreamDesc describes the bidirectional stream at protocol.GRPCLogInMethod
+var logInStreamDesc = grpc.StreamDesc{
+	StreamName:    "LogIn",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// Marshal encodes a message as JSON
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes a JSON message into v
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name returns protocol.GRPCCodec
+func (jsonCodec) Name() string {
+	return protocol.GRPCCodec
+}
+
+// ReadMessage reads the next message of a gRPC stream into v, until the stream's context is done
+func (gc grpcConn) ReadMessage(_ context.Context, v any) error {
+	return gc.stream.RecvMsg(v)
+}
+
+// WriteMessage writes a message to a gRPC stream, until the stream's context is done
+func (gc grpcConn) WriteMessage(_ context.Context, v any) error {
+	return gc.stream.SendMsg(v)
+}
+
+// Close ends the client's side of a gRPC stream
+func (gc grpcConn) Close() error {
+	return gc.stream.CloseSend()
+}
+
+// DialGRPC returns a Dialer that logs in over a bidirectional stream on a gRPC connection to a server.Server's RegisterGRPC service,
+// whose messages are sent with the protocol.GRPCCodec codec
+func DialGRPC(cc grpc.ClientConnInterface) Dialer {
+	return func(ctx context.Context) (protocol.MessageConn, error) {
+		stream, err := cc.NewStream(ctx, &logInStreamDesc, protocol.GRPCLogInMethod, grpc.ForceCodec(jsonCodec{}))
+		if err != nil {
+			return nil, err
+		}
+
+		return grpcConn{stream: stream}, nil
+	}
+}
@@ -0,0 +1,115 @@
+//go:build !js
+
+package client
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Transport is an http.RoundTripper that sends requests over HTTP/3 to hosts that advertise it, and over TCP otherwise
+// A host is only tried over HTTP/3 after a TCP response advertises it in its Alt-Svc header, and is forgotten if HTTP/3 fails
+type http3Transport struct {
+	fallback http.RoundTripper
+	quic     *http3.RoundTripper
+
+	mu    sync.Mutex
+	hosts map[string]bool
+}
+
+// preferHTTP3 returns a transport that prefers HTTP/3 to a TCP transport, with the TCP transport's TLS configuration
+func preferHTTP3(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	var config *tls.Config
+	if t, ok := transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		config = t.TLSClientConfig.Clone()
+	}
+
+	return &http3Transport{
+		fallback: transport,
+		quic:     &http3.RoundTripper{TLSClientConfig: config},
+		hosts:    map[string]bool{},
+	}
+}
+
+// RoundTrip sends a request over HTTP/3 if its host advertised it, retrying over TCP if HTTP/3 fails before a response
+// Requests whose body can't be replayed, and WebSocket upgrades, always use TCP
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.advertised(req.URL.Host) && req.Header.Get("Upgrade") == "" && (req.Body == nil || req.GetBody != nil) {
+		resp, err := t.quic.RoundTrip(req)
+		if err == nil || req.Context().Err() != nil {
+			return resp, err
+		}
+		t.remember(req.URL.Host, false)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+
+	resp, err := t.fallback.RoundTrip(req)
+	if err == nil && req.URL.Scheme == "https" && advertisesHTTP3(resp.Header, req.URL) {
+		t.remember(req.URL.Host, true)
+	}
+
+	return resp, err
+}
+
+// advertised returns whether a host advertised HTTP/3
+func (t *http3Transport) advertised(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.hosts[host]
+}
+
+// remember records whether a host advertised HTTP/3
+func (t *http3Transport) remember(host string, advertised bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if advertised {
+		t.hosts[host] = true
+	} else {
+		delete(t.hosts, host)
+	}
+}
+
+// advertisesHTTP3 returns whether an Alt-Svc header offers HTTP/3 on the same host and port as a url
+func advertisesHTTP3(header http.Header, u *url.URL) bool {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	for _, value := range header.Values("Alt-Svc") {
+		for _, service := range strings.Split(value, ",") {
+			protocol, authority, ok := strings.Cut(strings.TrimSpace(service), "=")
+			if !ok || protocol != "h3" {
+				continue
+			}
+
+			authority, _, _ = strings.Cut(authority, ";")
+			altHost, altPort, err := net.SplitHostPort(strings.Trim(authority, `"`))
+			if err == nil && (altHost == "" || altHost == u.Hostname()) && altPort == port {
+				return true
+			}
+		}
+	}
+
+	return false
+}
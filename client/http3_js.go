@@ -0,0 +1,10 @@
+//go:build js
+
+package client
+
+import "net/http"
+
+// preferHTTP3 returns a transport unchanged, since browsers negotiate HTTP/3 themselves
+func preferHTTP3(transport http.RoundTripper) http.RoundTripper {
+	return transport
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// AuthorizeOIDC authorizes an app for a Session's user with the query of the OpenID Connect authorization request the service's login page was opened with,
+// returning the app's redirect URI, carrying an authorization code or an error, to navigate the user to
+// Requests naming an unknown app or redirect URI return a StatusError that unwraps to protocol.ErrBadRequest
+func (s *Session) AuthorizeOIDC(ctx context.Context, query string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.client.baseURL()+protocol.OIDCAuthorizePath, strings.NewReader(strings.TrimPrefix(query, "?")))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", readError(resp)
+	}
+
+	var authorizeResponse protocol.OIDCAuthorizeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authorizeResponse); err != nil {
+		return "", err
+	}
+
+	return authorizeResponse.RedirectURI, nil
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/crypto/opaque"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errOPAQUERecovery = errors.New("users who sign up with OPAQUE can't enroll a recovery phrase")
+
+// enrollOPAQUE returns the OPAQUE record of a password, registered with the service's OPAQUE keys
+func (c *Client) enrollOPAQUE(ctx context.Context, password string) (*protocol.OPAQUEEnrollment, error) {
+	registration, request, err := opaque.NewClientRegistration(crypto.DefaultEntropySource, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var registerResponse protocol.OPAQUERegisterResponse
+	if err := c.postJSON(ctx, protocol.OPAQUERegisterPath, &protocol.OPAQUERegisterRequest{Request: request}, &registerResponse); err != nil {
+		return nil, err
+	}
+
+	record, salt, _, err := registration.Finalize(crypto.DefaultEntropySource, registerResponse.Response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.OPAQUEEnrollment{Nonce: registerResponse.Nonce, Record: record, Salt: salt}, nil
+}
+
+// LogInOPAQUECtx logs a user who signed up with OPAQUE into the service with a username and password, unless the context is done first
+// The service is authenticated by the key exchange before the Session is returned, and a wrong password returns a StatusError that unwraps to protocol.ErrInvalidCredentials
+func (c *Client) LogInOPAQUECtx(ctx context.Context, username, password string) (*Session, error) {
+	return c.remembered(ctx, username, func() (*Session, error) {
+		return c.logInOPAQUE(ctx, username, password)
+	})
+}
+
+// logInOPAQUE logs a user who signed up with OPAQUE into the service with a username and password
+func (c *Client) logInOPAQUE(ctx context.Context, username, password string) (*Session, error) {
+	beginReq := &protocol.OPAQUEBeginRequest{Username: username}
+
+	return c.screened(ctx, username, &beginReq.StepUpToken, &beginReq.CaptchaToken, func() (*Session, error) {
+		return c.logInOPAQUEOnce(ctx, beginReq, password)
+	})
+}
+
+// logInOPAQUEOnce runs both steps of an OPAQUE login, starting with a begin request, with the user's password
+// A password the service's response shows is wrong still finishes the login, with an empty message, so the service counts the failure
+func (c *Client) logInOPAQUEOnce(ctx context.Context, beginReq *protocol.OPAQUEBeginRequest, password string) (*Session, error) {
+	opaqueClient, ke1, err := opaque.NewClientLogin(crypto.DefaultEntropySource, password)
+	if err != nil {
+		return nil, err
+	}
+	beginReq.KE1 = ke1
+
+	var beginResponse protocol.OPAQUEBeginResponse
+	if err := c.postJSON(ctx, protocol.OPAQUELogInBeginPath, beginReq, &beginResponse); err != nil {
+		return nil, err
+	}
+
+	ke3, _, _, err := opaqueClient.Finish(beginResponse.KE2, beginResponse.Salt)
+	if err != nil && !errors.Is(err, opaque.ErrInvalidCredentials) {
+		return nil, err
+	}
+
+	var logInResponse protocol.LogInResponse
+	if err := c.postJSON(ctx, protocol.OPAQUELogInFinishPath, &protocol.OPAQUEFinishRequest{
+		Username:   beginReq.Username,
+		CeremonyID: beginResponse.CeremonyID,
+		KE3:        ke3,
+	}, &logInResponse); err != nil {
+		return nil, err
+	}
+
+	return c.logInSession(beginReq.Username, &logInResponse)
+}
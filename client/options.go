@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+type (
+	// Option configures a Client
+	Option func(*Client)
+
+	// StepUpFunc returns a step-up token for a user, such as one from a verification the service's operator asks for, unless the context is done first
+	StepUpFunc func(ctx context.Context, username string) (string, error)
+
+	// CaptchaFunc returns the token of a CAPTCHA solved by the user, such as an hCaptcha or reCAPTCHA widget's, unless the context is done first
+	CaptchaFunc func(ctx context.Context) (string, error)
+)
+
+// WithBaseURL sets the service's full base url, such as https://auth.example.com/v1, instead of localhost at the client's port
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.url = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sets the http.Client used for calls to the service
+// The http.Client is copied, so later options don't modify it
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		copied := *httpClient
+		c.httpClient = &copied
+	}
+}
+
+// WithTransport sets the http.RoundTripper used for calls to the service
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithTimeout sets the time limit for each call to the service, including reading its response
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithBackend sets the Backend that derives keys from passwords, which tests may replace with crypto.MakePlaintextBackend to skip TFHE
+// The service must use the same Backend
+func WithBackend(backend crypto.Backend) Option {
+	return func(c *Client) {
+		c.backend = backend
+	}
+}
+
+// WithAsyncChallenges makes logins ask the service to compute their challenge in the background and poll for it,
+// rather than holding a request open while it is computed, which suits slow parameter sets and mobile connections
+func WithAsyncChallenges() Option {
+	return func(c *Client) {
+		c.asyncChallenges = true
+	}
+}
+
+// WithWebSocketLogIn makes logins run both steps over a single WebSocket, receiving the challenge as the service computes it
+// WebSockets need a real connection, so this can't be combined with WithHandler
+func WithWebSocketLogIn() Option {
+	return func(c *Client) {
+		c.webSocketLogIn = true
+	}
+}
+
+// WithHTTP3 makes calls prefer HTTP/3 over QUIC once the service advertises it, falling back to TCP if it fails,
+// since QUIC's loss recovery speeds up key uploads on lossy mobile networks
+// The TCP transport's TLS configuration also applies to HTTP/3, and browsers negotiate HTTP/3 themselves under js/wasm
+func WithHTTP3() Option {
+	return func(c *Client) {
+		c.http3 = true
+	}
+}
+
+// WithDebugWriter writes the secret and decrypted secret of each signup and login to a writer, for demonstrations only
+func WithDebugWriter(w io.Writer) Option {
+	return func(c *Client) {
+		c.debug = w
+	}
+}
+
+// WithHeader adds a header to every call to the service, such as an API key expected by a load balancer
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.headers.Add(key, value)
+	}
+}
+
+// WithStepUp retries logins that the service refuses with protocol.ErrStepUpRequired once, with a token from a StepUpFunc
+func WithStepUp(stepUp StepUpFunc) Option {
+	return func(c *Client) {
+		c.stepUp = stepUp
+	}
+}
+
+// WithCaptcha retries signups and logins that the service refuses with protocol.ErrCaptchaRequired once, with a token from a CaptchaFunc
+func WithCaptcha(captcha CaptchaFunc) Option {
+	return func(c *Client) {
+		c.captcha = captcha
+	}
+}
+
+// WithPasswordPolicy checks each password signed up with against a PasswordPolicy, before its keys are generated
+func WithPasswordPolicy(policy *PasswordPolicy) Option {
+	return func(c *Client) {
+		c.passwordPolicy = policy
+	}
+}
+
+// WithSRP signs users up, and resets their passwords, with an SRP-6a verifier in place of an encrypted secret, and logs them in with SRP,
+// for devices that can't afford FHE key generation
+// Clients without it still log in users who signed up with SRP, once the service says they did
+func WithSRP() Option {
+	return func(c *Client) {
+		c.srp = true
+	}
+}
+
+// WithOPAQUE signs users up, and resets their passwords, with an OPAQUE record in place of an encrypted secret, and logs them in with OPAQUE,
+// so a deployment can compare the standardized aPAKE with FHE logins through the same calls, on services with OPAQUE keys
+// Clients without it still log in users who signed up with OPAQUE, once the service says they did
+func WithOPAQUE() Option {
+	return func(c *Client) {
+		c.opaque = true
+	}
+}
+
+// WithRememberDevice remembers the device users log in on under a name, bound to a fingerprint of the device if one is given,
+// keeping their device tokens in a DeviceTokenStore, and logs them in with their token while the service accepts it,
+// skipping key generation and the homomorphic login
+// Services that don't remember devices still log users in with their password
+func WithRememberDevice(store DeviceTokenStore, name, fingerprint string) Option {
+	return func(c *Client) {
+		c.devices, c.deviceName, c.fingerprint = store, name, fingerprint
+	}
+}
+
+// WithPinStore keeps the terms pinned for each service in a PinStore, so a service that offers weaker terms than it did in an earlier run is refused too,
+// and logins fail rather than proceed unpinned if it can't load or save them
+func WithPinStore(store PinStore) Option {
+	return func(c *Client) {
+		c.pins.persisted = store
+	}
+}
+
+// WithServerKey pins the Ed25519 public key the service signs its login challenges with, served at protocol.ServerKeyPath,
+// so logins whose challenge it didn't sign fail with ErrInvalidSignature before their secret is sent, even over plaintext or misconfigured TLS
+func WithServerKey(key ed25519.PublicKey) Option {
+	return func(c *Client) {
+		c.serverKey = key
+	}
+}
+
+// WithDialer makes logins run both steps over connections a Dialer opens, such as DialStream's raw TCP, DialQUIC's QUIC, or DialGRPC's gRPC streams,
+// for devices whose link doesn't carry HTTP
+// Only logins use the Dialer, so clients with no HTTP route to the service log in with LogInWithPacketCtx, which needs no KDF parameters
+func WithDialer(dialer Dialer) Option {
+	return func(c *Client) {
+		c.dialer = dialer
+	}
+}
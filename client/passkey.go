@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// PasskeyRequiredError is returned by logins whose password was accepted, but whose user must also assert a passkey
+// The Ceremony's Options are passed to the user's authenticator, and its response to FinishPasskeyLogIn
+type PasskeyRequiredError struct {
+	Username string
+	Ceremony protocol.PasskeyCeremony
+}
+
+// Error returns a PasskeyRequiredError's message
+func (e *PasskeyRequiredError) Error() string {
+	return "passkey required to finish logging in as " + e.Username
+}
+
+// logInSession returns a Session for a user from a successful login response, or a PasskeyRequiredError if it holds a passkey ceremony
+func (c *Client) logInSession(username string, resp *protocol.LogInResponse) (*Session, error) {
+	if resp.Passkey != nil {
+		return nil, &PasskeyRequiredError{Username: username, Ceremony: *resp.Passkey}
+	}
+
+	return makeSession(c, username, resp), nil
+}
+
+// readCeremony returns the ceremony in a response to a request that begins one
+func readCeremony(resp *http.Response) (*protocol.PasskeyCeremony, error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var ceremony protocol.PasskeyCeremony
+	if err := json.NewDecoder(resp.Body).Decode(&ceremony); err != nil {
+		return nil, err
+	}
+
+	return &ceremony, nil
+}
+
+// BeginPasskeySignUp begins registering a new passwordless user, whose only credential is the passkey the ceremony creates
+// The email address may be empty unless the service verifies addresses, as it does for SignUpWithEmailCtx
+// Taken usernames return a StatusError that unwraps to protocol.ErrUserExists
+func (c *Client) BeginPasskeySignUp(ctx context.Context, username, email string) (*protocol.PasskeyCeremony, error) {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+protocol.PasskeyRegisterBeginPath, &protocol.PasskeyBeginRequest{
+		Username: username,
+		Email:    email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return readCeremony(resp)
+}
+
+// BeginPasskeyRegistration begins registering a passkey for a Session's user, which must then assert it after each password login
+func (s *Session) BeginPasskeyRegistration(ctx context.Context) (*protocol.PasskeyCeremony, error) {
+	body, err := json.Marshal(&protocol.PasskeyBeginRequest{Username: s.username, Versioned: protocol.Versioned{Version: protocol.Version}})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.client.baseURL()+protocol.PasskeyRegisterBeginPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return readCeremony(resp)
+}
+
+// FinishPasskeyRegistration finishes a registration ceremony with the JSON of the PublicKeyCredential the user's authenticator created
+// Rejected attestations return a StatusError that unwraps to protocol.ErrInvalidCredentials,
+// and expired ceremonies one that unwraps to protocol.ErrUnknownChallenge
+func (c *Client) FinishPasskeyRegistration(ctx context.Context, username, ceremonyID string, credential json.RawMessage) error {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+protocol.PasskeyRegisterFinishPath, &protocol.PasskeyFinishRequest{
+		Username:   username,
+		CeremonyID: ceremonyID,
+		Credential: credential,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	return nil
+}
+
+// BeginPasskeyLogIn begins logging a passwordless user in with a passkey
+// Users with a password begin their ceremony by logging in, which returns a PasskeyRequiredError holding it
+func (c *Client) BeginPasskeyLogIn(ctx context.Context, username string) (*protocol.PasskeyCeremony, error) {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+protocol.PasskeyLogInBeginPath, &protocol.PasskeyBeginRequest{Username: username})
+	if err != nil {
+		return nil, err
+	}
+
+	return readCeremony(resp)
+}
+
+// FinishPasskeyLogIn finishes a login ceremony with the JSON of the PublicKeyCredential the user's authenticator asserted
+// Rejected assertions return a StatusError that unwraps to protocol.ErrInvalidCredentials,
+// and expired ceremonies one that unwraps to protocol.ErrUnknownChallenge
+func (c *Client) FinishPasskeyLogIn(ctx context.Context, username, ceremonyID string, assertion json.RawMessage) (*Session, error) {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+protocol.PasskeyLogInFinishPath, &protocol.PasskeyFinishRequest{
+		Username:   username,
+		CeremonyID: ceremonyID,
+		Credential: assertion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var logInResponse protocol.LogInResponse
+	if err := json.NewDecoder(resp.Body).Decode(&logInResponse); err != nil {
+		return nil, err
+	}
+
+	return makeSession(c, username, &logInResponse), nil
+}
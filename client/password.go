@@ -0,0 +1,332 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// EnforceReject refuses to sign up with a password that breaks the PasswordPolicy
+	EnforceReject PasswordEnforcement = iota
+	// EnforceWarn signs up with a password that breaks the PasswordPolicy, after passing its violations to the policy's OnViolation
+	EnforceWarn
+)
+
+const (
+	// RuleMinLength is broken by passwords with fewer characters than a PasswordPolicy's MinLength
+	RuleMinLength = "min_length"
+	// RuleCharacterClasses is broken by passwords with fewer of lowercase letters, uppercase letters, digits, and symbols than a PasswordPolicy's MinClasses
+	RuleCharacterClasses = "character_classes"
+	// RuleStrength is broken by passwords whose estimated strength scores below a PasswordPolicy's MinScore
+	RuleStrength = "strength"
+)
+
+// ErrWeakPassword is unwrapped from a PasswordPolicyError
+var ErrWeakPassword = errors.New("password breaks the password policy")
+
+// strengthScoreGuesses are the log10 guesses a password must take to reach each score from 1 to 4, as zxcvbn scores them
+var strengthScoreGuesses = [...]float64{3, 6, 8, 10}
+
+// commonPasswords are frequently chosen passwords and words, ranked from most common, that strength estimates guess first
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "letmein", "dragon", "monkey", "football", "iloveyou", "admin", "welcome",
+	"login", "master", "sunshine", "princess", "shadow", "baseball", "superman", "trustno1", "michael", "jennifer",
+	"hello", "freedom", "whatever", "starwars", "batman", "soccer", "hunter", "charlie", "summer", "winter",
+	"secret", "computer", "internet", "cookie", "pepper", "ginger", "flower", "orange", "banana", "chocolate",
+	"love", "angel", "tiger", "lovely", "jordan", "thomas", "andrew", "daniel", "jessica", "ashley",
+	"passw0rd", "changeme", "default", "access", "mustang", "killer", "purple", "silver", "golden", "matrix",
+}
+
+// keyboardRows are runs of adjacent keys that strength estimates guess as patterns
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "1qaz2wsx3edc", "qazwsxedc"}
+
+// l33tSubstitutions are the letters that common digit and symbol substitutions stand for
+var l33tSubstitutions = map[rune]rune{'4': 'a', '@': 'a', '8': 'b', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '0': 'o', '5': 's', '$': 's', '7': 't', '2': 'z'}
+
+type (
+	// PasswordEnforcement is what a client does with a password that breaks its PasswordPolicy at signup
+	PasswordEnforcement int
+
+	// PasswordPolicy is checked against each password a client signs up with, before its keys are generated
+	// MinLength counts characters, MinClasses counts the classes of lowercase letters, uppercase letters, digits, and symbols used,
+	// and MinScore is the lowest strength, from 0 to 4, that EstimatePasswordStrength may score the password, where 0 checks nothing
+	// OnViolation, if set, is passed the violations of passwords that are signed up with anyway under EnforceWarn
+	PasswordPolicy struct {
+		MinLength   int
+		MinClasses  int
+		MinScore    int
+		Enforcement PasswordEnforcement
+		OnViolation func(*PasswordPolicyError)
+	}
+
+	// PasswordViolation is a rule of a PasswordPolicy that a password breaks, and a message explaining it to the user
+	PasswordViolation struct {
+		Rule    string
+		Message string
+	}
+
+	// PasswordPolicyError is the error of a password that breaks a PasswordPolicy, with each violation and the password's estimated strength
+	PasswordPolicyError struct {
+		Violations []PasswordViolation
+		Strength   PasswordStrength
+	}
+
+	// PasswordStrength is the estimated number of guesses, as a power of 10, an attacker needs to find a password,
+	// and its score from 0, guessed almost at once, to 4, very unlikely to be guessed
+	PasswordStrength struct {
+		GuessesLog10 float64
+		Score        int
+	}
+
+	// passwordMatch is a guessable pattern spanning the runes of a password from start to end, and the log10 guesses needed to find it
+	passwordMatch struct {
+		start, end   int
+		guessesLog10 float64
+	}
+)
+
+// Error returns the messages of a PasswordPolicyError's violations
+func (ppe *PasswordPolicyError) Error() string {
+	messages := make([]string, len(ppe.Violations))
+	for i, violation := range ppe.Violations {
+		messages[i] = violation.Message
+	}
+
+	return fmt.Sprintf("%v: %s", ErrWeakPassword, strings.Join(messages, ", "))
+}
+
+// Unwrap returns ErrWeakPassword
+func (ppe *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Check returns a PasswordPolicyError if a user's password breaks a PasswordPolicy, where the username and any other inputs, such as an email address,
+// are guessed first by the strength estimate
+func (pp *PasswordPolicy) Check(password string, userInputs ...string) error {
+	policyErr := &PasswordPolicyError{Strength: EstimatePasswordStrength(password, userInputs...)}
+
+	if length := utf8.RuneCountInString(password); length < pp.MinLength {
+		policyErr.Violations = append(policyErr.Violations, PasswordViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("passwords need at least %d characters, not %d", pp.MinLength, length),
+		})
+	}
+	if classes := characterClasses(password); classes < pp.MinClasses {
+		policyErr.Violations = append(policyErr.Violations, PasswordViolation{
+			Rule:    RuleCharacterClasses,
+			Message: fmt.Sprintf("passwords need at least %d of lowercase letters, uppercase letters, digits, and symbols, not %d", pp.MinClasses, classes),
+		})
+	}
+	if policyErr.Strength.Score < pp.MinScore {
+		policyErr.Violations = append(policyErr.Violations, PasswordViolation{
+			Rule:    RuleStrength,
+			Message: fmt.Sprintf("passwords need a strength of at least %d out of 4, not %d", pp.MinScore, policyErr.Strength.Score),
+		})
+	}
+
+	if len(policyErr.Violations) == 0 {
+		return nil
+	}
+
+	return policyErr
+}
+
+// enforce checks a password against a PasswordPolicy, returning its error under EnforceReject,
+// or passing it to OnViolation and returning nil under EnforceWarn
+func (pp *PasswordPolicy) enforce(password string, userInputs ...string) error {
+	err := pp.Check(password, userInputs...)
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || pp.Enforcement != EnforceWarn {
+		return err
+	}
+
+	if pp.OnViolation != nil {
+		pp.OnViolation(policyErr)
+	}
+
+	return nil
+}
+
+// characterClasses returns how many of lowercase letters, uppercase letters, digits, and symbols a password uses
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+// EstimatePasswordStrength estimates how many guesses an attacker needs to find a password, in the manner of zxcvbn,
+// by splitting it into the cheapest sequence of common words, l33t spellings, repeats, sequences, keyboard runs, years, and brute forced characters,
+// where the user's own inputs, such as their username, are guessed first
+func EstimatePasswordStrength(password string, userInputs ...string) PasswordStrength {
+	runes := []rune(password)
+	matches := passwordMatches(runes, userInputs)
+
+	// cheapest[i] is the fewest log10 guesses to find the first i runes
+	cheapest := make([]float64, len(runes)+1)
+	for end := 1; end <= len(runes); end++ {
+		cheapest[end] = cheapest[end-1] + math.Log10(bruteForceCardinality(runes[end-1]))
+		for _, match := range matches {
+			if match.end == end {
+				cheapest[end] = min(cheapest[end], cheapest[match.start]+match.guessesLog10)
+			}
+		}
+	}
+
+	strength := PasswordStrength{GuessesLog10: cheapest[len(runes)]}
+	for _, guesses := range strengthScoreGuesses {
+		if strength.GuessesLog10 >= guesses {
+			strength.Score++
+		}
+	}
+
+	return strength
+}
+
+// passwordMatches returns every guessable pattern in a password's runes
+func passwordMatches(runes []rune, userInputs []string) []passwordMatch {
+	lowered := []rune(strings.ToLower(string(runes)))
+	unleeted := make([]rune, len(lowered))
+	for i, r := range lowered {
+		if letter, ok := l33tSubstitutions[r]; ok {
+			unleeted[i] = letter
+		} else {
+			unleeted[i] = r
+		}
+	}
+
+	dictionary := make([]string, 0, len(userInputs)+len(commonPasswords))
+	for _, input := range userInputs {
+		if input != "" {
+			dictionary = append(dictionary, strings.ToLower(input))
+		}
+	}
+	dictionary = append(dictionary, commonPasswords...)
+
+	var matches []passwordMatch
+	for start := range runes {
+		for end := start + 1; end <= len(runes); end++ {
+			if guesses, ok := dictionaryGuesses(dictionary, runes[start:end], lowered[start:end], unleeted[start:end]); ok {
+				matches = append(matches, passwordMatch{start: start, end: end, guessesLog10: math.Log10(guesses)})
+			}
+			if end-start < 3 {
+				continue
+			}
+			if guesses, ok := patternGuesses(lowered[start:end]); ok {
+				matches = append(matches, passwordMatch{start: start, end: end, guessesLog10: math.Log10(guesses)})
+			}
+		}
+	}
+
+	return matches
+}
+
+// dictionaryGuesses returns the guesses needed to find a token as a dictionary word, doubled if it is capitalized or spelled in l33t,
+// and false if it isn't one
+func dictionaryGuesses(dictionary []string, token, lowered, unleeted []rune) (float64, bool) {
+	for rank, word := range dictionary {
+		guesses := float64(rank + 1)
+		switch word {
+		case string(lowered):
+		case string(unleeted):
+			guesses *= 2
+		default:
+			continue
+		}
+		if string(token) != string(lowered) {
+			guesses *= 2
+		}
+
+		return guesses, true
+	}
+
+	return 0, false
+}
+
+// patternGuesses returns the guesses needed to find a lowercased token of at least three runes as a repeat, sequence, keyboard run, or year,
+// and false if it is none of them
+func patternGuesses(token []rune) (float64, bool) {
+	length := float64(len(token))
+	if year, err := strconv.Atoi(string(token)); err == nil && len(token) == 4 && year >= 1900 && year <= 2099 {
+		return 200, true
+	}
+	if repeated(token) {
+		return bruteForceCardinality(token[0]) * length, true
+	}
+	if sequential(token) {
+		return 10 * length, true
+	}
+	for _, row := range keyboardRows {
+		if strings.Contains(row, string(token)) || strings.Contains(row, reversed(token)) {
+			return 20 * length, true
+		}
+	}
+
+	return 0, false
+}
+
+// repeated returns whether every rune of a token is the same
+func repeated(token []rune) bool {
+	for _, r := range token[1:] {
+		if r != token[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sequential returns whether a token's runes step up or down by one, such as abc or 987
+func sequential(token []rune) bool {
+	step := token[1] - token[0]
+	if step != 1 && step != -1 {
+		return false
+	}
+	for i := 2; i < len(token); i++ {
+		if token[i]-token[i-1] != step {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reversed returns a token's runes in reverse order
+func reversed(token []rune) string {
+	reversed := make([]rune, len(token))
+	for i, r := range token {
+		reversed[len(token)-1-i] = r
+	}
+
+	return string(reversed)
+}
+
+// bruteForceCardinality returns the number of characters in a rune's class that brute force guesses try for it
+func bruteForceCardinality(r rune) float64 {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	case r < utf8.RuneSelf:
+		return 33
+	default:
+		return 100
+	}
+}
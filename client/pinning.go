@@ -0,0 +1,105 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errPinStore = errors.New("pinned terms can't be read or saved")
+
+type (
+	// DowngradeError is returned when a server negotiates weaker terms than it has previously negotiated with a client
+	DowngradeError struct {
+		Server  string
+		Pinned  protocol.Negotiation
+		Offered protocol.Negotiation
+	}
+
+	// PinStore keeps the strongest Negotiation each service has offered, such as in a file, so pins outlive the Client
+	PinStore interface {
+		// LoadPin returns the pinned Negotiation of the service at a base URL, or nil if there is none
+		LoadPin(baseURL string) (*protocol.Negotiation, error)
+		// SavePin replaces the pinned Negotiation of the service at a base URL
+		SavePin(baseURL string, pin protocol.Negotiation) error
+	}
+
+	// pinStore remembers the strongest Negotiation seen from each server, loading and saving them through a PinStore if it has one
+	pinStore struct {
+		pins      map[string]protocol.Negotiation
+		persisted PinStore
+		mu        sync.Mutex
+	}
+)
+
+// Error returns a description of the weakened terms
+func (e *DowngradeError) Error() string {
+	return fmt.Sprintf("protocol downgrade from %s: pinned %+v, offered %+v", e.Server, e.Pinned, e.Offered)
+}
+
+// makePinStore returns an empty pinStore
+func makePinStore() *pinStore {
+	return &pinStore{pins: map[string]protocol.Negotiation{}}
+}
+
+// check records a server's offered Negotiation, returning a DowngradeError if it is weaker than the pinned one
+// Allowed downgrades never weaken the pin, so disallowing them later still detects them
+// Pins that can't be loaded or saved fail the check, so a lost pin never lets a downgrade through
+func (ps *pinStore) check(server string, offered protocol.Negotiation, allowDowngrade bool) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	pinned, ok, err := ps.load(server)
+	if err != nil {
+		return err
+	}
+
+	if ok && offered.WeakerThan(pinned) && !allowDowngrade {
+		return &DowngradeError{
+			Server:  server,
+			Pinned:  pinned,
+			Offered: offered,
+		}
+	}
+
+	pin := offered
+	if ok {
+		pin = pinned.Strongest(offered)
+	}
+	if ps.persisted != nil && (!ok || pin != pinned) {
+		if err := ps.persisted.SavePin(server, pin); err != nil {
+			return fmt.Errorf("%w: %w", errPinStore, err)
+		}
+	}
+
+	ps.pins[server] = pin
+	return nil
+}
+
+// load returns the Negotiation pinned for a server, from the PinStore if it isn't already remembered
+func (ps *pinStore) load(server string) (protocol.Negotiation, bool, error) {
+	if pinned, ok := ps.pins[server]; ok || ps.persisted == nil {
+		return pinned, ok, nil
+	}
+
+	pinned, err := ps.persisted.LoadPin(server)
+	if err != nil {
+		return protocol.Negotiation{}, false, fmt.Errorf("%w: %w", errPinStore, err)
+	} else if pinned == nil {
+		return protocol.Negotiation{}, false, nil
+	}
+
+	ps.pins[server] = *pinned
+	return *pinned, true, nil
+}
+
+// pinned returns the strongest Negotiation seen from a server, which is unknown if its pin can't be loaded
+func (ps *pinStore) pinned(server string) (protocol.Negotiation, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	n, ok, err := ps.load(server)
+	return n, ok && err == nil
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// pregeneration is a login whose Packet a pregenerator derives ahead of it
+	pregeneration struct {
+		username string
+		password string
+	}
+
+	// pregenerator derives the Packet of the latest login it is given in the background, once its password stays unchanged for a delay,
+	// so logins find it in the client's cache, while passwords replaced as they are typed are never derived
+	// At most one Packet is derived at a time, by a worker that exits once no login is pending
+	pregenerator struct {
+		delay   time.Duration
+		derive  func(ctx context.Context, username, password string) error
+		next    *pregeneration
+		changed time.Time
+		running bool
+		mu      sync.Mutex
+		debugf  func(format string, args ...any)
+	}
+)
+
+// prepare replaces the pending login with another, starting the worker if it isn't running
+func (pg *pregenerator) prepare(username, password string) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	pg.next, pg.changed = &pregeneration{username: username, password: password}, time.Now()
+	if !pg.running {
+		pg.running = true
+		go pg.run()
+	}
+}
+
+// forget drops the pending login, if it is a user's, or any pending login when the username is empty
+func (pg *pregenerator) forget(username string) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	if pg.next != nil && (username == "" || pg.next.username == username) {
+		pg.next = nil
+	}
+}
+
+// run derives pending logins' Packets once their delay passes, until none is pending
+func (pg *pregenerator) run() {
+	for {
+		pg.mu.Lock()
+		next, wait := pg.next, pg.delay-time.Since(pg.changed)
+		switch {
+		case next == nil:
+			pg.running = false
+			pg.mu.Unlock()
+			return
+		case wait > 0:
+			pg.mu.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		pg.next = nil
+		pg.mu.Unlock()
+
+		if err := pg.derive(context.Background(), next.username, next.password); err != nil {
+			pg.debugf("packet not pregenerated: %v\n", err)
+		}
+	}
+}
+
+// WithPregeneration derives the Packets of logins that PrepareLogIn is told of in the background, once their password stays unchanged for a delay,
+// so the multi-second key generation is done, or underway, by the time the user submits the password
+func WithPregeneration(delay time.Duration) Option {
+	return func(c *Client) {
+		c.pregenerator = &pregenerator{delay: delay}
+	}
+}
+
+// PrepareLogIn starts deriving the Packet of a user's password in the background, such as each time a login form's password changes,
+// so LogInCtx with the same password finds it in the client's cache without waiting for key generation, or waits less
+// Only the latest password is derived, once it stays unchanged for the delay of WithPregeneration, and PrepareLogIn never blocks
+// Clients built without WithPregeneration, and clients logging in with SRP or OPAQUE, which derive no Packet, ignore it
+func (c *Client) PrepareLogIn(username, password string) {
+	if c.pregenerator == nil || c.srp || c.opaque || username == "" || password == "" {
+		return
+	}
+
+	c.pregenerator.prepare(username, password)
+}
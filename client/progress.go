@@ -0,0 +1,37 @@
+package client
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+type (
+	// ProgressFunc reports how many bytes of a request body to an endpoint have been sent out of its total
+	ProgressFunc func(endpoint string, sent, total int64)
+
+	// progressReader is a request body that reports its progress as it is read
+	progressReader struct {
+		reader   io.Reader
+		endpoint string
+		sent     atomic.Int64
+		total    int64
+		progress ProgressFunc
+	}
+)
+
+// Read reads from a progressReader's body and reports the bytes sent so far
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.reader.Read(b)
+	if n > 0 {
+		pr.progress(pr.endpoint, pr.sent.Add(int64(n)), pr.total)
+	}
+
+	return n, err
+}
+
+// WithProgress reports the progress of request bodies, such as the public key sent to log in and the encrypted secret sent to sign up
+func WithProgress(progress ProgressFunc) Option {
+	return func(c *Client) {
+		c.progress = progress
+	}
+}
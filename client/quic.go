@@ -0,0 +1,48 @@
+//go:build !js
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/quic-go/quic-go"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// quicConn is a protocol.MessageConn over a QUIC stream, which closes the stream's connection with it
+type quicConn struct {
+	protocol.MessageConn
+	conn quic.Connection
+}
+
+// Close closes a QUIC stream and its connection
+func (qc quicConn) Close() error {
+	qc.MessageConn.Close()
+	return qc.conn.CloseWithError(0, "")
+}
+
+// DialQUIC returns a Dialer that logs in over a stream of a new QUIC connection to an address, served by server.ServeQUIC,
+// negotiating protocol.QUICNextProto under a TLS configuration
+func DialQUIC(address string, tlsConfig *tls.Config) Dialer {
+	return func(ctx context.Context) (protocol.MessageConn, error) {
+		tlsConfig := tlsConfig.Clone()
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.NextProtos = []string{protocol.QUICNextProto}
+
+		conn, err := quic.DialAddr(ctx, address, tlsConfig, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		stream, err := conn.OpenStreamSync(ctx)
+		if err != nil {
+			conn.CloseWithError(0, "")
+			return nil, err
+		}
+
+		return quicConn{MessageConn: protocol.NewStreamConn(stream), conn: conn}, nil
+	}
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+)
+
+const (
+	// recoveryPhraseByteLen is the entropy of a generated recovery phrase before encoding
+	recoveryPhraseByteLen = 20
+	// recoveryPhraseGroupLen is the number of characters between each dash of a generated recovery phrase
+	recoveryPhraseGroupLen = 4
+)
+
+// GenerateRecoveryPhrase returns a random recovery phrase, as dash separated groups of base32, for SignUpWithRecoveryCtx
+func GenerateRecoveryPhrase() (string, error) {
+	entropy := make([]byte, recoveryPhraseByteLen)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(entropy)
+	groups := make([]string, 0, len(encoded)/recoveryPhraseGroupLen)
+	for i := 0; i < len(encoded); i += recoveryPhraseGroupLen {
+		groups = append(groups, encoded[i:min(i+recoveryPhraseGroupLen, len(encoded))])
+	}
+
+	return strings.Join(groups, "-"), nil
+}
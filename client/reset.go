@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// RequestPasswordReset asks the service to mail a token that resets a user's password to their verified email address
+// Users without one return a StatusError that unwraps to protocol.ErrBadRequest, or protocol.ErrUnverified if it isn't verified
+func (c *Client) RequestPasswordReset(ctx context.Context, username string) error {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+protocol.ResetPasswordBeginPath, &protocol.ResetPasswordBeginRequest{Username: username})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return readError(resp)
+	}
+
+	return nil
+}
+
+// ResetPassword enrolls a new password for a user with a mailed reset token, as if they signed up again
+// The service revokes every session of the user, and their passkeys, if any, are still required after the new password
+// Wrong tokens return a StatusError that unwraps to protocol.ErrInvalidCredentials, and expired ones one that unwraps to protocol.ErrUnknownChallenge
+func (c *Client) ResetPassword(ctx context.Context, username, token, newPassword string) error {
+	return c.resetPassword(ctx, username, token, newPassword, c.do)
+}
+
+// ResetPassword enrolls a new password for a Session's user, which must have logged in with LogInWithRecoveryCtx
+// The service revokes every session of the user, including this one
+// Sessions that logged in with a password return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) ResetPassword(ctx context.Context, newPassword string) error {
+	return s.client.resetPassword(ctx, s.username, "", newPassword, s.Do)
+}
+
+// resetPassword enrolls a new password for a user, authorized by a mailed reset token or, without one, the recovery session do authenticates with
+// Clients built WithOPAQUE or WithSRP enroll an OPAQUE record or SRP verifier in place of an encrypted secret
+func (c *Client) resetPassword(ctx context.Context, username, token, newPassword string, do func(*http.Request) (*http.Response, error)) error {
+	resetRequest := &protocol.ResetPasswordRequest{Username: username, Token: token}
+	if c.opaque {
+		enrollment, err := c.enrollOPAQUE(ctx, newPassword)
+		if err != nil {
+			return err
+		}
+		resetRequest.OPAQUE = enrollment
+	} else if c.srp {
+		enrollment, err := enrollSRP(newPassword)
+		if err != nil {
+			return err
+		}
+		resetRequest.SRP = enrollment
+	} else {
+		params, encryptedSecret, secret, err := c.enroll(ctx, username, newPassword, false)
+		if err != nil {
+			return err
+		}
+		defer crypto.Release(encryptedSecret)
+
+		resetRequest.KDFParams, resetRequest.EncryptedSecret, resetRequest.Secret = params, encryptedSecret, secret
+	}
+
+	req, err := c.newJSONRequest(ctx, http.MethodPost, c.baseURL()+protocol.ResetPasswordPath, resetRequest)
+	if err != nil {
+		return err
+	}
+
+	resp, err := do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// RotationRequired returns whether the service asked for a Session's user's secret to be rotated when they logged in, until RotateSecret rotates it
+func (s *Session) RotationRequired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rotationRequired
+}
+
+// RotateSecret replaces a Session's user's secret with a new one, enrolled as at sign up under their password stretched with fresh KDF parameters
+// LogInCtx rotates secrets itself when the service requires it, so only Sessions of logins without the password, such as LogInWithPacketCtx, need to
+// Sessions of recovery logins return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) RotateSecret(ctx context.Context, password string) error {
+	params, encryptedSecret, secret, err := s.client.enroll(ctx, s.username, password, false)
+	if err != nil {
+		return err
+	}
+	defer crypto.Release(encryptedSecret)
+
+	rotateRequest := &protocol.RotateSecretRequest{KDFParams: params, EncryptedSecret: encryptedSecret, Secret: secret}
+	if err := s.sendJSON(ctx, http.MethodPost, protocol.RotateSecretPath, rotateRequest, nil); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotationRequired = false
+	return nil
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// sessionRefreshWindow is how long before expiry a Session refreshes its token
+const sessionRefreshWindow = time.Minute
+
+// Session is an authenticated session with a service, which refreshes its token before it expires
+type Session struct {
+	client    *Client
+	username  string
+	token     string
+	expiresAt time.Time
+	// rotationRequired is whether the service asked for the user's secret to be rotated when they logged in
+	rotationRequired bool
+	mu               sync.Mutex
+}
+
+// makeSession returns a Session for a user from a successful login response
+func makeSession(client *Client, username string, resp *protocol.LogInResponse) *Session {
+	return &Session{
+		client:           client,
+		username:         username,
+		token:            resp.Token,
+		expiresAt:        resp.ExpiresAt,
+		rotationRequired: resp.RotationRequired,
+	}
+}
+
+// ResumeSession returns a Session for a user from a token issued earlier, such as one saved to disk
+func (c *Client) ResumeSession(username, token string, expiresAt time.Time) *Session {
+	return makeSession(c, username, &protocol.LogInResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Username returns the user a Session is authenticated as
+func (s *Session) Username() string {
+	return s.username
+}
+
+// Token returns a Session's current token
+func (s *Session) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.token
+}
+
+// ExpiresAt returns when a Session's current token expires
+func (s *Session) ExpiresAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.expiresAt
+}
+
+// Refresh exchanges a Session's token for a new one with a later expiry
+func (s *Session) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refresh(ctx)
+}
+
+// refresh exchanges a Session's token for a new one, and must be called with the Session locked
+func (s *Session) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.client.baseURL()+"/refresh", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	var logInResponse protocol.LogInResponse
+	if err := json.NewDecoder(resp.Body).Decode(&logInResponse); err != nil {
+		return err
+	}
+
+	s.token, s.expiresAt = logInResponse.Token, logInResponse.ExpiresAt
+	return nil
+}
+
+// Do sends an http request with a Session's credentials, first refreshing its token if it is about to expire
+func (s *Session) Do(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	if time.Until(s.expiresAt) < sessionRefreshWindow {
+		if err := s.refresh(req.Context()); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	token := s.token
+	s.mu.Unlock()
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return s.client.do(req)
+}
+
+// WhoAmI returns the user the service recognizes a Session's token as
+// Rejected tokens return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) WhoAmI(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.client.baseURL()+"/whoami", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", readError(resp)
+	}
+
+	var whoAmIResponse protocol.WhoAmIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&whoAmIResponse); err != nil {
+		return "", err
+	}
+
+	return whoAmIResponse.Username, nil
+}
+
+// Profile returns the profile of a Session's user, such as when they signed up and last logged in, and how many logins failed since
+// Rejected tokens return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) Profile(ctx context.Context) (*protocol.ProfileResponse, error) {
+	var profileResponse protocol.ProfileResponse
+	if err := s.sendJSON(ctx, http.MethodGet, protocol.ProfilePath, nil, &profileResponse); err != nil {
+		return nil, err
+	}
+
+	return &profileResponse, nil
+}
+
+// LogInHistory returns the recent login attempts of a Session's user, oldest first, such as to spot logins they didn't make
+// Rejected tokens return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) LogInHistory(ctx context.Context) ([]protocol.LogInAttempt, error) {
+	var logInHistoryResponse protocol.LogInHistoryResponse
+	if err := s.sendJSON(ctx, http.MethodGet, protocol.LogInHistoryPath, nil, &logInHistoryResponse); err != nil {
+		return nil, err
+	}
+
+	return logInHistoryResponse.Attempts, nil
+}
+
+// ExportData returns everything the service holds about a Session's user
+// Rejected tokens return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) ExportData(ctx context.Context) (*protocol.DataExport, error) {
+	var dataExport protocol.DataExport
+	if err := s.sendJSON(ctx, http.MethodGet, protocol.ExportDataPath, nil, &dataExport); err != nil {
+		return nil, err
+	}
+
+	return &dataExport, nil
+}
+
+// EraseAccount deletes a Session's user and everything the service holds about them, after which none of their sessions are valid
+// Sessions whose login isn't recent return a StatusError that unwraps to protocol.ErrLogInRequired, and their user must log in again first
+func (s *Session) EraseAccount(ctx context.Context) error {
+	return s.sendJSON(ctx, http.MethodPost, protocol.EraseAccountPath, &protocol.EraseAccountRequest{Username: s.username}, nil)
+}
+
+// Sessions returns the active sessions of a Session's user, ordered by when they were issued, with this Session's marked Current
+// Rejected tokens return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) Sessions(ctx context.Context) ([]protocol.SessionInfo, error) {
+	var sessionsResponse protocol.SessionsResponse
+	if err := s.sendJSON(ctx, http.MethodGet, protocol.SessionsPath, nil, &sessionsResponse); err != nil {
+		return nil, err
+	}
+
+	return sessionsResponse.Sessions, nil
+}
+
+// RevokeSession revokes one of a Session's user's sessions by the ID Sessions listed it with, such as one left logged in on another device
+// IDs of expired sessions and sessions of other users return a StatusError that unwraps to protocol.ErrInvalidSession
+func (s *Session) RevokeSession(ctx context.Context, id string) error {
+	return s.sendJSON(ctx, http.MethodPost, protocol.RevokeSessionPath, &protocol.RevokeSessionRequest{ID: id}, nil)
+}
+
+// sendJSON sends a request body, if there is one, to a path of the service with a Session's credentials,
+// and decodes its 2XX response into a response body, if there is one
+func (s *Session) sendJSON(ctx context.Context, method, path string, reqBody, respBody any) error {
+	var body []byte
+	if reqBody != nil {
+		protocol.StampVersion(reqBody)
+		var err error
+		if body, err = json.Marshal(reqBody); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.client.baseURL()+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	if respBody == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(respBody)
+}
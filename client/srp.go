@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/crypto/srp"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errSRPRecovery = errors.New("users who sign up with SRP can't enroll a recovery phrase")
+
+// enrollSRP returns the SRP verifier of a password stretched with new KDFParams
+func enrollSRP(password string) (*protocol.SRPEnrollment, error) {
+	params, err := crypto.MakeKDFParams()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := srp.Verifier(password, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.SRPEnrollment{KDFParams: params, Verifier: verifier}, nil
+}
+
+// LogInSRPCtx logs a user who signed up with SRP into the service with a username and password, unless the context is done first
+// The service's proof that it holds the user's verifier is checked before the Session is returned, and a wrong one returns srp.ErrInvalidProof
+func (c *Client) LogInSRPCtx(ctx context.Context, username, password string) (*Session, error) {
+	return c.remembered(ctx, username, func() (*Session, error) {
+		return c.logInSRP(ctx, username, password)
+	})
+}
+
+// logInSRP logs a user who signed up with SRP into the service with a username and password
+func (c *Client) logInSRP(ctx context.Context, username, password string) (*Session, error) {
+	beginReq := &protocol.SRPBeginRequest{Username: username}
+
+	return c.screened(ctx, username, &beginReq.StepUpToken, &beginReq.CaptchaToken, func() (*Session, error) {
+		return c.logInSRPOnce(ctx, beginReq, password)
+	})
+}
+
+// logInSRPOnce runs both steps of an SRP login, starting with a begin request, with the user's password
+func (c *Client) logInSRPOnce(ctx context.Context, beginReq *protocol.SRPBeginRequest, password string) (*Session, error) {
+	srpClient, err := srp.NewClient(crypto.DefaultEntropySource)
+	if err != nil {
+		return nil, err
+	}
+	beginReq.PublicKey = srpClient.PublicKey()
+
+	var beginResponse protocol.SRPBeginResponse
+	if err := c.postJSON(ctx, protocol.SRPLogInBeginPath, beginReq, &beginResponse); err != nil {
+		return nil, err
+	}
+
+	proof, err := srpClient.Proof(beginReq.Username, password, beginResponse.KDFParams, beginResponse.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var finishResponse protocol.SRPFinishResponse
+	if err := c.postJSON(ctx, protocol.SRPLogInFinishPath, &protocol.SRPFinishRequest{
+		Username:   beginReq.Username,
+		CeremonyID: beginResponse.CeremonyID,
+		Proof:      proof,
+	}, &finishResponse); err != nil {
+		return nil, err
+	}
+
+	if err := srpClient.VerifyServer(finishResponse.Proof); err != nil {
+		return nil, err
+	}
+
+	return c.logInSession(beginReq.Username, &finishResponse.LogInResponse)
+}
+
+// postJSON posts a request body to a path of the service and decodes its 2XX response into a response body
+func (c *Client) postJSON(ctx context.Context, path string, reqBody, respBody any) error {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+path, reqBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(respBody)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errUnexpectedMessage = errors.New("unexpected login stream message")
+
+// logInStream logs a user into the service with a first login request and their packet over a MessageConn, whatever transport carries it,
+// unless the context is done first
+func (c *Client) logInStream(ctx context.Context, conn protocol.MessageConn, firstReq *protocol.FirstLogInRequest, packet crypto.Scheme) (*Session, error) {
+	protocol.StampVersion(firstReq)
+	if err := conn.WriteMessage(ctx, firstReq); err != nil {
+		return nil, err
+	}
+
+	header, err := readStreamMessage(ctx, conn)
+	if err != nil {
+		return nil, err
+	} else if header.Negotiation == nil {
+		return nil, errUnexpectedMessage
+	}
+
+	firstLogInResponse := &protocol.FirstLogInResponse{
+		SecretByteLen: header.SecretByteLen,
+		ChallengeID:   header.ChallengeID,
+		Nonce:         header.Nonce,
+		Negotiation:   *header.Negotiation,
+		Versioned:     header.Versioned,
+	}
+	if header.ExpiresAt != nil {
+		firstLogInResponse.ExpiresAt = *header.ExpiresAt
+	}
+	for len(firstLogInResponse.EncryptedMutatedSecret) < header.Bits {
+		chunk, err := readStreamMessage(ctx, conn)
+		if err != nil {
+			return nil, err
+		} else if len(chunk.Samples) == 0 {
+			return nil, errUnexpectedMessage
+		}
+		firstLogInResponse.EncryptedMutatedSecret = append(firstLogInResponse.EncryptedMutatedSecret, chunk.Samples...)
+	}
+
+	trailer, err := readStreamMessage(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	firstLogInResponse.Signature = trailer.Signature
+
+	secondReq, err := c.answerChallenge(firstReq, firstLogInResponse, packet)
+	if err != nil {
+		return nil, err
+	}
+	c.debugf("Decrypted Secret:\t%v\n", secondReq.Secret)
+
+	if err := conn.WriteMessage(ctx, secondReq); err != nil {
+		return nil, err
+	}
+
+	result, err := readStreamMessage(ctx, conn)
+	if err != nil {
+		return nil, err
+	} else if result.LogIn == nil {
+		return nil, errUnexpectedMessage
+	}
+	conn.Close()
+
+	return c.logInSession(firstReq.Username, result.LogIn)
+}
+
+// readStreamMessage reads a message of a streamed login, returning a StatusError for messages holding an error
+func readStreamMessage(ctx context.Context, conn protocol.MessageConn) (*protocol.LogInStreamMessage, error) {
+	var message protocol.LogInStreamMessage
+	if err := conn.ReadMessage(ctx, &message); err != nil {
+		return nil, err
+	}
+
+	if message.Error != nil {
+		return nil, &StatusError{
+			StatusCode:    message.Status,
+			ErrorResponse: *message.Error,
+		}
+	}
+
+	return &message, nil
+}
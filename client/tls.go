@@ -0,0 +1,19 @@
+//go:build !js
+
+package client
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// WithTLSConfig calls the service over https with a TLS configuration
+// The TLS configuration applies to a copy of the default transport, replacing any custom transport
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		c.httpClient.Transport = transport
+		c.scheme = "https"
+	}
+}
@@ -0,0 +1,13 @@
+//go:build js
+
+package client
+
+import "crypto/tls"
+
+// WithTLSConfig calls the service over https
+// Browsers negotiate TLS themselves, so the configuration is ignored
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.scheme = "https"
+	}
+}
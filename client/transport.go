@@ -0,0 +1,81 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// transportRemoteAddr is the remote address handlers see for requests sent through a Transport
+const transportRemoteAddr = "127.0.0.1:0"
+
+type (
+	// Transport is an http.RoundTripper that serves requests with a handler in process, such as a server.Server, without a network socket
+	// Integration tests and single binary deployments use it to skip TCP entirely
+	Transport struct {
+		Handler http.Handler
+	}
+
+	// transportResponse records a handler's response for a Transport
+	transportResponse struct {
+		header http.Header
+		status int
+		body   bytes.Buffer
+	}
+)
+
+// Header returns the response's header, which may be changed until the status is written
+func (tr *transportResponse) Header() http.Header {
+	return tr.header
+}
+
+// WriteHeader records the response's status, ignoring later calls
+func (tr *transportResponse) WriteHeader(status int) {
+	if tr.status == 0 {
+		tr.status = status
+	}
+}
+
+// Write records part of the response's body, writing a 2XX status first if none was written
+func (tr *transportResponse) Write(p []byte) (int, error) {
+	tr.WriteHeader(http.StatusOK)
+	return tr.body.Write(p)
+}
+
+// RoundTrip serves a request with the Transport's handler, returning its response once the handler returns
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	serverReq := req.Clone(req.Context())
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+	serverReq.RemoteAddr = transportRemoteAddr
+	serverReq.RequestURI = req.URL.RequestURI()
+	serverReq.Host = req.URL.Host
+	defer serverReq.Body.Close()
+
+	tr := &transportResponse{header: http.Header{}}
+	t.Handler.ServeHTTP(tr, serverReq)
+	tr.WriteHeader(http.StatusOK)
+
+	return &http.Response{
+		Status:        strconv.Itoa(tr.status) + " " + http.StatusText(tr.status),
+		StatusCode:    tr.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        tr.header,
+		Body:          io.NopCloser(&tr.body),
+		ContentLength: int64(tr.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// WithHandler serves every call to the service with a handler in process, such as a server.Server, through a Transport
+func WithHandler(handler http.Handler) Option {
+	return WithTransport(&Transport{Handler: handler})
+}
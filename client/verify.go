@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// VerifyEmail verifies a user's email address with the token the service mailed to it, after which the user can log in
+// Wrong tokens return a StatusError that unwraps to protocol.ErrInvalidCredentials, and expired ones one that unwraps to protocol.ErrUnknownChallenge
+func (c *Client) VerifyEmail(ctx context.Context, username, token string) error {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+protocol.VerifyEmailPath, &protocol.VerifyEmailRequest{
+		Username: username,
+		Token:    token,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	return nil
+}
+
+// ResendVerification asks the service to mail a fresh token to a user whose email address isn't yet verified
+func (c *Client) ResendVerification(ctx context.Context, username string) error {
+	resp, err := c.makeHTTPCall(ctx, http.MethodPost, c.baseURL()+protocol.VerifyEmailPath, &protocol.VerifyEmailRequest{Username: username})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return readError(resp)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// webSocketURL returns the url of the service's WebSocket login endpoint
+func (c *Client) webSocketURL() string {
+	url := c.baseURL() + protocol.LogInWebSocketPath
+	if strings.HasPrefix(url, "https://") {
+		return "wss://" + strings.TrimPrefix(url, "https://")
+	}
+
+	return "ws://" + strings.TrimPrefix(url, "http://")
+}
+
+// webSocketConn is a protocol.MessageConn over a WebSocket, carrying each message as a JSON text message
+type webSocketConn struct {
+	conn *websocket.Conn
+}
+
+// ReadMessage reads the next message of a WebSocket into v
+func (wc webSocketConn) ReadMessage(ctx context.Context, v any) error {
+	return wsjson.Read(ctx, wc.conn, v)
+}
+
+// WriteMessage writes a message to a WebSocket
+func (wc webSocketConn) WriteMessage(ctx context.Context, v any) error {
+	return wsjson.Write(ctx, wc.conn, v)
+}
+
+// Close closes a WebSocket normally
+func (wc webSocketConn) Close() error {
+	return wc.conn.Close(websocket.StatusNormalClosure, "")
+}
+
+// logInWebSocket logs a user into the service with a first login request and their packet over a single WebSocket, unless the context is done first
+func (c *Client) logInWebSocket(ctx context.Context, firstReq *protocol.FirstLogInRequest, packet crypto.Scheme) (*Session, error) {
+	conn, err := c.dialWebSocket(ctx, c.webSocketURL())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(-1)
+
+	return c.logInStream(ctx, webSocketConn{conn: conn}, firstReq, packet)
+}
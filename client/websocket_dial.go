@@ -0,0 +1,18 @@
+//go:build !js
+
+package client
+
+import (
+	"context"
+
+	"github.com/coder/websocket"
+)
+
+// dialWebSocket opens a WebSocket with the client's http.Client and headers
+func (c *Client) dialWebSocket(ctx context.Context, url string) (*websocket.Conn, error) {
+	conn, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		HTTPClient: c.httpClient,
+		HTTPHeader: c.headers.Clone(),
+	})
+	return conn, err
+}
@@ -0,0 +1,15 @@
+//go:build js
+
+package client
+
+import (
+	"context"
+
+	"github.com/coder/websocket"
+)
+
+// dialWebSocket opens a WebSocket with the browser's WebSocket API, which sends neither the client's http.Client nor its headers
+func (c *Client) dialWebSocket(ctx context.Context, url string) (*websocket.Conn, error) {
+	conn, _, err := websocket.Dial(ctx, url, nil)
+	return conn, err
+}
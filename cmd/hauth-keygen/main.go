@@ -0,0 +1,178 @@
+// Command hauth-keygen derives key pairs for a password at parameter levels, reporting generation times and serialized sizes
+// Keys are written in the crypto package's export format, so a 128 bit key can seed the hauth command's key cache
+// The password is read from HAUTH_PASSWORD when set, or from the first line of stdin
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+var errUnknownLevel = errors.New("unknown parameter level")
+
+// countingWriter counts the bytes written to it
+type countingWriter int
+
+// Write counts and discards a slice of bytes
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	*cw += countingWriter(len(p))
+	return len(p), nil
+}
+
+// parameterSet returns the go-tfhe parameter set for a level, which is test, 80, or 128
+func parameterSet(level string) (*gates.GateBootstrappingParameterSet, error) {
+	switch level {
+	case "test":
+		return gates.TestGateBootstrappingParameters(), nil
+	case "80":
+		return gates.DefaultGateBootstrappingParameters(80), nil
+	case "128":
+		return gates.DefaultGateBootstrappingParameters(128), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownLevel, level)
+	}
+}
+
+// readPassword returns the password from HAUTH_PASSWORD, or from the first line of stdin
+func readPassword() (string, error) {
+	if password, ok := os.LookupEnv("HAUTH_PASSWORD"); ok {
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readKDFParams returns the KDFParams in a JSON file, such as a service's /kdf response, or fresh ones when no path is given
+func readKDFParams(path string) (*crypto.KDFParams, error) {
+	if path == "" {
+		return crypto.MakeKDFParams()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var params crypto.KDFParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	return &params, params.Check()
+}
+
+// levelProgress returns a Progress that writes a level's key generation progress to stderr on one line, or nil when progress isn't shown
+func levelProgress(level string, show bool) crypto.Progress {
+	if !show {
+		return nil
+	}
+
+	return func(fraction float64) {
+		fmt.Fprintf(os.Stderr, "\rgenerating %s level keys: %3.0f%%", level, 100*fraction)
+		if fraction == 1 {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// writeKey exports a Packet to a file readable only by the current user
+func writeKey(path string, packet *crypto.Packet) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := packet.Export(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func main() {
+	levels := flag.String("levels", "80,128", "comma separated parameter levels to generate, from test, 80, and 128")
+	kdfPath := flag.String("kdf", "", "JSON file of KDF parameters, such as a service's /kdf response, defaulting to fresh ones")
+	out := flag.String("out", "", "directory to write each level's keys to as <level>.key, skipped when empty")
+	progress := flag.Bool("progress", false, "show each level's key generation progress on stderr")
+	flag.Parse()
+
+	password, err := readPassword()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	kdfParams, err := readKDFParams(*kdfPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *kdfPath == "" {
+		params, _ := json.Marshal(kdfParams)
+		fmt.Printf("kdf parameters: %s\n", params)
+	}
+
+	start := time.Now()
+	seed, err := crypto.MakePasswordSeed([]byte(password), kdfParams)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("kdf time: %v\n\n", time.Since(start).Round(time.Millisecond))
+
+	if *out != "" {
+		if err := os.MkdirAll(*out, 0o700); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "level\tkeygen time\tpublic key bytes\texport bytes")
+	for _, level := range strings.Split(*levels, ",") {
+		level = strings.TrimSpace(level)
+		params, err := parameterSet(level)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		start := time.Now()
+		packet, err := crypto.GenerateKeysWithProgress(seed, params, levelProgress(level, *progress))
+		if err != nil {
+			log.Fatal(err)
+		}
+		elapsed := time.Since(start)
+
+		var publicKeyBytes, exportBytes countingWriter
+		if err := json.NewEncoder(&publicKeyBytes).Encode(crypto.MakePublicKey(packet.Pub())); err != nil {
+			log.Fatal(err)
+		}
+		if err := packet.Export(&exportBytes); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(table, "%s\t%v\t%d\t%d\n", level, elapsed.Round(time.Millisecond), publicKeyBytes, exportBytes)
+
+		if *out != "" {
+			if err := writeKey(filepath.Join(*out, level+".key"), packet); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	table.Flush()
+}
@@ -0,0 +1,199 @@
+// Command hauth-server serves the signup and login service
+// Settings come from the config package, merging defaults, a YAML file, HAUTH_* environment variables, and flags
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/zambozoo/homomorphic-authentication/config"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+	"github.com/zambozoo/homomorphic-authentication/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	c, err := config.Load(flag.CommandLine, os.Args[1:], config.ServerScope)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var opts []server.Option
+	snapshotted := make(chan error, 1)
+	if c.Snapshot.File != "" {
+		store := server.NewMemoryStore()
+		if err := store.LoadSnapshot(c.Snapshot.File); err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, server.WithUserStore(store))
+
+		go func() {
+			snapshotted <- store.SnapshotEvery(ctx, c.Snapshot.File, c.Snapshot.Interval, func(err error) {
+				log.Printf("snapshot failed: %v", err)
+			})
+		}()
+	} else {
+		snapshotted <- nil
+	}
+
+	s, err := server.NewFromConfig(c, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go s.PurgeChallengesEvery(ctx, c.Challenges.PurgeInterval, func(err error) {
+		log.Printf("challenge purge failed: %v", err)
+	})
+
+	listeners, err := server.ListenAll(c.ListenAddresses())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	errs := make(chan error, len(listeners)+3)
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- serve(c, s, listener)
+		}(listener)
+	}
+	transports, err := serveTransports(c, s, errs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+		log.Print("shutting down")
+	}
+
+	stop()
+	if err := <-snapshotted; err != nil {
+		log.Fatal(err)
+	}
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	for _, transport := range transports {
+		transport.Close()
+	}
+	if serveErr != nil {
+		log.Fatal(serveErr)
+	}
+}
+
+// serve serves a handler on a listener, also serving HTTP/3 on the same UDP port if configured and the listener is over TCP
+func serve(c *config.Config, handler http.Handler, listener net.Listener) error {
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if _, isTCP := listener.Addr().(*net.TCPAddr); c.TLS.HTTP3 && isTCP {
+		quicServer := &http3.Server{
+			Addr:    listener.Addr().String(),
+			Handler: handler,
+		}
+		httpServer.Handler = advertiseHTTP3(quicServer, handler)
+
+		go func() {
+			log.Printf("listening for HTTP/3 on %s", quicServer.Addr)
+			log.Fatal(quicServer.ListenAndServeTLS(c.TLS.CertFile, c.TLS.KeyFile))
+		}()
+	}
+
+	log.Printf("listening on %s", listener.Addr())
+	if c.TLS.CertFile != "" {
+		return httpServer.ServeTLS(listener, c.TLS.CertFile, c.TLS.KeyFile)
+	}
+
+	return httpServer.Serve(listener)
+}
+
+// serveTransports serves logins on each transport outside HTTP that is configured, over TLS if a certificate is,
+// sending the error that stops each to errs, and returns what closes them
+func serveTransports(c *config.Config, s *server.Server, errs chan<- error) ([]io.Closer, error) {
+	var tlsConfig *tls.Config
+	if c.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	var closers []io.Closer
+	if c.Transports.TCP != "" {
+		listener, err := net.Listen("tcp", c.Transports.TCP)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		closers = append(closers, listener)
+
+		log.Printf("listening for TCP logins on %s", listener.Addr())
+		go func() {
+			errs <- s.ServeStreams(listener)
+		}()
+	}
+	if c.Transports.QUIC != "" {
+		quicConfig := tlsConfig.Clone()
+		quicConfig.NextProtos = []string{protocol.QUICNextProto}
+		listener, err := quic.ListenAddr(c.Transports.QUIC, quicConfig, nil)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, listener)
+
+		log.Printf("listening for QUIC logins on %s", listener.Addr())
+		go func() {
+			errs <- s.ServeQUIC(listener)
+		}()
+	}
+	if c.Transports.GRPC != "" {
+		listener, err := net.Listen("tcp", c.Transports.GRPC)
+		if err != nil {
+			return nil, err
+		}
+		var grpcOpts []grpc.ServerOption
+		if tlsConfig != nil {
+			grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer := grpc.NewServer(grpcOpts...)
+		s.RegisterGRPC(grpcServer)
+		closers = append(closers, listener)
+
+		log.Printf("listening for gRPC logins on %s", listener.Addr())
+		go func() {
+			errs <- grpcServer.Serve(listener)
+		}()
+	}
+
+	return closers, nil
+}
+
+// advertiseHTTP3 wraps a handler to advertise an HTTP/3 server in each response's Alt-Svc header, once it is listening
+func advertiseHTTP3(quicServer *http3.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		quicServer.SetQUICHeaders(w.Header())
+		handler.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,108 @@
+//go:build js && wasm
+
+// Command hauth-wasm exposes the client to JavaScript as the global hauth object
+// Build it with GOOS=js GOARCH=wasm, and load it with the wasm_exec.js shipped with Go
+package main
+
+import (
+	"context"
+	"syscall/js"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/client"
+)
+
+// pregenerationDelay is how long a password must stay unchanged before prepareLogIn derives its keys, so they aren't derived for every keystroke
+const pregenerationDelay = 500 * time.Millisecond
+
+// promise returns a JavaScript Promise settled by a function run in a goroutine
+// Blocking calls such as http requests deadlock if made on the JavaScript event loop, so every binding returns a Promise
+func promise(f func() (any, error)) js.Value {
+	executor := js.FuncOf(func(this js.Value, args []js.Value) any {
+		resolve, reject := args[0], args[1]
+		go func() {
+			value, err := f()
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+
+			resolve.Invoke(value)
+		}()
+
+		return nil
+	})
+	defer executor.Release()
+
+	return js.Global().Get("Promise").New(executor)
+}
+
+// newClient binds hauth.newClient(baseURL, messageByteLen), returning an object with signUp, prepareLogIn, logIn, and changePassword methods
+// prepareLogIn(username, password), called as a login form's password changes, derives its keys in the background so logIn doesn't wait for them
+// logIn resolves to the session's username, token, and expiry, and an authorize(query) method that resolves to the redirect URI of an OpenID Connect login page's request
+func newClient(this js.Value, args []js.Value) any {
+	c := client.New(args[1].Int(), 0, client.WithBaseURL(args[0].String()), client.WithPregeneration(pregenerationDelay))
+
+	return js.ValueOf(map[string]any{
+		"signUp": js.FuncOf(func(this js.Value, args []js.Value) any {
+			username, password := args[0].String(), args[1].String()
+			return promise(func() (any, error) {
+				return c.SignUpCtx(context.Background(), username, password)
+			})
+		}),
+		"prepareLogIn": js.FuncOf(func(this js.Value, args []js.Value) any {
+			c.PrepareLogIn(args[0].String(), args[1].String())
+			return nil
+		}),
+		"logIn": js.FuncOf(func(this js.Value, args []js.Value) any {
+			username, password := args[0].String(), args[1].String()
+			return promise(func() (any, error) {
+				session, err := c.LogInCtx(context.Background(), username, password)
+				if err != nil {
+					return nil, err
+				}
+
+				return map[string]any{
+					"username":  session.Username(),
+					"token":     session.Token(),
+					"expiresAt": session.ExpiresAt().Format(time.RFC3339),
+					"authorize": js.FuncOf(func(this js.Value, args []js.Value) any {
+						query := args[0].String()
+						return promise(func() (any, error) {
+							return session.AuthorizeOIDC(context.Background(), query)
+						})
+					}),
+				}, nil
+			})
+		}),
+		"changePassword": js.FuncOf(func(this js.Value, args []js.Value) any {
+			username, oldPassword, newPassword := args[0].String(), args[1].String(), args[2].String()
+			return promise(func() (any, error) {
+				return c.ChangePasswordCtx(context.Background(), username, oldPassword, newPassword)
+			})
+		}),
+	})
+}
+
+// passwordStrength binds hauth.passwordStrength(password, ...userInputs), returning the password's estimated score and log10 guesses for strength meters
+func passwordStrength(this js.Value, args []js.Value) any {
+	userInputs := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		userInputs[i] = arg.String()
+	}
+	strength := client.EstimatePasswordStrength(args[0].String(), userInputs...)
+
+	return js.ValueOf(map[string]any{
+		"score":        strength.Score,
+		"guessesLog10": strength.GuessesLog10,
+	})
+}
+
+func main() {
+	js.Global().Set("hauth", js.ValueOf(map[string]any{
+		"newClient":        js.FuncOf(newClient),
+		"passwordStrength": js.FuncOf(passwordStrength),
+	}))
+
+	select {}
+}
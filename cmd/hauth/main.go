@@ -0,0 +1,429 @@
+// Command hauth signs up, logs in, and changes passwords with the signup and login service from the shell
+// Keys derived from passwords are cached under ~/.config/hauth, so later logins skip the password and key generation
+// Services that verify email addresses mail new users a token, which verify-email passes back before they can log in,
+// and mail verified users a token that reset-password enrolls a new password with
+// Users who sign up with -recovery are shown a recovery phrase, which reset-password -recovery enrolls a new password with instead
+// With -srp or -opaque, users are signed up and logged in with SRP or OPAQUE, which cache no keys, and users who signed up with either are logged in with it regardless
+// With -remember-device, logins remember the device and later logins use its token, skipping the password and keys until it expires or is revoked
+// The terms each service negotiates are pinned under the cache directory too, and logins refuse a service that later offers weaker ones or whose pin can't be read
+// Passwords are read from HAUTH_PASSWORD, HAUTH_NEW_PASSWORD, and HAUTH_RECOVERY_PHRASE when set, or prompted for on stdin
+// Admins export and import encrypted archives of every user with the service's admin token, and a passphrase read from HAUTH_ARCHIVE_PASSPHRASE or stdin
+// The service and cache directory come from the config package, so they can also be set in a YAML file or HAUTH_* environment variables
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zambozoo/homomorphic-authentication/client"
+	"github.com/zambozoo/homomorphic-authentication/config"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errUsage = errors.New("usage: hauth [signup|verify-email|reset-password|login|change-password|whoami|export|import] [flags]")
+
+// command is a subcommand's parsed flags, store, and client
+type command struct {
+	server         string
+	username       string
+	email          string
+	token          string
+	recovery       bool
+	srp            bool
+	opaque         bool
+	rememberDevice bool
+	messageByteLen int
+	adminToken     string
+	archive        string
+	store          *store
+	client         *client.Client
+	stdin          *bufio.Reader
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "hauth:", err)
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the subcommand named by the first argument
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	subcommands := map[string]func(context.Context, *command) error{
+		"signup":          signUp,
+		"verify-email":    verifyEmail,
+		"reset-password":  resetPassword,
+		"login":           logIn,
+		"change-password": changePassword,
+		"whoami":          whoAmI,
+		"export":          exportUsers,
+		"import":          importUsers,
+	}
+	subcommand, ok := subcommands[args[0]]
+	if !ok {
+		return errUsage
+	}
+
+	cmd, err := parseCommand(args[0], args[1:])
+	if err != nil {
+		return err
+	}
+
+	return subcommand(ctx, cmd)
+}
+
+// parseCommand parses a subcommand's flags and opens its store
+func parseCommand(name string, args []string) (*command, error) {
+	cmd := &command{stdin: bufio.NewReader(os.Stdin)}
+
+	flags := flag.NewFlagSet("hauth "+name, flag.ContinueOnError)
+	flags.StringVar(&cmd.username, "user", "", "username, defaulting to the current session's user")
+	switch name {
+	case "signup":
+		flags.StringVar(&cmd.email, "email", "", "email address, which services that verify addresses mail a token to")
+		flags.BoolVar(&cmd.recovery, "recovery", false, "enroll and print a recovery phrase, which resets the password if it is lost")
+	case "verify-email":
+		flags.StringVar(&cmd.token, "token", "", "token mailed to the user's email address, or empty to mail a fresh one")
+	case "reset-password":
+		flags.StringVar(&cmd.token, "token", "", "password reset token mailed to the user, or empty to mail one")
+		flags.BoolVar(&cmd.recovery, "recovery", false, "log in with the user's recovery phrase instead of a mailed token")
+	}
+	admin := name == "export" || name == "import"
+	if admin {
+		flags.StringVar(&cmd.archive, "archive", "", "archive file to export to or import from, or - for stdout or stdin")
+	}
+	c, err := config.Load(flags, args, config.ClientScope)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := openStore(c.Client.Dir)
+	if err != nil {
+		return nil, err
+	}
+	cmd.server, cmd.messageByteLen, cmd.adminToken, cmd.srp, cmd.opaque, cmd.store = c.Client.Server, c.Client.MessageBytes, c.AdminToken, c.Client.SRP, c.Client.OPAQUE, store
+	opts := []client.Option{client.WithBaseURL(cmd.server), client.WithPasswordPolicy(passwordPolicy(c.Client)), client.WithPinStore(store)}
+	if cmd.srp {
+		opts = append(opts, client.WithSRP())
+	}
+	if cmd.opaque {
+		opts = append(opts, client.WithOPAQUE())
+	}
+	if cmd.rememberDevice = c.Client.RememberDevice; cmd.rememberDevice {
+		hostname, _ := os.Hostname()
+		opts = append(opts, client.WithRememberDevice(store, "hauth on "+hostname, hostname))
+	}
+	if c.Client.ServerKey != "" {
+		key, _ := base64.StdEncoding.DecodeString(c.Client.ServerKey)
+		opts = append(opts, client.WithServerKey(key))
+	}
+	cmd.client = client.New(cmd.messageByteLen, 0, opts...)
+
+	if admin && (cmd.archive == "" || cmd.adminToken == "") {
+		return nil, fmt.Errorf("%w: -archive and -admin-token are required", errUsage)
+	}
+	if cmd.username == "" && name != "whoami" && !admin {
+		session, err := store.loadSession()
+		if err != nil {
+			return nil, fmt.Errorf("%w: -user is required", errUsage)
+		}
+		cmd.username = session.Username
+	}
+
+	return cmd, nil
+}
+
+// passwordPolicy returns the PasswordPolicy a ClientConfig describes, which warns on stderr if it only warns
+func passwordPolicy(c config.ClientConfig) *client.PasswordPolicy {
+	policy := &client.PasswordPolicy{
+		MinLength:  c.PasswordMinLength,
+		MinClasses: c.PasswordMinClasses,
+		MinScore:   c.PasswordMinScore,
+	}
+	if c.PasswordWarnOnly {
+		policy.Enforcement = client.EnforceWarn
+		policy.OnViolation = func(err *client.PasswordPolicyError) {
+			fmt.Fprintln(os.Stderr, "hauth: warning:", err)
+		}
+	}
+
+	return policy
+}
+
+// password returns a password from an environment variable, or prompts for one on stdin
+func (cmd *command) password(env, prompt string) (string, error) {
+	if password, ok := os.LookupEnv(env); ok {
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := cmd.stdin.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// cachePacket derives a user's keys from their password and caches them, unless they log in with SRP or OPAQUE, which have no keys to cache
+func (cmd *command) cachePacket(ctx context.Context, password string) error {
+	if cmd.srp || cmd.opaque {
+		return nil
+	}
+
+	packet, err := cmd.client.DerivePacketCtx(ctx, cmd.username, password)
+	if err != nil {
+		return err
+	}
+
+	return cmd.store.savePacket(cmd.server, cmd.username, packet)
+}
+
+// signUp signs up a user, printing their recovery phrase if they enroll one, and caches their keys
+func signUp(ctx context.Context, cmd *command) error {
+	password, err := cmd.password("HAUTH_PASSWORD", "Password: ")
+	if err != nil {
+		return err
+	}
+
+	var recoveryPhrase string
+	if cmd.recovery {
+		if recoveryPhrase, err = client.GenerateRecoveryPhrase(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := cmd.client.SignUpWithRecoveryCtx(ctx, cmd.username, cmd.email, password, recoveryPhrase); err != nil {
+		return err
+	}
+
+	fmt.Printf("signed up %s\n", cmd.username)
+	if recoveryPhrase != "" {
+		fmt.Printf("recovery phrase: %s\n", recoveryPhrase)
+	}
+	return cmd.cachePacket(ctx, password)
+}
+
+// verifyEmail verifies a user's email address with a mailed token, or asks for a fresh one without a token
+func verifyEmail(ctx context.Context, cmd *command) error {
+	if cmd.token == "" {
+		if err := cmd.client.ResendVerification(ctx, cmd.username); err != nil {
+			return err
+		}
+
+		fmt.Printf("mailed a verification token to %s\n", cmd.username)
+		return nil
+	}
+
+	if err := cmd.client.VerifyEmail(ctx, cmd.username, cmd.token); err != nil {
+		return err
+	}
+
+	fmt.Printf("verified email address of %s\n", cmd.username)
+	return nil
+}
+
+// resetPassword mails a user a password reset token, or enrolls a new password and caches its keys with a token or their recovery phrase
+func resetPassword(ctx context.Context, cmd *command) error {
+	if cmd.token == "" && !cmd.recovery {
+		if err := cmd.client.RequestPasswordReset(ctx, cmd.username); err != nil {
+			return err
+		}
+
+		fmt.Printf("mailed a password reset token to %s\n", cmd.username)
+		return nil
+	}
+
+	newPassword, err := cmd.password("HAUTH_NEW_PASSWORD", "New password: ")
+	if err != nil {
+		return err
+	}
+
+	if cmd.recovery {
+		recoveryPhrase, err := cmd.password("HAUTH_RECOVERY_PHRASE", "Recovery phrase: ")
+		if err != nil {
+			return err
+		}
+
+		session, err := cmd.client.LogInWithRecoveryCtx(ctx, cmd.username, recoveryPhrase)
+		if err != nil {
+			return err
+		}
+		if err := session.ResetPassword(ctx, newPassword); err != nil {
+			return err
+		}
+	} else if err := cmd.client.ResetPassword(ctx, cmd.username, cmd.token, newPassword); err != nil {
+		return err
+	}
+	if err := cmd.store.forgetPacket(cmd.server, cmd.username); err != nil {
+		return err
+	}
+
+	fmt.Printf("reset password for %s\n", cmd.username)
+	return cmd.cachePacket(ctx, newPassword)
+}
+
+// logIn logs a user in with their cached keys, or their password if there are none or they log in with SRP or OPAQUE, and saves the session
+func logIn(ctx context.Context, cmd *command) error {
+	session, err := cmd.logIn(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("logged in as %s until %s\n", session.Username(), session.ExpiresAt().Format("15:04:05"))
+	return cmd.store.saveSession(&savedSession{
+		Server:    cmd.server,
+		Username:  session.Username(),
+		Token:     session.Token(),
+		ExpiresAt: session.ExpiresAt(),
+	})
+}
+
+// logIn returns the session of a user logged in with their device token if the device is remembered,
+// or else with their cached keys, or their password if there are none or they log in with SRP or OPAQUE
+func (cmd *command) logIn(ctx context.Context) (*client.Session, error) {
+	if cmd.rememberDevice {
+		if session, err := cmd.client.LogInRememberedCtx(ctx, cmd.username); !errors.Is(err, client.ErrNotRemembered) {
+			return session, err
+		}
+	}
+
+	packet, err := cmd.store.loadPacket(cmd.server, cmd.username)
+	if err != nil {
+		return nil, err
+	}
+	if packet != nil && !cmd.srp && !cmd.opaque {
+		return cmd.client.LogInWithPacketCtx(ctx, cmd.username, packet)
+	}
+
+	password, err := cmd.password("HAUTH_PASSWORD", "Password: ")
+	if err != nil {
+		return nil, err
+	}
+	if cmd.srp || cmd.opaque {
+		return cmd.client.LogInCtx(ctx, cmd.username, password)
+	}
+
+	packet, err = cmd.client.DerivePacketCtx(ctx, cmd.username, password)
+	if errors.Is(err, protocol.ErrSRPRequired) {
+		return cmd.client.LogInSRPCtx(ctx, cmd.username, password)
+	} else if errors.Is(err, protocol.ErrOPAQUERequired) {
+		return cmd.client.LogInOPAQUECtx(ctx, cmd.username, password)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := cmd.store.savePacket(cmd.server, cmd.username, packet); err != nil {
+		return nil, err
+	}
+
+	return cmd.client.LogInWithPacketCtx(ctx, cmd.username, packet)
+}
+
+// changePassword changes a user's password and replaces their cached keys
+func changePassword(ctx context.Context, cmd *command) error {
+	oldPassword, err := cmd.password("HAUTH_PASSWORD", "Old password: ")
+	if err != nil {
+		return err
+	}
+	newPassword, err := cmd.password("HAUTH_NEW_PASSWORD", "New password: ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := cmd.client.ChangePasswordCtx(ctx, cmd.username, oldPassword, newPassword); err != nil {
+		return err
+	}
+	if err := cmd.store.forgetPacket(cmd.server, cmd.username); err != nil {
+		return err
+	}
+
+	fmt.Printf("changed password for %s\n", cmd.username)
+	return cmd.cachePacket(ctx, newPassword)
+}
+
+// whoAmI prints the user of the saved session, refreshing its token if it is about to expire
+func whoAmI(ctx context.Context, cmd *command) error {
+	saved, err := cmd.store.loadSession()
+	if err != nil {
+		return err
+	}
+
+	c := client.New(cmd.messageByteLen, 0, client.WithBaseURL(saved.Server))
+	session := c.ResumeSession(saved.Username, saved.Token, saved.ExpiresAt)
+	username, err := session.WhoAmI(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(username)
+	saved.Token, saved.ExpiresAt = session.Token(), session.ExpiresAt()
+	return cmd.store.saveSession(saved)
+}
+
+// exportUsers writes an encrypted archive of every user of the service to a file
+func exportUsers(ctx context.Context, cmd *command) error {
+	passphrase, err := cmd.password("HAUTH_ARCHIVE_PASSPHRASE", "Archive passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	if cmd.archive == "-" {
+		return cmd.client.ExportUsers(ctx, cmd.adminToken, passphrase, os.Stdout)
+	}
+
+	file, err := os.OpenFile(cmd.archive, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := cmd.client.ExportUsers(ctx, cmd.adminToken, passphrase, file); err != nil {
+		file.Close()
+		os.Remove(cmd.archive)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported users to %s\n", cmd.archive)
+	return nil
+}
+
+// importUsers creates the users in an encrypted archive file in the service
+func importUsers(ctx context.Context, cmd *command) error {
+	passphrase, err := cmd.password("HAUTH_ARCHIVE_PASSPHRASE", "Archive passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	var archive io.Reader = cmd.stdin
+	if cmd.archive != "-" {
+		file, err := os.Open(cmd.archive)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		archive = file
+	}
+
+	importResponse, err := cmd.client.ImportUsers(ctx, cmd.adminToken, passphrase, archive)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %d users, skipped %d existing users\n", importResponse.Imported, importResponse.Skipped)
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var (
+	errNoSession     = errors.New("no saved session, log in first")
+	errNotExportable = errors.New("keys can't be exported")
+)
+
+type (
+	// store keeps cached keys, device tokens, pinned terms, and the current session under a directory, ~/.config/hauth by default
+	store struct {
+		dir string
+	}
+
+	// savedSession is the current session as written to disk
+	savedSession struct {
+		Server    string    `json:"Server"`
+		Username  string    `json:"Username"`
+		Token     string    `json:"Token"`
+		ExpiresAt time.Time `json:"ExpiresAt"`
+	}
+)
+
+// openStore returns a store under a directory, or under the user's config directory when none is given
+func openStore(dir string) (*store, error) {
+	if dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(configDir, "hauth")
+	}
+
+	return &store{dir: dir}, os.MkdirAll(dir, 0o700)
+}
+
+// keyPath returns where a user's cached keys for a server are kept
+func (s *store) keyPath(server, username string) string {
+	return filepath.Join(s.dir, "keys", url.PathEscape(server), url.PathEscape(username)+".key")
+}
+
+// loadPacket returns a user's cached keys for a server, or nil if there are none
+func (s *store) loadPacket(server, username string) (crypto.Scheme, error) {
+	f, err := os.Open(s.keyPath(server, username))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	packet, err := crypto.ImportPacket(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// savePacket caches a user's keys for a server, readable only by the current user
+func (s *store) savePacket(server, username string, scheme crypto.Scheme) error {
+	packet, ok := scheme.(interface{ Export(w io.Writer) error })
+	if !ok {
+		return errNotExportable
+	}
+
+	path := s.keyPath(server, username)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := packet.Export(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// forgetPacket removes a user's cached keys for a server
+func (s *store) forgetPacket(server, username string) error {
+	if err := os.Remove(s.keyPath(server, username)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// loadSession returns the current session
+func (s *store) loadSession() (*savedSession, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "session.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoSession
+	} else if err != nil {
+		return nil, err
+	}
+
+	var session savedSession
+	return &session, json.Unmarshal(data, &session)
+}
+
+// saveSession replaces the current session, readable only by the current user
+func (s *store) saveSession(session *savedSession) error {
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(s.dir, "session.json"), data, 0o600)
+}
+
+// deviceTokenPath returns where a user's device token for a server is kept
+func (s *store) deviceTokenPath(server, username string) string {
+	return filepath.Join(s.dir, "devices", url.PathEscape(server), url.PathEscape(username)+".json")
+}
+
+// LoadDeviceToken returns a user's device token for a server, or nil if there is none
+func (s *store) LoadDeviceToken(server, username string) (*protocol.DeviceToken, error) {
+	data, err := os.ReadFile(s.deviceTokenPath(server, username))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var deviceToken protocol.DeviceToken
+	return &deviceToken, json.Unmarshal(data, &deviceToken)
+}
+
+// SaveDeviceToken replaces a user's device token for a server, readable only by the current user
+func (s *store) SaveDeviceToken(server, username string, deviceToken *protocol.DeviceToken) error {
+	data, err := json.MarshalIndent(deviceToken, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := s.deviceTokenPath(server, username)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
+
+// DeleteDeviceToken removes a user's device token for a server
+func (s *store) DeleteDeviceToken(server, username string) error {
+	if err := os.Remove(s.deviceTokenPath(server, username)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// pinPath returns where the terms pinned for a server are kept
+func (s *store) pinPath(server string) string {
+	return filepath.Join(s.dir, "pins", url.PathEscape(server)+".json")
+}
+
+// LoadPin returns the terms pinned for a server, or nil if there are none
+func (s *store) LoadPin(server string) (*protocol.Negotiation, error) {
+	data, err := os.ReadFile(s.pinPath(server))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var pin protocol.Negotiation
+	return &pin, json.Unmarshal(data, &pin)
+}
+
+// SavePin replaces the terms pinned for a server, readable only by the current user
+func (s *store) SavePin(server string, pin protocol.Negotiation) error {
+	data, err := json.MarshalIndent(pin, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := s.pinPath(server)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
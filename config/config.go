@@ -0,0 +1,547 @@
+// Package config loads the settings of the server and command line client
+// Defaults are overridden by a YAML file, then HAUTH_* environment variables, then flags, and the result is validated
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+type (
+	// Config is the configuration shared by hauth-server and hauth
+	// Listen is a comma separated list of addresses, each host:port over TCP or unix:path for a Unix domain socket
+	Config struct {
+		Listen             string              `yaml:"listen"`
+		Store              string              `yaml:"store"`
+		Snapshot           SnapshotConfig      `yaml:"snapshot"`
+		Sessions           SessionConfig       `yaml:"sessions"`
+		Challenges         ChallengeConfig     `yaml:"challenges"`
+		TLS                TLSConfig           `yaml:"tls"`
+		Transports         TransportConfig     `yaml:"transports"`
+		CORS               CORSConfig          `yaml:"cors"`
+		SessionCookies     SessionCookieConfig `yaml:"sessionCookies"`
+		AccessLog          AccessLogConfig     `yaml:"accessLog"`
+		RequestTimeout     time.Duration       `yaml:"requestTimeout"`
+		AdminToken         string              `yaml:"adminToken"`
+		MasterKey          string              `yaml:"masterKey"`
+		OPAQUEKey          string              `yaml:"opaqueKey"`
+		SigningKey         string              `yaml:"signingKey"`
+		MinProtocolVersion int                 `yaml:"minProtocolVersion"`
+		IdempotencyTTL     time.Duration       `yaml:"idempotencyTTL"`
+		Keys               KeysConfig          `yaml:"keys"`
+		WebAuthn           WebAuthnConfig      `yaml:"webAuthn"`
+		OIDC               OIDCConfig          `yaml:"oidc"`
+		Mail               MailConfig          `yaml:"mail"`
+		Webhook            WebhookConfig       `yaml:"webhook"`
+		Captcha            CaptchaConfig       `yaml:"captcha"`
+		Usernames          UsernameConfig      `yaml:"usernames"`
+		RateLimit          RateLimitConfig     `yaml:"rateLimit"`
+		Secrets            SecretConfig        `yaml:"secrets"`
+		Hashing            HashingConfig       `yaml:"hashing"`
+		Circuits           CircuitConfig       `yaml:"circuits"`
+		Client             ClientConfig        `yaml:"client"`
+	}
+
+	// SnapshotConfig is the file a memory store is loaded from on start and saved to each interval it changed, where an empty file disables snapshots
+	SnapshotConfig struct {
+		File     string        `yaml:"file"`
+		Interval time.Duration `yaml:"interval"`
+	}
+
+	// SessionConfig is the store sessions are kept in, such as memory:// or a redis:// URL that replicas share,
+	// and, if positive, the maximum lifetime after login up to which each session's expiry slides as it is used,
+	// and how long device tokens, which log users in on remembered devices, are valid, where 0 doesn't remember devices,
+	// and how long each user's login attempts are kept in their login history, where 0 keeps none
+	SessionConfig struct {
+		Store          string        `yaml:"store"`
+		MaxLifetime    time.Duration `yaml:"maxLifetime"`
+		DeviceTokenTTL time.Duration `yaml:"deviceTokenTTL"`
+		LogInHistory   time.Duration `yaml:"logInHistory"`
+	}
+
+	// ChallengeConfig is the store login challenges are kept in until their second login requests answer them,
+	// such as memory:// or a redis:// URL that replicas share, how long each can be answered, and the time between purges of the challenges of abandoned logins,
+	// and the mutator that constructs them: mirrored, pad, or additive
+	ChallengeConfig struct {
+		Store         string        `yaml:"store"`
+		TTL           time.Duration `yaml:"ttl"`
+		PurgeInterval time.Duration `yaml:"purgeInterval"`
+		Mutator       string        `yaml:"mutator"`
+	}
+
+	// KeysConfig is where server key material, such as the master key, is fetched from, where an empty provider keeps none outside the config
+	// Keys are fetched again each refresh interval, picking up rotations, and the KMS providers unwrap the base64 ciphertexts of each key's versions in Wrapped
+	KeysConfig struct {
+		Provider     string              `yaml:"provider"`
+		Refresh      time.Duration       `yaml:"refresh"`
+		VaultAddress string              `yaml:"vaultAddress"`
+		VaultPath    string              `yaml:"vaultPath"`
+		AWSRegion    string              `yaml:"awsRegion"`
+		GCPKey       string              `yaml:"gcpKey"`
+		Endpoint     string              `yaml:"endpoint"`
+		Wrapped      map[string][]string `yaml:"wrapped"`
+	}
+
+	// WebAuthnConfig is the relying party passkeys are registered with, where an empty id disables passkeys,
+	// and the origins, such as https://login.example.com, whose pages may register and use them
+	WebAuthnConfig struct {
+		RPID    string   `yaml:"rpID"`
+		RPName  string   `yaml:"rpName"`
+		Origins []string `yaml:"origins"`
+	}
+
+	// OIDCConfig is the OpenID Connect provider fronting logins, where an empty issuer, the URL the server is reached at, disables it
+	// ID tokens are signed with the RSA key in the PEM file KeyFile, or with a key generated at start when empty, whose tokens don't verify after a restart,
+	// and users without a session are sent to the login page at LoginURL, which apps registered in Clients, or with the admin token, redirect them through
+	OIDCConfig struct {
+		Issuer   string             `yaml:"issuer"`
+		KeyFile  string             `yaml:"keyFile"`
+		LoginURL string             `yaml:"loginURL"`
+		Clients  []OIDCClientConfig `yaml:"clients"`
+	}
+
+	// OIDCClientConfig is an app registered with the OpenID Connect provider, and the redirect URIs its authorization codes may be sent to
+	OIDCClientConfig struct {
+		ID           string   `yaml:"id"`
+		Secret       string   `yaml:"secret"`
+		Name         string   `yaml:"name"`
+		RedirectURIs []string `yaml:"redirectURIs"`
+	}
+
+	// MailConfig is how mail, such as email verification tokens, is sent, where an empty mailer sends none and doesn't verify addresses
+	// The smtp mailer sends from an address through a server at host:port, authenticating as a username if one is set,
+	// and the log mailer logs messages instead, for development
+	// VerifyURL, if set, is linked to in verification mail with username and token query parameters
+	MailConfig struct {
+		Mailer       string `yaml:"mailer"`
+		SMTPAddress  string `yaml:"smtpAddress"`
+		SMTPUsername string `yaml:"smtpUsername"`
+		From         string `yaml:"from"`
+		VerifyURL    string `yaml:"verifyURL"`
+	}
+
+	// WebhookConfig is the url auth events, such as logins, are posted to, where an empty url posts none,
+	// and how many times failed posts are retried
+	WebhookConfig struct {
+		URL     string `yaml:"url"`
+		Retries int    `yaml:"retries"`
+	}
+
+	// CaptchaConfig is the CAPTCHA provider, hcaptcha or recaptcha, whose tokens are verified, where an empty provider requires none,
+	// the site key of hCaptcha sites and the minimum score of reCAPTCHA v3 sites, and when tokens are required:
+	// on every signup if OnSignUp is set, and on logins once their user or address has failed AfterFailures times, where 0 is never
+	CaptchaConfig struct {
+		Provider      string  `yaml:"provider"`
+		SiteKey       string  `yaml:"siteKey"`
+		MinScore      float64 `yaml:"minScore"`
+		OnSignUp      bool    `yaml:"onSignUp"`
+		AfterFailures int     `yaml:"afterFailures"`
+	}
+
+	// UsernameConfig is whether usernames are NFKC and PRECIS normalized, and case folded if CaseInsensitive is set, before users are stored or looked up,
+	// and the rune lengths, where a MaxLength of 0 is unlimited, and regular expression Pattern, if set, that normalized usernames must fit
+	UsernameConfig struct {
+		Normalize       bool   `yaml:"normalize"`
+		CaseInsensitive bool   `yaml:"caseInsensitive"`
+		MinLength       int    `yaml:"minLength"`
+		MaxLength       int    `yaml:"maxLength"`
+		Pattern         string `yaml:"pattern"`
+	}
+
+	// TLSConfig is the certificate and key served over https, where an empty certificate serves http,
+	// and whether HTTP/3 is also served over QUIC on the same port
+	TLSConfig struct {
+		CertFile string `yaml:"certFile"`
+		KeyFile  string `yaml:"keyFile"`
+		HTTP3    bool   `yaml:"http3"`
+	}
+
+	// TransportConfig is the addresses logins are also served at outside HTTP, each empty to not serve it, for devices whose link doesn't carry HTTP:
+	// raw TCP streams, over TLS when a certificate is configured, QUIC streams, which need a certificate, and gRPC streams
+	TransportConfig struct {
+		TCP  string `yaml:"tcp"`
+		QUIC string `yaml:"quic"`
+		GRPC string `yaml:"grpc"`
+	}
+
+	// CORSConfig is the origins, such as https://app.example.com or * for every origin, whose pages may call the server from a browser, where none disables CORS,
+	// whether they may send cookies with their requests, which * can't, and how long browsers may cache a preflight's result, where 0 leaves it to the browser
+	CORSConfig struct {
+		Origins          []string      `yaml:"origins"`
+		AllowCredentials bool          `yaml:"allowCredentials"`
+		MaxAge           time.Duration `yaml:"maxAge"`
+	}
+
+	// SessionCookieConfig is how the CSRF tokens of sessions delivered as cookies are delivered, double-submit or same-site, where none doesn't deliver sessions as cookies,
+	// the domain the cookies are sent to, where none sends them only to the server's host, and whether they're sent over plain HTTP
+	SessionCookieConfig struct {
+		CSRF     string `yaml:"csrf"`
+		Domain   string `yaml:"domain"`
+		Insecure bool   `yaml:"insecure"`
+	}
+
+	// AccessLogConfig is whether each request is logged, and whether its body is logged too, for debugging, with its secret fields redacted
+	AccessLogConfig struct {
+		Enabled bool `yaml:"enabled"`
+		Bodies  bool `yaml:"bodies"`
+	}
+
+	// RateLimitConfig is the requests per second and burst allowed per client address, where 0 requests per second is unlimited,
+	// the login challenges computed at once, where 0 is unlimited, and the recovery logins per hour and burst allowed per user
+	RateLimitConfig struct {
+		RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+		Burst             int     `yaml:"burst"`
+		MaxChallenges     int     `yaml:"maxChallenges"`
+		RecoveryPerHour   float64 `yaml:"recoveryPerHour"`
+		RecoveryBurst     int     `yaml:"recoveryBurst"`
+	}
+
+	// SecretConfig is the range of lengths, in bytes, of the secrets clients can enroll,
+	// how long a secret replaced by a password change or rotation still logs in, where zero is not at all,
+	// and how long after a secret is enrolled its logins require its rotation, where zero is never,
+	// and the fewest estimated bits of security of the parameter sets secrets are enrolled and logged in under: 0, 80, or 128
+	SecretConfig struct {
+		MinBytes         int           `yaml:"minBytes"`
+		MaxBytes         int           `yaml:"maxBytes"`
+		GracePeriod      time.Duration `yaml:"gracePeriod"`
+		MaxAge           time.Duration `yaml:"maxAge"`
+		MinSecurityLevel int           `yaml:"minSecurityLevel"`
+	}
+
+	// HashingConfig is how users' secrets are salted and hashed, and the base64 pepper mixed into them first, where empty is none
+	HashingConfig struct {
+		SaltBytes int    `yaml:"saltBytes"`
+		Hasher    string `yaml:"hasher"`
+		Time      uint32 `yaml:"time"`
+		Memory    uint32 `yaml:"memory"`
+		Threads   uint8  `yaml:"threads"`
+		Pepper    string `yaml:"pepper"`
+	}
+
+	// CircuitConfig bounds the circuits the server evaluates, the bits of the encrypted secrets and circuit inputs it accepts,
+	// and the circuits it evaluates at once, where 0 is unlimited
+	CircuitConfig struct {
+		MaxGates          int `yaml:"maxGates"`
+		MaxDepth          int `yaml:"maxDepth"`
+		MaxInputBits      int `yaml:"maxInputBits"`
+		MaxCiphertextBits int `yaml:"maxCiphertextBits"`
+		MaxEvaluations    int `yaml:"maxEvaluations"`
+	}
+
+	// ClientConfig is the service the command line client talks to, and where it caches keys and sessions,
+	// and the password policy it signs up with: the fewest characters, classes of characters, and strength score from 0 to 4,
+	// where 0 checks nothing, and whether passwords that break it are only warned about,
+	// and whether users are signed up and logged in with SRP or OPAQUE instead of FHE keys
+	ClientConfig struct {
+		Server             string `yaml:"server"`
+		MessageBytes       int    `yaml:"messageBytes"`
+		Dir                string `yaml:"dir"`
+		PasswordMinLength  int    `yaml:"passwordMinLength"`
+		PasswordMinClasses int    `yaml:"passwordMinClasses"`
+		PasswordMinScore   int    `yaml:"passwordMinScore"`
+		PasswordWarnOnly   bool   `yaml:"passwordWarnOnly"`
+		SRP                bool   `yaml:"srp"`
+		OPAQUE             bool   `yaml:"opaque"`
+		RememberDevice     bool   `yaml:"rememberDevice"`
+		ServerKey          string `yaml:"serverKey"`
+	}
+)
+
+// Default returns the configuration used for omitted settings
+func Default() *Config {
+	return &Config{
+		Listen:             ":8080",
+		Store:              "memory://",
+		MinProtocolVersion: protocol.Version,
+		IdempotencyTTL:     24 * time.Hour,
+		Snapshot: SnapshotConfig{
+			Interval: time.Minute,
+		},
+		Sessions: SessionConfig{
+			Store:        "memory://",
+			LogInHistory: 30 * 24 * time.Hour,
+		},
+		Challenges: ChallengeConfig{
+			Store:         "memory://",
+			TTL:           5 * time.Minute,
+			PurgeInterval: time.Minute,
+			Mutator:       "mirrored",
+		},
+		Keys: KeysConfig{
+			Refresh: 5 * time.Minute,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPName: "hauth",
+		},
+		Webhook: WebhookConfig{
+			Retries: 3,
+		},
+		Usernames: UsernameConfig{
+			MinLength: 1,
+			MaxLength: 64,
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond: 10,
+			Burst:             20,
+			RecoveryPerHour:   6,
+			RecoveryBurst:     3,
+		},
+		Secrets: SecretConfig{
+			MinBytes:    1,
+			MaxBytes:    64,
+			GracePeriod: 10 * time.Minute,
+		},
+		Hashing: HashingConfig{
+			SaltBytes: 16,
+			Hasher:    "argon2id",
+			Time:      1,
+			Memory:    64 * 1024,
+			Threads:   4,
+		},
+		Circuits: CircuitConfig{
+			MaxGates:          1 << 8,
+			MaxDepth:          8,
+			MaxInputBits:      1 << 14,
+			MaxCiphertextBits: 1024,
+			MaxEvaluations:    2,
+		},
+		Client: ClientConfig{
+			Server:       "http://localhost:8080",
+			MessageBytes: 8,
+		},
+	}
+}
+
+// LoadFile overrides a Config with the settings in a YAML file
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return nil
+}
+
+// ListenAddresses returns the addresses the server listens on
+func (c *Config) ListenAddresses() []string {
+	addresses := strings.Split(c.Listen, ",")
+	for i := range addresses {
+		addresses[i] = strings.TrimSpace(addresses[i])
+	}
+
+	return addresses
+}
+
+// validMasterKey returns whether a master key is 32 bytes encoded in standard base64
+func validMasterKey(masterKey string) bool {
+	key, err := base64.StdEncoding.DecodeString(masterKey)
+	return err == nil && len(key) == 32
+}
+
+// validPepper returns whether a pepper is at least 16 bytes encoded in standard base64
+func validPepper(pepper string) bool {
+	key, err := base64.StdEncoding.DecodeString(pepper)
+	return err == nil && len(key) >= 16
+}
+
+// validEd25519Key returns whether an Ed25519 private key seed or public key is 32 bytes encoded in standard base64
+func validEd25519Key(ed25519Key string) bool {
+	key, err := base64.StdEncoding.DecodeString(ed25519Key)
+	return err == nil && len(key) == 32
+}
+
+// validOPAQUEKey returns whether an OPAQUE key is 64 bytes encoded in standard base64
+func validOPAQUEKey(opaqueKey string) bool {
+	key, err := base64.StdEncoding.DecodeString(opaqueKey)
+	return err == nil && len(key) == 64
+}
+
+// validSessionStore returns whether a session or challenge store is a memory, redis, or rediss url
+func validSessionStore(store string) bool {
+	scheme, _, _ := strings.Cut(store, "://")
+	return scheme == "memory" || scheme == "redis" || scheme == "rediss"
+}
+
+// validURL returns whether a URL is absolute
+func validURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.IsAbs()
+}
+
+// validCORSOrigins returns whether every CORS origin is an absolute url, or * for every origin when credentials aren't allowed
+func validCORSOrigins(origins []string, allowCredentials bool) bool {
+	for _, origin := range origins {
+		if origin == "*" && allowCredentials || origin != "*" && !validURL(origin) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validOIDCClients returns whether every OIDC client has an id, a secret, and a redirect URI
+func validOIDCClients(clients []OIDCClientConfig) bool {
+	for _, client := range clients {
+		if client.ID == "" || client.Secret == "" || len(client.RedirectURIs) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validPattern returns whether a pattern is empty or a regular expression
+func validPattern(pattern string) bool {
+	_, err := regexp.Compile(pattern)
+	return err == nil
+}
+
+// Validate returns an error wrapping ErrInvalidConfig for the first setting that is out of range
+func (c *Config) Validate() error {
+	switch {
+	case c.Snapshot.File != "" && c.Store != "" && !strings.HasPrefix(c.Store, "memory://"):
+		return fmt.Errorf("%w: only memory stores are snapshotted", ErrInvalidConfig)
+	case c.Snapshot.File != "" && c.Snapshot.Interval <= 0:
+		return fmt.Errorf("%w: snapshots need a positive interval", ErrInvalidConfig)
+	case c.Sessions.Store != "" && !validSessionStore(c.Sessions.Store):
+		return fmt.Errorf("%w: session stores are memory:// or redis:// urls", ErrInvalidConfig)
+	case c.Sessions.MaxLifetime < 0 || c.Sessions.DeviceTokenTTL < 0:
+		return fmt.Errorf("%w: session lifetimes can't be negative", ErrInvalidConfig)
+	case c.Sessions.LogInHistory < 0:
+		return fmt.Errorf("%w: login history retention can't be negative", ErrInvalidConfig)
+	case c.Challenges.Store != "" && !validSessionStore(c.Challenges.Store):
+		return fmt.Errorf("%w: challenge stores are memory:// or redis:// urls", ErrInvalidConfig)
+	case c.Challenges.TTL <= 0 || c.Challenges.PurgeInterval <= 0:
+		return fmt.Errorf("%w: challenges need a positive ttl and purge interval", ErrInvalidConfig)
+	case c.Challenges.Mutator != "mirrored" && c.Challenges.Mutator != "pad" && c.Challenges.Mutator != "additive":
+		return fmt.Errorf("%w: unknown challenge mutator %q", ErrInvalidConfig, c.Challenges.Mutator)
+	case c.MasterKey != "" && !validMasterKey(c.MasterKey):
+		return fmt.Errorf("%w: master keys are 32 bytes of standard base64", ErrInvalidConfig)
+	case c.OPAQUEKey != "" && !validOPAQUEKey(c.OPAQUEKey):
+		return fmt.Errorf("%w: opaque keys are 64 bytes of standard base64", ErrInvalidConfig)
+	case c.SigningKey != "" && !validEd25519Key(c.SigningKey):
+		return fmt.Errorf("%w: signing keys are 32 byte Ed25519 seeds of standard base64", ErrInvalidConfig)
+	case c.MinProtocolVersion < 1:
+		return fmt.Errorf("%w: protocol versions start at 1", ErrInvalidConfig)
+	case c.IdempotencyTTL < 0:
+		return fmt.Errorf("%w: idempotency ttl can't be negative", ErrInvalidConfig)
+	case c.Client.ServerKey != "" && !validEd25519Key(c.Client.ServerKey):
+		return fmt.Errorf("%w: server keys are 32 byte Ed25519 public keys of standard base64", ErrInvalidConfig)
+	case c.Hashing.Pepper != "" && !validPepper(c.Hashing.Pepper):
+		return fmt.Errorf("%w: peppers are at least 16 bytes of standard base64", ErrInvalidConfig)
+	case c.Keys.Provider != "" && c.Keys.Provider != "vault" && c.Keys.Provider != "aws-kms" && c.Keys.Provider != "gcp-kms":
+		return fmt.Errorf("%w: unknown key provider %q", ErrInvalidConfig, c.Keys.Provider)
+	case c.Keys.Provider != "" && c.Keys.Refresh <= 0:
+		return fmt.Errorf("%w: key providers need a positive refresh interval", ErrInvalidConfig)
+	case c.Keys.Provider == "vault" && (c.Keys.VaultAddress == "" || c.Keys.VaultPath == ""):
+		return fmt.Errorf("%w: vault needs an address and a path", ErrInvalidConfig)
+	case c.Keys.Provider == "aws-kms" && c.Keys.AWSRegion == "":
+		return fmt.Errorf("%w: aws kms needs a region", ErrInvalidConfig)
+	case c.Keys.Provider == "gcp-kms" && c.Keys.GCPKey == "":
+		return fmt.Errorf("%w: gcp kms needs a key", ErrInvalidConfig)
+	case c.WebAuthn.RPID != "" && len(c.WebAuthn.Origins) == 0:
+		return fmt.Errorf("%w: webauthn needs at least one origin", ErrInvalidConfig)
+	case c.OIDC.Issuer != "" && !validURL(c.OIDC.Issuer):
+		return fmt.Errorf("%w: oidc issuers are absolute urls", ErrInvalidConfig)
+	case c.OIDC.LoginURL != "" && !validURL(c.OIDC.LoginURL):
+		return fmt.Errorf("%w: oidc login pages are absolute urls", ErrInvalidConfig)
+	case !validOIDCClients(c.OIDC.Clients):
+		return fmt.Errorf("%w: oidc clients need an id, a secret, and a redirect uri", ErrInvalidConfig)
+	case c.Mail.Mailer != "" && c.Mail.Mailer != "smtp" && c.Mail.Mailer != "log":
+		return fmt.Errorf("%w: unknown mailer %q", ErrInvalidConfig, c.Mail.Mailer)
+	case c.Mail.Mailer == "smtp" && (c.Mail.SMTPAddress == "" || c.Mail.From == ""):
+		return fmt.Errorf("%w: smtp needs an address and a from address", ErrInvalidConfig)
+	case c.Captcha.Provider != "" && c.Captcha.Provider != "hcaptcha" && c.Captcha.Provider != "recaptcha":
+		return fmt.Errorf("%w: unknown captcha provider %q", ErrInvalidConfig, c.Captcha.Provider)
+	case c.Captcha.MinScore < 0 || c.Captcha.MinScore > 1:
+		return fmt.Errorf("%w: captcha scores are between 0 and 1", ErrInvalidConfig)
+	case c.Captcha.AfterFailures < 0:
+		return fmt.Errorf("%w: negative captcha failure threshold", ErrInvalidConfig)
+	case c.Usernames.MinLength < 0 || c.Usernames.MaxLength < 0:
+		return fmt.Errorf("%w: negative username length", ErrInvalidConfig)
+	case c.Usernames.MaxLength > 0 && c.Usernames.MaxLength < c.Usernames.MinLength:
+		return fmt.Errorf("%w: username max length is below its min length", ErrInvalidConfig)
+	case !validPattern(c.Usernames.Pattern):
+		return fmt.Errorf("%w: username pattern isn't a regular expression", ErrInvalidConfig)
+	case c.Client.PasswordMinLength < 0:
+		return fmt.Errorf("%w: negative password length", ErrInvalidConfig)
+	case c.Client.PasswordMinClasses < 0 || c.Client.PasswordMinClasses > 4:
+		return fmt.Errorf("%w: password character classes are between 0 and 4", ErrInvalidConfig)
+	case c.Client.PasswordMinScore < 0 || c.Client.PasswordMinScore > 4:
+		return fmt.Errorf("%w: password scores are between 0 and 4", ErrInvalidConfig)
+	case c.Webhook.Retries < 0:
+		return fmt.Errorf("%w: negative webhook retries", ErrInvalidConfig)
+	case (c.TLS.CertFile == "") != (c.TLS.KeyFile == ""):
+		return fmt.Errorf("%w: tls needs both a certificate and a key", ErrInvalidConfig)
+	case c.TLS.HTTP3 && c.TLS.CertFile == "":
+		return fmt.Errorf("%w: http3 needs a tls certificate", ErrInvalidConfig)
+	case !validCORSOrigins(c.CORS.Origins, c.CORS.AllowCredentials):
+		return fmt.Errorf("%w: cors origins are absolute urls, or * without credentials", ErrInvalidConfig)
+	case c.CORS.MaxAge < 0:
+		return fmt.Errorf("%w: cors max age can't be negative", ErrInvalidConfig)
+	case c.SessionCookies.CSRF != "" && c.SessionCookies.CSRF != "double-submit" && c.SessionCookies.CSRF != "same-site":
+		return fmt.Errorf("%w: session cookie csrf is double-submit or same-site", ErrInvalidConfig)
+	case c.Transports.QUIC != "" && c.TLS.CertFile == "":
+		return fmt.Errorf("%w: quic logins need a tls certificate", ErrInvalidConfig)
+	case c.RequestTimeout < 0:
+		return fmt.Errorf("%w: negative request timeout", ErrInvalidConfig)
+	case c.RateLimit.RequestsPerSecond < 0:
+		return fmt.Errorf("%w: negative rate limit", ErrInvalidConfig)
+	case c.RateLimit.RequestsPerSecond > 0 && c.RateLimit.Burst < 1:
+		return fmt.Errorf("%w: rate limits need a positive burst", ErrInvalidConfig)
+	case c.RateLimit.MaxChallenges < 0:
+		return fmt.Errorf("%w: negative challenge limit", ErrInvalidConfig)
+	case c.RateLimit.RecoveryPerHour <= 0 || c.RateLimit.RecoveryBurst < 1:
+		return fmt.Errorf("%w: recovery logins need a positive rate limit and burst", ErrInvalidConfig)
+	case c.Secrets.MinBytes < 1 || c.Secrets.MaxBytes < c.Secrets.MinBytes:
+		return fmt.Errorf("%w: secrets need a positive minimum length no more than their maximum", ErrInvalidConfig)
+	case c.Secrets.GracePeriod < 0 || c.Secrets.MaxAge < 0:
+		return fmt.Errorf("%w: secrets need a grace period and max age of at least zero", ErrInvalidConfig)
+	case c.Secrets.MinSecurityLevel != 0 && c.Secrets.MinSecurityLevel != 80 && c.Secrets.MinSecurityLevel != 128:
+		return fmt.Errorf("%w: minimum security level %d is not 0, 80, or 128", ErrInvalidConfig, c.Secrets.MinSecurityLevel)
+	case c.Hashing.SaltBytes < 8:
+		return fmt.Errorf("%w: salts need at least 8 bytes", ErrInvalidConfig)
+	case c.Hashing.Hasher != "argon2id" && c.Hashing.Hasher != "fnv64":
+		return fmt.Errorf("%w: unknown hasher %q", ErrInvalidConfig, c.Hashing.Hasher)
+	case c.Hashing.Hasher == "argon2id" && (c.Hashing.Time == 0 || c.Hashing.Threads == 0):
+		return fmt.Errorf("%w: argon2id needs a positive time and thread count", ErrInvalidConfig)
+	case c.Circuits.MaxGates < 1 || c.Circuits.MaxDepth < 1 || c.Circuits.MaxInputBits < 1:
+		return fmt.Errorf("%w: circuit limits must be positive", ErrInvalidConfig)
+	case c.Circuits.MaxEvaluations < 0:
+		return fmt.Errorf("%w: concurrent circuit evaluations can't be negative", ErrInvalidConfig)
+	case c.Circuits.MaxCiphertextBits < 16*c.Secrets.MaxBytes:
+		return fmt.Errorf("%w: encrypted secrets of %d bytes need %d bits", ErrInvalidConfig, c.Secrets.MaxBytes, 16*c.Secrets.MaxBytes)
+	case c.Client.MessageBytes < 1:
+		return fmt.Errorf("%w: message length must be positive", ErrInvalidConfig)
+	}
+
+	for _, address := range c.ListenAddresses() {
+		if address == "" || address == "unix:" {
+			return fmt.Errorf("%w: listen address is empty", ErrInvalidConfig)
+		}
+	}
+
+	if u, err := url.Parse(c.Client.Server); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%w: server %q isn't an absolute url", ErrInvalidConfig, c.Client.Server)
+	}
+	if u, err := url.Parse(c.Webhook.URL); c.Webhook.URL != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+		return fmt.Errorf("%w: webhook %q isn't an absolute url", ErrInvalidConfig, c.Webhook.URL)
+	}
+
+	return nil
+}
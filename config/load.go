@@ -0,0 +1,248 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix prefixes the environment variable of every setting
+const envPrefix = "HAUTH_"
+
+// Scope selects the settings a command exposes as flags and environment variables
+type Scope uint8
+
+const (
+	// ServerScope selects the settings of hauth-server
+	ServerScope Scope = 1 << iota
+	// ClientScope selects the settings of the hauth command line client
+	ClientScope
+)
+
+// setting is a Config field that can be set from an environment variable or flag
+// Its environment variable is its flag name in upper case with dashes replaced by underscores, after envPrefix
+type setting struct {
+	flag  string
+	usage string
+	scope Scope
+	set   func(c *Config, value string) error
+}
+
+// bind returns a function that parses a value into a Config field
+func bind[T any](field func(c *Config) *T, parse func(value string) (T, error)) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := parse(value)
+		if err != nil {
+			return err
+		}
+
+		*field(c) = parsed
+		return nil
+	}
+}
+
+// parseString returns a value unchanged
+func parseString(value string) (string, error) {
+	return value, nil
+}
+
+// parseUint32 parses a 32 bit unsigned integer
+func parseUint32(value string) (uint32, error) {
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	return uint32(parsed), err
+}
+
+// parseUint8 parses an 8 bit unsigned integer
+func parseUint8(value string) (uint8, error) {
+	parsed, err := strconv.ParseUint(value, 10, 8)
+	return uint8(parsed), err
+}
+
+// parseInt parses a decimal integer
+func parseInt(value string) (int, error) {
+	return strconv.Atoi(value)
+}
+
+// parseFloat64 parses a floating point number
+func parseFloat64(value string) (float64, error) {
+	return strconv.ParseFloat(value, 64)
+}
+
+// parseList splits a comma separated list, where an empty value is an empty list
+func parseList(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	return strings.Split(value, ","), nil
+}
+
+// settings are every setting that can be set from an environment variable or flag
+var settings = []setting{
+	{"listen", "comma separated addresses to listen on, each host:port or unix:path", ServerScope, bind(func(c *Config) *string { return &c.Listen }, parseString)},
+	{"store", "user store to open, such as memory://", ServerScope, bind(func(c *Config) *string { return &c.Store }, parseString)},
+	{"snapshot-file", "file the memory store is loaded from and periodically saved to, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Snapshot.File }, parseString)},
+	{"snapshot-interval", "time between snapshots of a changed memory store, such as 1m", ServerScope, bind(func(c *Config) *time.Duration { return &c.Snapshot.Interval }, time.ParseDuration)},
+	{"session-store", "session store to open, such as memory:// or redis://localhost:6379/0", ServerScope, bind(func(c *Config) *string { return &c.Sessions.Store }, parseString)},
+	{"session-max-lifetime", "time after login up to which sessions' expiries slide as they are used, such as 12h, or 0 for fixed expiries", ServerScope, bind(func(c *Config) *time.Duration { return &c.Sessions.MaxLifetime }, time.ParseDuration)},
+	{"device-token-ttl", "time device tokens log users in on remembered devices for, such as 720h, or 0 to not remember devices", ServerScope, bind(func(c *Config) *time.Duration { return &c.Sessions.DeviceTokenTTL }, time.ParseDuration)},
+	{"login-history", "time users' login attempts are kept in their login history, such as 720h, or 0 to keep none", ServerScope, bind(func(c *Config) *time.Duration { return &c.Sessions.LogInHistory }, time.ParseDuration)},
+	{"challenge-store", "challenge store to open, such as memory:// or redis://localhost:6379/0", ServerScope, bind(func(c *Config) *string { return &c.Challenges.Store }, parseString)},
+	{"challenge-ttl", "time a login's challenge and nonce can be answered by its second login request, such as 5m", ServerScope, bind(func(c *Config) *time.Duration { return &c.Challenges.TTL }, time.ParseDuration)},
+	{"challenge-purge-interval", "time between purges of the challenges of abandoned logins, such as 1m", ServerScope, bind(func(c *Config) *time.Duration { return &c.Challenges.PurgeInterval }, time.ParseDuration)},
+	{"challenge-mutator", "how login challenges are constructed from stored secrets: mirrored, pad, or additive", ServerScope, bind(func(c *Config) *string { return &c.Challenges.Mutator }, parseString)},
+	{"tls-cert", "TLS certificate file, serving http when empty", ServerScope, bind(func(c *Config) *string { return &c.TLS.CertFile }, parseString)},
+	{"tls-key", "TLS key file", ServerScope, bind(func(c *Config) *string { return &c.TLS.KeyFile }, parseString)},
+	{"http3", "also serve HTTP/3 over QUIC, which needs a TLS certificate", ServerScope, bind(func(c *Config) *bool { return &c.TLS.HTTP3 }, strconv.ParseBool)},
+	{"login-tcp-listen", "host:port raw TCP login streams are served at, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Transports.TCP }, parseString)},
+	{"login-quic-listen", "host:port QUIC login streams are served at, which needs a TLS certificate, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Transports.QUIC }, parseString)},
+	{"login-grpc-listen", "host:port gRPC login streams are served at, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Transports.GRPC }, parseString)},
+	{"cors-origins", "comma separated origins whose pages may call the server from a browser, such as https://app.example.com, or * for every origin", ServerScope, bind(func(c *Config) *[]string { return &c.CORS.Origins }, parseList)},
+	{"cors-allow-credentials", "let allowed origins send cookies with their requests, which * can't", ServerScope, bind(func(c *Config) *bool { return &c.CORS.AllowCredentials }, strconv.ParseBool)},
+	{"session-cookie-csrf", "deliver sessions as cookies, with CSRF tokens delivered by double-submit or same-site", ServerScope, bind(func(c *Config) *string { return &c.SessionCookies.CSRF }, parseString)},
+	{"session-cookie-domain", "domain session cookies are sent to, such as example.com, or empty for only the server's host", ServerScope, bind(func(c *Config) *string { return &c.SessionCookies.Domain }, parseString)},
+	{"session-cookie-insecure", "let browsers send session cookies over plain HTTP, such as to localhost", ServerScope, bind(func(c *Config) *bool { return &c.SessionCookies.Insecure }, strconv.ParseBool)},
+	{"access-log", "log each request's method, path, status, latency, sizes, and request ID", ServerScope, bind(func(c *Config) *bool { return &c.AccessLog.Enabled }, strconv.ParseBool)},
+	{"access-log-bodies", "log each request's body too, for debugging, with all but fields known to hold no secrets, such as its username, redacted", ServerScope, bind(func(c *Config) *bool { return &c.AccessLog.Bodies }, strconv.ParseBool)},
+	{"cors-max-age", "time browsers may cache a preflight's result, such as 10m, or 0 to leave it to the browser", ServerScope, bind(func(c *Config) *time.Duration { return &c.CORS.MaxAge }, time.ParseDuration)},
+	{"request-timeout", "deadline for each request's encrypted work, such as 30s, or 0 for none", ServerScope, bind(func(c *Config) *time.Duration { return &c.RequestTimeout }, time.ParseDuration)},
+	{"admin-token", "bearer token of admin requests, such as exports and imports, or empty to disable them", ServerScope | ClientScope, bind(func(c *Config) *string { return &c.AdminToken }, parseString)},
+	{"master-key", "base64 encoded 32 byte key that users' secrets are sealed under, or empty to store them unsealed", ServerScope, bind(func(c *Config) *string { return &c.MasterKey }, parseString)},
+	{"opaque-key", "base64 encoded 64 byte key that OPAQUE users' OPRF keys and the server's OPAQUE key pair are derived from, or empty to disable OPAQUE", ServerScope, bind(func(c *Config) *string { return &c.OPAQUEKey }, parseString)},
+	{"signing-key", "base64 encoded 32 byte Ed25519 seed of the key login challenges are signed with, or empty to not sign them", ServerScope, bind(func(c *Config) *string { return &c.SigningKey }, parseString)},
+	{"min-protocol-version", "oldest protocol version logins are accepted in, such as 1 while clients that send no version are upgraded, which weakens replay protection", ServerScope, bind(func(c *Config) *int { return &c.MinProtocolVersion }, parseInt)},
+	{"idempotency-ttl", "time the outcome of a sign up with an Idempotency-Key header is returned to its retries, such as 24h, or 0 to ignore the header", ServerScope, bind(func(c *Config) *time.Duration { return &c.IdempotencyTTL }, time.ParseDuration)},
+	{"key-provider", "where server keys are fetched from, vault, aws-kms, or gcp-kms, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Keys.Provider }, parseString)},
+	{"key-refresh", "time between fetches of server keys, picking up rotations, such as 5m", ServerScope, bind(func(c *Config) *time.Duration { return &c.Keys.Refresh }, time.ParseDuration)},
+	{"vault-address", "url of the Vault server holding server keys, authenticated by VAULT_TOKEN", ServerScope, bind(func(c *Config) *string { return &c.Keys.VaultAddress }, parseString)},
+	{"vault-path", "API path of the Vault secret holding server keys, such as secret/data/hauth", ServerScope, bind(func(c *Config) *string { return &c.Keys.VaultPath }, parseString)},
+	{"aws-kms-region", "AWS KMS region that unwraps server keys", ServerScope, bind(func(c *Config) *string { return &c.Keys.AWSRegion }, parseString)},
+	{"gcp-kms-key", "resource name of the GCP Cloud KMS key that unwraps server keys", ServerScope, bind(func(c *Config) *string { return &c.Keys.GCPKey }, parseString)},
+	{"kms-endpoint", "endpoint overriding the KMS provider's default, such as an emulator", ServerScope, bind(func(c *Config) *string { return &c.Keys.Endpoint }, parseString)},
+	{"webauthn-rp-id", "WebAuthn relying party id that passkeys are registered with, such as example.com, or empty to disable passkeys", ServerScope, bind(func(c *Config) *string { return &c.WebAuthn.RPID }, parseString)},
+	{"webauthn-rp-name", "WebAuthn relying party name shown by authenticators", ServerScope, bind(func(c *Config) *string { return &c.WebAuthn.RPName }, parseString)},
+	{"oidc-issuer", "url the server is reached at, which serves an OpenID Connect provider in front of its logins, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.OIDC.Issuer }, parseString)},
+	{"oidc-key-file", "PEM file of the RSA key ID tokens are signed with, or empty to generate one at start", ServerScope, bind(func(c *Config) *string { return &c.OIDC.KeyFile }, parseString)},
+	{"oidc-login-url", "login page users without a session are sent to by OpenID Connect authorization requests", ServerScope, bind(func(c *Config) *string { return &c.OIDC.LoginURL }, parseString)},
+	{"webauthn-origins", "comma separated origins whose pages may register and use passkeys, such as https://login.example.com", ServerScope, bind(func(c *Config) *[]string { return &c.WebAuthn.Origins }, parseList)},
+	{"mailer", "how mail is sent, smtp or log, or empty to send none and not verify email addresses", ServerScope, bind(func(c *Config) *string { return &c.Mail.Mailer }, parseString)},
+	{"smtp-address", "host:port of the SMTP server mail is sent through", ServerScope, bind(func(c *Config) *string { return &c.Mail.SMTPAddress }, parseString)},
+	{"smtp-username", "username authenticating with the SMTP server, whose password is read from SMTP_PASSWORD, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Mail.SMTPUsername }, parseString)},
+	{"mail-from", "address mail is sent from", ServerScope, bind(func(c *Config) *string { return &c.Mail.From }, parseString)},
+	{"verify-url", "url linked to in verification mail with username and token query parameters, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Mail.VerifyURL }, parseString)},
+	{"webhook-url", "url auth events are posted to, signed with the HMAC-SHA256 key read from WEBHOOK_SECRET, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Webhook.URL }, parseString)},
+	{"webhook-retries", "times a failed webhook post is retried", ServerScope, bind(func(c *Config) *int { return &c.Webhook.Retries }, strconv.Atoi)},
+	{"captcha", "CAPTCHA provider, hcaptcha or recaptcha, whose secret is read from CAPTCHA_SECRET, or empty to require none", ServerScope, bind(func(c *Config) *string { return &c.Captcha.Provider }, parseString)},
+	{"captcha-site-key", "hCaptcha site key tokens must be solved for, or empty for any", ServerScope, bind(func(c *Config) *string { return &c.Captcha.SiteKey }, parseString)},
+	{"captcha-min-score", "minimum reCAPTCHA v3 score accepted", ServerScope, bind(func(c *Config) *float64 { return &c.Captcha.MinScore }, parseFloat64)},
+	{"captcha-signup", "require a CAPTCHA on every signup", ServerScope, bind(func(c *Config) *bool { return &c.Captcha.OnSignUp }, strconv.ParseBool)},
+	{"captcha-after-failures", "failed logins of a user or address after which logins require a CAPTCHA, or 0 for never", ServerScope, bind(func(c *Config) *int { return &c.Captcha.AfterFailures }, strconv.Atoi)},
+	{"username-normalize", "NFKC and PRECIS normalize usernames before storing or looking up users", ServerScope, bind(func(c *Config) *bool { return &c.Usernames.Normalize }, strconv.ParseBool)},
+	{"username-case-insensitive", "fold the case of normalized usernames, so Alice and alice are the same user", ServerScope, bind(func(c *Config) *bool { return &c.Usernames.CaseInsensitive }, strconv.ParseBool)},
+	{"username-min-length", "fewest characters in a normalized username", ServerScope, bind(func(c *Config) *int { return &c.Usernames.MinLength }, strconv.Atoi)},
+	{"username-max-length", "most characters in a normalized username, or 0 for unlimited", ServerScope, bind(func(c *Config) *int { return &c.Usernames.MaxLength }, strconv.Atoi)},
+	{"username-pattern", "regular expression normalized usernames must match, or empty for any", ServerScope, bind(func(c *Config) *string { return &c.Usernames.Pattern }, parseString)},
+	{"rate-limit", "requests per second allowed per client address, or 0 for unlimited", ServerScope, bind(func(c *Config) *float64 { return &c.RateLimit.RequestsPerSecond }, parseFloat64)},
+	{"rate-limit-burst", "requests allowed in a burst per client address", ServerScope, bind(func(c *Config) *int { return &c.RateLimit.Burst }, strconv.Atoi)},
+	{"max-challenges", "login challenges computed at once, or 0 for unlimited", ServerScope, bind(func(c *Config) *int { return &c.RateLimit.MaxChallenges }, strconv.Atoi)},
+	{"recovery-rate-limit", "recovery logins per hour allowed per user", ServerScope, bind(func(c *Config) *float64 { return &c.RateLimit.RecoveryPerHour }, parseFloat64)},
+	{"recovery-rate-limit-burst", "recovery logins allowed in a burst per user", ServerScope, bind(func(c *Config) *int { return &c.RateLimit.RecoveryBurst }, strconv.Atoi)},
+	{"min-secret-bytes", "length of the shortest secret clients can enroll, in bytes", ServerScope, bind(func(c *Config) *int { return &c.Secrets.MinBytes }, strconv.Atoi)},
+	{"max-secret-bytes", "length of the longest secret clients can enroll, in bytes", ServerScope, bind(func(c *Config) *int { return &c.Secrets.MaxBytes }, strconv.Atoi)},
+	{"secret-grace-period", "time a secret replaced by a password change still logs in, so logins begun before it can finish, such as 10m, or 0 for none", ServerScope, bind(func(c *Config) *time.Duration { return &c.Secrets.GracePeriod }, time.ParseDuration)},
+	{"min-security-level", "fewest estimated bits of security of the parameter sets secrets are enrolled and logged in under: 0, 80, or 128", ServerScope, bind(func(c *Config) *int { return &c.Secrets.MinSecurityLevel }, strconv.Atoi)},
+	{"secret-max-age", "time after a secret is enrolled that logins require its rotation, such as 2160h for 90 days, or 0 for never", ServerScope, bind(func(c *Config) *time.Duration { return &c.Secrets.MaxAge }, time.ParseDuration)},
+	{"salt-bytes", "length of each user's salt", ServerScope, bind(func(c *Config) *int { return &c.Hashing.SaltBytes }, strconv.Atoi)},
+	{"hasher", "secret hasher, argon2id or fnv64", ServerScope, bind(func(c *Config) *string { return &c.Hashing.Hasher }, parseString)},
+	{"hash-time", "argon2id passes", ServerScope, bind(func(c *Config) *uint32 { return &c.Hashing.Time }, parseUint32)},
+	{"hash-memory", "argon2id memory in KiB", ServerScope, bind(func(c *Config) *uint32 { return &c.Hashing.Memory }, parseUint32)},
+	{"hash-threads", "argon2id threads", ServerScope, bind(func(c *Config) *uint8 { return &c.Hashing.Threads }, parseUint8)},
+	{"pepper", "base64 encoded pepper of at least 16 bytes mixed into secrets before they're hashed, or empty for none", ServerScope, bind(func(c *Config) *string { return &c.Hashing.Pepper }, parseString)},
+	{"max-gates", "most gates in an evaluated circuit", ServerScope, bind(func(c *Config) *int { return &c.Circuits.MaxGates }, strconv.Atoi)},
+	{"max-depth", "deepest evaluated circuit", ServerScope, bind(func(c *Config) *int { return &c.Circuits.MaxDepth }, strconv.Atoi)},
+	{"max-input-bits", "most input bits in an evaluated circuit, across all its inputs", ServerScope, bind(func(c *Config) *int { return &c.Circuits.MaxInputBits }, strconv.Atoi)},
+	{"max-evaluations", "circuits evaluated at once, or 0 for unlimited", ServerScope, bind(func(c *Config) *int { return &c.Circuits.MaxEvaluations }, strconv.Atoi)},
+	{"max-ciphertext-bits", "most bits in an uploaded encrypted secret or circuit input", ServerScope, bind(func(c *Config) *int { return &c.Circuits.MaxCiphertextBits }, strconv.Atoi)},
+	{"server", "base url of the service", ClientScope, bind(func(c *Config) *string { return &c.Client.Server }, parseString)},
+	{"message-bytes", "length of the secret the service stores, in bytes", ClientScope, bind(func(c *Config) *int { return &c.Client.MessageBytes }, strconv.Atoi)},
+	{"dir", "directory for cached keys and sessions, defaulting to ~/.config/hauth", ClientScope, bind(func(c *Config) *string { return &c.Client.Dir }, parseString)},
+	{"password-min-length", "fewest characters in a password signed up with", ClientScope, bind(func(c *Config) *int { return &c.Client.PasswordMinLength }, strconv.Atoi)},
+	{"password-min-classes", "fewest of lowercase letters, uppercase letters, digits, and symbols in a password signed up with", ClientScope, bind(func(c *Config) *int { return &c.Client.PasswordMinClasses }, strconv.Atoi)},
+	{"password-min-score", "lowest estimated strength, from 0 to 4, of a password signed up with", ClientScope, bind(func(c *Config) *int { return &c.Client.PasswordMinScore }, strconv.Atoi)},
+	{"password-warn-only", "warn about passwords that break the password policy instead of refusing them", ClientScope, bind(func(c *Config) *bool { return &c.Client.PasswordWarnOnly }, strconv.ParseBool)},
+	{"srp", "sign up, reset passwords, and log in with SRP instead of FHE keys, for devices that can't afford key generation", ClientScope, bind(func(c *Config) *bool { return &c.Client.SRP }, strconv.ParseBool)},
+	{"opaque", "sign up, reset passwords, and log in with OPAQUE instead of FHE keys, on servers with an OPAQUE key", ClientScope, bind(func(c *Config) *bool { return &c.Client.OPAQUE }, strconv.ParseBool)},
+	{"remember-device", "remember this device at login, and log in with its device token while the server accepts it", ClientScope, bind(func(c *Config) *bool { return &c.Client.RememberDevice }, strconv.ParseBool)},
+	{"server-key", "base64 encoded Ed25519 public key the server signs login challenges with, served at /server-key, which logins then require, or empty to not check", ClientScope, bind(func(c *Config) *string { return &c.Client.ServerKey }, parseString)},
+}
+
+// env returns a setting's environment variable
+func (s setting) env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.flag, "-", "_"))
+}
+
+// loadEnv overrides a Config with the environment variables of a scope's settings
+func (c *Config) loadEnv(scope Scope) error {
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env())
+		if !ok || s.scope&scope == 0 {
+			continue
+		}
+
+		if err := s.set(c, value); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, s.env(), err)
+		}
+	}
+
+	return nil
+}
+
+// Load registers a scope's settings and -config as flags, parses the arguments, and returns the validated Config they describe
+// Defaults are overridden by the file named by -config or HAUTH_CONFIG, then environment variables, then flags
+func Load(flags *flag.FlagSet, args []string, scope Scope) (*Config, error) {
+	path := flags.String("config", os.Getenv(envPrefix+"CONFIG"), "path to a YAML config file (env "+envPrefix+"CONFIG)")
+
+	var flagged []func(c *Config)
+	for _, s := range settings {
+		if s.scope&scope == 0 {
+			continue
+		}
+
+		s := s
+		flags.Func(s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env()), func(value string) error {
+			if err := s.set(Default(), value); err != nil {
+				return err
+			}
+
+			flagged = append(flagged, func(c *Config) {
+				s.set(c, value)
+			})
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+	if *path != "" {
+		if err := c.LoadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadEnv(scope); err != nil {
+		return nil, err
+	}
+	for _, set := range flagged {
+		set(c)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,179 @@
+//go:build tfhe_cgo && cgo
+
+package crypto
+
+/*
+#cgo LDFLAGS: -ltfhe-spqlios-fma
+#include <stdlib.h>
+#include <string.h>
+#include <tfhe/tfhe.h>
+
+enum { HAUTH_AND, HAUTH_OR, HAUTH_XOR, HAUTH_XNOR, HAUTH_NAND, HAUTH_NOR, HAUTH_MUX, HAUTH_REFRESH };
+
+// hauth_set_bk copies one polynomial of a bootstrapping key row
+static void hauth_set_bk(LweBootstrappingKey* bk, int32_t i, int32_t row, int32_t poly, const int32_t* coefs, double variance) {
+	TLweSample* s = &bk->bk[i].all_sample[row];
+	memcpy(s->a[poly].coefsT, coefs, bk->accum_params->N * sizeof(int32_t));
+	s->current_variance = variance;
+}
+
+// hauth_set_ks copies one sample of a key switching key
+static void hauth_set_ks(LweBootstrappingKey* bk, int32_t i, int32_t j, int32_t k, const int32_t* a, int32_t b, double variance) {
+	LweSample* s = &bk->ks->ks[i][j][k];
+	memcpy(s->a, a, bk->ks->out_params->n * sizeof(int32_t));
+	s->b = b;
+	s->current_variance = variance;
+}
+
+// hauth_gate evaluates a gate on samples flattened as their mask followed by their body
+static void hauth_gate(const TFheGateBootstrappingCloudKeySet* cloud, int op, int32_t* out, double* variances, const int32_t* a, const int32_t* b, const int32_t* c) {
+	const LweParams* params = cloud->params->in_out_params;
+	int32_t n = params->n;
+	LweSample* samples = new_LweSample_array(4, params);
+	const int32_t* inputs[3] = {a, b, c};
+	for (int i = 0; i < 3; i++) {
+		if (inputs[i] != NULL) {
+			memcpy(samples[i + 1].a, inputs[i], n * sizeof(int32_t));
+			samples[i + 1].b = inputs[i][n];
+			samples[i + 1].current_variance = variances[i + 1];
+		}
+	}
+
+	switch (op) {
+	case HAUTH_AND: bootsAND(&samples[0], &samples[1], &samples[2], cloud); break;
+	case HAUTH_OR: bootsOR(&samples[0], &samples[1], &samples[2], cloud); break;
+	case HAUTH_XOR: bootsXOR(&samples[0], &samples[1], &samples[2], cloud); break;
+	case HAUTH_XNOR: bootsXNOR(&samples[0], &samples[1], &samples[2], cloud); break;
+	case HAUTH_NAND: bootsNAND(&samples[0], &samples[1], &samples[2], cloud); break;
+	case HAUTH_NOR: bootsNOR(&samples[0], &samples[1], &samples[2], cloud); break;
+	case HAUTH_MUX: bootsMUX(&samples[0], &samples[1], &samples[2], &samples[3], cloud); break;
+	case HAUTH_REFRESH: tfhe_bootstrap_FFT(&samples[0], cloud->bkFFT, modSwitchToTorus32(1, 8), &samples[1]); break;
+	}
+
+	memcpy(out, samples[0].a, n * sizeof(int32_t));
+	out[n] = samples[0].b;
+	variances[0] = samples[0].current_variance;
+	delete_LweSample_array(4, samples);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"runtime"
+	"unsafe"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+type (
+	// cKeySet is a public key converted for the C TFHE library
+	cKeySet struct {
+		params *C.TFheGateBootstrappingParameterSet
+		cloud  *C.TFheGateBootstrappingCloudKeySet
+	}
+
+	// cEvaluator is an Evaluator for one public key that bootstraps gates with the C TFHE library
+	// Gates that don't bootstrap are cheap, so they're still executed by a CPUEvaluator
+	cEvaluator struct {
+		keys *cKeySet
+	}
+)
+
+// accelerate returns a Packet made from a public key whose bootstrapped gates run in the C TFHE library
+func accelerate(p *Packet) *Packet {
+	return p.WithEvaluator(&cEvaluator{keys: makeCKeySet(p.pub)})
+}
+
+// makeCKeySet copies a go-tfhe public key's parameters, bootstrapping key, and key switching key into the C TFHE library
+// The C key set is freed once the returned cKeySet is garbage collected
+func makeCKeySet(pk *gates.PublicKey) *cKeySet {
+	p := pk.Params
+	tlwe := p.TgswParams.TlweParams
+	inOutParams := C.new_LweParams(C.int32_t(p.InOutParams.N), C.double(p.InOutParams.AlphaMin), C.double(p.InOutParams.AlphaMax))
+	tlweParams := C.new_TLweParams(C.int32_t(tlwe.N), C.int32_t(tlwe.K), C.double(tlwe.AlphaMin), C.double(tlwe.AlphaMax))
+	tgswParams := C.new_TGswParams(C.int32_t(p.TgswParams.L), C.int32_t(p.TgswParams.Bgbit), tlweParams)
+	params := C.new_TFheGateBootstrappingParameterSet(C.int32_t(p.KsT), C.int32_t(p.KsBasebit), inOutParams, tgswParams)
+
+	bk := C.new_LweBootstrappingKey(C.int32_t(p.KsT), C.int32_t(p.KsBasebit), inOutParams, tgswParams)
+	for i, tgsw := range pk.Bkw.Bk.Bk {
+		for row := range tgsw.AllSample {
+			sample := &tgsw.AllSample[row]
+			for poly := range sample.A {
+				C.hauth_set_bk(bk, C.int32_t(i), C.int32_t(row), C.int32_t(poly), (*C.int32_t)(unsafe.Pointer(&sample.A[poly].Coefs[0])), C.double(sample.CurrentVariance))
+			}
+		}
+	}
+	for i := range pk.Bkw.Bk.Ks.Ks {
+		for j := range pk.Bkw.Bk.Ks.Ks[i] {
+			for k, sample := range pk.Bkw.Bk.Ks.Ks[i][j] {
+				C.hauth_set_ks(bk, C.int32_t(i), C.int32_t(j), C.int32_t(k), (*C.int32_t)(unsafe.Pointer(&sample.A[0])), C.int32_t(sample.B), C.double(sample.CurrentVariance))
+			}
+		}
+	}
+
+	keys := &cKeySet{
+		params: params,
+		cloud:  C.new_TFheGateBootstrappingCloudKeySet(params, bk, C.new_LweBootstrappingKeyFFT(bk)),
+	}
+	runtime.SetFinalizer(keys, func(keys *cKeySet) {
+		C.delete_gate_bootstrapping_cloud_keyset(keys.cloud)
+		C.delete_gate_bootstrapping_parameters(keys.params)
+	})
+
+	return keys
+}
+
+// cOps are the C TFHE gates for the Ops that bootstrap
+var cOps = map[Op]C.int{
+	OpAnd:     C.HAUTH_AND,
+	OpOr:      C.HAUTH_OR,
+	OpXor:     C.HAUTH_XOR,
+	OpXNor:    C.HAUTH_XNOR,
+	OpNand:    C.HAUTH_NAND,
+	OpNor:     C.HAUTH_NOR,
+	OpMux:     C.HAUTH_MUX,
+	OpRefresh: C.HAUTH_REFRESH,
+}
+
+// Evaluate executes a C TFHE gate on each bit of a batch in parallel, until the context is done
+func (ce *cEvaluator) Evaluate(ctx context.Context, pk *gates.PublicKey, op Op, operands ...gates.Ctxt) gates.Ctxt {
+	cOp, ok := cOps[op]
+	if !ok {
+		return CPUEvaluator{}.Evaluate(ctx, pk, op, operands...)
+	}
+
+	n := checkOperands(op, operands)
+	result := make(gates.Ctxt, n)
+	parallelForContext(ctx, n, func(i int) {
+		inputs := make([]*core.LweSample, len(operands))
+		for j, operand := range operands {
+			inputs[j] = operand[i]
+		}
+		result[i] = ce.gate(int(pk.Params.InOutParams.N), cOp, inputs)
+	})
+
+	return result
+}
+
+// gate evaluates a C TFHE gate on samples of dimension n
+func (ce *cEvaluator) gate(n int, op C.int, inputs []*core.LweSample) *core.LweSample {
+	out := make([]int32, n+1)
+	variances := make([]C.double, 4)
+	flat := make([]*C.int32_t, 3)
+	for i, sample := range inputs {
+		in := append(append(make([]int32, 0, n+1), sample.A...), sample.B)
+		flat[i] = (*C.int32_t)(unsafe.Pointer(&in[0]))
+		variances[i+1] = C.double(sample.CurrentVariance)
+	}
+
+	C.hauth_gate(ce.keys.cloud, op, (*C.int32_t)(unsafe.Pointer(&out[0])), &variances[0], flat[0], flat[1], flat[2])
+	runtime.KeepAlive(ce.keys)
+
+	return &core.LweSample{
+		A:               out[:n],
+		B:               out[n],
+		CurrentVariance: float64(variances[0]),
+	}
+}
@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// Encrypted integers are little endian bit vectors, as produced by Encrypt, and are unsigned
+
+// Add uses a Packet's public key to add two encrypted integers of equal width
+// The result is one bit wider than the inputs, so it never overflows
+func (p *Packet) Add(a, b gates.Ctxt) gates.Ctxt {
+	propagate := p.Xor(a, b)
+	generate := p.And(a, b)
+
+	result := make(gates.Ctxt, len(a)+1)
+	carry := p.pub.Constant(false)
+	defer p.observeGates(len(propagate), time.Now(), OpXor, OpAnd, OpOr)
+	for i := range propagate {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			result[i] = p.pub.Xor(propagate[i], carry)
+		}()
+
+		carried := carry
+		go func() {
+			defer wg.Done()
+
+			carried = p.pub.Or(generate[i], p.pub.And(carry, propagate[i]))
+		}()
+
+		wg.Wait()
+		carry = carried
+	}
+	result[len(a)] = carry
+
+	return result
+}
+
+// PopCount uses a Packet's public key to count the set bits of an encrypted payload
+// The result is an encrypted integer just wide enough to hold len(a)
+func (p *Packet) PopCount(a gates.Ctxt) gates.Ctxt {
+	width := bits.Len(uint(len(a)))
+	if width == 0 {
+		return gates.Ctxt{p.pub.Constant(false)}
+	}
+
+	counts := make([]gates.Ctxt, len(a))
+	for i := range a {
+		counts[i] = gates.Ctxt{a[i]}
+	}
+
+	for len(counts) > 1 {
+		next := make([]gates.Ctxt, (len(counts)+1)/2)
+
+		var wg sync.WaitGroup
+		wg.Add(len(counts) / 2)
+		for i := 0; i+1 < len(counts); i += 2 {
+			i := i
+			go func() {
+				defer wg.Done()
+
+				x, y := counts[i], counts[i+1]
+				w := max(len(x), len(y))
+				next[i/2] = p.Add(p.extend(x, w), p.extend(y, w))
+			}()
+		}
+		if len(counts)%2 == 1 {
+			next[len(next)-1] = counts[len(counts)-1]
+		}
+
+		wg.Wait()
+		counts = next
+	}
+
+	return p.extend(counts[0], width)[:width]
+}
+
+// HammingDistance uses a Packet's public key to count the differing bits of two encrypted payloads of equal length
+// The result is an encrypted integer just wide enough to hold len(a)
+func (p *Packet) HammingDistance(a, b gates.Ctxt) gates.Ctxt {
+	return p.PopCount(p.Xor(a, b))
+}
+
+// extend zero extends an encrypted integer to a width, leaving wider integers unchanged
+func (p *Packet) extend(a gates.Ctxt, width int) gates.Ctxt {
+	if len(a) >= width {
+		return a
+	}
+
+	result := make(gates.Ctxt, width)
+	copy(result, a)
+	for i := len(a); i < width; i++ {
+		result[i] = p.pub.Constant(false)
+	}
+
+	return result
+}
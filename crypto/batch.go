@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// bitIndex locates a bit within a batch of payloads
+type bitIndex struct {
+	payload int
+	bit     int
+}
+
+// EncryptAll uses a Packet's private key to encrypt many payloads
+// Every bit of every payload is encrypted on one shared worker pool, rather than a pool per payload
+// Packets without a private key return ErrNoPrivateKey
+func (p *Packet) EncryptAll(payloads [][]byte) ([]gates.Ctxt, error) {
+	if err := p.checkPrivate(); err != nil {
+		return nil, err
+	}
+
+	results := make([]gates.Ctxt, len(payloads))
+	var indices []bitIndex
+	for i, payload := range payloads {
+		results[i] = make(gates.Ctxt, 8*len(payload))
+		for j := range results[i] {
+			indices = append(indices, bitIndex{payload: i, bit: j})
+		}
+	}
+
+	defer p.observeEncrypt(len(indices), time.Now())
+	parallelFor(len(indices), func(k int) {
+		i, j := indices[k].payload, indices[k].bit
+		results[i][j] = p.prv.BootsSymEncrypt(int(payloads[i][j/8]>>(j%8)) & 0x1)
+	})
+
+	return results, nil
+}
+
+// DecryptAll uses a Packet's private key to decrypt many encrypted payloads
+// Every bit of every payload is decrypted on one shared worker pool, then packed as Decrypt would
+// Packets without a private key return ErrNoPrivateKey
+func (p *Packet) DecryptAll(encryptedPayloads []gates.Ctxt) ([][]byte, error) {
+	if err := p.checkPrivate(); err != nil {
+		return nil, err
+	}
+
+	bits := make([][]int, len(encryptedPayloads))
+	var indices []bitIndex
+	for i, encryptedPayload := range encryptedPayloads {
+		bits[i] = make([]int, len(encryptedPayload))
+		for j := range encryptedPayload {
+			indices = append(indices, bitIndex{payload: i, bit: j})
+		}
+	}
+
+	start := time.Now()
+	parallelFor(len(indices), func(k int) {
+		i, j := indices[k].payload, indices[k].bit
+		bits[i][j] = p.prv.BootsSymDecrypt(encryptedPayloads[i][j])
+	})
+	p.observeDecrypt(len(indices), start)
+
+	results := make([][]byte, len(encryptedPayloads))
+	for i := range bits {
+		results[i] = packBits(bits[i])
+	}
+
+	return results, nil
+}
+
+// packBits packs decrypted bits into bytes with the same layout as Decrypt
+// The final partial byte is filled from its most significant bit, matching Decrypt's shifting
+func packBits(bits []int) []byte {
+	result := make([]byte, (len(bits)+7)/8)
+	if len(result) == 0 {
+		return nil
+	}
+
+	i := 0
+	for j := 0; ; j++ {
+		for k := 0; k < 8; k++ {
+			result[j] = (result[j] >> 1) | (byte(bits[i]) << 7)
+			i++
+
+			if i >= len(bits) {
+				return result
+			}
+		}
+	}
+}
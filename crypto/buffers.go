@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"sync"
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/thedonutfactory/go-tfhe/types"
+)
+
+// samplePool holds released samples for reuse by encryptions, whatever their parameter set
+var samplePool sync.Pool
+
+// getSample returns a sample sized for a parameter set, reusing a released sample when one is large enough
+// Its contents are stale, so it must be overwritten before use
+func getSample(params *core.LweParams) *core.LweSample {
+	if sample, ok := samplePool.Get().(*core.LweSample); ok && cap(sample.A) >= int(params.N) {
+		sample.A = sample.A[:params.N]
+		return sample
+	}
+
+	return core.NewLweSample(params)
+}
+
+// Release returns an encrypted payload's samples to a pool for reuse by later encryptions
+// Neither the payload nor any payload sharing its samples may be used afterwards
+func Release(ctxt gates.Ctxt) {
+	for i, sample := range ctxt {
+		if sample != nil {
+			samplePool.Put(sample)
+			ctxt[i] = nil
+		}
+	}
+}
+
+// encryptBit uses a Packet's private key to encrypt a bit into an existing sample, like go-tfhe's BootsSymEncrypt
+func (p *Packet) encryptBit(dst *core.LweSample, bit int) {
+	mu := types.ModSwitchToTorus32(1, 8)
+	if bit == 0 {
+		mu = -mu
+	}
+
+	core.LweSymEncrypt(dst, mu, p.prv.Params.InOutParams.AlphaMin, p.prv.LweKey)
+}
+
+// resizeCtxt returns an encrypted payload of n samples that reuses dst's backing array, and any samples in it, when it is large enough
+func resizeCtxt(dst gates.Ctxt, n int) gates.Ctxt {
+	if cap(dst) >= n {
+		return dst[:n]
+	}
+
+	resized := make(gates.Ctxt, n)
+	copy(resized, dst[:cap(dst)])
+	return resized
+}
+
+// EncryptInto uses a Packet's private key to encrypt a payload into dst, reusing its samples, and returns the resized dst
+// Missing samples are taken from those released with Release, so a server encrypting many payloads of one size allocates little
+// Packets without a private key return ErrNoPrivateKey
+func (p *Packet) EncryptInto(dst gates.Ctxt, payload []byte) (gates.Ctxt, error) {
+	if err := p.checkPrivate(); err != nil {
+		return nil, err
+	}
+	defer p.observeEncrypt(8*len(payload), time.Now())
+
+	dst = resizeCtxt(dst, 8*len(payload))
+	params := p.prv.LweKey.Params
+	pt := newProgressTracker(p.progress)
+	pt.stage(0, 1, len(dst))
+	for i := range dst {
+		if dst[i] == nil || len(dst[i].A) != int(params.N) {
+			dst[i] = getSample(params)
+		}
+		p.encryptBit(dst[i], int(payload[i/8]>>(i%8))&1)
+		pt.advance()
+	}
+	pt.finish()
+
+	return dst, nil
+}
+
+// DecryptInto uses a Packet's private key to decrypt a payload into dst, and returns the resized dst
+// Bytes are packed like Decrypt, so a final partial byte holds its bits in its most significant positions
+// Packets without a private key return ErrNoPrivateKey
+func (p *Packet) DecryptInto(dst []byte, encryptedPayload gates.Ctxt) ([]byte, error) {
+	if err := p.checkPrivate(); err != nil {
+		return nil, err
+	}
+	defer p.observeDecrypt(len(encryptedPayload), time.Now())
+
+	n := (len(encryptedPayload) + 7) / 8
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:n]
+	clear(dst)
+
+	for i, sample := range encryptedPayload {
+		shift := i % 8
+		if lastBits := len(encryptedPayload) - i/8*8; lastBits < 8 {
+			shift += 8 - lastBits
+		}
+		dst[i/8] |= byte(p.prv.BootsSymDecrypt(sample)) << shift
+	}
+
+	return dst, nil
+}
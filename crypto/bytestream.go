@@ -3,37 +3,112 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/sha256"
 	"encoding/binary"
-	"hash/fnv"
-	"math/rand"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/hkdf"
+)
+
+// hkdfSalt separates this package's HKDF derivations from any other use of the same key
+var hkdfSalt = []byte("homomorphic-authentication bytestream")
+
+type (
+	// ByteSource is a source of bytes for key generation, such as a ByteStream
+	ByteSource interface {
+		NextBytes(n int) []byte
+	}
+
+	// forker is a ByteSource that can derive independent child streams
+	forker interface {
+		Fork(label string) *ByteStream
+	}
+
+	// ByteStream is used to generate a stream of bytes
+	ByteStream struct {
+		stream    cipher.Stream
+		prk       []byte
+		newStream func(prk []byte) cipher.Stream
+	}
 )
 
-// ByteStream is used to generate a stream of bytes
-type ByteStream struct {
-	stream cipher.Stream
+// expand returns n bytes derived from a pseudorandom key for a labelled purpose
+func expand(prk []byte, info string, n int) []byte {
+	result := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte(info)), result); err != nil {
+		panic(err)
+	}
+
+	return result
+}
+
+// aesCTR returns an AES-CTR stream keyed from a pseudorandom key
+func aesCTR(prk []byte) cipher.Stream {
+	material := expand(prk, "aes-ctr", 32+aes.BlockSize)
+	block, err := aes.NewCipher(material[:32])
+	if err != nil {
+		panic(err)
+	}
+
+	return cipher.NewCTR(block, material[32:])
+}
+
+// chaCha20 returns a ChaCha20 stream keyed from a pseudorandom key
+func chaCha20(prk []byte) cipher.Stream {
+	material := expand(prk, "chacha20", chacha20.KeySize+chacha20.NonceSize)
+	stream, err := chacha20.NewUnauthenticatedCipher(material[:chacha20.KeySize], material[chacha20.KeySize:])
+	if err != nil {
+		panic(err)
+	}
+
+	return stream
+}
+
+// makeByteStream returns a ByteStream from a pseudorandom key and a stream constructor
+func makeByteStream(prk []byte, newStream func(prk []byte) cipher.Stream) *ByteStream {
+	return &ByteStream{
+		stream:    newStream(prk),
+		prk:       prk,
+		newStream: newStream,
+	}
 }
 
 // MakeByteStream returns a ByteStream initialized by key
 func MakeByteStream(key []byte) *ByteStream {
-	seed1Hash := fnv.New128()
-	seed1Hash.Write(append(key, 0))
-	seed1 := seed1Hash.Sum(nil)
+	return makeByteStream(hkdf.Extract(sha256.New, key, hkdfSalt), aesCTR)
+}
 
-	seed2Hash := fnv.New128()
-	seed2Hash.Write(append(key, 1))
-	seed2 := seed2Hash.Sum(nil)
+// MakeChaChaByteStream returns a ByteStream initialized by key, backed by ChaCha20 rather than AES-CTR
+// It is faster on platforms without AES instructions
+func MakeChaChaByteStream(key []byte) *ByteStream {
+	return makeByteStream(hkdf.Extract(sha256.New, key, hkdfSalt), chaCha20)
+}
 
-	block, err := aes.NewCipher(seed1)
+// MakeRandByteStream returns a ByteStream initialized by a random value from the DefaultEntropySource
+func MakeRandByteStream() *ByteStream {
+	byteStream, err := MakeEntropyByteStream(DefaultEntropySource)
 	if err != nil {
 		panic(err)
 	}
 
-	return &ByteStream{stream: cipher.NewCTR(block, seed2)}
+	return byteStream
 }
 
-// MakeRandByteStream returns a ByteStream initialized by a random value
-func MakeRandByteStream() *ByteStream {
-	return MakeByteStream(binary.LittleEndian.AppendUint64(nil, rand.Uint64()))
+// MakeEntropyByteStream returns a ByteStream initialized by a random value from an EntropySource
+func MakeEntropyByteStream(source EntropySource) (*ByteStream, error) {
+	key, err := readEntropy(source, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	return MakeByteStream(key), nil
+}
+
+// Fork returns a child ByteStream for a label, independent of its parent's and siblings' output
+// Children depend only on the parent's key and the label, never on how much of the parent has been read
+func (cbs *ByteStream) Fork(label string) *ByteStream {
+	return makeByteStream(expand(cbs.prk, "fork "+label, sha256.Size), cbs.newStream)
 }
 
 // NextBytes returns a ByteStream's next n bytes
@@ -47,3 +122,36 @@ func (cbs *ByteStream) NextBytes(n int) []byte {
 func (cbs *ByteStream) NextByte() byte {
 	return cbs.NextBytes(1)[0]
 }
+
+// Read fills b with a ByteStream's next len(b) bytes, so a ByteStream is an io.Reader that never fails
+func (cbs *ByteStream) Read(b []byte) (int, error) {
+	clear(b)
+	cbs.stream.XORKeyStream(b, b)
+	return len(b), nil
+}
+
+// NextUint32 returns a ByteStream's next 4 bytes as a little endian uint32
+func (cbs *ByteStream) NextUint32() uint32 {
+	return binary.LittleEndian.Uint32(cbs.NextBytes(4))
+}
+
+// NextUint64 returns a ByteStream's next 8 bytes as a little endian uint64
+func (cbs *ByteStream) NextUint64() uint64 {
+	return binary.LittleEndian.Uint64(cbs.NextBytes(8))
+}
+
+// NextIntn returns a uniformly random int in [0, n) from a ByteStream, and panics if n <= 0
+// Values that would bias the result towards small numbers are rejected and redrawn
+func (cbs *ByteStream) NextIntn(n int) int {
+	if n <= 0 {
+		panic("expected positive bound")
+	}
+
+	bound := uint64(n)
+	threshold := -bound % bound
+	for {
+		if v := cbs.NextUint64(); v >= threshold {
+			return int(v % bound)
+		}
+	}
+}
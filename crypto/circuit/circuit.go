@@ -0,0 +1,349 @@
+// Package circuit provides a builder for boolean circuits over encrypted bits
+// Circuits are declared symbolically, then evaluated against ciphertexts with independent gates run in parallel
+package circuit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+// Op is the operation performed by a gate
+type Op string
+
+const (
+	OpInput    Op = "input"
+	OpConstant Op = "constant"
+	OpCopy     Op = "copy"
+	OpNot      Op = "not"
+	OpAnd      Op = "and"
+	OpOr       Op = "or"
+	OpXor      Op = "xor"
+	OpXNor     Op = "xnor"
+	OpNand     Op = "nand"
+	OpNor      Op = "nor"
+	OpMux      Op = "mux"
+)
+
+var (
+	ErrMissingInput = errors.New("missing circuit input")
+	ErrInputWidth   = errors.New("circuit input has the wrong width")
+)
+
+type (
+	// Wire is a single bit in a Circuit, identified by the index of the gate that drives it
+	Wire int
+
+	// Wires is a little endian vector of bits in a Circuit
+	Wires []Wire
+
+	// gate is a single node in a Circuit
+	gate struct {
+		Op     Op
+		Inputs []Wire
+		Name   string
+		Index  int
+		Value  bool
+	}
+
+	// Circuit is a boolean circuit declared from named inputs, gates, and named outputs
+	Circuit struct {
+		gates       []gate
+		inputWidths map[string]int
+		outputs     map[string]Wires
+	}
+)
+
+// New returns an empty Circuit
+func New() *Circuit {
+	return &Circuit{
+		inputWidths: map[string]int{},
+		outputs:     map[string]Wires{},
+	}
+}
+
+// add appends a gate to a Circuit and returns the Wire it drives
+func (c *Circuit) add(g gate) Wire {
+	c.gates = append(c.gates, g)
+	return Wire(len(c.gates) - 1)
+}
+
+// Input declares a named input of a width in bits
+// Declaring the same name twice returns the same Wires, and panics if the widths differ
+func (c *Circuit) Input(name string, width int) Wires {
+	if w, ok := c.inputWidths[name]; ok {
+		if w != width {
+			panic("expected equal bit size")
+		}
+
+		result := make(Wires, width)
+		for i, g := range c.gates {
+			if g.Op == OpInput && g.Name == name {
+				result[g.Index] = Wire(i)
+			}
+		}
+		return result
+	}
+
+	c.inputWidths[name] = width
+	result := make(Wires, width)
+	for i := range result {
+		result[i] = c.add(gate{Op: OpInput, Name: name, Index: i})
+	}
+
+	return result
+}
+
+// Constant declares a trivially encrypted integer of a width in bits
+func (c *Circuit) Constant(value uint64, width int) Wires {
+	result := make(Wires, width)
+	for i := range result {
+		result[i] = c.add(gate{Op: OpConstant, Value: i < 64 && (value>>i)&1 == 1})
+	}
+
+	return result
+}
+
+// Output declares a named output, replacing any previous output with the same name
+func (c *Circuit) Output(name string, w Wires) {
+	c.outputs[name] = w
+}
+
+// unary declares a gate per bit of a with an operation
+func (c *Circuit) unary(op Op, a Wires) Wires {
+	result := make(Wires, len(a))
+	for i := range a {
+		result[i] = c.add(gate{Op: op, Inputs: []Wire{a[i]}})
+	}
+
+	return result
+}
+
+// binary declares a gate per bit pair of a and b with an operation
+func (c *Circuit) binary(op Op, a, b Wires) Wires {
+	if len(a) != len(b) {
+		panic("expected equal bit size")
+	}
+
+	result := make(Wires, len(a))
+	for i := range a {
+		result[i] = c.add(gate{Op: op, Inputs: []Wire{a[i], b[i]}})
+	}
+
+	return result
+}
+
+// Copy declares a bitwise Copy
+func (c *Circuit) Copy(a Wires) Wires {
+	return c.unary(OpCopy, a)
+}
+
+// Not declares a bitwise Not
+func (c *Circuit) Not(a Wires) Wires {
+	return c.unary(OpNot, a)
+}
+
+// And declares a bitwise And
+func (c *Circuit) And(a, b Wires) Wires {
+	return c.binary(OpAnd, a, b)
+}
+
+// Or declares a bitwise Or
+func (c *Circuit) Or(a, b Wires) Wires {
+	return c.binary(OpOr, a, b)
+}
+
+// Xor declares a bitwise Xor
+func (c *Circuit) Xor(a, b Wires) Wires {
+	return c.binary(OpXor, a, b)
+}
+
+// XNor declares a bitwise XNor
+func (c *Circuit) XNor(a, b Wires) Wires {
+	return c.binary(OpXNor, a, b)
+}
+
+// Nand declares a bitwise Nand
+func (c *Circuit) Nand(a, b Wires) Wires {
+	return c.binary(OpNand, a, b)
+}
+
+// Nor declares a bitwise Nor
+func (c *Circuit) Nor(a, b Wires) Wires {
+	return c.binary(OpNor, a, b)
+}
+
+// Mux declares a bitwise multiplexer, selecting a where s is set and b elsewhere
+func (c *Circuit) Mux(s, a, b Wires) Wires {
+	if len(s) != len(a) || len(a) != len(b) {
+		panic("expected equal bit size")
+	}
+
+	result := make(Wires, len(a))
+	for i := range a {
+		result[i] = c.add(gate{Op: OpMux, Inputs: []Wire{s[i], a[i], b[i]}})
+	}
+
+	return result
+}
+
+// Size returns the number of bootstrapped gates in a Circuit, which dominates its evaluation cost
+func (c *Circuit) Size() int {
+	size := 0
+	for _, g := range c.gates {
+		if bootstrapped(g.Op) {
+			size++
+		}
+	}
+
+	return size
+}
+
+// Depth returns the longest chain of bootstrapped gates in a Circuit
+func (c *Circuit) Depth() int {
+	depth := 0
+	for _, level := range c.levels() {
+		depth = max(depth, level)
+	}
+
+	return depth
+}
+
+// bootstrapped returns whether an operation requires a gate bootstrapping
+func bootstrapped(op Op) bool {
+	switch op {
+	case OpInput, OpConstant, OpCopy, OpNot:
+		return false
+	default:
+		return true
+	}
+}
+
+// levels returns the number of bootstrapped gates preceding each gate's output, including itself
+// Gates are only ever declared after their inputs, so a single pass suffices
+func (c *Circuit) levels() []int {
+	levels := make([]int, len(c.gates))
+	for i, g := range c.gates {
+		for _, in := range g.Inputs {
+			levels[i] = max(levels[i], levels[in])
+		}
+		if bootstrapped(g.Op) {
+			levels[i]++
+		}
+	}
+
+	return levels
+}
+
+// schedule groups gates into waves, such that each gate only depends on gates in earlier waves
+func (c *Circuit) schedule() [][]int {
+	waves := make([]int, len(c.gates))
+	var schedule [][]int
+	for i, g := range c.gates {
+		for _, in := range g.Inputs {
+			waves[i] = max(waves[i], waves[in]+1)
+		}
+		if waves[i] == len(schedule) {
+			schedule = append(schedule, nil)
+		}
+		schedule[waves[i]] = append(schedule[waves[i]], i)
+	}
+
+	return schedule
+}
+
+// Evaluate uses a Scheme, such as a Packet made from a public key, to evaluate a Circuit against encrypted inputs, returning its encrypted outputs
+// Gates within a wave of the schedule are evaluated in parallel
+func (c *Circuit) Evaluate(scheme crypto.Scheme, inputs map[string]gates.Ctxt) (map[string]gates.Ctxt, error) {
+	return c.EvaluateCtx(context.Background(), scheme, inputs)
+}
+
+// EvaluateCtx is Evaluate that stops between waves once a context is done, returning its error
+func (c *Circuit) EvaluateCtx(ctx context.Context, scheme crypto.Scheme, inputs map[string]gates.Ctxt) (map[string]gates.Ctxt, error) {
+	for name, width := range c.inputWidths {
+		input, ok := inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingInput, name)
+		}
+		if len(input) != width {
+			return nil, fmt.Errorf("%w: %s has %d bits, expected %d", ErrInputWidth, name, len(input), width)
+		}
+	}
+
+	scheme = scheme.WithContext(ctx)
+	values := make([]*core.LweSample, len(c.gates))
+	for _, wave := range c.schedule() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(len(wave))
+		for _, i := range wave {
+			i := i
+			go func() {
+				defer wg.Done()
+
+				values[i] = c.evaluateGate(scheme, c.gates[i], values, inputs)
+			}()
+		}
+
+		wg.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string]gates.Ctxt, len(c.outputs))
+	for name, w := range c.outputs {
+		output := make(gates.Ctxt, len(w))
+		for i, wire := range w {
+			output[i] = values[wire]
+		}
+		outputs[name] = output
+	}
+
+	return outputs, nil
+}
+
+// evaluateGate evaluates a single gate whose inputs have already been evaluated
+func (c *Circuit) evaluateGate(scheme crypto.Scheme, g gate, values []*core.LweSample, inputs map[string]gates.Ctxt) *core.LweSample {
+	in := func(i int) gates.Ctxt {
+		return gates.Ctxt{values[g.Inputs[i]]}
+	}
+
+	var result gates.Ctxt
+	switch g.Op {
+	case OpInput:
+		return inputs[g.Name][g.Index]
+	case OpConstant:
+		result = scheme.Constant([]bool{g.Value})
+	case OpCopy:
+		result = scheme.Copy(in(0))
+	case OpNot:
+		result = scheme.Not(in(0))
+	case OpAnd:
+		result = scheme.And(in(0), in(1))
+	case OpOr:
+		result = scheme.Or(in(0), in(1))
+	case OpXor:
+		result = scheme.Xor(in(0), in(1))
+	case OpXNor:
+		result = scheme.XNor(in(0), in(1))
+	case OpNand:
+		result = scheme.Nand(in(0), in(1))
+	case OpNor:
+		result = scheme.Nor(in(0), in(1))
+	case OpMux:
+		result = scheme.Mux(in(0), in(1), in(2))
+	default:
+		panic("unknown circuit operation " + string(g.Op))
+	}
+
+	return result[0]
+}
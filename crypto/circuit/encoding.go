@@ -0,0 +1,208 @@
+package circuit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMalformed = errors.New("malformed circuit")
+	ErrTooLarge  = errors.New("circuit has too many gates")
+	ErrTooDeep   = errors.New("circuit is too deep")
+	ErrTooWide   = errors.New("circuit has too many input bits")
+)
+
+type (
+	// Limits bounds the cost of evaluating a Circuit, zero values are unlimited
+	Limits struct {
+		MaxGates int
+		MaxDepth int
+		// MaxInputBits bounds the widths of a Circuit's inputs added together
+		MaxInputBits int
+	}
+
+	// jsonGate is the json version of a gate
+	jsonGate struct {
+		Op     Op     `json:"Op"`
+		Inputs []Wire `json:"Inputs,omitempty"`
+		Name   string `json:"Name,omitempty"`
+		Index  int    `json:"Index,omitempty"`
+		Value  bool   `json:"Value,omitempty"`
+	}
+
+	// jsonCircuit is the json version of a Circuit
+	jsonCircuit struct {
+		Gates   []jsonGate       `json:"Gates"`
+		Inputs  map[string]int   `json:"Inputs"`
+		Outputs map[string]Wires `json:"Outputs"`
+	}
+)
+
+// arity returns the number of inputs expected by an operation, or -1 if the operation is unknown
+func arity(op Op) int {
+	switch op {
+	case OpInput, OpConstant:
+		return 0
+	case OpCopy, OpNot:
+		return 1
+	case OpAnd, OpOr, OpXor, OpXNor, OpNand, OpNor:
+		return 2
+	case OpMux:
+		return 3
+	default:
+		return -1
+	}
+}
+
+// inputBits returns the widths of inputs added together, or an error if any is negative or they exceed a bound,
+// checked as they are added so huge widths can't overflow
+func inputBits(widths map[string]int, bound int) (int, error) {
+	total := 0
+	for name, width := range widths {
+		if width < 0 {
+			return 0, fmt.Errorf("%w: input %s has negative width", ErrMalformed, name)
+		} else if width > bound-total {
+			return 0, fmt.Errorf("%w: more than %d", ErrTooWide, bound)
+		}
+		total += width
+	}
+
+	return total, nil
+}
+
+// Check returns an error if a Circuit exceeds any of the limits
+func (c *Circuit) Check(limits Limits) error {
+	if limits.MaxGates > 0 && len(c.gates) > limits.MaxGates {
+		return fmt.Errorf("%w: %d > %d", ErrTooLarge, len(c.gates), limits.MaxGates)
+	}
+
+	if limits.MaxInputBits > 0 {
+		if _, err := inputBits(c.inputWidths, limits.MaxInputBits); err != nil {
+			return err
+		}
+	}
+
+	if depth := c.Depth(); limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return fmt.Errorf("%w: %d > %d", ErrTooDeep, depth, limits.MaxDepth)
+	}
+
+	return nil
+}
+
+// Decode returns the Circuit encoded in json data, or an error if it is malformed or exceeds any of the limits
+// The gate count and input widths are checked before the gates are decoded into a Circuit
+func Decode(data []byte, limits Limits) (*Circuit, error) {
+	var jc jsonCircuit
+	if err := json.Unmarshal(data, &jc); err != nil {
+		return nil, err
+	}
+
+	if limits.MaxGates > 0 && len(jc.Gates) > limits.MaxGates {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooLarge, len(jc.Gates), limits.MaxGates)
+	}
+	if limits.MaxInputBits > 0 {
+		if _, err := inputBits(jc.Inputs, limits.MaxInputBits); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := jc.circuit()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, c.Check(limits)
+}
+
+// MarshalJSON returns the json encoding of a Circuit
+func (c *Circuit) MarshalJSON() ([]byte, error) {
+	jc := jsonCircuit{
+		Gates:   make([]jsonGate, len(c.gates)),
+		Inputs:  c.inputWidths,
+		Outputs: c.outputs,
+	}
+	for i, g := range c.gates {
+		jc.Gates[i] = jsonGate(g)
+	}
+
+	return json.Marshal(&jc)
+}
+
+// UnmarshalJSON decodes a json encoded Circuit without limits, use Decode for untrusted data
+func (c *Circuit) UnmarshalJSON(data []byte) error {
+	var jc jsonCircuit
+	if err := json.Unmarshal(data, &jc); err != nil {
+		return err
+	}
+
+	decoded, err := jc.circuit()
+	if err != nil {
+		return err
+	}
+
+	*c = *decoded
+	return nil
+}
+
+// circuit returns the Circuit described by a jsonCircuit, or an error if it is malformed
+// Gates may only consume earlier gates, so a well formed Circuit is always acyclic
+// Every input bit is read by its own gate, so inputs wider than the gates added together are malformed, and rejected before their bits are tracked
+func (jc *jsonCircuit) circuit() (*Circuit, error) {
+	if _, err := inputBits(jc.Inputs, len(jc.Gates)); errors.Is(err, ErrTooWide) {
+		return nil, fmt.Errorf("%w: inputs are wider than the circuit's %d gates", ErrMalformed, len(jc.Gates))
+	} else if err != nil {
+		return nil, err
+	}
+
+	c := New()
+	seen := map[string][]bool{}
+	for name, width := range jc.Inputs {
+		c.inputWidths[name] = width
+		seen[name] = make([]bool, width)
+	}
+
+	c.gates = make([]gate, len(jc.Gates))
+	for i, g := range jc.Gates {
+		if n := arity(g.Op); n < 0 {
+			return nil, fmt.Errorf("%w: gate %d has unknown operation %q", ErrMalformed, i, g.Op)
+		} else if len(g.Inputs) != n {
+			return nil, fmt.Errorf("%w: gate %d has %d inputs, expected %d", ErrMalformed, i, len(g.Inputs), n)
+		}
+
+		for _, in := range g.Inputs {
+			if in < 0 || int(in) >= i {
+				return nil, fmt.Errorf("%w: gate %d consumes gate %d", ErrMalformed, i, in)
+			}
+		}
+
+		if g.Op == OpInput {
+			bits, ok := seen[g.Name]
+			if !ok || g.Index < 0 || g.Index >= len(bits) || bits[g.Index] {
+				return nil, fmt.Errorf("%w: gate %d is an undeclared input %s[%d]", ErrMalformed, i, g.Name, g.Index)
+			}
+			bits[g.Index] = true
+		}
+
+		c.gates[i] = gate(g)
+	}
+
+	for name, bits := range seen {
+		for i, ok := range bits {
+			if !ok {
+				return nil, fmt.Errorf("%w: input %s[%d] has no gate", ErrMalformed, name, i)
+			}
+		}
+	}
+
+	for name, w := range jc.Outputs {
+		for _, wire := range w {
+			if wire < 0 || int(wire) >= len(c.gates) {
+				return nil, fmt.Errorf("%w: output %s consumes gate %d", ErrMalformed, name, wire)
+			}
+		}
+		c.outputs[name] = w
+	}
+
+	return c, nil
+}
@@ -1,2 +1,13 @@
 // Package crypto provides cryptographic primitives for the homomorphic authentication protocol
+//
+// # Noise
+//
+// Every encrypted bit carries noise, and decrypts correctly while its noise stays well below 1/16 of the torus
+//   - Encrypt produces fresh samples whose noise has the parameter set's minimum standard deviation
+//   - Not, Copy, and the shifts and rotations leave noise unchanged
+//   - And, Or, Xor, XNor, and every operation built from them bootstrap their output, so its noise is fixed by the parameter set regardless of the inputs' noise
+//   - Refresh bootstraps without changing the encrypted bit, resetting the noise of samples that have not passed through a bootstrapped gate
+//
+// Chains of bootstrapped gates, such as Add and PopCount, therefore stay decryptable at any depth as long as each gate's inputs do
+// NoiseEstimate and Validate report the tracked noise, so a service can check a computation before returning it
 package crypto
@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// EncBytes is an encrypted byte string, stored as eight encrypted bits per byte from least to most significant
+type EncBytes gates.Ctxt
+
+// Len returns the number of bytes in an EncBytes
+func (eb EncBytes) Len() int {
+	return len(eb) / 8
+}
+
+// EncryptBytes uses a Packet's private key to encrypt a payload into an EncBytes
+func (p *Packet) EncryptBytes(payload []byte) (EncBytes, error) {
+	ctxt, err := p.Encrypt(payload)
+	return EncBytes(ctxt), err
+}
+
+// DecryptBytes uses a Packet's private key to decrypt an EncBytes
+func (p *Packet) DecryptBytes(eb EncBytes) ([]byte, error) {
+	return p.Decrypt(gates.Ctxt(eb))
+}
+
+// EqualsAll uses a Packet's public key to compare two EncBytes, returning a single encrypted bit that is set iff every byte is equal
+// EncBytes of different lengths are never equal, and compare to a trivial encryption of false
+func (p *Packet) EqualsAll(a, b EncBytes) *core.LweSample {
+	if len(a) != len(b) {
+		return p.pub.Constant(false)
+	}
+
+	return p.AndAll(p.XNor(gates.Ctxt(a), gates.Ctxt(b)))
+}
+
+// AndAll uses a Packet's public key to reduce an encrypted payload to a single encrypted bit with And
+// The reduction is a balanced tree, so each level is evaluated in parallel
+func (p *Packet) AndAll(a gates.Ctxt) *core.LweSample {
+	return p.reduce(p.And, true)(a)
+}
+
+// OrAll uses a Packet's public key to reduce an encrypted payload to a single encrypted bit with Or
+// The reduction is a balanced tree, so each level is evaluated in parallel
+func (p *Packet) OrAll(a gates.Ctxt) *core.LweSample {
+	return p.reduce(p.Or, false)(a)
+}
+
+// reduce returns a function that folds an encrypted payload with a parallel binary operation, returning identity if it is empty
+func (p *Packet) reduce(operation func(a, b gates.Ctxt) gates.Ctxt, identity bool) func(a gates.Ctxt) *core.LweSample {
+	return func(a gates.Ctxt) *core.LweSample {
+		if len(a) == 0 {
+			return p.pub.Constant(identity)
+		}
+
+		for len(a) > 1 {
+			half := len(a) / 2
+			next := operation(a[:half], a[half:2*half])
+			if len(a)%2 == 1 {
+				next = append(next, a[2*half])
+			}
+			a = next
+		}
+
+		return a[0]
+	}
+}
@@ -0,0 +1,30 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// EntropySource is a source of unpredictable bytes, such as crypto/rand.Reader
+type EntropySource interface {
+	Read(b []byte) (int, error)
+}
+
+// DefaultEntropySource is the EntropySource used for random streams, salts, and shares, defaulting to crypto/rand
+// Replacing it with a deterministic source makes those reproducible for tests, and must never be done otherwise
+var DefaultEntropySource EntropySource = rand.Reader
+
+// MakeDeterministicEntropySource returns a reproducible EntropySource initialized by seed, for tests only
+func MakeDeterministicEntropySource(seed []byte) EntropySource {
+	return MakeByteStream(seed)
+}
+
+// readEntropy returns n bytes from an EntropySource
+func readEntropy(source EntropySource, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(source, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
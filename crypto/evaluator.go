@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// Op is a gate executed by an Evaluator
+type Op uint8
+
+const (
+	OpAnd Op = iota
+	OpOr
+	OpXor
+	OpXNor
+	OpNand
+	OpNor
+	// OpMux takes a selector, then the operands selected where it's set and where it's not
+	OpMux
+	OpNot
+	OpCopy
+	// OpRefresh bootstraps its operand, resetting its noise without changing its value
+	OpRefresh
+)
+
+type (
+	// Evaluator executes a gate on a batch of bits under a public key, so a Packet's gates can be offloaded to accelerators such as GPUs
+	// Every operand has one sample per bit, and bit i of the result is the gate applied to bit i of each operand
+	// Once the context is done, bits may be left nil, and the result must be discarded
+	Evaluator interface {
+		Evaluate(ctx context.Context, pk *gates.PublicKey, op Op, operands ...gates.Ctxt) gates.Ctxt
+	}
+
+	// CPUEvaluator is the default Evaluator, executing go-tfhe gates on a pool of at most GOMAXPROCS goroutines
+	CPUEvaluator struct{}
+)
+
+// Arity returns the number of operands an Op takes
+func (op Op) Arity() int {
+	switch op {
+	case OpNot, OpCopy, OpRefresh:
+		return 1
+	case OpMux:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// String returns the name of an Op, such as And, for labeling metrics
+func (op Op) String() string {
+	switch op {
+	case OpAnd:
+		return "And"
+	case OpOr:
+		return "Or"
+	case OpXor:
+		return "Xor"
+	case OpXNor:
+		return "XNor"
+	case OpNand:
+		return "Nand"
+	case OpNor:
+		return "Nor"
+	case OpMux:
+		return "Mux"
+	case OpNot:
+		return "Not"
+	case OpCopy:
+		return "Copy"
+	case OpRefresh:
+		return "Refresh"
+	default:
+		return fmt.Sprintf("Op(%d)", op)
+	}
+}
+
+// Evaluate executes a go-tfhe gate on each bit of a batch in parallel, until the context is done
+func (CPUEvaluator) Evaluate(ctx context.Context, pk *gates.PublicKey, op Op, operands ...gates.Ctxt) gates.Ctxt {
+	n := checkOperands(op, operands)
+	result := make(gates.Ctxt, n)
+	parallelForContext(ctx, n, func(i int) {
+		result[i] = cpuGate(pk, op, operands, i)
+	})
+
+	return result
+}
+
+// checkOperands returns the bit size of a batch, panicking if it has the wrong number of operands or their sizes differ
+func checkOperands(op Op, operands []gates.Ctxt) int {
+	if len(operands) != op.Arity() {
+		panic("expected operand per gate input")
+	}
+	for _, operand := range operands[1:] {
+		if len(operand) != len(operands[0]) {
+			panic("expected equal bit size")
+		}
+	}
+
+	return len(operands[0])
+}
+
+// cpuGate executes a go-tfhe gate on bit i of its operands
+func cpuGate(pk *gates.PublicKey, op Op, operands []gates.Ctxt, i int) *core.LweSample {
+	switch op {
+	case OpAnd:
+		return pk.And(operands[0][i], operands[1][i])
+	case OpOr:
+		return pk.Or(operands[0][i], operands[1][i])
+	case OpXor:
+		return pk.Xor(operands[0][i], operands[1][i])
+	case OpXNor:
+		return pk.Xnor(operands[0][i], operands[1][i])
+	case OpNand:
+		return pk.Nand(operands[0][i], operands[1][i])
+	case OpNor:
+		return pk.Nor(operands[0][i], operands[1][i])
+	case OpMux:
+		return pk.Mux(operands[0][i], operands[1][i], operands[2][i])
+	case OpNot:
+		return pk.Not(operands[0][i])
+	case OpCopy:
+		return pk.Copy(operands[0][i])
+	case OpRefresh:
+		return bootstrap(pk, operands[0][i])
+	default:
+		panic("unknown gate")
+	}
+}
+
+// WithEvaluator returns a copy of a Packet whose gates are executed by an Evaluator
+func (p *Packet) WithEvaluator(evaluator Evaluator) *Packet {
+	copied := *p
+	copied.evaluator = evaluator
+	return &copied
+}
+
+// WithContext returns a copy of a Packet whose gates stop early once a context is done, such as when a request's client disconnects
+// Results of gates evaluated after the context is done have nil bits, and must be discarded
+func (p *Packet) WithContext(ctx context.Context) Scheme {
+	copied := *p
+	copied.ctx = ctx
+	return &copied
+}
+
+// context returns a Packet's context, or the background context if it has none
+func (p *Packet) context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+
+	return p.ctx
+}
+
+// evaluate executes a gate with a Packet's Evaluator, or a CPUEvaluator if it has none
+// Once the Packet's context is done, nothing is executed, so results with nil bits are never operated on
+func (p *Packet) evaluate(op Op, operands ...gates.Ctxt) gates.Ctxt {
+	if p.destroyed {
+		panic(ErrPacketDestroyed)
+	}
+
+	ctx := p.context()
+	if ctx.Err() != nil {
+		return make(gates.Ctxt, checkOperands(op, operands))
+	}
+
+	defer p.observeGates(len(operands[0]), time.Now(), op)
+	if p.evaluator == nil {
+		return CPUEvaluator{}.Evaluate(ctx, p.pub, op, operands...)
+	}
+
+	return p.evaluator.Evaluate(ctx, p.pub, op, operands...)
+}
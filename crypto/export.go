@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// packetExportVersion is the current version of the Packet export format
+const packetExportVersion = 1
+
+var ErrUnsupportedExport = errors.New("unsupported packet export")
+
+// exportedPacket is the gob encoded export format of a Packet, holding its public key and the bits of its private keys
+type exportedPacket struct {
+	Version   int
+	PublicKey *PublicKey
+	LweKey    []int32
+	TlweKey   [][]int32
+}
+
+// Export writes a Packet's keys to a writer, so it can be imported without generating them again
+// The export holds the private key, so it must be stored as carefully as the password it was derived from
+func (p *Packet) Export(w io.Writer) error {
+	export := exportedPacket{
+		Version:   packetExportVersion,
+		PublicKey: MakePublicKey(p.pub),
+	}
+	if p.prv != nil {
+		export.LweKey = p.prv.LweKey.Key
+		for _, polynomial := range p.prv.TgswKey.TlweKey.Key {
+			export.TlweKey = append(export.TlweKey, polynomial.Coefs)
+		}
+	}
+
+	return gob.NewEncoder(w).Encode(&export)
+}
+
+// ImportPacket reads a Packet exported by Export
+func ImportPacket(r io.Reader) (*Packet, error) {
+	var export exportedPacket
+	if err := gob.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedExport, err)
+	}
+
+	if export.Version != packetExportVersion || export.PublicKey == nil || export.PublicKey.Params == nil {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedExport, export.Version)
+	}
+
+	packet := MakePublicPacket(export.PublicKey)
+	if export.LweKey == nil {
+		return packet, nil
+	}
+
+	params := packet.pub.Params
+	lweKey := core.NewLweKey(params.InOutParams)
+	tgswKey := core.NewTGswKey(params.TgswParams)
+	if len(export.LweKey) != len(lweKey.Key) || len(export.TlweKey) != len(tgswKey.TlweKey.Key) {
+		return nil, fmt.Errorf("%w: private key doesn't match its parameters", ErrUnsupportedExport)
+	}
+
+	lweKey.Key = export.LweKey
+	for i, coefs := range export.TlweKey {
+		if len(coefs) != len(tgswKey.TlweKey.Key[i].Coefs) {
+			return nil, fmt.Errorf("%w: private key doesn't match its parameters", ErrUnsupportedExport)
+		}
+		copy(tgswKey.TlweKey.Key[i].Coefs, coefs)
+	}
+
+	packet.prv = gates.NewPrivateKey(params, packet.pub.Bkw, lweKey, tgswKey)
+	return packet, nil
+}
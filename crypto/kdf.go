@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// kdfSaltByteLen is the length of a generated KDF salt
+	kdfSaltByteLen = 16
+	// kdfKeyByteLen is the length of a stretched password
+	kdfKeyByteLen = 32
+	// minKDFMemory is the least memory in KiB parameters may use, and minKDFCost the least memory times passes, OWASP's minimum of two passes over 19 MiB
+	minKDFMemory = 19 * 1024
+	minKDFCost   = 2 * minKDFMemory
+	// maxKDFMemory bounds the memory in KiB a client spends on parameters chosen by a server
+	maxKDFMemory = 1 << 20
+	// maxKDFTime bounds the passes a client spends on parameters chosen by a server
+	maxKDFTime = 16
+)
+
+var ErrInvalidKDFParams = errors.New("invalid key derivation parameters")
+
+// KDFParams are the Argon2id parameters used to stretch a password before deriving a key stream from it
+type KDFParams struct {
+	Salt    []byte `json:"Salt"`
+	Time    uint32 `json:"Time"`
+	Memory  uint32 `json:"Memory"`
+	Threads uint8  `json:"Threads"`
+}
+
+// MakeKDFParams returns KDFParams with a random salt and the recommended Argon2id cost of one pass over 64 MiB with 4 threads
+func MakeKDFParams() (*KDFParams, error) {
+	salt, err := readEntropy(DefaultEntropySource, kdfSaltByteLen)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KDFParams{
+		Salt:    salt,
+		Time:    1,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}, nil
+}
+
+// Check returns an error if KDFParams are too weak to protect a password, costing less than OWASP's minimum for Argon2id, or too costly to be worth computing
+func (kp *KDFParams) Check() error {
+	switch {
+	case kp == nil:
+		return fmt.Errorf("%w: missing", ErrInvalidKDFParams)
+	case len(kp.Salt) < kdfSaltByteLen:
+		return fmt.Errorf("%w: salt has %d bytes, expected at least %d", ErrInvalidKDFParams, len(kp.Salt), kdfSaltByteLen)
+	case kp.Time < 1 || kp.Time > maxKDFTime:
+		return fmt.Errorf("%w: time %d is outside [1, %d]", ErrInvalidKDFParams, kp.Time, maxKDFTime)
+	case kp.Threads < 1:
+		return fmt.Errorf("%w: no threads", ErrInvalidKDFParams)
+	case kp.Memory < minKDFMemory || kp.Memory < 8*uint32(kp.Threads) || kp.Memory > maxKDFMemory:
+		return fmt.Errorf("%w: memory %d KiB is outside [%d, %d]", ErrInvalidKDFParams, kp.Memory, max(minKDFMemory, 8*uint32(kp.Threads)), maxKDFMemory)
+	case uint64(kp.Memory)*uint64(kp.Time) < minKDFCost:
+		return fmt.Errorf("%w: %d passes over %d KiB cost less than %d passes over %d KiB", ErrInvalidKDFParams, kp.Time, kp.Memory, minKDFCost/minKDFMemory, minKDFMemory)
+	}
+
+	return nil
+}
+
+// Stretch returns a password stretched with Argon2id, or an error if KDFParams fail Check
+func Stretch(password []byte, params *KDFParams) ([]byte, error) {
+	if err := params.Check(); err != nil {
+		return nil, err
+	}
+
+	return argon2.IDKey(password, params.Salt, params.Time, params.Memory, params.Threads, kdfKeyByteLen), nil
+}
+
+// MakePasswordByteStream returns a ByteStream initialized by a password stretched with Argon2id
+func MakePasswordByteStream(password []byte, params *KDFParams) (*ByteStream, error) {
+	key, err := Stretch(password, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return MakeByteStream(key), nil
+}
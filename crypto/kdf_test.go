@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKDFParamsCheck(t *testing.T) {
+	salt := make([]byte, kdfSaltByteLen)
+	for _, test := range []struct {
+		name   string
+		params *KDFParams
+		valid  bool
+	}{
+		{"default", &KDFParams{Salt: salt, Time: 1, Memory: 64 * 1024, Threads: 4}, true},
+		{"OWASP minimum", &KDFParams{Salt: salt, Time: 2, Memory: 19 * 1024, Threads: 1}, true},
+		{"one pass over 19 MiB", &KDFParams{Salt: salt, Time: 1, Memory: 19 * 1024, Threads: 1}, false},
+		{"many passes over little memory", &KDFParams{Salt: salt, Time: 16, Memory: 8 * 1024, Threads: 1}, false},
+		{"short salt", &KDFParams{Salt: salt[1:], Time: 1, Memory: 64 * 1024, Threads: 4}, false},
+		{"no threads", &KDFParams{Salt: salt, Time: 1, Memory: 64 * 1024}, false},
+		{"too costly", &KDFParams{Salt: salt, Time: maxKDFTime + 1, Memory: 64 * 1024, Threads: 4}, false},
+		{"missing", nil, false},
+	} {
+		err := test.params.Check()
+		if test.valid && err != nil {
+			t.Errorf("%s: Check returned %v", test.name, err)
+		} else if !test.valid && !errors.Is(err, ErrInvalidKDFParams) {
+			t.Errorf("%s: Check returned %v, want %v", test.name, err, ErrInvalidKDFParams)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package crypto
+
+import "time"
+
+// Metrics receives the cost of a Packet's operations, so applications can attribute CPU time per operation type without wrapping every call
+// Each method is called once per operation, after it finishes, possibly from many goroutines at once
+// Gates executed together in one pass, such as by a Pipeline or Add's carry chain, split the pass's time evenly
+type Metrics interface {
+	// GatesEvaluated is called after a gate is executed on a batch of bits
+	GatesEvaluated(op Op, bits int, elapsed time.Duration)
+	// BitsEncrypted is called after bits are encrypted with a Packet's private key
+	BitsEncrypted(bits int, elapsed time.Duration)
+	// BitsDecrypted is called after bits are decrypted with a Packet's private key
+	BitsDecrypted(bits int, elapsed time.Duration)
+}
+
+// WithMetrics returns a copy of a Packet whose operations are reported to Metrics
+func (p *Packet) WithMetrics(metrics Metrics) *Packet {
+	copied := *p
+	copied.metrics = metrics
+	return &copied
+}
+
+// observeGates reports gates executed on a batch of bits in one pass since a time to a Packet's Metrics, if it has any
+func (p *Packet) observeGates(bits int, start time.Time, ops ...Op) {
+	if p.metrics == nil || len(ops) == 0 {
+		return
+	}
+
+	elapsed := time.Since(start) / time.Duration(len(ops))
+	for _, op := range ops {
+		p.metrics.GatesEvaluated(op, bits, elapsed)
+	}
+}
+
+// observeEncrypt reports bits encrypted since a time to a Packet's Metrics, if it has any
+func (p *Packet) observeEncrypt(bits int, start time.Time) {
+	if p.metrics != nil {
+		p.metrics.BitsEncrypted(bits, time.Since(start))
+	}
+}
+
+// observeDecrypt reports bits decrypted since a time to a Packet's Metrics, if it has any
+func (p *Packet) observeDecrypt(bits int, start time.Time) {
+	if p.metrics != nil {
+		p.metrics.BitsDecrypted(bits, time.Since(start))
+	}
+}
@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"errors"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+var ErrKeyMismatch = errors.New("switching key doesn't target the public key")
+
+// ReEncryptionKey re-encrypts payloads from one Packet's key to another's without decrypting them
+// It is a bootstrapping key whose samples encrypt the source LWE key under the target TGSW key, so bootstrapping a source sample yields a target sample
+// Holding one reveals neither private key, so a server can combine ciphertexts of two users once both have approved
+type ReEncryptionKey struct {
+	pub *gates.PublicKey
+}
+
+// MakeReEncryptionKey uses two Packets' private keys to make a ReEncryptionKey from one to the other
+// Both Packets must use the same parameter set
+func MakeReEncryptionKey(from, to *Packet) *ReEncryptionKey {
+	params := to.pub.Params
+	if from.pub.Params.InOutParams.N != params.InOutParams.N || from.pub.Params.TgswParams.TlweParams.N != params.TgswParams.TlweParams.N {
+		panic("expected equal parameter sets")
+	}
+
+	bk := &core.LweBootstrappingKey{
+		InOutParams:   params.InOutParams,
+		BkParams:      params.TgswParams,
+		AccumParams:   params.TgswParams.TlweParams,
+		ExtractParams: &params.TgswParams.TlweParams.ExtractedLweparams,
+		Bk:            core.NewTGswSampleArray(params.InOutParams.N, params.TgswParams),
+		Ks:            to.pub.Bkw.Bk.Ks,
+	}
+
+	alpha := bk.AccumParams.AlphaMin
+	parallelFor(len(bk.Bk), func(i int) {
+		core.TGswSymEncryptInt(bk.Bk[i], from.prv.LweKey.Key[i], alpha, to.prv.TgswKey)
+	})
+
+	return &ReEncryptionKey{pub: gates.NewPublicKey(params, &core.LweBootstrappingKeyWrapper{
+		Bk:    bk,
+		BkFFT: bootstrappingKeyFFT(bk, nil),
+	})}
+}
+
+// MakePublicReEncryptionKey makes a ReEncryptionKey from its json marshallable form
+func MakePublicReEncryptionKey(publicKey *PublicKey) *ReEncryptionKey {
+	return &ReEncryptionKey{pub: publicKey.fromPublicKey()}
+}
+
+// PublicKey returns the json marshallable form of a ReEncryptionKey
+func (rk *ReEncryptionKey) PublicKey() *PublicKey {
+	return MakePublicKey(rk.pub)
+}
+
+// ReEncrypt bootstraps an encrypted payload under the source key in parallel, returning it encrypted under the target key
+func (rk *ReEncryptionKey) ReEncrypt(a gates.Ctxt) gates.Ctxt {
+	return (&Packet{pub: rk.pub}).Refresh(a)
+}
+
+// Combine returns a binary operation between payloads under a ReEncryptionKey's source and target keys
+// The first payload is re-encrypted under the target key, then the operation, which should use a target Packet's public key, is applied
+func Combine(rk *ReEncryptionKey, operation func(a, b gates.Ctxt) gates.Ctxt) func(a, b gates.Ctxt) gates.Ctxt {
+	return func(a, b gates.Ctxt) gates.Ctxt {
+		return operation(rk.ReEncrypt(a), b)
+	}
+}
+
+// SwitchingKey uses a Packet's private key and a new Packet's private key to make the json marshallable switching key between them
+// A client that knows both passwords makes one, so a server can move stored payloads to the new key with SwitchKey
+// The new Scheme must also be a Packet
+func (p *Packet) SwitchingKey(to Scheme) *PublicKey {
+	return MakeReEncryptionKey(p, to.(*Packet)).PublicKey()
+}
+
+// SwitchKey uses a Packet's public key, made from a switching key, to re-encrypt an encrypted payload under the switching key's target
+// The target's public key must be the one the switching key was made for, so the result is usable with it
+// The payload is never decrypted, so a server can re-key stored secrets without learning them
+func (p *Packet) SwitchKey(ctxt gates.Ctxt, toPublicKey *PublicKey) (gates.Ctxt, error) {
+	if toPublicKey == nil || toPublicKey.Bkw == nil || toPublicKey.Bkw.Bk == nil || !sameKeySwitchKey(p.pub.Bkw.Bk.Ks, toPublicKey.Bkw.Bk.Ks) {
+		return nil, ErrKeyMismatch
+	}
+
+	result := p.Refresh(ctxt)
+	if err := p.context().Err(); err != nil {
+		return nil, err
+	}
+
+	return result, p.Validate(result)
+}
+
+// sameKeySwitchKey returns whether two key switching keys are identical, which identifies the LWE key they switch to
+func sameKeySwitchKey(a, b *core.LweKeySwitchKey) bool {
+	if a == nil || b == nil || a.N != b.N || a.T != b.T || a.Base != b.Base || len(a.Ks) != len(b.Ks) {
+		return false
+	}
+
+	for i := range a.Ks {
+		if len(a.Ks[i]) != len(b.Ks[i]) {
+			return false
+		}
+		for j := range a.Ks[i] {
+			if len(a.Ks[i][j]) != len(b.Ks[i][j]) {
+				return false
+			}
+			for k := range a.Ks[i][j] {
+				x, y := a.Ks[i][j][k], b.Ks[i][j][k]
+				if x.B != y.B || len(x.A) != len(y.A) {
+					return false
+				}
+				for l := range x.A {
+					if x.A[l] != y.A[l] {
+						return false
+					}
+				}
+			}
+		}
+	}
+
+	return true
+}
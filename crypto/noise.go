@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+var (
+	ErrMalformedSample     = errors.New("malformed encrypted sample")
+	ErrNoiseBudgetExceeded = errors.New("encrypted sample is too noisy to decrypt reliably")
+)
+
+// NoiseEstimate uses a Packet's parameters to estimate the largest noise standard deviation in an encrypted payload
+// The estimate is tracked by go-tfhe as each operation combines samples, so it is only as trustworthy as the payload's origin
+func (p *Packet) NoiseEstimate(a gates.Ctxt) float64 {
+	variance := 0.
+	for _, sample := range a {
+		if sample != nil {
+			variance = max(variance, sample.CurrentVariance)
+		}
+	}
+
+	return math.Sqrt(variance)
+}
+
+// Validate uses a Packet's parameters to check that every sample in an encrypted payload is well formed and likely to decrypt correctly
+// Samples are flagged once their noise standard deviation exceeds the parameter set's maximum
+func (p *Packet) Validate(a gates.Ctxt) error {
+	params := p.pub.Params.InOutParams
+	for i, sample := range a {
+		if sample == nil || len(sample.A) != int(params.N) {
+			return fmt.Errorf("%w: bit %d", ErrMalformedSample, i)
+		}
+
+		if stdev := math.Sqrt(sample.CurrentVariance); math.IsNaN(stdev) || stdev > params.AlphaMax {
+			return fmt.Errorf("%w: bit %d has standard deviation %g > %g", ErrNoiseBudgetExceeded, i, stdev, params.AlphaMax)
+		}
+	}
+
+	return nil
+}
+
+// CtxtSecurityLevel returns the estimated bits of security of the parameter set an encrypted payload was encrypted under, judged by its mask dimension,
+// or 0 if the dimension is unrecognized, as it is for PlaintextSchemes
+func CtxtSecurityLevel(a gates.Ctxt) int {
+	if len(a) == 0 || a[0] == nil {
+		return 0
+	}
+
+	for _, lambda := range []int32{128, 80} {
+		if len(a[0].A) == int(gates.DefaultGateBootstrappingParameters(lambda).InOutParams.N) {
+			return int(lambda)
+		}
+	}
+
+	return 0
+}
+
+// CheckCtxt checks that an encrypted payload has a number of bits, and that every sample's mask has the same dimension,
+// no larger than the largest recognized parameter set's
+func CheckCtxt(a gates.Ctxt, bits int) error {
+	if len(a) != bits {
+		return fmt.Errorf("%w: %d bits, expected %d", ErrMalformedSample, len(a), bits)
+	}
+
+	for i, sample := range a {
+		if sample == nil || len(sample.A) != len(a[0].A) || len(sample.A) > maxCtxtDimension {
+			return fmt.Errorf("%w: bit %d", ErrMalformedSample, i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package opaque
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+
+	"filippo.io/bigmod"
+	"filippo.io/nistec"
+)
+
+const (
+	// elementByteLen is the length of a compressed P-256 point
+	elementByteLen = 33
+	// scalarByteLen is the length of a P-256 scalar
+	scalarByteLen = 32
+	// hashToFieldByteLen is the length of the uniform bytes each field element is reduced from, as RFC 9380 sets for P-256
+	hashToFieldByteLen = 48
+)
+
+var errMalformedElement = errors.New("malformed group element")
+
+// Public constants are derived with math/big once, and every secret is only ever operated on by nistec's points and bigmod's constant time arithmetic
+var (
+	p256P, _ = new(big.Int).SetString("ffffffff00000001000000000000000000000000ffffffffffffffffffffffff", 16)
+	p256N, _ = new(big.Int).SetString("ffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551", 16)
+	p256B, _ = new(big.Int).SetString("5ac635d8aa3a93e7b3ebbd55769886bc651d06b0cc53b0f63bce3c3e27d2604b", 16)
+
+	// fieldOrder is P-256's prime and groupOrder the order of its group
+	fieldOrder = modulus(p256P)
+	groupOrder = modulus(p256N)
+	// wideModulus is 2^384+1, which holds the uniform bytes of any field element before they are reduced
+	wideModulus = modulus(new(big.Int).SetBit(big.NewInt(1), 8*hashToFieldByteLen, 1))
+
+	// invertExponent, squareExponent, and sqrtExponent are p-2, (p-1)/2, and (p+1)/4, which invert, test for squares, and take square roots modulo P-256's prime,
+	// and invertScalarExponent is n-2, which inverts scalars modulo its order
+	invertExponent       = new(big.Int).Sub(p256P, big.NewInt(2)).Bytes()
+	squareExponent       = new(big.Int).Rsh(p256P, 1).Bytes()
+	sqrtExponent         = new(big.Int).Rsh(new(big.Int).Add(p256P, big.NewInt(1)), 2).Bytes()
+	invertScalarExponent = new(big.Int).Sub(p256N, big.NewInt(2)).Bytes()
+
+	// sswuZ is the Z of P-256's simplified SWU map, sswuA and sswuB the curve's coefficients,
+	// and sswuMinusBOverA and sswuBOverZA the constants of the map's straight line form
+	sswuZ           = fieldConstant(new(big.Int).Sub(p256P, big.NewInt(10)))
+	sswuA           = fieldConstant(new(big.Int).Sub(p256P, big.NewInt(3)))
+	sswuB           = fieldConstant(p256B)
+	sswuMinusBOverA = fieldConstant(new(big.Int).Mul(new(big.Int).Neg(p256B), new(big.Int).ModInverse(big.NewInt(-3), p256P)))
+	sswuBOverZA     = fieldConstant(new(big.Int).Mul(p256B, new(big.Int).ModInverse(big.NewInt(30), p256P)))
+	fieldOne        = fieldConstant(big.NewInt(1))
+)
+
+// modulus returns the Modulus of a public integer
+func modulus(i *big.Int) *bigmod.Modulus {
+	m, err := bigmod.NewModulus(i.Bytes())
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
+
+// fieldConstant returns a public integer reduced modulo P-256's prime
+func fieldConstant(i *big.Int) *bigmod.Nat {
+	n, err := bigmod.NewNat().SetBytes(new(big.Int).Mod(i, p256P).Bytes(), fieldOrder)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+// element is a point on P-256
+type element struct {
+	point *nistec.P256Point
+}
+
+// serialize returns the compressed SEC1 encoding of an element
+func (e element) serialize() []byte {
+	return e.point.BytesCompressed()
+}
+
+// deserializeElement returns the element a compressed SEC1 encoding holds, which must be on the curve and not the identity
+func deserializeElement(data []byte) (element, error) {
+	if len(data) != elementByteLen {
+		return element{}, errMalformedElement
+	}
+
+	point, err := nistec.NewP256Point().SetBytes(data)
+	if err != nil {
+		return element{}, errMalformedElement
+	}
+
+	return element{point: point}, nil
+}
+
+// scalarMult returns an element multiplied by a scalar
+func (e element) scalarMult(scalar *bigmod.Nat) element {
+	point, err := nistec.NewP256Point().ScalarMult(e.point, scalar.Bytes(groupOrder))
+	if err != nil {
+		panic(err)
+	}
+
+	return element{point: point}
+}
+
+// baseMult returns the generator multiplied by a scalar
+func baseMult(scalar *bigmod.Nat) element {
+	point, err := nistec.NewP256Point().ScalarBaseMult(scalar.Bytes(groupOrder))
+	if err != nil {
+		panic(err)
+	}
+
+	return element{point: point}
+}
+
+// deserializeScalar returns the scalar a fixed length big endian encoding holds, which must be nonzero and below the group's order
+func deserializeScalar(data []byte) (*bigmod.Nat, error) {
+	if len(data) != scalarByteLen {
+		return nil, errMalformedElement
+	}
+
+	scalar, err := bigmod.NewNat().SetBytes(data, groupOrder)
+	if err != nil || scalar.IsZero() == 1 {
+		return nil, errMalformedElement
+	}
+
+	return scalar, nil
+}
+
+// randomScalar returns a random nonzero scalar from an entropy source
+func randomScalar(entropy io.Reader) (*bigmod.Nat, error) {
+	for {
+		data := make([]byte, scalarByteLen)
+		if _, err := io.ReadFull(entropy, data); err != nil {
+			return nil, err
+		}
+		if scalar, err := deserializeScalar(data); err == nil {
+			return scalar, nil
+		}
+	}
+}
+
+// invertScalar returns the inverse of a nonzero scalar modulo the group's order
+func invertScalar(scalar *bigmod.Nat) *bigmod.Nat {
+	return bigmod.NewNat().Exp(scalar, invertScalarExponent, groupOrder)
+}
+
+// expandMessageXMD returns a number of uniform bytes expanded from a message under a domain separation tag with SHA-256, as RFC 9380 defines
+func expandMessageXMD(msg, dst []byte, length int) []byte {
+	ell := (length + sha256.Size - 1) / sha256.Size
+	dstPrime := append(append([]byte{}, dst...), byte(len(dst)))
+
+	h := sha256.New()
+	h.Write(make([]byte, sha256.BlockSize))
+	h.Write(msg)
+	h.Write([]byte{byte(length >> 8), byte(length), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	h.Reset()
+	h.Write(b0)
+	h.Write([]byte{1})
+	h.Write(dstPrime)
+	bi := h.Sum(nil)
+
+	uniform := append([]byte{}, bi...)
+	for i := 2; i <= ell; i++ {
+		h.Reset()
+		for j := range bi {
+			bi[j] ^= b0[j]
+		}
+		h.Write(bi)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		bi = h.Sum(nil)
+		uniform = append(uniform, bi...)
+	}
+
+	return uniform[:length]
+}
+
+// hashToField returns a number of integers modulo a modulus hashed from a message under a domain separation tag
+func hashToField(msg, dst []byte, count int, m *bigmod.Modulus) []*bigmod.Nat {
+	uniform := expandMessageXMD(msg, dst, count*hashToFieldByteLen)
+
+	elements := make([]*bigmod.Nat, count)
+	for i := range elements {
+		wide, err := bigmod.NewNat().SetBytes(uniform[i*hashToFieldByteLen:(i+1)*hashToFieldByteLen], wideModulus)
+		if err != nil {
+			panic(err)
+		}
+		elements[i] = bigmod.NewNat().Mod(wide, m)
+	}
+
+	return elements
+}
+
+// fieldCopy returns a copy of a field element
+func fieldCopy(a *bigmod.Nat) *bigmod.Nat {
+	return bigmod.NewNat().Mod(a, fieldOrder)
+}
+
+// fieldMul returns the product of two field elements
+func fieldMul(a, b *bigmod.Nat) *bigmod.Nat {
+	return fieldCopy(a).Mul(b, fieldOrder)
+}
+
+// fieldAdd returns the sum of two field elements
+func fieldAdd(a, b *bigmod.Nat) *bigmod.Nat {
+	return fieldCopy(a).Add(b, fieldOrder)
+}
+
+// fieldSelect returns one field element if a condition is 0, and another if it is 1, without branching on it
+func fieldSelect(condition uint, ifZero, ifOne *bigmod.Nat) *bigmod.Nat {
+	choice := bigmod.NewNat().SetUint(condition).ExpandFor(fieldOrder)
+	return fieldAdd(ifZero, fieldMul(choice, fieldCopy(ifOne).Sub(ifZero, fieldOrder)))
+}
+
+// curveY2 returns x^3 + Ax + B, the square of the y coordinate of the point with a field element as its x coordinate
+func curveY2(x *bigmod.Nat) *bigmod.Nat {
+	return fieldAdd(fieldAdd(fieldMul(fieldMul(x, x), x), fieldMul(sswuA, x)), sswuB)
+}
+
+// mapToCurve returns the point a field element maps to under P-256's simplified SWU map, in the straight line form of RFC 9380 section 6.6.2
+// so neither its branches nor its timing depend on the element
+func mapToCurve(u *bigmod.Nat) element {
+	zu2 := fieldMul(sswuZ, fieldMul(u, u))
+	tv1 := fieldAdd(fieldMul(zu2, zu2), zu2)
+	x1 := fieldMul(sswuMinusBOverA, fieldAdd(fieldOne, bigmod.NewNat().Exp(tv1, invertExponent, fieldOrder)))
+	x1 = fieldSelect(tv1.IsZero(), x1, sswuBOverZA)
+	gx1 := curveY2(x1)
+	x2 := fieldMul(zu2, x1)
+	gx2 := curveY2(x2)
+
+	legendre := bigmod.NewNat().Exp(gx1, squareExponent, fieldOrder)
+	square := legendre.IsZero() | legendre.IsOne()
+	x := fieldSelect(square, x2, x1)
+	y := bigmod.NewNat().Exp(fieldSelect(square, gx2, gx1), sqrtExponent, fieldOrder)
+	negY := bigmod.NewNat().ExpandFor(fieldOrder).Sub(y, fieldOrder)
+	y = fieldSelect(u.IsOdd()^y.IsOdd(), y, negY)
+
+	point, err := nistec.NewP256Point().SetBytes(append(append([]byte{4}, x.Bytes(fieldOrder)...), y.Bytes(fieldOrder)...))
+	if err != nil {
+		panic(err)
+	}
+
+	return element{point: point}
+}
+
+// hashToGroup returns the point a message hashes to under a domain separation tag, as RFC 9380's P256_XMD:SHA-256_SSWU_RO_ suite hashes it
+func hashToGroup(msg, dst []byte) element {
+	u := hashToField(msg, dst, 2, fieldOrder)
+	q0, q1 := mapToCurve(u[0]), mapToCurve(u[1])
+	return element{point: q0.point.Add(q0.point, q1.point)}
+}
+
+// hashToScalar returns the scalar a message hashes to under a domain separation tag
+func hashToScalar(msg, dst []byte) *bigmod.Nat {
+	return hashToField(msg, dst, 1, groupOrder)[0]
+}
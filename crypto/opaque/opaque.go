@@ -0,0 +1,486 @@
+// Package opaque implements the OPAQUE-3DH augmented PAKE of RFC 9807 with the P256-SHA256 OPRF of RFC 9497, HKDF-SHA256, HMAC-SHA256,
+// and Argon2id stretching under a random salt kept with each record, where a server stores a registration record from which nothing about the password can be learned without an offline attack
+// on the server's own OPRF key, and a login proves knowledge of the password to a server that never sees it
+package opaque
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"filippo.io/bigmod"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// KSFSaltByteLen is the length of the salt each record's OPRF output is stretched under
+	KSFSaltByteLen = 16
+	// SetupByteLen is the length of a ServerSetup's encoding, an OPRF seed followed by the seed of the server's key pair
+	SetupByteLen = 2 * seedByteLen
+	// RecordByteLen is the length of a registration record, the client's public key, masking key, and envelope
+	RecordByteLen = elementByteLen + hashByteLen + envelopeByteLen
+
+	// hashByteLen is the length of SHA-256 digests, HMAC tags, and HKDF keys
+	hashByteLen = sha256.Size
+	// nonceByteLen is the length of the nonces of envelopes, masked responses, and key exchanges
+	nonceByteLen = 32
+	// seedByteLen is the length of the seeds key pairs are derived from
+	seedByteLen = 32
+	// envelopeByteLen is the length of an envelope, a nonce and an authentication tag
+	envelopeByteLen = nonceByteLen + hashByteLen
+	// maskedResponseByteLen is the length of the server's public key and the user's envelope, as masked in a credential response
+	maskedResponseByteLen = elementByteLen + envelopeByteLen
+	// ke1ByteLen is the length of a client's first login message, its blinded password, nonce, and key share
+	ke1ByteLen = elementByteLen + nonceByteLen + elementByteLen
+	// ke2ByteLen is the length of a server's login response, its evaluated element, masking nonce, masked response, nonce, key share, and MAC
+	ke2ByteLen = elementByteLen + nonceByteLen + maskedResponseByteLen + nonceByteLen + elementByteLen + hashByteLen
+)
+
+var (
+	ErrMalformed          = errors.New("malformed opaque message")
+	ErrInvalidCredentials = errors.New("invalid opaque credentials")
+)
+
+var (
+	// oprfContext is RFC 9497's context string of the P256-SHA256 suite in its base mode
+	oprfContext = []byte("OPRFV1-\x00-P256-SHA256")
+	// exchangeContext is bound into every key exchange's transcript
+	exchangeContext = []byte("hauth")
+	// versionLabel begins every key exchange's transcript, and diffieHellmanLabel is the info key exchange key pairs are derived under
+	versionLabel       = []byte("OPAQUEv1-")
+	diffieHellmanLabel = "OPAQUE-DeriveDiffieHellmanKeyPair"
+	// stretch is the key stretching function of OPRF outputs, Argon2id under a record's salt
+	stretch = func(oprfOutput, salt []byte) []byte {
+		return argon2.IDKey(oprfOutput, salt, 1, 64*1024, 4, hashByteLen)
+	}
+)
+
+type (
+	// ServerSetup is a server's long-term OPAQUE keys: the seed each user's OPRF key is derived from, and the key pair of its key exchanges
+	ServerSetup struct {
+		oprfSeed, keySeed []byte
+		privateKey        *bigmod.Nat
+		publicKey         []byte
+	}
+
+	// ClientRegistration is a client's state between sending its registration request and finalizing its record
+	ClientRegistration struct {
+		password []byte
+		blind    *bigmod.Nat
+	}
+
+	// ClientLogin is a client's state between sending its first login message and finishing the key exchange
+	ClientLogin struct {
+		password []byte
+		blind    *bigmod.Nat
+		secret   *bigmod.Nat
+		ke1      []byte
+	}
+
+	// ServerLogin is a server's state between answering a client's first login message and checking its MAC
+	ServerLogin struct {
+		expectedMAC []byte
+		sessionKey  []byte
+	}
+)
+
+// expand returns HKDF-Expand of a pseudorandom key with info
+func expand(prk []byte, length int, info ...[]byte) []byte {
+	out := make([]byte, length)
+	io.ReadFull(hkdf.Expand(sha256.New, prk, bytes.Join(info, nil)), out)
+	return out
+}
+
+// extract returns HKDF-Extract of input keying material with an empty salt
+func extract(ikm ...[]byte) []byte {
+	return hkdf.Extract(sha256.New, bytes.Join(ikm, nil), nil)
+}
+
+// mac returns the HMAC-SHA256 of messages under a key
+func mac(key []byte, messages ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, message := range messages {
+		h.Write(message)
+	}
+
+	return h.Sum(nil)
+}
+
+// hash returns the SHA-256 of the concatenation of values
+func hash(values ...[]byte) []byte {
+	h := sha256.New()
+	for _, value := range values {
+		h.Write(value)
+	}
+
+	return h.Sum(nil)
+}
+
+// lengthPrefixed returns a value prefixed with its two byte big endian length
+func lengthPrefixed(value []byte) []byte {
+	return append([]byte{byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+// random returns a number of bytes from an entropy source
+func random(entropy io.Reader, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(entropy, out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// deriveKeyPair returns the key pair RFC 9497's DeriveKeyPair derives from a seed and info
+func deriveKeyPair(seed []byte, info string) (*bigmod.Nat, element) {
+	deriveInput := append(append([]byte{}, seed...), lengthPrefixed([]byte(info))...)
+	dst := append([]byte("DeriveKeyPair"), oprfContext...)
+	for counter := 0; ; counter++ {
+		if sk := hashToScalar(append(deriveInput, byte(counter)), dst); sk.IsZero() == 0 {
+			return sk, baseMult(sk)
+		}
+	}
+}
+
+// deriveDiffieHellmanKeyPair returns the key exchange key pair a seed derives
+func deriveDiffieHellmanKeyPair(seed []byte) (*bigmod.Nat, element) {
+	return deriveKeyPair(seed, diffieHellmanLabel)
+}
+
+// blind returns a random blind and the blinded element of a password
+func blind(entropy io.Reader, password []byte) (*bigmod.Nat, []byte, error) {
+	r, err := randomScalar(entropy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r, blindWith(r, password), nil
+}
+
+// blindWith returns the blinded element of a password under a blind
+func blindWith(r *bigmod.Nat, password []byte) []byte {
+	return hashToGroup(password, append([]byte("HashToGroup-"), oprfContext...)).scalarMult(r).serialize()
+}
+
+// finalize returns the OPRF output of a password from the element the server evaluated its blinded element to
+func finalize(password []byte, r *bigmod.Nat, evaluated []byte) ([]byte, error) {
+	element, err := deserializeElement(evaluated)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	unblinded := element.scalarMult(invertScalar(r)).serialize()
+	return hash(lengthPrefixed(password), lengthPrefixed(unblinded), []byte("Finalize")), nil
+}
+
+// randomizedPassword returns the randomized password an OPRF output derives, stretched under a salt
+func randomizedPassword(oprfOutput, salt []byte) []byte {
+	return extract(oprfOutput, stretch(oprfOutput, salt))
+}
+
+// cleartextCredentials returns the credentials an envelope authenticates, with each party's public key as its identity
+func cleartextCredentials(serverPublicKey, clientPublicKey []byte) []byte {
+	return bytes.Join([][]byte{serverPublicKey, lengthPrefixed(serverPublicKey), lengthPrefixed(clientPublicKey)}, nil)
+}
+
+// envelopeKeys returns the authentication key, export key, and client key pair a randomized password and envelope nonce derive
+func envelopeKeys(randomizedPassword, nonce []byte) (authKey, exportKey []byte, privateKey *bigmod.Nat, publicKey []byte) {
+	authKey = expand(randomizedPassword, hashByteLen, nonce, []byte("AuthKey"))
+	exportKey = expand(randomizedPassword, hashByteLen, nonce, []byte("ExportKey"))
+	privateKey, public := deriveDiffieHellmanKeyPair(expand(randomizedPassword, seedByteLen, nonce, []byte("PrivateKey")))
+	return authKey, exportKey, privateKey, public.serialize()
+}
+
+// credentialResponsePad returns the pad a masking key and nonce mask a credential response with
+func credentialResponsePad(maskingKey, nonce []byte) []byte {
+	return expand(maskingKey, maskedResponseByteLen, nonce, []byte("CredentialResponsePad"))
+}
+
+// xor returns the exclusive or of two equal length byte slices
+func xor(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+
+	return out
+}
+
+// expandLabel returns RFC 9807's Expand-Label of a secret
+func expandLabel(secret []byte, label string, context []byte) []byte {
+	label = "OPAQUE-" + label
+	customLabel := bytes.Join([][]byte{{0, hashByteLen, byte(len(label))}, []byte(label), {byte(len(context))}, context}, nil)
+	return expand(secret, hashByteLen, customLabel)
+}
+
+// preamble returns the transcript a key exchange's keys are bound to
+func preamble(clientPublicKey, ke1, serverPublicKey, credentialResponse, serverNonce, serverKeyShare []byte) []byte {
+	return bytes.Join([][]byte{
+		versionLabel, lengthPrefixed(exchangeContext),
+		lengthPrefixed(clientPublicKey), ke1,
+		lengthPrefixed(serverPublicKey), credentialResponse, serverNonce, serverKeyShare,
+	}, nil)
+}
+
+// deriveKeys returns the server's and client's MAC keys and the session key of a key exchange's Diffie-Hellman outputs and preamble
+func deriveKeys(ikm, preamble []byte) (serverMACKey, clientMACKey, sessionKey []byte) {
+	prk := extract(ikm)
+	transcript := hash(preamble)
+	handshakeSecret := expandLabel(prk, "HandshakeSecret", transcript)
+	sessionKey = expandLabel(prk, "SessionKey", transcript)
+	return expandLabel(handshakeSecret, "ServerMAC", nil), expandLabel(handshakeSecret, "ClientMAC", nil), sessionKey
+}
+
+// diffieHellman returns the encoding of a peer's public key multiplied by a private key
+func diffieHellman(privateKey *bigmod.Nat, publicKey []byte) ([]byte, error) {
+	public, err := deserializeElement(publicKey)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	return public.scalarMult(privateKey).serialize(), nil
+}
+
+// tripleDiffieHellman returns the input keying material of a key exchange, the concatenation of the ephemeral-ephemeral,
+// and both ephemeral-static, Diffie-Hellman outputs in the order RFC 9807 sets
+func tripleDiffieHellman(ephemeral, static *bigmod.Nat, peerEphemeral, peerStatic []byte, server bool) ([]byte, error) {
+	dh1, err := diffieHellman(ephemeral, peerEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	dh2, err := diffieHellman(static, peerEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	dh3, err := diffieHellman(ephemeral, peerStatic)
+	if err != nil {
+		return nil, err
+	}
+	if !server {
+		dh2, dh3 = dh3, dh2
+	}
+
+	return bytes.Join([][]byte{dh1, dh2, dh3}, nil), nil
+}
+
+// NewServerSetup returns a ServerSetup with seeds from an entropy source
+func NewServerSetup(entropy io.Reader) (*ServerSetup, error) {
+	seeds, err := random(entropy, SetupByteLen)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseServerSetup(seeds)
+}
+
+// ParseServerSetup returns the ServerSetup an encoding from Bytes holds
+func ParseServerSetup(data []byte) (*ServerSetup, error) {
+	if len(data) != SetupByteLen {
+		return nil, ErrMalformed
+	}
+
+	privateKey, publicKey := deriveDiffieHellmanKeyPair(data[seedByteLen:])
+	return &ServerSetup{
+		oprfSeed:   append([]byte{}, data[:seedByteLen]...),
+		keySeed:    append([]byte{}, data[seedByteLen:]...),
+		privateKey: privateKey,
+		publicKey:  publicKey.serialize(),
+	}, nil
+}
+
+// Bytes returns a ServerSetup's encoding, which must be kept secret and stable for its users to keep logging in
+func (ss *ServerSetup) Bytes() []byte {
+	return append(append([]byte{}, ss.oprfSeed...), ss.keySeed...)
+}
+
+// evaluate returns the element a user's OPRF key evaluates a blinded element to
+func (ss *ServerSetup) evaluate(credentialIdentifier string, blinded []byte) ([]byte, error) {
+	element, err := deserializeElement(blinded)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	seed := expand(ss.oprfSeed, seedByteLen, []byte(credentialIdentifier), []byte("OprfKey"))
+	oprfKey, _ := deriveKeyPair(seed, "OPAQUE-DeriveKeyPair")
+	return element.scalarMult(oprfKey).serialize(), nil
+}
+
+// RegistrationResponse returns the response to a client's registration request for the user a credential identifier names,
+// the evaluated element of its blinded password followed by the server's public key
+func (ss *ServerSetup) RegistrationResponse(credentialIdentifier string, request []byte) ([]byte, error) {
+	evaluated, err := ss.evaluate(credentialIdentifier, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(evaluated, ss.publicKey...), nil
+}
+
+// NewClientRegistration returns a client's registration state for a password and the request to send the server, its blinded password
+func NewClientRegistration(entropy io.Reader, password string) (*ClientRegistration, []byte, error) {
+	r, request, err := blind(entropy, []byte(password))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ClientRegistration{password: []byte(password), blind: r}, request, nil
+}
+
+// Finalize returns the record a server stores for the user from its registration response, the random salt its OPRF output is stretched under,
+// which is stored with the record and passed to ClientLogin.Finish, and the export key only the password can derive
+func (cr *ClientRegistration) Finalize(entropy io.Reader, response []byte) (record, salt, exportKey []byte, err error) {
+	if len(response) != 2*elementByteLen {
+		return nil, nil, nil, ErrMalformed
+	}
+	serverPublicKey := response[elementByteLen:]
+	if _, err := deserializeElement(serverPublicKey); err != nil {
+		return nil, nil, nil, ErrMalformed
+	}
+
+	oprfOutput, err := finalize(cr.password, cr.blind, response[:elementByteLen])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	nonce, err := random(entropy, nonceByteLen)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	salt, err = random(entropy, KSFSaltByteLen)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rwd := randomizedPassword(oprfOutput, salt)
+	maskingKey := expand(rwd, hashByteLen, []byte("MaskingKey"))
+	authKey, exportKey, _, clientPublicKey := envelopeKeys(rwd, nonce)
+	authTag := mac(authKey, nonce, cleartextCredentials(serverPublicKey, clientPublicKey))
+
+	return bytes.Join([][]byte{clientPublicKey, maskingKey, nonce, authTag}, nil), salt, exportKey, nil
+}
+
+// CheckRecord returns ErrMalformed unless a registration record is of the right length and holds a valid public key
+func CheckRecord(record []byte) error {
+	if len(record) != RecordByteLen {
+		return ErrMalformed
+	} else if _, err := deserializeElement(record[:elementByteLen]); err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
+// NewClientLogin returns a client's login state for a password and its first login message, KE1, to send the server
+func NewClientLogin(entropy io.Reader, password string) (*ClientLogin, []byte, error) {
+	r, blinded, err := blind(entropy, []byte(password))
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := random(entropy, nonceByteLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := randomScalar(entropy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ke1 := bytes.Join([][]byte{blinded, nonce, baseMult(secret).serialize()}, nil)
+	return &ClientLogin{password: []byte(password), blind: r, secret: secret, ke1: ke1}, ke1, nil
+}
+
+// NewServerLogin returns a server's login state for the user a credential identifier names and their registration record,
+// and its response, KE2, to the client's first login message
+func (ss *ServerSetup) NewServerLogin(entropy io.Reader, credentialIdentifier string, record, ke1 []byte) (*ServerLogin, []byte, error) {
+	if err := CheckRecord(record); err != nil {
+		return nil, nil, err
+	} else if len(ke1) != ke1ByteLen {
+		return nil, nil, ErrMalformed
+	}
+	clientPublicKey, maskingKey, envelope := record[:elementByteLen], record[elementByteLen:elementByteLen+hashByteLen], record[elementByteLen+hashByteLen:]
+	clientKeyShare := ke1[elementByteLen+nonceByteLen:]
+
+	evaluated, err := ss.evaluate(credentialIdentifier, ke1[:elementByteLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	maskingNonce, err := random(entropy, nonceByteLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverNonce, err := random(entropy, nonceByteLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := randomScalar(entropy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	maskedResponse := xor(credentialResponsePad(maskingKey, maskingNonce), append(append([]byte{}, ss.publicKey...), envelope...))
+	credentialResponse := bytes.Join([][]byte{evaluated, maskingNonce, maskedResponse}, nil)
+
+	serverKeyShare := baseMult(secret).serialize()
+	ikm, err := tripleDiffieHellman(secret, ss.privateKey, clientKeyShare, clientPublicKey, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transcript := preamble(clientPublicKey, ke1, ss.publicKey, credentialResponse, serverNonce, serverKeyShare)
+	serverMACKey, clientMACKey, sessionKey := deriveKeys(ikm, transcript)
+	serverMAC := mac(serverMACKey, hash(transcript))
+
+	return &ServerLogin{
+		expectedMAC: mac(clientMACKey, hash(transcript, serverMAC)),
+		sessionKey:  sessionKey,
+	}, bytes.Join([][]byte{credentialResponse, serverNonce, serverKeyShare, serverMAC}, nil), nil
+}
+
+// Finish returns a client's final login message, KE3, and the session key and export key, from the server's response and the salt stored with the user's record,
+// or ErrInvalidCredentials if the password was wrong or the server isn't the one the user registered with
+func (cl *ClientLogin) Finish(ke2, salt []byte) (ke3, sessionKey, exportKey []byte, err error) {
+	if len(ke2) != ke2ByteLen || len(salt) != KSFSaltByteLen {
+		return nil, nil, nil, ErrMalformed
+	}
+	credentialResponse, rest := ke2[:elementByteLen+nonceByteLen+maskedResponseByteLen], ke2[elementByteLen+nonceByteLen+maskedResponseByteLen:]
+	evaluated, maskingNonce, maskedResponse := credentialResponse[:elementByteLen], credentialResponse[elementByteLen:elementByteLen+nonceByteLen], credentialResponse[elementByteLen+nonceByteLen:]
+	serverNonce, serverKeyShare, serverMAC := rest[:nonceByteLen], rest[nonceByteLen:nonceByteLen+elementByteLen], rest[nonceByteLen+elementByteLen:]
+
+	oprfOutput, err := finalize(cl.password, cl.blind, evaluated)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rwd := randomizedPassword(oprfOutput, salt)
+	maskingKey := expand(rwd, hashByteLen, []byte("MaskingKey"))
+	unmasked := xor(credentialResponsePad(maskingKey, maskingNonce), maskedResponse)
+	serverPublicKey, nonce, authTag := unmasked[:elementByteLen], unmasked[elementByteLen:elementByteLen+nonceByteLen], unmasked[elementByteLen+nonceByteLen:]
+
+	authKey, exportKey, clientPrivateKey, clientPublicKey := envelopeKeys(rwd, nonce)
+	if !hmac.Equal(authTag, mac(authKey, nonce, cleartextCredentials(serverPublicKey, clientPublicKey))) {
+		return nil, nil, nil, ErrInvalidCredentials
+	}
+
+	ikm, err := tripleDiffieHellman(cl.secret, clientPrivateKey, serverKeyShare, serverPublicKey, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	transcript := preamble(clientPublicKey, cl.ke1, serverPublicKey, credentialResponse, serverNonce, serverKeyShare)
+	serverMACKey, clientMACKey, sessionKey := deriveKeys(ikm, transcript)
+	if !hmac.Equal(serverMAC, mac(serverMACKey, hash(transcript))) {
+		return nil, nil, nil, ErrInvalidCredentials
+	}
+
+	return mac(clientMACKey, hash(transcript, serverMAC)), sessionKey, exportKey, nil
+}
+
+// Finish returns the session key a server shares with the client, or ErrInvalidCredentials unless the client's final message, KE3, proves it knows the password
+func (sl *ServerLogin) Finish(ke3 []byte) ([]byte, error) {
+	if !hmac.Equal(sl.expectedMAC, ke3) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return sl.sessionKey, nil
+}
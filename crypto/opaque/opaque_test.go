@@ -0,0 +1,244 @@
+package opaque
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// unhex returns the bytes a hex string encodes, failing the test if it is malformed
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// TestExpandMessageXMD checks expand_message_xmd against RFC 9380 appendix K.1
+func TestExpandMessageXMD(t *testing.T) {
+	dst := []byte("QUUX-V01-CS02-with-expander-SHA256-128")
+	for _, test := range []struct {
+		msg     string
+		length  int
+		uniform string
+	}{
+		{"", 0x20, "68a985b87eb6b46952128911f2a4412bbc302a9d759667f87f7a21d803f07235"},
+		{"abc", 0x20, "d8ccab23b5985ccea865c6c97b6e5b8350e794e603b4b97902f53a8a0d605615"},
+		{"abcdef0123456789", 0x20, "eff31487c770a893cfb36f912fbfcbff40d5661771ca4b2cb4eafe524333f5c1"},
+		{"", 0x80, "af84c27ccfd45d41914fdff5df25293e221afc53d8ad2ac06d5e3e29485dadbee0d121587713a3e0dd4d5e69e93eb7cd4f5df4cd103e188cf60cb02edc3edf18eda8576c412b18ffb658e3dd6ec849469b979d444cf7b26911a08e63cf31f9dcc541708d3491184472c2c29bb749d4286b004ceb5ee6b9a7fa5b646c993f0ced"},
+	} {
+		if got := expandMessageXMD([]byte(test.msg), dst, test.length); !bytes.Equal(got, unhex(t, test.uniform)) {
+			t.Errorf("expandMessageXMD(%q, %d) = %x, want %s", test.msg, test.length, got, test.uniform)
+		}
+	}
+}
+
+// TestHashToGroup checks the P256_XMD:SHA-256_SSWU_RO_ suite against RFC 9380 appendix J.1.1
+func TestHashToGroup(t *testing.T) {
+	dst := []byte("QUUX-V01-CS02-with-P256_XMD:SHA-256_SSWU_RO_")
+	for _, test := range []struct {
+		msg, x, y string
+	}{
+		{"", "2c15230b26dbc6fc9a37051158c95b79656e17a1a920b11394ca91c44247d3e4", "8a7a74985cc5c776cdfe4b1f19884970453912e9d31528c060be9ab5c43e8415"},
+		{"abc", "0bb8b87485551aa43ed54f009230450b492fead5f1cc91658775dac4a3388a0f", "5c41b3d0731a27a7b14bc0bf0ccded2d8751f83493404c84a88e71ffd424212e"},
+		{"abcdef0123456789", "65038ac8f2b1def042a5df0b33b1f4eca6bff7cb0f9c6c1526811864e544ed80", "cad44d40a656e7aff4002a8de287abc8ae0482b5ae825822bb870d6df9b56ca3"},
+	} {
+		want := append(append([]byte{4}, unhex(t, test.x)...), unhex(t, test.y)...)
+		if got := hashToGroup([]byte(test.msg), dst).point.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("hashToGroup(%q) = %x, want %x", test.msg, got, want)
+		}
+	}
+}
+
+// TestOPRF checks the P256-SHA256 OPRF in its base mode against RFC 9497 appendix A.3.1
+func TestOPRF(t *testing.T) {
+	sk, _ := deriveKeyPair(unhex(t, "a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3a3"), "test key")
+	if got, want := sk.Bytes(groupOrder), unhex(t, "159749d750713afe245d2d39ccfaae8381c53ce92d098a9375ee70739c7ac0bf"); !bytes.Equal(got, want) {
+		t.Fatalf("deriveKeyPair = %x, want %x", got, want)
+	}
+
+	r, err := deserializeScalar(unhex(t, "3338fa65ec36e0290022b48eb562889d89dbfa691d1cde91517fa222ed7ad364"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		input, blinded, evaluated, output string
+	}{
+		{"00", "03723a1e5c09b8b9c18d1dcbca29e8007e95f14f4732d9346d490ffc195110368d",
+			"030de02ffec47a1fd53efcdd1c6faf5bdc270912b8749e783c7ca75bb412958832", "a0b34de5fa4c5b6da07e72af73cc507cceeb48981b97b7285fc375345fe495dd"},
+		{"5a5a5a5a5a5a5a5a5a5a5a5a5a5a5a5a5a", "03cc1df781f1c2240a64d1c297b3f3d16262ef5d4cf102734882675c26231b0838",
+			"03a0395fe3828f2476ffcd1f4fe540e5a8489322d398be3c4e5a869db7fcb7c52c", "c748ca6dd327f0ce85f4ae3a8cd6d4d5390bbb804c9e12dcf94f853fece3dcce"},
+	} {
+		input := unhex(t, test.input)
+		blinded := blindWith(r, input)
+		if !bytes.Equal(blinded, unhex(t, test.blinded)) {
+			t.Errorf("blindWith(%s) = %x, want %s", test.input, blinded, test.blinded)
+			continue
+		}
+
+		element, err := deserializeElement(blinded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evaluated := element.scalarMult(sk).serialize()
+		if !bytes.Equal(evaluated, unhex(t, test.evaluated)) {
+			t.Errorf("evaluation of %s = %x, want %s", test.input, evaluated, test.evaluated)
+			continue
+		}
+
+		if output, err := finalize(input, r, evaluated); err != nil || !bytes.Equal(output, unhex(t, test.output)) {
+			t.Errorf("finalize(%s) = %x, %v, want %s", test.input, output, err, test.output)
+		}
+	}
+}
+
+// TestOPAQUE checks registration and login against the P256-SHA256 test vector without identities of the OPAQUE draft RFC 9807 was published from,
+// which uses the identity function as its key stretching function, its own context, and the draft's version and key pair labels,
+// RFC 9807's only changes to the computations the vector covers
+func TestOPAQUE(t *testing.T) {
+	defer func(context, version []byte, label string, ksf func(oprfOutput, salt []byte) []byte) {
+		exchangeContext, versionLabel, diffieHellmanLabel, stretch = context, version, label, ksf
+	}(exchangeContext, versionLabel, diffieHellmanLabel, stretch)
+	exchangeContext, versionLabel, diffieHellmanLabel = []byte("OPAQUE-POC"), []byte("RFCXXXX"), "OPAQUE-DeriveAuthKeyPair"
+	stretch = func(oprfOutput, _ []byte) []byte {
+		return oprfOutput
+	}
+
+	var (
+		password             = string(unhex(t, "436f7272656374486f72736542617474657279537461706c65"))
+		credentialIdentifier = string(unhex(t, "31323334"))
+		salt                 = make([]byte, KSFSaltByteLen)
+	)
+	serverPrivateKey, err := deserializeScalar(unhex(t, "c36139381df63bfc91c850db0b9cfbec7a62e86d80040a41aa7725bf0e79d5e5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := &ServerSetup{
+		oprfSeed:   unhex(t, "62f60b286d20ce4fd1d64809b0021dad6ed5d52a2c8cf27ae6582543a0a8dce2"),
+		privateKey: serverPrivateKey,
+		publicKey:  baseMult(serverPrivateKey).serialize(),
+	}
+	if want := unhex(t, "035f40ff9cf88aa1f5cd4fe5fd3da9ea65a4923a5594f84fd9f2092d6067784874"); !bytes.Equal(ss.publicKey, want) {
+		t.Fatalf("server public key = %x, want %x", ss.publicKey, want)
+	}
+
+	registration, request, err := NewClientRegistration(bytes.NewReader(unhex(t, "411bf1a62d119afe30df682b91a0a33d777972d4f2daa4b34ca527d597078153")), password)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := unhex(t, "029e949a29cfa0bf7c1287333d2fb3dc586c41aa652f5070d26a5315a1b50229f8"); !bytes.Equal(request, want) {
+		t.Fatalf("registration request = %x, want %x", request, want)
+	}
+
+	response, err := ss.RegistrationResponse(credentialIdentifier, request)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := unhex(t, "0350d3694c00978f00a5ce7cd08a00547e4ab5fb5fc2b2f6717cdaa6c89136efef035f40ff9cf88aa1f5cd4fe5fd3da9ea65a4923a5594f84fd9f2092d6067784874"); !bytes.Equal(response, want) {
+		t.Fatalf("registration response = %x, want %x", response, want)
+	}
+
+	envelopeNonce := unhex(t, "a921f2a014513bd8a90e477a629794e89fec12d12206dde662ebdcf65670e51f")
+	record, _, exportKey, err := registration.Finalize(bytes.NewReader(append(envelopeNonce, salt...)), response)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := unhex(t, "02dc91b178ba2c4bbf9b9403fca25457b906a7f507e59b6e703031e09114ba2be07f0ed53532d3ae8e505ecc70d42d2b814b6b0e48156def71ea029148b2803aafa921f2a014513bd8a90e477a629794e89fec12d12206dde662ebdcf65670e51fe155412cb432898eda63529c3b2633521f770cccbd25d7548a4e20665a45e65a"); !bytes.Equal(record, want) {
+		t.Fatalf("registration record = %x, want %x", record, want)
+	}
+
+	clientEntropy := bytes.Join([][]byte{
+		unhex(t, "c497fddf6056d241e6cf9fb7ac37c384f49b357a221eb0a802c989b9942256c1"),
+		unhex(t, "ab3d33bde0e93eda72392346a7a73051110674bbf6b1b7ffab8be4f91fdaeeb1"),
+		unhex(t, "89d5a7e18567f255748a86beac13913df755a5adf776d69e143147b545d22134"),
+	}, nil)
+	client, ke1, err := NewClientLogin(bytes.NewReader(clientEntropy), password)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := unhex(t, "037342f0bcb3ecea754c1e67576c86aa90c1de3875f390ad599a26686cdfee6e07ab3d33bde0e93eda72392346a7a73051110674bbf6b1b7ffab8be4f91fdaeeb103493f36ca12467d1f5eaaabea67ca31377c4869c1e9a62346b6f01a991624b95d"); !bytes.Equal(ke1, want) {
+		t.Fatalf("KE1 = %x, want %x", ke1, want)
+	}
+
+	serverEntropy := bytes.Join([][]byte{
+		unhex(t, "38fe59af0df2c79f57b8780278f5ae47355fe1f817119041951c80f612fdfc6d"),
+		unhex(t, "71cd9960ecef2fe0d0f7494986fa3d8b2bb01963537e60efb13981e138e3d4a1"),
+		unhex(t, "9addab838c920fa7044f3a46b91ecaea24b0e72039928ee7d4c37a5b9bc17349"),
+	}, nil)
+	server, ke2, err := ss.NewServerLogin(bytes.NewReader(serverEntropy), credentialIdentifier, record, ke1)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := unhex(t, "0246da9fe4d41d5ba69faa6c509a1d5bafd49a48615a47a8dd4b0823cc1476481138fe59af0df2c79f57b8780278f5ae47355fe1f817119041951c80f612fdfc6d2f0c547f70deaeca54d878c14c1aa5e1ab405dec833777132eea905c2fbb12504a67dcbe0e66740c76b62c13b04a38a77926e19072953319ec65e41f9bfd2ae2687bd3348bfe33cb0bb9864fdb3b307f7dd68a17f3f150074a0bfc830ab889717d71cd9960ecef2fe0d0f7494986fa3d8b2bb01963537e60efb13981e138e3d4a1020e67941e94deba835214421d2d8c90de9b0f7f925d11e2032ce19b1832ae8e0fb5166145361a2c344d9737dd5c826fede3bbfafa418ad379ce4fa65fbb15db6e"); !bytes.Equal(ke2, want) {
+		t.Fatalf("KE2 = %x, want %x", ke2, want)
+	}
+
+	ke3, clientSessionKey, clientExportKey, err := client.Finish(ke2, salt)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := unhex(t, "272d04758b2b436bf0239ba7b9bd0a1686a9b6542ceaaf08732054beda956498"); !bytes.Equal(ke3, want) {
+		t.Fatalf("KE3 = %x, want %x", ke3, want)
+	}
+
+	wantSessionKey := unhex(t, "a224790a010afc0a3f37e23c1b7a5cb7f9e73e3d9a924116510d97d80e2a1e0c")
+	wantExportKey := unhex(t, "c3c9a1b0e33ac84dd83d0b7e8af6794e17e7a3caadff289fbd9dc769a853c64b")
+	if !bytes.Equal(clientSessionKey, wantSessionKey) {
+		t.Errorf("client session key = %x, want %x", clientSessionKey, wantSessionKey)
+	}
+	if !bytes.Equal(exportKey, wantExportKey) || !bytes.Equal(clientExportKey, wantExportKey) {
+		t.Errorf("export keys = %x and %x, want %x", exportKey, clientExportKey, wantExportKey)
+	}
+	if serverSessionKey, err := server.Finish(ke3); err != nil || !bytes.Equal(serverSessionKey, wantSessionKey) {
+		t.Errorf("server session key = %x, %v, want %x", serverSessionKey, err, wantSessionKey)
+	}
+}
+
+// TestWrongPassword checks that a login with the wrong password, or under the wrong salt, fails on both sides
+func TestWrongPassword(t *testing.T) {
+	ss, err := NewServerSetup(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registration, request, err := NewClientRegistration(rand.Reader, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := ss.RegistrationResponse("alice", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, salt, _, err := registration.Finalize(rand.Reader, response)
+	if err != nil {
+		t.Fatal(err)
+	} else if bytes.Equal(salt, make([]byte, KSFSaltByteLen)) {
+		t.Fatal("Finalize returned an all zero salt")
+	}
+
+	for _, test := range []struct {
+		name, password string
+		salt           []byte
+		wantErr        error
+	}{
+		{"right password", "correct horse", salt, nil},
+		{"wrong password", "battery staple", salt, ErrInvalidCredentials},
+		{"wrong salt", "correct horse", make([]byte, KSFSaltByteLen), ErrInvalidCredentials},
+	} {
+		client, ke1, err := NewClientLogin(rand.Reader, test.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, ke2, err := ss.NewServerLogin(rand.Reader, "alice", record, ke1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ke3, _, _, err := client.Finish(ke2, test.salt)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: ClientLogin.Finish returned %v, want %v", test.name, err, test.wantErr)
+		} else if _, err := server.Finish(ke3); !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: ServerLogin.Finish returned %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -1,56 +1,169 @@
 package crypto
 
 import (
-	"sync"
+	"context"
+	"errors"
+	"math/rand"
+	"time"
 
 	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/fft"
 	"github.com/thedonutfactory/go-tfhe/gates"
 	"github.com/thedonutfactory/go-tfhe/types"
 )
 
 // Packet is used to encrypt values, and decrypt or operate on encrypted values
 type Packet struct {
-	pub *gates.PublicKey
-	prv *gates.PrivateKey
+	pub       *gates.PublicKey
+	prv       *gates.PrivateKey
+	evaluator Evaluator
+	metrics   Metrics
+	progress  Progress
+	ctx       context.Context
+	destroyed bool
 }
 
-// lweKeyGen is a wrapper around a go-tfhe function to use ByteStream
-func lweKeyGen(byteStream *ByteStream, result *core.LweKey) {
+var (
+	ErrPacketDestroyed = errors.New("packet was destroyed")
+	ErrNoPrivateKey    = errors.New("packet has no private key")
+)
+
+// lweKeyGen is a wrapper around a go-tfhe function to use a ByteSource
+func lweKeyGen(byteSource ByteSource, result *core.LweKey) {
 	z := make([]int32, result.Params.N)
-	for i := range z {
-		z[i] = types.Torus32(byteStream.NextByte() & 1)
+	for i, b := range byteSource.NextBytes(len(z)) {
+		z[i] = types.Torus32(b & 1)
 	}
 	result.Key = z
 }
 
-// tlweKeyGen is a wrapper around a go-tfhe function to use ByteStream
-func tlweKeyGen(byteStream *ByteStream, result *core.TLweKey) {
+// tlweKeyGen is a wrapper around a go-tfhe function to use a ByteSource
+func tlweKeyGen(byteSource ByteSource, result *core.TLweKey) {
 	N := result.Params.N
 	k := result.Params.K
 	for i := int32(0); i < k; i++ {
-		for j := int32(0); j < N; j++ {
-			result.Key[i].Coefs[j] = types.Torus32(byteStream.NextByte() & 1)
+		for j, b := range byteSource.NextBytes(int(N)) {
+			result.Key[i].Coefs[j] = types.Torus32(b & 1)
 		}
 	}
 }
 
-// generateKeys is a wrapper around go-tfhe functions to generate a public-private key pair from a ByteStream
-func generateKeys(byteStream *ByteStream, params *gates.GateBootstrappingParameterSet) (*gates.PublicKey, *gates.PrivateKey) {
+// keySwitchKeyGen is go-tfhe's key switching key generation, encrypting each coefficient of the extracted TLWE key under the LWE key
+// in parallel on the pool gates run on, where the noises are drawn, and recentered, before any sample is encrypted
+// Each coefficient encrypted advances a progressTracker's stage
+func keySwitchKeyGen(result *core.LweKeySwitchKey, tlweKey *core.TLweKey, lweKey *core.LweKey, pt *progressTracker) {
+	N, k := tlweKey.Params.N, tlweKey.Params.K
+	extracted := make([]int32, 0, N*k)
+	for i := int32(0); i < k; i++ {
+		extracted = append(extracted, tlweKey.Key[i].Coefs[:N]...)
+	}
+
+	alpha := lweKey.Params.AlphaMin
+	noises := make([]float64, int(result.N*result.T*(result.Base-1)))
+	var mean float64
+	for i := range noises {
+		noises[i] = rand.Float64() * alpha
+		mean += noises[i]
+	}
+	mean /= float64(len(noises))
+
+	perCoefficient := int(result.T * (result.Base - 1))
+	parallelFor(int(result.N), func(i int) {
+		noise := noises[i*perCoefficient : (i+1)*perCoefficient]
+		for j := int32(0); j < result.T; j++ {
+			core.LweNoiselessTrivial(result.Ks[i][j][0], 0, lweKey.Params)
+			for h := int32(1); h < result.Base; h++ {
+				message := (extracted[i] * h) * (1 << (32 - (j+1)*result.Basebit))
+				core.LweSymEncryptWithExternalNoise(result.Ks[i][j][h], message, noise[0]-mean, alpha, lweKey)
+				noise = noise[1:]
+			}
+		}
+		pt.advance()
+	})
+}
+
+// bootstrappingKeyFFT is go-tfhe's InitLweBootstrappingKeyFFT, converting the TGSW samples of a bootstrapping key to the FFT domain
+// in parallel on the pool gates run on, where each sample converted advances a progressTracker's stage
+func bootstrappingKeyFFT(bk *core.LweBootstrappingKey, pt *progressTracker) *core.LweBootstrappingKeyFFT {
+	ks := core.NewLweKeySwitchKey(bk.Ks.N, bk.Ks.T, bk.Ks.Basebit, bk.InOutParams)
+	for i := range ks.Ks {
+		for j := range ks.Ks[i] {
+			for h := range ks.Ks[i][j] {
+				core.LweCopy(ks.Ks[i][j][h], bk.Ks.Ks[i][j][h], bk.InOutParams)
+			}
+		}
+	}
+
+	bkFFT := core.NewTGswSampleFFTArray(int32(len(bk.Bk)), bk.BkParams)
+	parallelFor(len(bk.Bk), func(i int) {
+		for p := range bkFFT[i].AllSample {
+			source, result := &bk.Bk[i].AllSample[p], bkFFT[i].AllSample[p]
+			for q := range result.A {
+				fft.TorusPolynomialIfft(result.A[q], source.A[q].Coefs)
+			}
+			result.CurrentVariance = source.CurrentVariance
+		}
+		pt.advance()
+	})
+
+	return core.NewLweBootstrappingKeyFFT(bk.InOutParams, bk.BkParams, bk.AccumParams, bk.ExtractParams, bkFFT, ks)
+}
+
+// generateKeys is a wrapper around go-tfhe functions to generate a public-private key pair from a ByteSource
+// Sources that can Fork give each key its own child stream
+// The samples of the bootstrapping and key switching keys, which are most of key generation's work, are encrypted,
+// and the bootstrapping key converted to the FFT domain, in parallel on the pool gates run on, reporting their progress to a Progress if it isn't nil
+func generateKeys(byteStream ByteSource, params *gates.GateBootstrappingParameterSet, progress Progress) (*gates.PublicKey, *gates.PrivateKey) {
+	lweSource, tlweSource := byteStream, byteStream
+	if f, ok := byteStream.(forker); ok {
+		lweSource, tlweSource = f.Fork("lwe key"), f.Fork("tlwe key")
+	}
+
 	lweKey := core.NewLweKey(params.InOutParams)
-	lweKeyGen(byteStream, lweKey)
+	lweKeyGen(lweSource, lweKey)
 
 	tgswKey := core.NewTGswKey(params.TgswParams)
-	tlweKeyGen(byteStream, &tgswKey.TlweKey)
-
-	bkw := core.NewLweBootstrappingKeyWrapper(params.KsT, params.KsBasebit, params.InOutParams, params.TgswParams, lweKey, tgswKey)
+	tlweKeyGen(tlweSource, &tgswKey.TlweKey)
+
+	accumParams := params.TgswParams.TlweParams
+	bk := &core.LweBootstrappingKey{
+		InOutParams:   params.InOutParams,
+		BkParams:      params.TgswParams,
+		AccumParams:   accumParams,
+		ExtractParams: &accumParams.ExtractedLweparams,
+		Bk:            core.NewTGswSampleArray(params.InOutParams.N, params.TgswParams),
+		Ks:            core.NewLweKeySwitchKey(accumParams.ExtractedLweparams.N, params.KsT, params.KsBasebit, params.InOutParams),
+	}
+	pt := newProgressTracker(progress)
+	pt.stage(0, keySwitchKeyShare, int(bk.Ks.N))
+	keySwitchKeyGen(bk.Ks, &tgswKey.TlweKey, lweKey, pt)
+
+	alpha := accumParams.AlphaMin
+	pt.stage(keySwitchKeyShare, keySwitchKeyShare+bootstrappingKeyShare, len(bk.Bk))
+	parallelFor(len(bk.Bk), func(i int) {
+		core.TGswSymEncryptInt(bk.Bk[i], lweKey.Key[i], alpha, tgswKey)
+		pt.advance()
+	})
+
+	pt.stage(1-bootstrappingKeyFFTShare, 1, len(bk.Bk))
+	bkw := &core.LweBootstrappingKeyWrapper{
+		Bk:    bk,
+		BkFFT: bootstrappingKeyFFT(bk, pt),
+	}
+	pt.finish()
 
 	return gates.NewPublicKey(params, bkw), gates.NewPrivateKey(params, bkw, lweKey, tgswKey)
 }
 
-// MakePacket makes a Packet from a ByteStream
-func MakePacket(byteStream *ByteStream) *Packet {
+// MakePacket makes a Packet from a ByteSource, such as a ByteStream
+func MakePacket(byteStream ByteSource) *Packet {
+	return MakePacketWithProgress(byteStream, nil)
+}
+
+// MakePacketWithProgress is MakePacket that reports the progress of key generation, which takes seconds, to a Progress
+func MakePacketWithProgress(byteStream ByteSource, progress Progress) *Packet {
 	ctx := gates.DefaultGateBootstrappingParameters(128)
-	pub, prv := generateKeys(byteStream, ctx)
+	pub, prv := generateKeys(byteStream, ctx, progress)
 	return &Packet{
 		pub: pub,
 		prv: prv,
@@ -67,92 +180,193 @@ func (p *Packet) Pub() *gates.PublicKey {
 	return p.pub
 }
 
+// PublicKey returns the json marshallable form of a Packet's public key
+func (p *Packet) PublicKey() *PublicKey {
+	return MakePublicKey(p.pub)
+}
+
 // Pub returns a Packet's private key
 func (p *Packet) Prv() *gates.PrivateKey {
 	return p.prv
 }
 
-// Encrypt uses a Packet's private key to encrypt a payload
-func (p *Packet) Encrypt(payload []byte) gates.Ctxt {
-	ctxt := make(gates.Ctxt, 8*len(payload))
-	i := 0
-	for _, b := range payload {
-		for j := 0; j < 8; j++ {
-			ctxt[i] = p.prv.BootsSymEncrypt(int(b>>j) & 0x1)
-			i++
+// HasPrivate returns whether a Packet holds a private key, which encrypts and decrypts, rather than only its public key
+func (p *Packet) HasPrivate() bool {
+	return p.prv != nil
+}
+
+// Destroy wipes the coefficients of a Packet's private key and marks it unusable, so a secret derived from a password doesn't outlive the login it was for
+// Copies of the Packet, such as those made by WithContext, share the wiped key, and operating on a destroyed Packet panics with ErrPacketDestroyed
+func (p *Packet) Destroy() {
+	if p.prv != nil {
+		clear(p.prv.LweKey.Key)
+		for _, polynomial := range p.prv.TgswKey.Key {
+			clear(polynomial.Coefs)
+		}
+		for _, polynomial := range p.prv.TgswKey.TlweKey.Key {
+			clear(polynomial.Coefs)
 		}
 	}
 
-	return ctxt
+	p.pub, p.prv, p.destroyed = nil, nil, true
+}
+
+// Destroyed returns whether a Packet was destroyed
+func (p *Packet) Destroyed() bool {
+	return p.destroyed
+}
+
+// PublicOnly returns a copy of a Packet without its private key, which only operates on encrypted values,
+// so code that should never hold secret material, such as a server's, can be given a Packet that can't leak it
+func (p *Packet) PublicOnly() *Packet {
+	copied := *p
+	copied.prv = nil
+	return &copied
+}
+
+// checkPrivate returns ErrNoPrivateKey if a Packet has no private key, such as one made by MakePublicPacket or PublicOnly,
+// or ErrPacketDestroyed if it was destroyed
+func (p *Packet) checkPrivate() error {
+	if p.destroyed {
+		return ErrPacketDestroyed
+	} else if p.prv == nil {
+		return ErrNoPrivateKey
+	}
+
+	return nil
+}
+
+// Encrypt uses a Packet's private key to encrypt a payload, reporting its progress if the Packet was made WithProgress
+// Packets without a private key return ErrNoPrivateKey
+func (p *Packet) Encrypt(payload []byte) (gates.Ctxt, error) {
+	return p.EncryptInto(nil, payload)
 }
 
 // Decrypt uses a Packet's private key to decrypt a payload
-func (p *Packet) Decrypt(encryptedPayload gates.Ctxt) []byte {
-	result := make([]byte, (len(encryptedPayload)+7)/8)
-	if len(result) == 0 {
-		return nil
+// Packets without a private key return ErrNoPrivateKey
+func (p *Packet) Decrypt(encryptedPayload gates.Ctxt) ([]byte, error) {
+	if err := p.checkPrivate(); err != nil {
+		return nil, err
+	} else if len(encryptedPayload) == 0 {
+		return nil, nil
 	}
 
-	i := 0
-	for j := 0; ; j++ {
-		for k := 0; k < 8; k++ {
-			result[j] = (result[j] >> 1) | (byte(p.prv.BootsSymDecrypt(encryptedPayload[i])) << 7)
-			i++
+	return p.DecryptInto(nil, encryptedPayload)
+}
 
-			if i >= len(encryptedPayload) {
-				return result
-			}
+// EncryptBits uses a Packet's private key to encrypt a payload of bits, one sample per bit in order
+func (p *Packet) EncryptBits(payload []bool) (gates.Ctxt, error) {
+	if err := p.checkPrivate(); err != nil {
+		return nil, err
+	}
+	defer p.observeEncrypt(len(payload), time.Now())
+
+	ctxt := make(gates.Ctxt, len(payload))
+	pt := newProgressTracker(p.progress)
+	pt.stage(0, 1, len(ctxt))
+	for i, b := range payload {
+		bit := 0
+		if b {
+			bit = 1
 		}
+		ctxt[i] = getSample(p.prv.LweKey.Params)
+		p.encryptBit(ctxt[i], bit)
+		pt.advance()
+	}
+	pt.finish()
+
+	return ctxt, nil
+}
+
+// DecryptBits uses a Packet's private key to decrypt an encrypted payload into bits, one per sample in order
+// Unlike Decrypt, no bytes are packed, so payloads that aren't a multiple of 8 bits need no padding
+func (p *Packet) DecryptBits(encryptedPayload gates.Ctxt) ([]bool, error) {
+	if err := p.checkPrivate(); err != nil {
+		return nil, err
+	}
+	defer p.observeDecrypt(len(encryptedPayload), time.Now())
+
+	result := make([]bool, len(encryptedPayload))
+	for i, sample := range encryptedPayload {
+		result[i] = p.prv.BootsSymDecrypt(sample) == 1
 	}
+
+	return result, nil
 }
 
 // And uses a Packet's public key to perform a bitwise And on two encrypted payloads in parallel
 func (p *Packet) And(a, b gates.Ctxt) gates.Ctxt {
-	return p.ParallelBinary((*gates.PublicKey).And)(a, b)
+	return p.evaluate(OpAnd, a, b)
 }
 
 // Or uses a Packet's public key to perform a bitwise Or on two encrypted payloads in parallel
 func (p *Packet) Or(a, b gates.Ctxt) gates.Ctxt {
-	return p.ParallelBinary((*gates.PublicKey).Or)(a, b)
+	return p.evaluate(OpOr, a, b)
 }
 
 // Xor uses a Packet's public key to perform a bitwise Xor on two encrypted payloads in parallel
 func (p *Packet) Xor(a, b gates.Ctxt) gates.Ctxt {
-	return p.ParallelBinary((*gates.PublicKey).Xor)(a, b)
+	return p.evaluate(OpXor, a, b)
 }
 
 // XNor uses a Packet's public key to perform a bitwise XNor on two encrypted payloads in parallel
 func (p *Packet) XNor(a, b gates.Ctxt) gates.Ctxt {
-	return p.ParallelBinary((*gates.PublicKey).Xnor)(a, b)
+	return p.evaluate(OpXNor, a, b)
+}
+
+// Nand uses a Packet's public key to perform a bitwise Nand on two encrypted payloads in parallel
+func (p *Packet) Nand(a, b gates.Ctxt) gates.Ctxt {
+	return p.evaluate(OpNand, a, b)
+}
+
+// Nor uses a Packet's public key to perform a bitwise Nor on two encrypted payloads in parallel
+func (p *Packet) Nor(a, b gates.Ctxt) gates.Ctxt {
+	return p.evaluate(OpNor, a, b)
+}
+
+// Mux uses a Packet's public key to select bits of the first payload where the selector is set, and of the second elsewhere, in parallel
+func (p *Packet) Mux(s, a, b gates.Ctxt) gates.Ctxt {
+	return p.evaluate(OpMux, s, a, b)
+}
+
+// Constant uses a Packet's public key to make trivial, unencrypted samples of a payload of bits
+func (p *Packet) Constant(payload []bool) gates.Ctxt {
+	ctxt := make(gates.Ctxt, len(payload))
+	for i, b := range payload {
+		ctxt[i] = p.pub.Constant(b)
+	}
+
+	return ctxt
 }
 
 // Not uses a Packet's public key to perform a bitwise Not on two encrypted payloads in parallel
 func (p *Packet) Not(a gates.Ctxt) gates.Ctxt {
-	return p.ParallelUnary((*gates.PublicKey).Not)(a)
+	return p.evaluate(OpNot, a)
 }
 
 // Copy uses a Packet's public key to copy an encrypted payload in parallel
 func (p *Packet) Copy(a gates.Ctxt) gates.Ctxt {
-	return p.ParallelUnary((*gates.PublicKey).Copy)(a)
+	return p.evaluate(OpCopy, a)
+}
+
+// Refresh uses a Packet's public key to bootstrap an encrypted payload in parallel, resetting its noise without changing its value
+func (p *Packet) Refresh(a gates.Ctxt) gates.Ctxt {
+	return p.evaluate(OpRefresh, a)
+}
+
+// bootstrap is a go-tfhe style gate that bootstraps a sample, preserving the encrypted bit
+func bootstrap(pk *gates.PublicKey, a *core.LweSample) *core.LweSample {
+	return core.TfheBootstrapFFT(pk.Bkw.BkFFT, types.ModSwitchToTorus32(1, 8), a)
 }
 
 // ParallelUnary uses a Packet's public key to performa binary operation on an encrypted payload in parallel
 func (p *Packet) ParallelUnary(operation func(pk *gates.PublicKey, a *core.LweSample) *core.LweSample) func(a gates.Ctxt) gates.Ctxt {
 	return func(a gates.Ctxt) gates.Ctxt {
-		var wg sync.WaitGroup
-		wg.Add(len(a))
-
 		result := make([]*core.LweSample, len(a))
-		for i := range a {
-			i := i
-			go func() {
-				defer wg.Done()
+		parallelFor(len(a), func(i int) {
+			result[i] = operation(p.pub, a[i])
+		})
 
-				result[i] = operation(p.pub, a[i])
-			}()
-		}
-
-		wg.Wait()
 		return result
 	}
 }
@@ -164,20 +378,11 @@ func (p *Packet) ParallelBinary(operation func(pk *gates.PublicKey, a, b *core.L
 			panic("expected equal bit size")
 		}
 
-		var wg sync.WaitGroup
-		wg.Add(len(a))
-
 		result := make([]*core.LweSample, len(a))
-		for i := range a {
-			i := i
-			go func() {
-				defer wg.Done()
-
-				result[i] = operation(p.pub, a[i], b[i])
-			}()
-		}
+		parallelFor(len(a), func(i int) {
+			result[i] = operation(p.pub, a[i], b[i])
+		})
 
-		wg.Wait()
 		return result
 	}
 }
@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+var ErrMalformedPadding = errors.New("malformed padded payload")
+
+// lengthPrefixBits returns the width of the length prefix of payloads of up to a capacity of bits, enough to count to the capacity
+func lengthPrefixBits(capacityBits int) int {
+	return bits.Len(uint(capacityBits))
+}
+
+// PaddedByteLen returns the length in bytes every payload of up to a capacity of bits is padded to
+func PaddedByteLen(capacityBits int) int {
+	return (lengthPrefixBits(capacityBits) + capacityBits + 7) / 8
+}
+
+// PadBits encodes a payload of up to a capacity of bits as PaddedByteLen bytes: its length in bits, then its bits, then zeros,
+// each least significant first, as Encrypt orders a byte's bits, so payloads that aren't byte-aligned or of a fixed length round-trip through Encrypt and Decrypt,
+// and every payload of a capacity encrypts to as many samples, whatever its length
+func PadBits(payload []bool, capacityBits int) ([]byte, error) {
+	if capacityBits < 0 || len(payload) > capacityBits {
+		return nil, fmt.Errorf("%w: %d bits exceeds a capacity of %d", ErrMalformedPadding, len(payload), capacityBits)
+	}
+
+	padded := make([]byte, PaddedByteLen(capacityBits))
+	prefixBits := lengthPrefixBits(capacityBits)
+	for i := 0; i < prefixBits; i++ {
+		if len(payload)>>i&1 == 1 {
+			padded[i/8] |= 1 << (i % 8)
+		}
+	}
+	for i, b := range payload {
+		if b {
+			padded[(prefixBits+i)/8] |= 1 << ((prefixBits + i) % 8)
+		}
+	}
+
+	return padded, nil
+}
+
+// UnpadBits decodes a payload PadBits encoded with a capacity, rejecting encodings of another length, whose length exceeds the capacity,
+// or whose padding isn't zeros, so every payload has exactly one encoding
+func UnpadBits(padded []byte, capacityBits int) ([]bool, error) {
+	if capacityBits < 0 || len(padded) != PaddedByteLen(capacityBits) {
+		return nil, fmt.Errorf("%w: %d bytes, expected %d", ErrMalformedPadding, len(padded), PaddedByteLen(capacityBits))
+	}
+
+	bit := func(i int) bool {
+		return padded[i/8]>>(i%8)&1 == 1
+	}
+	prefixBits, length := lengthPrefixBits(capacityBits), 0
+	for i := 0; i < prefixBits; i++ {
+		if bit(i) {
+			length |= 1 << i
+		}
+	}
+	if length > capacityBits {
+		return nil, fmt.Errorf("%w: %d bits exceeds a capacity of %d", ErrMalformedPadding, length, capacityBits)
+	}
+
+	payload := make([]bool, length)
+	for i := range payload {
+		payload[i] = bit(prefixBits + i)
+	}
+	for i := prefixBits + length; i < 8*len(padded); i++ {
+		if bit(i) {
+			return nil, fmt.Errorf("%w: nonzero padding", ErrMalformedPadding)
+		}
+	}
+
+	return payload, nil
+}
+
+// PadBytes encodes a payload of up to a capacity of bytes as PadBits does its bits
+func PadBytes(payload []byte, capacityBytes int) ([]byte, error) {
+	payloadBits := make([]bool, 8*len(payload))
+	for i := range payloadBits {
+		payloadBits[i] = payload[i/8]>>(i%8)&1 == 1
+	}
+
+	return PadBits(payloadBits, 8*capacityBytes)
+}
+
+// UnpadBytes decodes a payload PadBytes encoded with a capacity, rejecting those whose length isn't a whole number of bytes
+func UnpadBytes(padded []byte, capacityBytes int) ([]byte, error) {
+	payloadBits, err := UnpadBits(padded, 8*capacityBytes)
+	if err != nil {
+		return nil, err
+	} else if len(payloadBits)%8 != 0 {
+		return nil, fmt.Errorf("%w: %d bits isn't a whole number of bytes", ErrMalformedPadding, len(payloadBits))
+	}
+
+	payload := make([]byte, len(payloadBits)/8)
+	for i, b := range payloadBits {
+		if b {
+			payload[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return payload, nil
+}
+
+// EncryptPadded uses a Scheme's private key to encrypt a payload of up to a capacity of bits, padded by PadBits
+func EncryptPadded(scheme Scheme, payload []bool, capacityBits int) (gates.Ctxt, error) {
+	padded, err := PadBits(payload, capacityBits)
+	if err != nil {
+		return nil, err
+	}
+
+	return scheme.Encrypt(padded)
+}
+
+// DecryptPadded uses a Scheme's private key to decrypt a payload EncryptPadded encrypted with a capacity
+func DecryptPadded(scheme Scheme, encryptedPayload gates.Ctxt, capacityBits int) ([]bool, error) {
+	if len(encryptedPayload) != 8*PaddedByteLen(capacityBits) {
+		return nil, fmt.Errorf("%w: %d bits, expected %d", ErrMalformedPadding, len(encryptedPayload), 8*PaddedByteLen(capacityBits))
+	}
+
+	padded, err := scheme.Decrypt(encryptedPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	return UnpadBits(padded, capacityBits)
+}
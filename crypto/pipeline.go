@@ -0,0 +1,125 @@
+package crypto
+
+import (
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+type (
+	// pipelineStep applies one gate to a bit's intermediate result, given the bit's index
+	// owned reports whether the intermediate result was made by the pipeline, so it may be changed in place or released
+	pipelineStep func(pk *gates.PublicKey, acc *core.LweSample, owned bool, i int) (*core.LweSample, bool)
+
+	// Pipeline is a chain of bitwise gates that a Packet evaluates bit by bit in a single parallel pass
+	// Unlike chaining Packet operations, no intermediate payloads are allocated, Not negates intermediate results in place,
+	// and superseded intermediate results are released for reuse by later encryptions
+	Pipeline struct {
+		packet *Packet
+		input  gates.Ctxt
+		steps  []pipelineStep
+		ops    []Op
+	}
+)
+
+// Pipeline returns an empty Pipeline over an encrypted payload, which evaluates to a copy of it
+func (p *Packet) Pipeline(a gates.Ctxt) *Pipeline {
+	return &Pipeline{
+		packet: p,
+		input:  a,
+	}
+}
+
+// then returns a Pipeline with a bootstrapped binary gate against another encrypted payload appended
+func (pl *Pipeline) then(op Op, operation func(pk *gates.PublicKey, a, b *core.LweSample) *core.LweSample, b gates.Ctxt) *Pipeline {
+	if len(b) != len(pl.input) {
+		panic("expected equal bit size")
+	}
+
+	pl.ops = append(pl.ops, op)
+	pl.steps = append(pl.steps, func(pk *gates.PublicKey, acc *core.LweSample, owned bool, i int) (*core.LweSample, bool) {
+		result := operation(pk, acc, b[i])
+		if owned {
+			samplePool.Put(acc)
+		}
+
+		return result, true
+	})
+	return pl
+}
+
+// And appends a bitwise And with an encrypted payload
+func (pl *Pipeline) And(b gates.Ctxt) *Pipeline {
+	return pl.then(OpAnd, (*gates.PublicKey).And, b)
+}
+
+// Or appends a bitwise Or with an encrypted payload
+func (pl *Pipeline) Or(b gates.Ctxt) *Pipeline {
+	return pl.then(OpOr, (*gates.PublicKey).Or, b)
+}
+
+// Xor appends a bitwise Xor with an encrypted payload
+func (pl *Pipeline) Xor(b gates.Ctxt) *Pipeline {
+	return pl.then(OpXor, (*gates.PublicKey).Xor, b)
+}
+
+// XNor appends a bitwise XNor with an encrypted payload
+func (pl *Pipeline) XNor(b gates.Ctxt) *Pipeline {
+	return pl.then(OpXNor, (*gates.PublicKey).Xnor, b)
+}
+
+// Nand appends a bitwise Nand with an encrypted payload
+func (pl *Pipeline) Nand(b gates.Ctxt) *Pipeline {
+	return pl.then(OpNand, (*gates.PublicKey).Nand, b)
+}
+
+// Nor appends a bitwise Nor with an encrypted payload
+func (pl *Pipeline) Nor(b gates.Ctxt) *Pipeline {
+	return pl.then(OpNor, (*gates.PublicKey).Nor, b)
+}
+
+// Not appends a bitwise Not, which needs no bootstrapping and is done in place on intermediate results
+func (pl *Pipeline) Not() *Pipeline {
+	pl.ops = append(pl.ops, OpNot)
+	pl.steps = append(pl.steps, func(pk *gates.PublicKey, acc *core.LweSample, owned bool, i int) (*core.LweSample, bool) {
+		if !owned {
+			return pk.Not(acc), true
+		}
+
+		core.LweNegate(acc, acc, pk.Params.InOutParams)
+		return acc, true
+	})
+	return pl
+}
+
+// Eval evaluates a Pipeline into a new encrypted payload
+func (pl *Pipeline) Eval() gates.Ctxt {
+	return pl.Into(nil)
+}
+
+// Into evaluates a Pipeline into dst's backing array when it is large enough, and returns the resized dst
+// dst may be the Pipeline's input or one of its operands, since each bit is only read before its result is written
+// Bits are left nil once the Packet's context is done
+func (pl *Pipeline) Into(dst gates.Ctxt) gates.Ctxt {
+	if cap(dst) < len(pl.input) {
+		dst = make(gates.Ctxt, len(pl.input))
+	}
+	dst = dst[:len(pl.input)]
+
+	pk := pl.packet.pub
+	defer pl.packet.observeGates(len(pl.input), time.Now(), pl.ops...)
+	parallelForContext(pl.packet.context(), len(pl.input), func(i int) {
+		acc, owned := pl.input[i], false
+		for _, step := range pl.steps {
+			acc, owned = step(pk, acc, owned, i)
+		}
+		if !owned {
+			acc = pk.Copy(acc)
+		}
+
+		dst[i] = acc
+	})
+
+	return dst
+}
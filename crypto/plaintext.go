@@ -0,0 +1,252 @@
+package crypto
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// PlaintextSchemeName is the Scheme of a PlaintextScheme's public keys
+const PlaintextSchemeName = "plaintext"
+
+type (
+	// PlaintextScheme is a fake Scheme whose samples hold their bit in B and their key's id in A, so operations cost nothing
+	// Samples of another key decrypt to random bits, like TFHE samples decrypted with the wrong key, so wrong passwords still fail
+	// It hides nothing, so it must never be used outside tests
+	PlaintextScheme struct {
+		id int32
+	}
+
+	// plaintextBackend is a Backend of PlaintextSchemes
+	plaintextBackend struct{}
+)
+
+// MakePlaintextBackend returns a Backend of PlaintextSchemes, for tests that would otherwise spend seconds on TFHE
+func MakePlaintextBackend() Backend {
+	return plaintextBackend{}
+}
+
+// GenerateKeys makes a PlaintextScheme whose key id is drawn from a Seed
+func (plaintextBackend) GenerateKeys(seed Seed) (Scheme, error) {
+	byteSource, err := seed.byteSource()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlaintextScheme{id: int32(binary.LittleEndian.Uint32(byteSource.NextBytes(4)))}, nil
+}
+
+// MakePublicScheme makes a PlaintextScheme from a public key, rejecting keys of other schemes
+func (plaintextBackend) MakePublicScheme(publicKey *PublicKey) (Scheme, error) {
+	if publicKey == nil {
+		return nil, ErrMalformedPublicKey
+	}
+	if publicKey.Scheme != PlaintextSchemeName {
+		return nil, fmt.Errorf("%w: %q", ErrSchemeMismatch, publicKey.Scheme)
+	}
+
+	return &PlaintextScheme{id: publicKey.KeyID}, nil
+}
+
+// sample returns a sample of a bit under a PlaintextScheme's key
+func (ps *PlaintextScheme) sample(bit int32) *core.LweSample {
+	return &core.LweSample{A: []int32{ps.id}, B: bit}
+}
+
+// bit returns the bit of a sample, which is random for samples of another key
+func (ps *PlaintextScheme) bit(sample *core.LweSample) int32 {
+	if len(sample.A) != 1 || sample.A[0] != ps.id {
+		return int32(MakeRandByteStream().NextByte() & 1)
+	}
+
+	return sample.B & 1
+}
+
+// Encrypt stores a payload's bits in samples, least significant bit of each byte first
+func (ps *PlaintextScheme) Encrypt(payload []byte) (gates.Ctxt, error) {
+	ctxt := make(gates.Ctxt, 0, 8*len(payload))
+	for _, b := range payload {
+		for j := 0; j < 8; j++ {
+			ctxt = append(ctxt, ps.sample(int32(b>>j)&1))
+		}
+	}
+
+	return ctxt, nil
+}
+
+// Decrypt packs samples' bits into bytes, least significant bit of each byte first
+func (ps *PlaintextScheme) Decrypt(encryptedPayload gates.Ctxt) ([]byte, error) {
+	result := make([]byte, (len(encryptedPayload)+7)/8)
+	for i, sample := range encryptedPayload {
+		result[i/8] |= byte(ps.bit(sample)) << (i % 8)
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// Constant returns samples of unencrypted bits
+func (ps *PlaintextScheme) Constant(payload []bool) gates.Ctxt {
+	ctxt := make(gates.Ctxt, len(payload))
+	for i, b := range payload {
+		ctxt[i] = ps.sample(boolToBit(b))
+	}
+
+	return ctxt
+}
+
+// boolToBit returns 1 for true and 0 for false
+func boolToBit(b bool) int32 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// unary returns a bitwise operation on a payload, keeping each sample's key
+func (ps *PlaintextScheme) unary(operation func(a int32) int32) func(a gates.Ctxt) gates.Ctxt {
+	return func(a gates.Ctxt) gates.Ctxt {
+		result := make(gates.Ctxt, len(a))
+		for i, sample := range a {
+			result[i] = &core.LweSample{A: append([]int32(nil), sample.A...), B: operation(sample.B & 1)}
+		}
+
+		return result
+	}
+}
+
+// binary returns a bitwise operation on two payloads, keeping the first payload's keys
+func (ps *PlaintextScheme) binary(operation func(a, b int32) int32) func(a, b gates.Ctxt) gates.Ctxt {
+	return func(a, b gates.Ctxt) gates.Ctxt {
+		if len(a) != len(b) {
+			panic("expected equal bit size")
+		}
+
+		result := make(gates.Ctxt, len(a))
+		for i := range a {
+			result[i] = &core.LweSample{A: append([]int32(nil), a[i].A...), B: operation(a[i].B&1, b[i].B&1) & 1}
+		}
+
+		return result
+	}
+}
+
+// And performs a bitwise And on two payloads
+func (ps *PlaintextScheme) And(a, b gates.Ctxt) gates.Ctxt {
+	return ps.binary(func(a, b int32) int32 { return a & b })(a, b)
+}
+
+// Or performs a bitwise Or on two payloads
+func (ps *PlaintextScheme) Or(a, b gates.Ctxt) gates.Ctxt {
+	return ps.binary(func(a, b int32) int32 { return a | b })(a, b)
+}
+
+// Xor performs a bitwise Xor on two payloads
+func (ps *PlaintextScheme) Xor(a, b gates.Ctxt) gates.Ctxt {
+	return ps.binary(func(a, b int32) int32 { return a ^ b })(a, b)
+}
+
+// XNor performs a bitwise XNor on two payloads
+func (ps *PlaintextScheme) XNor(a, b gates.Ctxt) gates.Ctxt {
+	return ps.binary(func(a, b int32) int32 { return ^(a ^ b) })(a, b)
+}
+
+// Nand performs a bitwise Nand on two payloads
+func (ps *PlaintextScheme) Nand(a, b gates.Ctxt) gates.Ctxt {
+	return ps.binary(func(a, b int32) int32 { return ^(a & b) })(a, b)
+}
+
+// Nor performs a bitwise Nor on two payloads
+func (ps *PlaintextScheme) Nor(a, b gates.Ctxt) gates.Ctxt {
+	return ps.binary(func(a, b int32) int32 { return ^(a | b) })(a, b)
+}
+
+// Mux selects bits of the first payload where the selector is set, and of the second elsewhere
+func (ps *PlaintextScheme) Mux(s, a, b gates.Ctxt) gates.Ctxt {
+	return ps.Or(ps.And(a, s), ps.And(b, ps.Not(s)))
+}
+
+// Add adds two integers of equal width as Packet.Add does, into a result one bit wider, keeping the first integer's keys
+func (ps *PlaintextScheme) Add(a, b gates.Ctxt) gates.Ctxt {
+	if len(a) != len(b) {
+		panic("expected equal bit size")
+	}
+
+	result := make(gates.Ctxt, len(a)+1)
+	carry := int32(0)
+	for i := range a {
+		sum := a[i].B&1 + b[i].B&1 + carry
+		result[i] = &core.LweSample{A: append([]int32(nil), a[i].A...), B: sum & 1}
+		carry = sum >> 1
+	}
+	result[len(a)] = ps.sample(carry)
+
+	return result
+}
+
+// Not performs a bitwise Not on a payload
+func (ps *PlaintextScheme) Not(a gates.Ctxt) gates.Ctxt {
+	return ps.unary(func(a int32) int32 { return a ^ 1 })(a)
+}
+
+// Copy copies a payload
+func (ps *PlaintextScheme) Copy(a gates.Ctxt) gates.Ctxt {
+	return ps.unary(func(a int32) int32 { return a })(a)
+}
+
+// Refresh copies a payload, since plaintext samples have no noise
+func (ps *PlaintextScheme) Refresh(a gates.Ctxt) gates.Ctxt {
+	return ps.Copy(a)
+}
+
+// Validate checks that every sample in a payload holds a key id and a bit
+func (ps *PlaintextScheme) Validate(a gates.Ctxt) error {
+	for i, sample := range a {
+		if sample == nil || len(sample.A) != 1 || sample.B&^1 != 0 {
+			return fmt.Errorf("%w: bit %d", ErrMalformedSample, i)
+		}
+	}
+
+	return nil
+}
+
+// PublicKey returns the public key identifying a PlaintextScheme's key
+func (ps *PlaintextScheme) PublicKey() *PublicKey {
+	return &PublicKey{
+		Scheme: PlaintextSchemeName,
+		KeyID:  ps.id,
+	}
+}
+
+// SwitchingKey returns the switching key to another PlaintextScheme's key
+func (ps *PlaintextScheme) SwitchingKey(to Scheme) *PublicKey {
+	return to.PublicKey()
+}
+
+// WithContext returns a PlaintextScheme itself, since its operations are too quick to be worth cancelling
+func (ps *PlaintextScheme) WithContext(ctx context.Context) Scheme {
+	return ps
+}
+
+// SwitchKey uses a PlaintextScheme made from a switching key to move a payload to the switching key's target
+func (ps *PlaintextScheme) SwitchKey(ctxt gates.Ctxt, toPublicKey *PublicKey) (gates.Ctxt, error) {
+	if toPublicKey == nil || toPublicKey.Scheme != PlaintextSchemeName || toPublicKey.KeyID != ps.id {
+		return nil, ErrKeyMismatch
+	}
+
+	result := make(gates.Ctxt, len(ctxt))
+	for i, sample := range ctxt {
+		if sample == nil {
+			return nil, fmt.Errorf("%w: bit %d", ErrMalformedSample, i)
+		}
+		result[i] = ps.sample(sample.B & 1)
+	}
+
+	return result, ps.Validate(result)
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelFor calls f for every index in [0, n) on a pool of at most GOMAXPROCS goroutines
+// Gate evaluations are CPU bound, so more goroutines than processors only adds scheduling overhead
+func parallelFor(n int, f func(i int)) {
+	parallelForContext(context.Background(), n, f)
+}
+
+// parallelForContext is parallelFor that stops starting new indices once a context is done
+// A panic in f stops the pool starting new indices, and is raised again in the calling goroutine, where callers such as servers can recover it
+func parallelForContext(ctx context.Context, n int, f func(i int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+
+	var next atomic.Int64
+	var panicked atomic.Pointer[any]
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					panicked.CompareAndSwap(nil, &r)
+				}
+			}()
+
+			for i := int(next.Add(1) - 1); i < n && ctx.Err() == nil && panicked.Load() == nil; i = int(next.Add(1) - 1) {
+				f(i)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if r := panicked.Load(); r != nil {
+		panic(*r)
+	}
+}
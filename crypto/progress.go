@@ -0,0 +1,93 @@
+package crypto
+
+import "sync"
+
+const (
+	// progressSteps is how many times an operation reports its progress at most before it completes
+	progressSteps = 100
+
+	// keySwitchKeyShare, bootstrappingKeyShare, and bootstrappingKeyFFTShare are the fractions of key generation's time spent encrypting the key switching key,
+	// encrypting the bootstrapping key, and converting it to the FFT domain, measured at the 128 bit parameter level, which other levels are close to
+	keySwitchKeyShare        = 0.15
+	bootstrappingKeyShare    = 0.55
+	bootstrappingKeyFFTShare = 0.30
+)
+
+type (
+	// Progress is called with the fraction of a slow operation that is complete, from 0 to 1, so CLIs and UIs can display its progress
+	// Calls are serialized, their fractions only increase, and the last is 1, but they may come from goroutines other than the caller's,
+	// and work waits on them, so they should return quickly
+	Progress func(fraction float64)
+
+	// progressTracker reports an operation's progress through stages, each a span of the operation's fractions split into units of work
+	// A nil progressTracker, of an operation whose progress isn't reported, ignores its calls
+	progressTracker struct {
+		progress Progress
+		from     float64
+		to       float64
+		done     int
+		total    int
+		reported int
+		mu       sync.Mutex
+	}
+)
+
+// WithProgress returns a copy of a Packet that reports the progress of each payload it encrypts to a Progress
+func (p *Packet) WithProgress(progress Progress) *Packet {
+	copied := *p
+	copied.progress = progress
+	return &copied
+}
+
+// newProgressTracker returns a progressTracker that reports to a Progress, or nil if the Progress is nil
+func newProgressTracker(progress Progress) *progressTracker {
+	if progress == nil {
+		return nil
+	}
+
+	return &progressTracker{progress: progress}
+}
+
+// stage starts a stage of an operation spanning fractions from one to another, split into units of work
+func (pt *progressTracker) stage(from, to float64, total int) {
+	if pt == nil {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pt.from, pt.to, pt.done, pt.total = from, to, 0, total
+}
+
+// advance records a unit of the current stage as done, reporting the operation's progress each time it passes a step
+func (pt *progressTracker) advance() {
+	if pt == nil {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pt.done++
+	fraction := pt.from + (pt.to-pt.from)*float64(pt.done)/float64(pt.total)
+	if step := int(fraction * progressSteps); step > pt.reported && step < progressSteps {
+		pt.reported = step
+		pt.progress(fraction)
+	}
+}
+
+// finish reports the operation as complete
+func (pt *progressTracker) finish() {
+	if pt == nil {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if pt.reported < progressSteps {
+		pt.reported = progressSteps
+		pt.progress(1)
+	}
+}
@@ -1,6 +1,8 @@
 package crypto
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 
 	"github.com/thedonutfactory/go-tfhe/core"
@@ -57,9 +59,12 @@ type (
 	}
 
 	// PublicKey is a json marshallable version of the go-tfhe public key
+	// Keys of other Schemes name their Scheme, and those without a bootstrapping key are identified by KeyID
 	PublicKey struct {
 		Params *gates.GateBootstrappingParameterSet
 		Bkw    *lweBootstrappingKeyWrapper
+		Scheme string `json:",omitempty"`
+		KeyID  int32  `json:",omitempty"`
 	}
 )
 
@@ -76,6 +81,11 @@ func (lhcp *lagrangeHalfCPolynomial) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&l)
 }
 
+// JSONType returns a value of the type a lagrangeHalfCPolynomial is encoded as, so schemas of the types embedding it can describe its encoding
+func (*lagrangeHalfCPolynomial) JSONType() any {
+	return _lagrangeHalfCPolynomial{}
+}
+
 func (lhcp *lagrangeHalfCPolynomial) UnmarshalJSON(data []byte) error {
 	var l _lagrangeHalfCPolynomial
 	if err := json.Unmarshal(data, &l); err != nil {
@@ -219,3 +229,55 @@ func (pk *PublicKey) fromPublicKey() *gates.PublicKey {
 		Bkw:    Bkw,
 	}
 }
+
+// SecurityLevel returns the estimated bits of security of a PublicKey's parameter set, or 0 if the parameter set is unrecognized
+func (pk *PublicKey) SecurityLevel() int {
+	if pk == nil || pk.Params == nil || pk.Params.InOutParams == nil {
+		return 0
+	}
+
+	for _, lambda := range []int32{128, 80} {
+		params := gates.DefaultGateBootstrappingParameters(lambda)
+		if pk.Params.InOutParams.N == params.InOutParams.N && pk.Params.KsT == params.KsT && pk.Params.KsBasebit == params.KsBasebit {
+			return int(lambda)
+		}
+	}
+
+	return 0
+}
+
+// Fingerprint returns a hash identifying a PublicKey, which covers its Scheme, KeyID, and parameters,
+// and the samples of its key-switching key, which are drawn from its private key, rather than the whole key
+// A nil PublicKey has a nil fingerprint
+func (pk *PublicKey) Fingerprint() []byte {
+	if pk == nil {
+		return nil
+	}
+
+	h := sha256.New()
+	buf := binary.BigEndian.AppendUint64(nil, uint64(len(pk.Scheme)))
+	buf = append(buf, pk.Scheme...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(pk.KeyID))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(pk.SecurityLevel()))
+	h.Write(buf)
+
+	if pk.Bkw == nil || pk.Bkw.Bk == nil || pk.Bkw.Bk.Ks == nil {
+		return h.Sum(nil)
+	}
+
+	ks := pk.Bkw.Bk.Ks
+	h.Write(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(ks.N)), uint32(ks.T)), uint32(ks.Basebit)))
+	for _, row := range ks.Ks {
+		for _, samples := range row {
+			for _, sample := range samples {
+				buf = buf[:0]
+				for _, a := range sample.A {
+					buf = binary.BigEndian.AppendUint32(buf, uint32(a))
+				}
+				h.Write(binary.BigEndian.AppendUint32(buf, uint32(sample.B)))
+			}
+		}
+	}
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+var (
+	ErrSchemeMismatch     = errors.New("public key is for another scheme")
+	ErrMalformedPublicKey = errors.New("malformed public key")
+)
+
+type (
+	// Scheme encrypts values, and decrypts or operates on encrypted values
+	// Packet implements it with TFHE, and PlaintextScheme with unencrypted bits so local tests stay quick
+	Scheme interface {
+		Encrypt(payload []byte) (gates.Ctxt, error)
+		Decrypt(encryptedPayload gates.Ctxt) ([]byte, error)
+		Constant(payload []bool) gates.Ctxt
+		And(a, b gates.Ctxt) gates.Ctxt
+		Or(a, b gates.Ctxt) gates.Ctxt
+		Xor(a, b gates.Ctxt) gates.Ctxt
+		XNor(a, b gates.Ctxt) gates.Ctxt
+		Nand(a, b gates.Ctxt) gates.Ctxt
+		Nor(a, b gates.Ctxt) gates.Ctxt
+		Mux(s, a, b gates.Ctxt) gates.Ctxt
+		Not(a gates.Ctxt) gates.Ctxt
+		Copy(a gates.Ctxt) gates.Ctxt
+		Refresh(a gates.Ctxt) gates.Ctxt
+		Validate(a gates.Ctxt) error
+		PublicKey() *PublicKey
+		SwitchingKey(to Scheme) *PublicKey
+		SwitchKey(ctxt gates.Ctxt, toPublicKey *PublicKey) (gates.Ctxt, error)
+		WithContext(ctx context.Context) Scheme
+	}
+
+	// Backend generates Schemes from Seeds and rebuilds them from public keys, so servers and clients can choose an implementation
+	Backend interface {
+		GenerateKeys(seed Seed) (Scheme, error)
+		MakePublicScheme(publicKey *PublicKey) (Scheme, error)
+	}
+
+	// tfheBackend is a Backend of Packets generated with a parameter set
+	tfheBackend struct {
+		params    *gates.GateBootstrappingParameterSet
+		evaluator Evaluator
+	}
+)
+
+// Destroy wipes a Scheme's private key, if it is a Packet or another Scheme that can, once the caller is done with it
+func Destroy(scheme Scheme) {
+	if destroyer, ok := scheme.(interface{ Destroy() }); ok {
+		destroyer.Destroy()
+	}
+}
+
+// MakeTFHEBackend returns a Backend of Packets, generating keys with a parameter set
+func MakeTFHEBackend(params *gates.GateBootstrappingParameterSet) Backend {
+	return tfheBackend{params: params}
+}
+
+// MakeEvaluatedTFHEBackend returns a Backend of Packets, generating keys with a parameter set, whose public Packets execute gates with an Evaluator
+func MakeEvaluatedTFHEBackend(params *gates.GateBootstrappingParameterSet, evaluator Evaluator) Backend {
+	return tfheBackend{
+		params:    params,
+		evaluator: evaluator,
+	}
+}
+
+// GenerateKeys deterministically generates a Packet from a Seed with the Backend's parameter set
+func (tb tfheBackend) GenerateKeys(seed Seed) (Scheme, error) {
+	return GenerateKeys(seed, tb.params)
+}
+
+// MakePublicScheme makes a Packet from a public key, rejecting keys of other schemes and keys not shaped like their parameter set
+func (tb tfheBackend) MakePublicScheme(publicKey *PublicKey) (Scheme, error) {
+	if publicKey == nil || publicKey.Params == nil || publicKey.Bkw == nil || publicKey.Bkw.Bk == nil || publicKey.Bkw.BkFFT == nil {
+		return nil, ErrMalformedPublicKey
+	}
+	if publicKey.Scheme != "" {
+		return nil, fmt.Errorf("%w: %s", ErrSchemeMismatch, publicKey.Scheme)
+	}
+	if err := publicKey.CheckShape(); err != nil {
+		return nil, err
+	}
+
+	if tb.evaluator != nil {
+		return MakePublicPacket(publicKey).WithEvaluator(tb.evaluator), nil
+	}
+
+	return accelerate(MakePublicPacket(publicKey)), nil
+}
@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SeedVersion identifies how a Seed is expanded into keys
+// A version's derivation never changes once released, so the same Seed yields the same keys across releases
+type SeedVersion uint8
+
+const (
+	// SeedV1 expands a Seed with HKDF-SHA256 into AES-CTR streams, forked separately for the LWE and TLWE keys
+	SeedV1 SeedVersion = 1
+	// CurrentSeedVersion is the SeedVersion used for new Seeds
+	CurrentSeedVersion = SeedV1
+)
+
+var ErrUnknownSeedVersion = errors.New("unknown seed version")
+
+// Seed is the versioned key material that deterministically generates a Packet
+type Seed struct {
+	Version SeedVersion `json:"Version"`
+	Key     []byte      `json:"Key"`
+}
+
+// MakeSeed returns a Seed of the current version from key material
+func MakeSeed(key []byte) Seed {
+	return Seed{
+		Version: CurrentSeedVersion,
+		Key:     key,
+	}
+}
+
+// MakePasswordSeed returns a Seed of the current version from a password stretched with Argon2id
+func MakePasswordSeed(password []byte, params *KDFParams) (Seed, error) {
+	key, err := Stretch(password, params)
+	if err != nil {
+		return Seed{}, err
+	}
+
+	return MakeSeed(key), nil
+}
+
+// byteSource returns the ByteSource a Seed's version expands it into
+func (s Seed) byteSource() (ByteSource, error) {
+	switch s.Version {
+	case SeedV1:
+		return makeByteStream(hkdf.Extract(sha256.New, s.Key, hkdfSalt), aesCTR), nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownSeedVersion, s.Version)
+	}
+}
+
+// GenerateKeys deterministically generates a Packet from a Seed with a parameter set
+func GenerateKeys(seed Seed, params *gates.GateBootstrappingParameterSet) (*Packet, error) {
+	return GenerateKeysWithProgress(seed, params, nil)
+}
+
+// GenerateKeysWithProgress is GenerateKeys that reports the progress of key generation, which takes seconds, to a Progress
+func GenerateKeysWithProgress(seed Seed, params *gates.GateBootstrappingParameterSet, progress Progress) (*Packet, error) {
+	byteSource, err := seed.byteSource()
+	if err != nil {
+		return nil, err
+	}
+
+	pub, prv := generateKeys(byteSource, params, progress)
+	return &Packet{
+		pub: pub,
+		prv: prv,
+	}, nil
+}
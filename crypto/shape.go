@@ -0,0 +1,210 @@
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// maxCtxtDimension is the mask dimension of the samples of the largest recognized parameter set, beyond which samples are never accepted
+var maxCtxtDimension = int(gates.DefaultGateBootstrappingParameters(128).InOutParams.N)
+
+const (
+	// maxTorusJSONLen, maxFloatJSONLen, and maxComplexJSONLen are the lengths of the longest JSON encodings of a torus value, a float64, and a complex128,
+	// with the separator following them
+	maxTorusJSONLen   = int64(len("-2147483648,"))
+	maxFloatJSONLen   = int64(len("-0.0000012345678901234567,"))
+	maxComplexJSONLen = int64(len(`{"Re":,"Im":},`)) + 2*(maxFloatJSONLen-1)
+	// maxFieldsJSONLen bounds the JSON encoding of the fields of a sample or polynomial besides its coefficients, and maxParamsJSONLen that of a key's parameters
+	maxFieldsJSONLen = 256
+	maxParamsJSONLen = 64 << 10
+)
+
+// MaxPublicKeyJSONLen returns the length of the longest JSON encoding of a PublicKey of the largest recognized parameter set that CheckShape accepts,
+// so servers can bound the bodies of requests carrying keys
+func MaxPublicKeyJSONLen() int64 {
+	params := gates.DefaultGateBootstrappingParameters(128)
+	tlwe := params.TgswParams.TlweParams
+	n, k, degree := int64(params.InOutParams.N), int64(tlwe.K), int64(tlwe.N)
+
+	// Each TGSW sample's rows are encoded in its AllSample, and again in its BlocSample
+	rows := 2 * n * int64(params.TgswParams.Kpl)
+	polynomials := rows * (k + 1)
+	bk := rows*maxFieldsJSONLen + polynomials*(degree*maxTorusJSONLen+maxFieldsJSONLen)
+	bkFFT := rows*maxFieldsJSONLen + polynomials*(degree/2*maxComplexJSONLen+maxFieldsJSONLen)
+	// Both bootstrapping keys carry the key-switching key
+	ks := maxCtxtJSONLen(k*degree*int64(params.KsT)<<params.KsBasebit, n)
+
+	return maxParamsJSONLen + bk + bkFFT + 2*ks
+}
+
+// MaxCtxtJSONLen returns the length of the longest JSON encoding of a Ctxt of a number of bits, encrypted under the largest recognized parameter set
+func MaxCtxtJSONLen(bits int) int64 {
+	return maxCtxtJSONLen(int64(bits), int64(maxCtxtDimension))
+}
+
+// maxCtxtJSONLen returns the length of the longest JSON encoding of a number of LWE samples of a mask dimension
+func maxCtxtJSONLen(samples, n int64) int64 {
+	return maxFieldsJSONLen + samples*((n+1)*maxTorusJSONLen+maxFieldsJSONLen)
+}
+
+// CheckShape checks that a PublicKey is of a recognized parameter set, and that every parameter it carries and every dimension of its bootstrapping
+// and key-switching keys match that set, so an uploaded key can't make gates loop or allocate beyond what the parameter set needs
+// Keys of other Schemes are only checked by their Backends
+func (pk *PublicKey) CheckShape() error {
+	if pk == nil || pk.Scheme != "" {
+		return nil
+	}
+
+	level := pk.SecurityLevel()
+	if level == 0 {
+		return fmt.Errorf("%w: unrecognized parameter set", ErrMalformedPublicKey)
+	}
+	want := gates.DefaultGateBootstrappingParameters(int32(level))
+	if pk.Bkw == nil || pk.Bkw.Bk == nil || pk.Bkw.BkFFT == nil {
+		return ErrMalformedPublicKey
+	}
+
+	bk, bkFFT := pk.Bkw.Bk, pk.Bkw.BkFFT
+	tgsw, tlwe := want.TgswParams, want.TgswParams.TlweParams
+	extractN := tlwe.K * tlwe.N
+	if !sameTGswParams(pk.Params.TgswParams, tgsw) ||
+		!sameLweParams(bk.InOutParams, want.InOutParams.N) || !sameTGswParams(bk.BkParams, tgsw) ||
+		!sameTLweParams(bk.AccumParams, tlwe) || !sameLweParams(bk.ExtractParams, extractN) ||
+		!sameLweParams(bkFFT.InOutParams, want.InOutParams.N) || !sameTGswParams(bkFFT.BkParams, tgsw) ||
+		!sameTLweParams(bkFFT.AccumParams, tlwe) || !sameLweParams(bkFFT.ExtractParams, extractN) {
+		return fmt.Errorf("%w: parameters don't match a %d bit parameter set", ErrMalformedPublicKey, level)
+	}
+
+	n := int(want.InOutParams.N)
+	if len(bk.Bk) != n || len(bkFFT.Bk) != n {
+		return fmt.Errorf("%w: bootstrapping key has the wrong number of samples", ErrMalformedPublicKey)
+	}
+	for i := range bk.Bk {
+		if !tgswSampleShaped(bk.Bk[i], tgsw) || !tgswSampleFFTShaped(bkFFT.Bk[i], tgsw) {
+			return fmt.Errorf("%w: bootstrapping key sample %d is misshapen", ErrMalformedPublicKey, i)
+		}
+	}
+
+	for _, ks := range []*core.LweKeySwitchKey{bk.Ks, bkFFT.Ks} {
+		if !keySwitchKeyShaped(ks, int(extractN), want) {
+			return fmt.Errorf("%w: key-switching key is misshapen", ErrMalformedPublicKey)
+		}
+	}
+
+	return nil
+}
+
+// sameLweParams returns whether LWE parameters are present with a dimension
+func sameLweParams(params *core.LweParams, n int32) bool {
+	return params != nil && params.N == n
+}
+
+// sameTLweParams returns whether TLWE parameters are present with the degree and mask size of others
+func sameTLweParams(params, want *core.TLweParams) bool {
+	return params != nil && params.N == want.N && params.K == want.K && params.ExtractedLweparams.N == want.ExtractedLweparams.N
+}
+
+// sameTGswParams returns whether TGSW parameters are present with the decomposition and rows of others
+func sameTGswParams(params, want *core.TGswParams) bool {
+	return params != nil && params.L == want.L && params.Bgbit == want.Bgbit && params.Bg == want.Bg && params.Kpl == want.Kpl &&
+		len(params.H) == len(want.H) && sameTLweParams(params.TlweParams, want.TlweParams)
+}
+
+// tgswSampleShaped returns whether a TGSW sample has a row per row of its parameters, each of k+1 polynomials of the parameters' degree
+func tgswSampleShaped(sample *core.TGswSample, params *core.TGswParams) bool {
+	if sample == nil || sample.K != params.TlweParams.K || sample.L != params.L || len(sample.AllSample) != int(params.Kpl) ||
+		len(sample.BlocSample) > int(params.TlweParams.K)+1 {
+		return false
+	}
+
+	for _, row := range sample.AllSample {
+		if !tlweSampleShaped(&row, params.TlweParams) {
+			return false
+		}
+	}
+	for _, bloc := range sample.BlocSample {
+		if len(bloc) > int(params.L) {
+			return false
+		}
+		for _, row := range bloc {
+			if row != nil && !tlweSampleShaped(row, params.TlweParams) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// tlweSampleShaped returns whether a TLWE sample has k+1 polynomials of its parameters' degree
+func tlweSampleShaped(sample *core.TLweSample, params *core.TLweParams) bool {
+	if sample.K != params.K || len(sample.A) != int(params.K)+1 {
+		return false
+	}
+
+	for _, polynomial := range sample.A {
+		if len(polynomial.Coefs) != int(params.N) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tgswSampleFFTShaped returns whether a TGSW sample in the Lagrange half complex domain has the shape tgswSampleShaped checks,
+// with polynomials of half the parameters' degree
+func tgswSampleFFTShaped(sample *tGswSampleFFT, params *core.TGswParams) bool {
+	if sample == nil || sample.K != params.TlweParams.K || sample.L != params.L || len(sample.AllSample) != int(params.Kpl) ||
+		len(sample.BlocSample) > int(params.TlweParams.K)+1 {
+		return false
+	}
+
+	rows := sample.AllSample
+	for _, bloc := range sample.BlocSample {
+		if len(bloc) > int(params.L) {
+			return false
+		}
+		rows = append(rows[:len(rows):len(rows)], bloc...)
+	}
+	for _, row := range rows {
+		if row == nil || row.K != params.TlweParams.K || len(row.A) != int(params.TlweParams.K)+1 {
+			return false
+		}
+		for _, polynomial := range row.A {
+			if polynomial == nil || len(polynomial.Coefs) != int(params.TlweParams.N)/2 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// keySwitchKeyShaped returns whether a key-switching key switches from a dimension to a parameter set's, with the set's decomposition
+func keySwitchKeyShaped(ks *core.LweKeySwitchKey, n int, params *gates.GateBootstrappingParameterSet) bool {
+	base := 1 << params.KsBasebit
+	if ks == nil || int(ks.N) != n || ks.T != params.KsT || ks.Basebit != params.KsBasebit || int(ks.Base) != base ||
+		!sameLweParams(ks.OutParams, params.InOutParams.N) || len(ks.Ks) != n {
+		return false
+	}
+
+	for _, row := range ks.Ks {
+		if len(row) != int(params.KsT) {
+			return false
+		}
+		for _, samples := range row {
+			if len(samples) != base {
+				return false
+			}
+			for _, sample := range samples {
+				if sample == nil || len(sample.A) != int(params.InOutParams.N) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
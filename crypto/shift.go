@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"github.com/thedonutfactory/go-tfhe/core"
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/thedonutfactory/go-tfhe/types"
+)
+
+// The shifts and rotations below treat an encrypted payload as a little endian bit vector, as produced by Encrypt
+// They only re-index samples, so they need no key and cost no gate evaluations
+// The results share samples with their inputs, so use Copy before mutating either in place
+
+// ShiftLeft returns an encrypted payload shifted n bits towards its most significant bit, padded with trivial zeros
+// A negative n shifts right
+func ShiftLeft(a gates.Ctxt, n int) gates.Ctxt {
+	if n < 0 {
+		return ShiftRight(a, -n)
+	}
+
+	result := make(gates.Ctxt, len(a))
+	for i := range result {
+		if i < n {
+			result[i] = trivialZero(a[0])
+		} else {
+			result[i] = a[i-n]
+		}
+	}
+
+	return result
+}
+
+// ShiftRight returns an encrypted payload shifted n bits towards its least significant bit, padded with trivial zeros
+// A negative n shifts left
+func ShiftRight(a gates.Ctxt, n int) gates.Ctxt {
+	if n < 0 {
+		return ShiftLeft(a, -n)
+	}
+
+	result := make(gates.Ctxt, len(a))
+	for i := range result {
+		if i+n < len(a) {
+			result[i] = a[i+n]
+		} else {
+			result[i] = trivialZero(a[0])
+		}
+	}
+
+	return result
+}
+
+// RotateLeft returns an encrypted payload rotated n bits towards its most significant bit
+// A negative n rotates right
+func RotateLeft(a gates.Ctxt, n int) gates.Ctxt {
+	if len(a) == 0 {
+		return gates.Ctxt{}
+	}
+
+	n %= len(a)
+	if n < 0 {
+		n += len(a)
+	}
+
+	result := make(gates.Ctxt, len(a))
+	for i := range a {
+		result[(i+n)%len(a)] = a[i]
+	}
+
+	return result
+}
+
+// RotateRight returns an encrypted payload rotated n bits towards its least significant bit
+// A negative n rotates left
+func RotateRight(a gates.Ctxt, n int) gates.Ctxt {
+	return RotateLeft(a, -(n % max(len(a), 1)))
+}
+
+// trivialZero returns a noiseless encryption of false with the same dimension as a template sample
+func trivialZero(template *core.LweSample) *core.LweSample {
+	params := core.NewLweParams(int32(len(template.A)), 0, 0)
+	result := core.NewLweSample(params)
+	core.LweNoiselessTrivial(result, types.ModSwitchToTorus32(-1, 8), params)
+	return result
+}
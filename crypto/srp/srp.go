@@ -0,0 +1,263 @@
+// Package srp implements SRP-6a password authentication over the 2048 bit group of RFC 5054, with SHA-256 as its hash
+// and passwords stretched with Argon2id before the private key is derived from them
+// Servers store a verifier of each password and the KDFParams it was stretched with, which proves a client knows the password without it, or anything an eavesdropper could guess it from, being sent
+package srp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+const (
+	// VerifierByteLen is the length of verifiers and public keys, which are padded to the length of the group's prime
+	VerifierByteLen = 256
+	// secretByteLen is the length of the random private exponents of clients and servers
+	secretByteLen = 32
+)
+
+var (
+	ErrMalformed    = errors.New("malformed srp value")
+	ErrInvalidProof = errors.New("invalid srp proof")
+)
+
+var (
+	// n is the 2048 bit safe prime of RFC 5054's group, and g its generator
+	n, _ = new(big.Int).SetString(""+
+		"AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050"+
+		"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50"+
+		"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8"+
+		"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B"+
+		"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748"+
+		"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6"+
+		"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6"+
+		"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73", 16)
+	g = big.NewInt(2)
+
+	// newHash is the hash function of the protocol
+	newHash = sha256.New
+)
+
+type (
+	// Client is a client's half of an SRP login, from its public key to checking the server's proof
+	Client struct {
+		a, publicKey            *big.Int
+		proof, serverProof, key []byte
+	}
+
+	// Server is a server's half of an SRP login, for the salt and verifier of a user and the public key of their client
+	Server struct {
+		username                          string
+		salt                              []byte
+		verifier, b, publicKey, clientKey *big.Int
+	}
+)
+
+// digest returns the hash of the concatenation of values
+func digest(values ...[]byte) []byte {
+	h := newHash()
+	for _, value := range values {
+		h.Write(value)
+	}
+
+	return h.Sum(nil)
+}
+
+// pad returns the bytes of an integer, left padded with zeros to the length of the group's prime
+func pad(i *big.Int) []byte {
+	return i.FillBytes(make([]byte, (n.BitLen()+7)/8))
+}
+
+// multiplier returns SRP-6a's multiplier k, the hash of the group
+func multiplier() *big.Int {
+	return new(big.Int).SetBytes(digest(n.Bytes(), pad(g)))
+}
+
+// randomExponent returns a random private exponent from an entropy source
+func randomExponent(entropy io.Reader) (*big.Int, error) {
+	secret := make([]byte, secretByteLen)
+	if _, err := io.ReadFull(entropy, secret); err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(secret), nil
+}
+
+// privateKey returns the private key x RFC 5054 derives from a salt, an identity, and a password
+func privateKey(identity, password, salt []byte) *big.Int {
+	return new(big.Int).SetBytes(digest(salt, digest(identity, []byte(":"), password)))
+}
+
+// stretchedPrivateKey returns the private key x of a user's password stretched with KDFParams, under their salt and an empty identity,
+// so it doesn't change with how a server normalizes the user's username
+func stretchedPrivateKey(password string, params *crypto.KDFParams) (*big.Int, error) {
+	stretched, err := crypto.Stretch([]byte(password), params)
+	if err != nil {
+		return nil, err
+	}
+
+	return privateKey(nil, stretched, params.Salt), nil
+}
+
+// publicValue returns an integer received from a peer, or ErrMalformed if it is longer than the group's prime or 0 modulo it, which would reveal the session key
+func publicValue(value []byte) (*big.Int, error) {
+	if len(value) > VerifierByteLen {
+		return nil, ErrMalformed
+	}
+
+	i := new(big.Int).SetBytes(value)
+	if new(big.Int).Mod(i, n).Sign() == 0 {
+		return nil, ErrMalformed
+	}
+
+	return i, nil
+}
+
+// scramble returns the scrambling parameter u of two public keys, or ErrMalformed if it is 0
+func scramble(clientKey, serverKey *big.Int) (*big.Int, error) {
+	u := new(big.Int).SetBytes(digest(pad(clientKey), pad(serverKey)))
+	if u.Sign() == 0 {
+		return nil, ErrMalformed
+	}
+
+	return u, nil
+}
+
+// proofs returns the session key of a premaster secret, and the client's and server's proofs that they share it
+func proofs(username string, salt []byte, clientKey, serverKey, premaster *big.Int) (key, clientProof, serverProof []byte) {
+	key = digest(pad(premaster))
+
+	groupHash, generatorHash := digest(n.Bytes()), digest(pad(g))
+	for i := range groupHash {
+		groupHash[i] ^= generatorHash[i]
+	}
+	clientProof = digest(groupHash, digest([]byte(username)), salt, pad(clientKey), pad(serverKey), key)
+	serverProof = digest(pad(clientKey), clientProof, key)
+
+	return key, clientProof, serverProof
+}
+
+// Verifier returns the verifier a server stores for a password stretched with KDFParams, which must have a random salt
+func Verifier(password string, params *crypto.KDFParams) ([]byte, error) {
+	x, err := stretchedPrivateKey(password, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pad(new(big.Int).Exp(g, x, n)), nil
+}
+
+// NewClient returns the client's half of an SRP login, with a private exponent from an entropy source
+func NewClient(entropy io.Reader) (*Client, error) {
+	a, err := randomExponent(entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{a: a, publicKey: new(big.Int).Exp(g, a, n)}, nil
+}
+
+// PublicKey returns the public key A a client sends the server to begin a login
+func (c *Client) PublicKey() []byte {
+	return pad(c.publicKey)
+}
+
+// Proof returns the proof M1 that a client knows a user's password, given the KDFParams and public key B the server answered with,
+// where the username is the one the client began the login with
+func (c *Client) Proof(username, password string, params *crypto.KDFParams, serverPublicKey []byte) ([]byte, error) {
+	x, err := stretchedPrivateKey(password, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.proveKey(username, x, params.Salt, serverPublicKey)
+}
+
+// proveKey returns the proof M1 that a client knows the private key x of a user's password under a salt, given the public key B the server answered with
+func (c *Client) proveKey(username string, x *big.Int, salt, serverPublicKey []byte) ([]byte, error) {
+	serverKey, err := publicValue(serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	u, err := scramble(c.publicKey, serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	base := new(big.Int).Sub(serverKey, new(big.Int).Mul(multiplier(), new(big.Int).Exp(g, x, n)))
+	base.Mod(base, n)
+	exponent := new(big.Int).Add(c.a, new(big.Int).Mul(u, x))
+	premaster := new(big.Int).Exp(base, exponent, n)
+
+	c.key, c.proof, c.serverProof = proofs(username, salt, c.publicKey, serverKey, premaster)
+	return c.proof, nil
+}
+
+// VerifyServer returns ErrInvalidProof unless a server's proof M2 shows it holds the user's verifier, which Proof must be called before
+func (c *Client) VerifyServer(serverProof []byte) error {
+	if c.serverProof == nil || !hmac.Equal(c.serverProof, serverProof) {
+		return ErrInvalidProof
+	}
+
+	return nil
+}
+
+// Key returns the session key a client shares with the server once their proofs are exchanged
+func (c *Client) Key() []byte {
+	return c.key
+}
+
+// NewServer returns the server's half of an SRP login for a user's salt and verifier, and the username and public key A their client began with,
+// with a private exponent from an entropy source
+func NewServer(entropy io.Reader, username string, salt, verifier, clientPublicKey []byte) (*Server, error) {
+	clientKey, err := publicValue(clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	b, err := randomExponent(entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	v := new(big.Int).SetBytes(verifier)
+	publicKey := new(big.Int).Mul(multiplier(), v)
+	publicKey.Add(publicKey, new(big.Int).Exp(g, b, n))
+	publicKey.Mod(publicKey, n)
+
+	return &Server{
+		username:  username,
+		salt:      salt,
+		verifier:  v,
+		b:         b,
+		publicKey: publicKey,
+		clientKey: clientKey,
+	}, nil
+}
+
+// PublicKey returns the public key B a server answers a client's with
+func (s *Server) PublicKey() []byte {
+	return pad(s.publicKey)
+}
+
+// Verify checks a client's proof M1 that it knows the user's password, returning the server's proof M2 to send back,
+// or ErrInvalidProof if the password was wrong
+func (s *Server) Verify(clientProof []byte) ([]byte, error) {
+	u, err := scramble(s.clientKey, s.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	base := new(big.Int).Mul(s.clientKey, new(big.Int).Exp(s.verifier, u, n))
+	premaster := new(big.Int).Exp(base.Mod(base, n), s.b, n)
+
+	_, expected, serverProof := proofs(s.username, s.salt, s.clientKey, s.publicKey, premaster)
+	if !hmac.Equal(expected, clientProof) {
+		return nil, ErrInvalidProof
+	}
+
+	return serverProof, nil
+}
@@ -0,0 +1,138 @@
+package srp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"hash"
+	"math/big"
+	"testing"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+// rfc5054Int returns the integer a hex string of RFC 5054's test vectors encodes
+func rfc5054Int(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("malformed integer %q", s)
+	}
+
+	return i
+}
+
+// TestRFC5054 checks SRP-6a against the test vectors of RFC 5054 appendix B, which use its 1024 bit group and SHA-1
+func TestRFC5054(t *testing.T) {
+	defer func(prime, generator *big.Int, hashFunc func() hash.Hash) {
+		n, g, newHash = prime, generator, hashFunc
+	}(n, g, newHash)
+	n = rfc5054Int(t, "EEAF0AB9ADB38DD69C33F80AFA8FC5E86072618775FF3C0B9EA2314C9C256576D674DF7496EA81D3383B4813D692C6E0E0D5D8E250B98BE48E495C1D6089DAD1"+
+		"5DC7D7B46154D6B6CE8EF4AD69B15D4982559B297BCF1885C529F566660E57EC68EDBC3C05726CC02FD4CBF4976EAA9AFD5138FE8376435B9FC61D2FC0EB06E3")
+	g, newHash = big.NewInt(2), sha1.New
+
+	var (
+		salt     = rfc5054Int(t, "BEB25379D1A8581EB5A727673A2441EE").Bytes()
+		a        = rfc5054Int(t, "60975527035CF2AD1989806F0407210BC81EDC04E2762A56AFD529DDDA2D4393").Bytes()
+		b        = rfc5054Int(t, "E487CB59D31AC550471E81F00F6928E01DDA08E974A004F49E61F5D105284D20").Bytes()
+		wantK    = rfc5054Int(t, "7556AA045AEF2CDD07ABAF0F665C3E818913186F")
+		wantX    = rfc5054Int(t, "94B7555AABE9127CC58CCF4993DB6CF84D16C124")
+		wantU    = rfc5054Int(t, "CE38B9593487DA98554ED47D70A7AE5F462EF019")
+		verifier = rfc5054Int(t, "7E273DE8696FFC4F4E337D05B4B375BEB0DDE1569E8FA00A9886D8129BADA1F1822223CA1A605B530E379BA4729FDC59F105B4787E5186F5C671085A1447B52A"+
+			"48CF1970B4FB6F8400BBF4CEBFBB168152E08AB5EA53D15C1AFF87B2B9DA6E04E058AD51CC72BFC9033B564E26480D78E955A5E29E7AB245DB2BE315E2099AFB")
+		wantA = rfc5054Int(t, "61D5E490F6F1B79547B0704C436F523DD0E560F0C64115BB72557EC44352E8903211C04692272D8B2D1A5358A2CF1B6E0BFCF99F921530EC8E39356179EAE45E"+
+			"42BA92AEACED825171E1E8B9AF6D9C03E1327F44BE087EF06530E69F66615261EEF54073CA11CF5858F0EDFDFE15EFEAB349EF5D76988A3672FAC47B0769447B")
+		wantB = rfc5054Int(t, "BD0C61512C692C0CB6D041FA01BB152D4916A1E77AF46AE105393011BAF38964DC46A0670DD125B95A981652236F99D9B681CBF87837EC996C6DA04453728610"+
+			"D0C6DDB58B318885D7D82C7F8DEB75CE7BD4FBAA37089E6F9C6059F388838E7A00030B331EB76840910440B1B27AAEAEEB4012B7D7665238A8E3FB004B117B58")
+		premaster = rfc5054Int(t, "B0DC82BABCF30674AE450C0287745E7990A3381F63B387AAF271A10D233861E359B48220F7C4693C9AE12B0A6F67809F0876E2D013800D6C41BB59B6D5979B5C"+
+			"00A172B4A2A5903A0BDCAF8A709585EB2AFAFA8F3499B200210DCC1F10EB33943CD67FC88A2F39A4BE5BEC4EC0A3212DC346D7E474B29EDE8A469FFECA686E5A")
+	)
+
+	if k := multiplier(); k.Cmp(wantK) != 0 {
+		t.Errorf("k = %X, want %X", k, wantK)
+	}
+	x := privateKey([]byte("alice"), []byte("password123"), salt)
+	if x.Cmp(wantX) != 0 {
+		t.Fatalf("x = %X, want %X", x, wantX)
+	}
+	if v := new(big.Int).Exp(g, x, n); v.Cmp(verifier) != 0 {
+		t.Fatalf("v = %X, want %X", v, verifier)
+	}
+
+	client, err := NewClient(bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(client.PublicKey(), pad(wantA)) {
+		t.Fatalf("A = %X, want %X", client.PublicKey(), wantA)
+	}
+
+	server, err := NewServer(bytes.NewReader(b), "alice", salt, pad(verifier), client.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(server.PublicKey(), pad(wantB)) {
+		t.Fatalf("B = %X, want %X", server.PublicKey(), wantB)
+	}
+
+	if u, err := scramble(wantA, wantB); err != nil || u.Cmp(wantU) != 0 {
+		t.Errorf("u = %X, %v, want %X", u, err, wantU)
+	}
+
+	proof, err := client.proveKey("alice", x, salt, server.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKey := digest(pad(premaster))
+	if !bytes.Equal(client.Key(), wantKey) {
+		t.Errorf("client session key = %X, want %X", client.Key(), wantKey)
+	}
+	serverProof, err := server.Verify(proof)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := client.VerifyServer(serverProof); err != nil {
+		t.Errorf("VerifyServer: %v", err)
+	}
+}
+
+// TestStretchedPassword checks that a login succeeds only with the password and KDFParams a verifier was made from
+func TestStretchedPassword(t *testing.T) {
+	params, err := crypto.MakeKDFParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := Verifier("password123", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherParams := *params
+	otherParams.Time++
+	for _, test := range []struct {
+		name, password string
+		params         *crypto.KDFParams
+		wantErr        error
+	}{
+		{"right password", "password123", params, nil},
+		{"wrong password", "password124", params, ErrInvalidProof},
+		{"wrong parameters", "password123", &otherParams, ErrInvalidProof},
+		{"weak parameters", "password123", &crypto.KDFParams{Salt: params.Salt}, crypto.ErrInvalidKDFParams},
+	} {
+		client, err := NewClient(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, err := NewServer(rand.Reader, "alice", params.Salt, verifier, client.PublicKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proof, err := client.Proof("alice", test.password, test.params, server.PublicKey())
+		if err == nil {
+			_, err = server.Verify(proof)
+		}
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+)
+
+// streamBuffer is the number of chunks buffered between the stages of a Stream
+const streamBuffer = 1
+
+var ErrStreamMismatch = errors.New("mismatched stream chunks")
+
+type (
+	// streamSource records the error that ended a stage of a Stream, written before the stage closes its chunks
+	streamSource struct {
+		err error
+	}
+
+	// Stream is an encrypted payload that flows from a source, through gates, to a sink in chunks over channels
+	// Each stage holds only a few chunks at a time, so memory stays flat regardless of the payload's size
+	// A Stream stops early when its context is cancelled, which callers should do when abandoning it
+	Stream struct {
+		ctx     context.Context
+		packet  *Packet
+		chunks  <-chan gates.Ctxt
+		sources []*streamSource
+	}
+)
+
+// EncryptStream uses a Packet's private key to encrypt a payload read from a reader as a Stream, chunkBytes bytes per chunk
+func (p *Packet) EncryptStream(ctx context.Context, r io.Reader, chunkBytes int) *Stream {
+	return p.stream(ctx, func(emit func(gates.Ctxt) bool) error {
+		buf := make([]byte, chunkBytes)
+		for {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				chunk, encryptErr := p.Encrypt(buf[:n])
+				if encryptErr != nil {
+					return encryptErr
+				} else if !emit(chunk) {
+					return nil
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// ReadStream returns a Stream of the chunks written to a reader by Encode
+func (p *Packet) ReadStream(ctx context.Context, r io.Reader) *Stream {
+	return p.stream(ctx, func(emit func(gates.Ctxt) bool) error {
+		decoder := json.NewDecoder(r)
+		for {
+			var chunk gates.Ctxt
+			if err := decoder.Decode(&chunk); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if !emit(chunk) {
+				return nil
+			}
+		}
+	})
+}
+
+// stream returns a Stream of the chunks a function emits from a goroutine, until it returns or emit reports the Stream was cancelled
+func (p *Packet) stream(ctx context.Context, produce func(emit func(gates.Ctxt) bool) error) *Stream {
+	chunks := make(chan gates.Ctxt, streamBuffer)
+	source := &streamSource{}
+	go func() {
+		defer close(chunks)
+
+		source.err = produce(func(chunk gates.Ctxt) bool {
+			return send(ctx, chunks, chunk)
+		})
+	}()
+
+	return &Stream{
+		ctx:     ctx,
+		packet:  p,
+		chunks:  chunks,
+		sources: []*streamSource{source},
+	}
+}
+
+// send sends a chunk to the next stage of a Stream, returning false if its context is cancelled first
+func send(ctx context.Context, chunks chan<- gates.Ctxt, chunk gates.Ctxt) bool {
+	select {
+	case chunks <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// drain discards the remaining chunks of a Stream, so its earlier stages can finish
+func drain(chunks <-chan gates.Ctxt) {
+	for chunk := range chunks {
+		Release(chunk)
+	}
+}
+
+// Map returns a Stream of a unary operation, such as a Packet's Not or a Pipeline's Eval, applied to each chunk of a Stream
+func (s *Stream) Map(operation func(a gates.Ctxt) gates.Ctxt) *Stream {
+	chunks := make(chan gates.Ctxt, streamBuffer)
+	go func() {
+		defer close(chunks)
+
+		for chunk := range s.chunks {
+			if !send(s.ctx, chunks, operation(chunk)) {
+				return
+			}
+		}
+	}()
+
+	return &Stream{
+		ctx:     s.ctx,
+		packet:  s.packet,
+		chunks:  chunks,
+		sources: s.sources,
+	}
+}
+
+// Zip returns a Stream of a binary operation, such as a Packet's And, applied to the chunks of two Streams pairwise
+// Both Streams must be chunked alike, or the Stream fails with ErrStreamMismatch
+func (s *Stream) Zip(other *Stream, operation func(a, b gates.Ctxt) gates.Ctxt) *Stream {
+	chunks := make(chan gates.Ctxt, streamBuffer)
+	zip := &streamSource{}
+	go func() {
+		defer close(chunks)
+
+		for {
+			a, aOk := <-s.chunks
+			b, bOk := <-other.chunks
+			if !aOk && !bOk {
+				return
+			}
+			if aOk != bOk || len(a) != len(b) {
+				zip.err = ErrStreamMismatch
+				go drain(s.chunks)
+				go drain(other.chunks)
+				return
+			}
+
+			if !send(s.ctx, chunks, operation(a, b)) {
+				return
+			}
+		}
+	}()
+
+	return &Stream{
+		ctx:     s.ctx,
+		packet:  s.packet,
+		chunks:  chunks,
+		sources: append(append([]*streamSource{zip}, s.sources...), other.sources...),
+	}
+}
+
+// Encode writes each chunk of a Stream to a writer as a line of JSON, which ReadStream reads back
+func (s *Stream) Encode(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return s.consume(func(chunk gates.Ctxt) error {
+		return encoder.Encode(chunk)
+	})
+}
+
+// DecryptTo uses a Packet's private key to decrypt each chunk of a Stream, writing its bytes to a writer
+func (s *Stream) DecryptTo(w io.Writer) error {
+	var buf []byte
+	return s.consume(func(chunk gates.Ctxt) error {
+		var err error
+		if buf, err = s.packet.DecryptInto(buf, chunk); err != nil {
+			return err
+		}
+
+		_, err = w.Write(buf)
+		return err
+	})
+}
+
+// consume calls a function on each chunk of a Stream, releasing the chunk afterwards, and returns the error that ended the Stream
+// If the function fails, the rest of the Stream is discarded in the background
+func (s *Stream) consume(f func(chunk gates.Ctxt) error) error {
+	for chunk := range s.chunks {
+		err := f(chunk)
+		Release(chunk)
+		if err != nil {
+			go drain(s.chunks)
+			return err
+		}
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, source := range s.sources {
+		if source.err != nil {
+			return source.err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/thedonutfactory/go-tfhe/types"
+)
+
+// Threshold decryption splits a Packet's private LWE key with replicated secret sharing
+// The key is the sum of one random share per unqualified set of threshold-1 parties, and each party holds every share of the sets it is not in
+// Any threshold parties therefore hold every share between them, while fewer parties always miss the share of a set containing all of them
+// Decrypting only needs the LWE key, so shares can decrypt challenges but cannot bootstrap or encrypt
+
+// maxParties bounds the number of parties, since the number of shares grows combinatorially
+const maxParties = 10
+
+// partialDecryptionStdev is the standard deviation of the noise added to partial decryptions, so they don't expose exact inner products with a share
+const partialDecryptionStdev = 1. / (1 << 12)
+
+var (
+	ErrInvalidThreshold   = errors.New("invalid threshold")
+	ErrMissingShare       = errors.New("missing key share")
+	ErrIncompleteDecrypt  = errors.New("partial decryptions don't cover every key share exactly once")
+	ErrMismatchedDecrypts = errors.New("partial decryptions don't match the encrypted payload")
+)
+
+type (
+	// KeyShare is one party's portion of a Packet's private LWE key
+	KeyShare struct {
+		Party     int
+		Threshold int
+		Parties   int
+		Shares    map[int][]int32
+	}
+
+	// PartialDecryption is one party's contribution to decrypting an encrypted payload
+	PartialDecryption struct {
+		Party  int
+		Shares []int
+		Phases []int32
+	}
+)
+
+// unqualifiedSets returns every set of threshold-1 parties in lexicographic order, each of which indexes a share
+func unqualifiedSets(threshold, parties int) [][]int {
+	var sets [][]int
+	var build func(start int, set []int)
+	build = func(start int, set []int) {
+		if len(set) == threshold-1 {
+			sets = append(sets, append([]int(nil), set...))
+			return
+		}
+
+		for i := start; i < parties; i++ {
+			build(i+1, append(set, i))
+		}
+	}
+	build(0, nil)
+
+	return sets
+}
+
+// contains returns whether a set of parties contains a party
+func contains(set []int, party int) bool {
+	for _, p := range set {
+		if p == party {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkThreshold returns an error if a threshold of parties is unsupported
+func checkThreshold(threshold, parties int) error {
+	if threshold < 1 || threshold > parties || parties > maxParties {
+		return fmt.Errorf("%w: %d of %d parties, up to %d parties are supported", ErrInvalidThreshold, threshold, parties, maxParties)
+	}
+
+	return nil
+}
+
+// SplitKey uses a Packet's private key to split its LWE key into one KeyShare per party, any threshold of which can decrypt
+// The Packet itself still holds the whole key, so it should be destroyed once the shares are distributed
+// Packets without a private key return ErrNoPrivateKey
+func (p *Packet) SplitKey(threshold, parties int) ([]*KeyShare, error) {
+	if err := checkThreshold(threshold, parties); err != nil {
+		return nil, err
+	} else if err := p.checkPrivate(); err != nil {
+		return nil, err
+	}
+
+	key := p.prv.LweKey.Key
+	sets := unqualifiedSets(threshold, parties)
+	shares := make([][]int32, len(sets))
+	last := append([]int32(nil), key...)
+	for i := range sets[:len(sets)-1] {
+		random, err := readEntropy(DefaultEntropySource, 4*len(key))
+		if err != nil {
+			return nil, err
+		}
+
+		shares[i] = make([]int32, len(key))
+		for j := range shares[i] {
+			shares[i][j] = int32(binary.LittleEndian.Uint32(random[4*j:]))
+			last[j] -= shares[i][j]
+		}
+	}
+	shares[len(sets)-1] = last
+
+	keyShares := make([]*KeyShare, parties)
+	for party := range keyShares {
+		keyShares[party] = &KeyShare{
+			Party:     party,
+			Threshold: threshold,
+			Parties:   parties,
+			Shares:    map[int][]int32{},
+		}
+		for i, set := range sets {
+			if !contains(set, party) {
+				keyShares[party].Shares[i] = shares[i]
+			}
+		}
+	}
+
+	return keyShares, nil
+}
+
+// AssignShares returns which shares each participating party should decrypt with, so that every share is used exactly once
+func AssignShares(threshold, parties int, participants []int) (map[int][]int, error) {
+	if err := checkThreshold(threshold, parties); err != nil {
+		return nil, err
+	}
+
+	assignment := map[int][]int{}
+	for i, set := range unqualifiedSets(threshold, parties) {
+		assigned := false
+		for _, party := range participants {
+			if party >= 0 && party < parties && !contains(set, party) {
+				assignment[party] = append(assignment[party], i)
+				assigned = true
+				break
+			}
+		}
+
+		if !assigned {
+			return nil, fmt.Errorf("%w: %d participants of a threshold of %d", ErrMissingShare, len(participants), threshold)
+		}
+	}
+
+	return assignment, nil
+}
+
+// PartialDecrypt uses a KeyShare's assigned shares to partially decrypt an encrypted payload
+func (ks *KeyShare) PartialDecrypt(encryptedPayload gates.Ctxt, assigned []int) (*PartialDecryption, error) {
+	for _, i := range assigned {
+		if _, ok := ks.Shares[i]; !ok {
+			return nil, fmt.Errorf("%w: party %d doesn't hold share %d", ErrMissingShare, ks.Party, i)
+		}
+	}
+
+	phases := make([]int32, len(encryptedPayload))
+	parallelFor(len(encryptedPayload), func(i int) {
+		var phase types.Torus32
+		for _, j := range assigned {
+			share := ks.Shares[j]
+			for k := range share {
+				phase += encryptedPayload[i].A[k] * share[k]
+			}
+		}
+		phases[i] = types.Gaussian32(phase, partialDecryptionStdev)
+	})
+
+	return &PartialDecryption{
+		Party:  ks.Party,
+		Shares: assigned,
+		Phases: phases,
+	}, nil
+}
+
+// CombinePartialDecryptions decrypts an encrypted payload from partial decryptions that together use every share exactly once
+// The result is packed into bytes as Decrypt would
+func CombinePartialDecryptions(encryptedPayload gates.Ctxt, threshold, parties int, partials []*PartialDecryption) ([]byte, error) {
+	if err := checkThreshold(threshold, parties); err != nil {
+		return nil, err
+	}
+
+	used := make([]bool, len(unqualifiedSets(threshold, parties)))
+	for _, partial := range partials {
+		if len(partial.Phases) != len(encryptedPayload) {
+			return nil, ErrMismatchedDecrypts
+		}
+
+		for _, i := range partial.Shares {
+			if i < 0 || i >= len(used) || used[i] {
+				return nil, ErrIncompleteDecrypt
+			}
+			used[i] = true
+		}
+	}
+
+	for _, ok := range used {
+		if !ok {
+			return nil, ErrIncompleteDecrypt
+		}
+	}
+
+	bits := make([]int, len(encryptedPayload))
+	for i, sample := range encryptedPayload {
+		phase := sample.B
+		for _, partial := range partials {
+			phase -= partial.Phases[i]
+		}
+		if phase > 0 {
+			bits[i] = 1
+		}
+	}
+
+	return packBits(bits), nil
+}
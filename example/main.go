@@ -1,20 +1,30 @@
 package main
 
+import (
+	"net/http"
+	"os"
+
+	"github.com/zambozoo/homomorphic-authentication/client"
+	"github.com/zambozoo/homomorphic-authentication/server"
+)
+
 func main() {
 	username := "Username"
 	password := "Password"
-	client := NewClient(8, 8080)
-	_ = NewServer(8, 8080)
+	c := client.New(8, 8080, client.WithDebugWriter(os.Stdout))
+	go func() {
+		if err := http.ListenAndServe(":8080", server.New()); err != nil {
+			panic(err)
+		}
+	}()
 
-	if ok, err := client.SignUp(username, password); err != nil {
+	if ok, err := c.SignUp(username, password); err != nil {
 		panic(err)
 	} else if !ok {
 		panic("failed to sign up")
 	}
 
-	if ok, err := client.LogIn(username, password); err != nil {
+	if _, err := c.LogIn(username, password); err != nil {
 		panic(err)
-	} else if !ok {
-		panic("failed to login")
 	}
 }
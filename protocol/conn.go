@@ -0,0 +1,69 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type (
+	// MessageConn is a connection carrying the messages of a login in order, over any transport, such as a WebSocket, a gRPC stream, or a raw TCP or QUIC stream
+	// The client writes its FirstLogInRequest and SecondLogInRequest, and the server answers each with LogInStreamMessages
+	MessageConn interface {
+		// ReadMessage reads the next message into v, unless the context is done first
+		ReadMessage(ctx context.Context, v any) error
+		// WriteMessage writes a message, unless the context is done first
+		WriteMessage(ctx context.Context, v any) error
+		// Close closes the connection
+		Close() error
+	}
+
+	// streamConn is a MessageConn over a byte stream, carrying each message as a JSON value
+	streamConn struct {
+		rwc     io.ReadWriteCloser
+		decoder *json.Decoder
+		encoder *json.Encoder
+	}
+)
+
+// NewStreamConn returns a MessageConn over a byte stream, such as a net.Conn or a QUIC stream, which carries each message as a JSON value
+// Streams with read or write deadlines are given the deadline of each call's context
+func NewStreamConn(rwc io.ReadWriteCloser) MessageConn {
+	return &streamConn{
+		rwc:     rwc,
+		decoder: json.NewDecoder(rwc),
+		encoder: json.NewEncoder(rwc),
+	}
+}
+
+// ReadMessage reads the next JSON value of a stream into v
+func (sc *streamConn) ReadMessage(ctx context.Context, v any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if conn, ok := sc.rwc.(interface{ SetReadDeadline(time.Time) error }); ok {
+		deadline, _ := ctx.Deadline()
+		conn.SetReadDeadline(deadline)
+	}
+
+	return sc.decoder.Decode(v)
+}
+
+// WriteMessage writes a message to a stream as a JSON value
+func (sc *streamConn) WriteMessage(ctx context.Context, v any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if conn, ok := sc.rwc.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		deadline, _ := ctx.Deadline()
+		conn.SetWriteDeadline(deadline)
+	}
+
+	return sc.encoder.Encode(v)
+}
+
+// Close closes a stream
+func (sc *streamConn) Close() error {
+	return sc.rwc.Close()
+}
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"errors"
+	"net/http"
+)
+
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUserExists         = "user_exists"
+	CodeUserDoesNotExist   = "user_does_not_exist"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidSession     = "invalid_session"
+	CodeBusy               = "busy"
+	CodeUnknownChallenge   = "unknown_challenge"
+	CodeNotAdmin           = "not_admin"
+	CodeUnverified         = "unverified"
+	CodeStepUpRequired     = "step_up_required"
+	CodeDenied             = "denied"
+	CodeCaptchaRequired    = "captcha_required"
+	CodeInvalidUsername    = "invalid_username"
+	CodeSRPRequired        = "srp_required"
+	CodeOPAQUERequired     = "opaque_required"
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeLogInRequired      = "login_required"
+	CodeAccountDisabled    = "account_disabled"
+	CodeInvalidAPIKey      = "invalid_api_key"
+	CodeInsufficientScope  = "insufficient_scope"
+	CodeUserChanged        = "user_changed"
+	CodeServer             = "server_error"
+)
+
+var (
+	ErrBadRequest         = errors.New("bad request")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserDoesNotExist   = errors.New("user doesn't exist")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidSession     = errors.New("invalid or expired session")
+	ErrBusy               = errors.New("server busy, retry later")
+	ErrUnknownChallenge   = errors.New("unknown or expired challenge")
+	ErrNotAdmin           = errors.New("missing or invalid admin token")
+	ErrUnverified         = errors.New("email address not yet verified")
+	ErrStepUpRequired     = errors.New("step-up verification required")
+	ErrDenied             = errors.New("login denied")
+	ErrCaptchaRequired    = errors.New("captcha required")
+	ErrInvalidUsername    = errors.New("invalid username")
+	ErrSRPRequired        = errors.New("user logs in with SRP")
+	ErrOPAQUERequired     = errors.New("user logs in with OPAQUE")
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	ErrLogInRequired      = errors.New("recent login required")
+	ErrAccountDisabled    = errors.New("account disabled")
+	ErrInvalidAPIKey      = errors.New("invalid, expired, or revoked API key")
+	ErrInsufficientScope  = errors.New("API key lacks a required scope")
+	ErrUserChanged        = errors.New("user changed while the request was handled, retry it")
+	ErrServer             = errors.New("server error")
+)
+
+// errorCodes maps the errors a client can act on to their codes
+var errorCodes = map[error]string{
+	ErrUserExists:         CodeUserExists,
+	ErrUserDoesNotExist:   CodeUserDoesNotExist,
+	ErrInvalidCredentials: CodeInvalidCredentials,
+	ErrInvalidSession:     CodeInvalidSession,
+	ErrBusy:               CodeBusy,
+	ErrUnknownChallenge:   CodeUnknownChallenge,
+	ErrNotAdmin:           CodeNotAdmin,
+	ErrUnverified:         CodeUnverified,
+	ErrStepUpRequired:     CodeStepUpRequired,
+	ErrDenied:             CodeDenied,
+	ErrCaptchaRequired:    CodeCaptchaRequired,
+	ErrInvalidUsername:    CodeInvalidUsername,
+	ErrSRPRequired:        CodeSRPRequired,
+	ErrOPAQUERequired:     CodeOPAQUERequired,
+	ErrUnsupportedVersion: CodeUnsupportedVersion,
+	ErrLogInRequired:      CodeLogInRequired,
+	ErrAccountDisabled:    CodeAccountDisabled,
+	ErrInvalidAPIKey:      CodeInvalidAPIKey,
+	ErrInsufficientScope:  CodeInsufficientScope,
+	ErrUserChanged:        CodeUserChanged,
+}
+
+// ErrorResponse is the body of every non 2XX response
+type ErrorResponse struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+	Versioned
+}
+
+// ErrorCode returns the code for an error sent with a status
+func ErrorCode(err error, status int) string {
+	for target, code := range errorCodes {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+
+	if status >= http.StatusInternalServerError {
+		return CodeServer
+	}
+
+	return CodeBadRequest
+}
+
+// CodeError returns the error a code received with a status represents
+func CodeError(code string, status int) error {
+	for err, c := range errorCodes {
+		if code == c {
+			return err
+		}
+	}
+
+	if status >= http.StatusInternalServerError {
+		return ErrServer
+	}
+
+	return ErrBadRequest
+}
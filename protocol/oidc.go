@@ -0,0 +1,166 @@
+package protocol
+
+import "encoding/json"
+
+const (
+	// OIDCDiscoveryPath is the path of the OpenID Connect provider's discovery document, relative to its issuer
+	OIDCDiscoveryPath = "/.well-known/openid-configuration"
+	// OIDCAuthorizePath is the path apps send users to for an authorization code, and that logged in clients post the same parameters to with their session
+	OIDCAuthorizePath = "/oidc/authorize"
+	// OIDCTokenPath is the path apps exchange an authorization code at for an ID token and an access token
+	OIDCTokenPath = "/oidc/token"
+	// OIDCUserInfoPath is the path apps fetch the claims of an access token's user from
+	OIDCUserInfoPath = "/oidc/userinfo"
+	// OIDCJWKSPath is the path of the keys ID tokens are signed with
+	OIDCJWKSPath = "/oidc/jwks"
+	// OIDCRegisterPath is the path of admin requests that register an app as a client of the provider
+	OIDCRegisterPath = "/oidc/register"
+
+	// IntrospectPath is the path resource servers check whether a session token, API key, or access token is active at, as RFC 7662 defines it,
+	// and RevokePath the path they revoke one at, as RFC 7009 defines it
+	IntrospectPath = "/introspect"
+	RevokePath     = "/revoke"
+
+	// TokenTypeSession, TokenTypeAPIKey, and TokenTypeAccessToken are the token types of introspected session tokens, API keys, and OIDC access tokens
+	TokenTypeSession     = "session"
+	TokenTypeAPIKey      = "api_key"
+	TokenTypeAccessToken = "access_token"
+)
+
+// OpenID Connect messages are named as the specifications name them, rather than as this package's other messages are
+type (
+	// OIDCDiscovery is an OpenID Connect provider's metadata
+	OIDCDiscovery struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JWKSURI                           string   `json:"jwks_uri"`
+		RegistrationEndpoint              string   `json:"registration_endpoint"`
+		IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+		RevocationEndpoint                string   `json:"revocation_endpoint"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+	}
+
+	// OIDCAuthorizeResponse is the response to an authorization request posted with a session, with the app's redirect URI carrying the code,
+	// which the client navigates the user to
+	OIDCAuthorizeResponse struct {
+		RedirectURI string `json:"RedirectURI"`
+	}
+
+	// OIDCTokenResponse is the response to a successful token request
+	OIDCTokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		IDToken     string `json:"id_token"`
+		Scope       string `json:"scope,omitempty"`
+	}
+
+	// OIDCUserInfo is the claims of an access token's user, whose custom Claims are encoded alongside the standard ones
+	OIDCUserInfo struct {
+		Subject           string                     `json:"sub"`
+		PreferredUsername string                     `json:"preferred_username"`
+		Email             string                     `json:"email,omitempty"`
+		EmailVerified     *bool                      `json:"email_verified,omitempty"`
+		Roles             []string                   `json:"roles,omitempty"`
+		Claims            map[string]json.RawMessage `json:"-"`
+	}
+
+	// TokenIntrospection is the response to an introspection request, where inactive tokens, whether unknown, expired, revoked,
+	// or of a user who can't log in, only set Active
+	// Scope is the space separated scopes of API keys and access tokens, ClientID the app access tokens were issued to,
+	// and ExpiresAt and IssuedAt are in seconds since the Unix epoch, where API keys that never expire omit ExpiresAt
+	TokenIntrospection struct {
+		Active    bool   `json:"active"`
+		TokenType string `json:"token_type,omitempty"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Username  string `json:"username,omitempty"`
+		Subject   string `json:"sub,omitempty"`
+		ExpiresAt int64  `json:"exp,omitempty"`
+		IssuedAt  int64  `json:"iat,omitempty"`
+	}
+
+	// OIDCError is the body of a rejected token, userinfo, registration, introspection, or revocation request, as OAuth 2.0 defines it
+	OIDCError struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+
+	// OIDCClientRegistration is a request to register an app as a client, as OAuth 2.0 dynamic client registration defines it,
+	// and, with the client's credentials, the response to one
+	OIDCClientRegistration struct {
+		ClientName            string   `json:"client_name,omitempty"`
+		RedirectURIs          []string `json:"redirect_uris"`
+		ClientID              string   `json:"client_id,omitempty"`
+		ClientSecret          string   `json:"client_secret,omitempty"`
+		ClientIDIssuedAt      int64    `json:"client_id_issued_at,omitempty"`
+		ClientSecretExpiresAt *int64   `json:"client_secret_expires_at,omitempty"`
+	}
+
+	// JWKS is a set of JSON web keys
+	JWKS struct {
+		Keys []JWK `json:"keys"`
+	}
+
+	// JWK is the public half of an RSA signing key as a JSON web key
+	JWK struct {
+		KeyType   string `json:"kty"`
+		Use       string `json:"use"`
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+		Modulus   string `json:"n"`
+		Exponent  string `json:"e"`
+	}
+)
+
+// MarshalJSON encodes a user's claims, with their custom Claims alongside the standard ones, which custom claims of the same name don't replace
+func (ui OIDCUserInfo) MarshalJSON() ([]byte, error) {
+	type standardClaims OIDCUserInfo
+	encoded, err := json.Marshal(standardClaims(ui))
+	if err != nil || len(ui.Claims) == 0 {
+		return encoded, err
+	}
+
+	claims := make(map[string]json.RawMessage, len(ui.Claims))
+	for name, value := range ui.Claims {
+		claims[name] = value
+	}
+	if err := json.Unmarshal(encoded, &claims); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(claims)
+}
+
+// UnmarshalJSON decodes a user's claims, keeping the claims that aren't standard in Claims
+func (ui *OIDCUserInfo) UnmarshalJSON(data []byte) error {
+	type standardClaims OIDCUserInfo
+	var standard standardClaims
+	if err := json.Unmarshal(data, &standard); err != nil {
+		return err
+	}
+
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	for _, name := range []string{"sub", "preferred_username", "email", "email_verified", "roles"} {
+		delete(claims, name)
+	}
+	if len(claims) == 0 {
+		claims = nil
+	}
+
+	*ui = OIDCUserInfo(standard)
+	ui.Claims = claims
+	return nil
+}
@@ -0,0 +1,711 @@
+// Package protocol defines the messages exchanged by clients and servers of the signup and login service
+// It has no dependencies on transport, so it builds for every platform the client does
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+const (
+	// ChallengeTypeMirroredXor is the challenge type that XORs the stored payload with a mutation whose halves are equal
+	ChallengeTypeMirroredXor = "mirrored-xor"
+	// ChallengeTypePadXor is the challenge type that XORs the stored payload with a random pad repeated in both halves
+	ChallengeTypePadXor = "pad-xor"
+	// ChallengeTypeAdditiveXor is the challenge type that XORs the stored payload with the bits adding a random integer to its first half changes
+	ChallengeTypeAdditiveXor = "additive-xor"
+
+	// SecretInputName is the circuit input bound to a user's encrypted secret
+	SecretInputName = "secret"
+
+	// ChallengeResultPath prefixes the path a client polls, followed by a challenge's id, for the result of an asynchronous first login request
+	ChallengeResultPath = "/login-1/result/"
+
+	// LogInWebSocketPath is the path of logins that run both steps over a single WebSocket
+	LogInWebSocketPath = "/login-ws"
+
+	// VerifyEmailPath is the path of requests that verify a user's email address with the token mailed to it
+	VerifyEmailPath = "/verify-email"
+
+	// ResetPasswordBeginPath is the path of requests that mail a user a token that resets their password
+	ResetPasswordBeginPath = "/reset-password/begin"
+
+	// ResetPasswordPath is the path of requests that enroll a new password with a mailed reset token
+	ResetPasswordPath = "/reset-password"
+
+	// ExportPath is the path of admin requests for an encrypted archive of every user
+	ExportPath = "/admin/export"
+
+	// ImportPath is the path of admin requests that create the users in an encrypted archive
+	ImportPath = "/admin/import"
+
+	// AdminLogInHistoryPath is the path of admin requests for the recent login attempts of the user named by the username query parameter
+	AdminLogInHistoryPath = "/admin/logins"
+
+	// AccountStatusPath is the path of admin requests for, or that change, the status of a user's account
+	AccountStatusPath = "/admin/status"
+
+	// UserClaimsPath is the path of admin requests for, or that replace, the roles and custom claims of a user, which the tokens issued for them carry
+	UserClaimsPath = "/admin/claims"
+
+	// PasskeyRegisterBeginPath and PasskeyRegisterFinishPath are the paths of the two steps that register a passkey,
+	// either for a session's user or for a new passwordless user
+	PasskeyRegisterBeginPath  = "/passkey/register/begin"
+	PasskeyRegisterFinishPath = "/passkey/register/finish"
+
+	// PasskeyLogInBeginPath and PasskeyLogInFinishPath are the paths of the two steps that log in with a passkey,
+	// where only passwordless users begin one, and users with a password are sent a ceremony after their second login request
+	PasskeyLogInBeginPath  = "/passkey/login/begin"
+	PasskeyLogInFinishPath = "/passkey/login/finish"
+
+	// SRPLogInBeginPath and SRPLogInFinishPath are the paths of the two steps that log in users who signed up with an SRP verifier
+	SRPLogInBeginPath  = "/srp/login/begin"
+	SRPLogInFinishPath = "/srp/login/finish"
+
+	// OPAQUERegisterPath is the path that evaluates a client's blinded password for the OPAQUE record it signs up or resets a password with
+	// OPAQUELogInBeginPath and OPAQUELogInFinishPath are the paths of the two steps that log in users who signed up with an OPAQUE record
+	OPAQUERegisterPath    = "/opaque/register"
+	OPAQUELogInBeginPath  = "/opaque/login/begin"
+	OPAQUELogInFinishPath = "/opaque/login/finish"
+
+	// ProfilePath is the path of requests for the profile of a session's user
+	ProfilePath = "/me"
+
+	// LogInHistoryPath is the path of requests for the recent login attempts of a session's user
+	LogInHistoryPath = "/me/logins"
+
+	// ExportDataPath is the path of requests for everything held about a session's user
+	ExportDataPath = "/me/export"
+
+	// EraseAccountPath is the path of requests that delete a session's user and everything held about them
+	EraseAccountPath = "/me/erase"
+
+	// SessionsPath is the path of requests for the active sessions of a session's user
+	// RevokeSessionPath is the path of requests that revoke one of them
+	SessionsPath      = "/sessions"
+	RevokeSessionPath = "/sessions/revoke"
+
+	// RotateSecretPath is the path of requests that replace a session's user's secret with a new enrollment under their password
+	RotateSecretPath = "/rotate-secret"
+
+	// RememberDevicePath is the path of requests that issue a session's user a device token, DevicesPath of requests for their remembered devices,
+	// and RevokeDevicePath of requests that revoke one of them
+	// DeviceLogInPath is the path that logs a user in with a device token in place of their password
+	RememberDevicePath = "/devices/remember"
+	DevicesPath        = "/devices"
+	RevokeDevicePath   = "/devices/revoke"
+	DeviceLogInPath    = "/devices/login"
+
+	// CreateAPIKeyPath is the path of requests that issue a session's user an API key, APIKeysPath of requests for their API keys,
+	// and RevokeAPIKeyPath of requests that revoke one of them
+	CreateAPIKeyPath = "/api-keys/create"
+	APIKeysPath      = "/api-keys"
+	RevokeAPIKeyPath = "/api-keys/revoke"
+
+	// APIKeyPrefix begins every API key, so they are told apart from session tokens and found by secret scanners
+	APIKeyPrefix = "hak_"
+
+	// QUICNextProto is the ALPN protocol of QUIC connections whose streams each carry a login's messages as JSON values
+	QUICNextProto = "hauth-login"
+
+	// GRPCCodec is the gRPC codec logins over gRPC are sent with, which carries their messages as JSON, so they need no generated code
+	// GRPCLogInMethod is the full method of the bidirectional stream that carries a login's messages
+	GRPCCodec       = "json"
+	GRPCLogInMethod = "/hauth.Login/LogIn"
+
+	// ServerKeyPath is the path of requests for the Ed25519 public key a server signs its login challenges with
+	ServerKeyPath = "/server-key"
+
+	// OpenAPIPath is the path of the OpenAPI document describing the endpoints a server serves and the encodings of their messages
+	OpenAPIPath = "/openapi.json"
+
+	// IdempotencyKeyHeader is the header of sign up requests holding a key unique to the request, whose retries return the outcome of its first success
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// ArchivePassphraseHeader is the header of export and import requests holding the passphrase an archive is encrypted with
+	ArchivePassphraseHeader = "X-Archive-Passphrase"
+
+	// SessionCookieName is the name of the cookie holding a session token, on servers that deliver sessions as cookies
+	SessionCookieName = "hauth_session"
+	// CSRFCookieName is the name of the cookie holding a session's CSRF token, on servers that deliver it by double submit
+	CSRFCookieName = "hauth_csrf"
+	// CSRFTokenHeader is the header of login responses holding a session's CSRF token, which requests authenticated by a session cookie that change state echo
+	CSRFTokenHeader = "X-CSRF-Token"
+
+	// RequestIDHeader is the header of requests holding an ID that identifies them in a server's access log, which responses echo, or hold a new one if the request had none
+	RequestIDHeader = "X-Request-ID"
+)
+
+const (
+	// AccountActive is the status of users who can log in
+	AccountActive AccountStatus = "active"
+	// AccountDisabled is the status of users an admin suspended, who can't log in until they are enabled again
+	AccountDisabled AccountStatus = "disabled"
+	// AccountPendingVerification is the status of active users who can't log in until they verify their email address
+	AccountPendingVerification AccountStatus = "pending-verification"
+	// AccountDeleted is the status of users an admin deleted, who are kept, and keep their username, but are treated as nonexistent until they are restored
+	AccountDeleted AccountStatus = "deleted"
+)
+
+// challengeTypeStrength ranks challenge types from weakest to strongest, unknown challenge types rank as 0
+// Mirrored challenges copy and negate the stored samples, while pad and additive challenges are computed with bootstrapped gates, whose samples are fresh
+var challengeTypeStrength = map[string]int{
+	ChallengeTypeMirroredXor: 1,
+	ChallengeTypePadXor:      2,
+	ChallengeTypeAdditiveXor: 2,
+}
+
+type (
+	// AccountStatus is where a user's account is in its lifecycle
+	AccountStatus string
+
+	// Negotiation is the protocol version, parameter set, and challenge type a server used for a login
+	Negotiation struct {
+		ProtocolVersion int    `json:"ProtocolVersion"`
+		SecurityLevel   int    `json:"SecurityLevel"`
+		ChallengeType   string `json:"ChallengeType"`
+	}
+
+	// SignUpRequest is a request to sign up for a service
+	// Services that verify email addresses require an Email, and the user can't log in until it is verified
+	// Services that refuse signups with ErrCaptchaRequired take the token of a solved CAPTCHA as CaptchaToken
+	// Requests with an SRP enrollment sign up a user who logs in at SRPLogInBeginPath, and have no KDFParams, EncryptedSecret, Secret, or Recovery,
+	// and those with an OPAQUE enrollment likewise sign up a user who logs in at OPAQUELogInBeginPath
+	SignUpRequest struct {
+		Username        string              `json:"Username"`
+		Email           string              `json:"Email,omitempty"`
+		KDFParams       *crypto.KDFParams   `json:"KDFParams"`
+		EncryptedSecret gates.Ctxt          `json:"EncryptedSecret"`
+		Secret          []byte              `json:"Secret"`
+		Recovery        *RecoveryEnrollment `json:"Recovery,omitempty"`
+		SRP             *SRPEnrollment      `json:"SRP,omitempty"`
+		OPAQUE          *OPAQUEEnrollment   `json:"OPAQUE,omitempty"`
+		CaptchaToken    string              `json:"CaptchaToken,omitempty"`
+		Versioned
+	}
+
+	// SRPEnrollment is the SRP-6a verifier of a password and the KDFParams it was stretched with, which logs a user in without the FHE key generation of an encrypted secret,
+	// for clients such as embedded devices that can't afford it
+	SRPEnrollment struct {
+		KDFParams *crypto.KDFParams `json:"KDFParams"`
+		Verifier  []byte            `json:"Verifier"`
+	}
+
+	// OPAQUEEnrollment is the OPAQUE registration record of a password, the nonce of the registration response it was finalized from, and the salt its OPRF output is stretched under,
+	// which logs a user in without FHE key generation, and without the server seeing the password or anything an offline attack could guess it from
+	OPAQUEEnrollment struct {
+		Nonce  []byte `json:"Nonce"`
+		Record []byte `json:"Record"`
+		Salt   []byte `json:"Salt"`
+	}
+
+	// OPAQUERegisterRequest is a request to evaluate a client's blinded password for a new OPAQUE record
+	OPAQUERegisterRequest struct {
+		Request []byte `json:"Request"`
+		Versioned
+	}
+
+	// OPAQUERegisterResponse is the response to an OPAQUE register request, with the random nonce the record's OPRF key is derived under,
+	// which the OPAQUEEnrollment finalized from Response is sent back with, so no request can evaluate passwords under an existing user's key
+	OPAQUERegisterResponse struct {
+		Nonce    []byte `json:"Nonce"`
+		Response []byte `json:"Response"`
+		Versioned
+	}
+
+	// RecoveryEnrollment is a second secret, encrypted under the keys of a recovery phrase as the first is under the password's,
+	// which logs in with Recovery requests when the password is lost
+	RecoveryEnrollment struct {
+		KDFParams       *crypto.KDFParams `json:"KDFParams"`
+		EncryptedSecret gates.Ctxt        `json:"EncryptedSecret"`
+		Secret          []byte            `json:"Secret"`
+	}
+
+	// KDFRequest is a request for the parameters that stretch a user's password, or their recovery phrase if Recovery is set
+	KDFRequest struct {
+		Username string `json:"Username"`
+		Recovery bool   `json:"Recovery,omitempty"`
+		Versioned
+	}
+
+	// FirstLogInRequest is a request to start logging into a service
+	// Async requests return a PendingChallenge immediately, and the FirstLogInResponse is polled for at ChallengeResultPath
+	// Recovery requests are challenged with the user's recovery secret, under the keys of their recovery phrase
+	// StepUpToken is a proof, such as one from the operator's fraud system, sent again after a login is refused with ErrStepUpRequired,
+	// and CaptchaToken is the token of a solved CAPTCHA, sent again after a login is refused with ErrCaptchaRequired
+	// KDFSalt is the salt of the KDFParams the password was stretched with, which picks the secret the user had under them until it expires after their password changes,
+	// where empty picks their current secret
+	FirstLogInRequest struct {
+		Username     string            `json:"Username"`
+		PublicKey    *crypto.PublicKey `json:"PublicKey"`
+		KDFSalt      []byte            `json:"KDFSalt,omitempty"`
+		Async        bool              `json:"Async,omitempty"`
+		Recovery     bool              `json:"Recovery,omitempty"`
+		StepUpToken  string            `json:"StepUpToken,omitempty"`
+		CaptchaToken string            `json:"CaptchaToken,omitempty"`
+		Versioned
+	}
+
+	// PendingChallenge is the response to an asynchronous first login request, and to polls before its challenge is computed
+	PendingChallenge struct {
+		ChallengeID string `json:"ChallengeID"`
+		Versioned
+	}
+
+	// FirstLogInResponse is the response to a first login request, with the length of the secret the user enrolled at sign up
+	// EncryptedMutatedSecret has two halves of a bit per bit of the secret, under the parameter set of the user's public key
+	FirstLogInResponse struct {
+		EncryptedMutatedSecret gates.Ctxt
+		SecretByteLen          int
+		// ChallengeID and Nonce are echoed by the second login request, which answers the challenge once, before it expires at ExpiresAt
+		ChallengeID string `json:",omitempty"`
+		Nonce       string `json:",omitempty"`
+		ExpiresAt   time.Time
+		// Signature is the server's signature of the login's Transcript up to and including the challenge, if the server signs challenges
+		Signature []byte `json:",omitempty"`
+		Negotiation
+		Versioned
+	}
+
+	// SecondLogInRequest is a request to finish logging into a service, with the user's recovery secret if Recovery is set,
+	// answering the challenge with the ChallengeID and Nonce of the FirstLogInResponse, so it can't be replayed,
+	// and the client's Transcript of the login followed by the secret, so it can't be spliced into another login
+	SecondLogInRequest struct {
+		Username    string     `json:"Username"`
+		Secret      []byte     `json:"Secret"`
+		Recovery    bool       `json:"Recovery,omitempty"`
+		ChallengeID string     `json:"ChallengeID"`
+		Nonce       string     `json:"Nonce"`
+		Transcript  Transcript `json:"Transcript"`
+		Versioned
+	}
+
+	// LogInStreamMessage is a message from a server during a login over a WebSocket, after the client sends its FirstLogInRequest
+	// The first message holds the Negotiation, the challenge's length in bits, and its id, nonce, and expiry, the following hold the challenge's samples in order,
+	// the one after them holds the challenge's Signature, which is empty if the server doesn't sign challenges,
+	// and the message answering the client's SecondLogInRequest holds its LogInResponse
+	// A message holding an Error and the status an http request would have returned ends the login
+	LogInStreamMessage struct {
+		Negotiation   *Negotiation   `json:"Negotiation,omitempty"`
+		Bits          int            `json:"Bits,omitempty"`
+		SecretByteLen int            `json:"SecretByteLen,omitempty"`
+		ChallengeID   string         `json:"ChallengeID,omitempty"`
+		Nonce         string         `json:"Nonce,omitempty"`
+		ExpiresAt     *time.Time     `json:"ExpiresAt,omitempty"`
+		Samples       gates.Ctxt     `json:"Samples,omitempty"`
+		Signature     []byte         `json:"Signature,omitempty"`
+		LogIn         *LogInResponse `json:"LogIn,omitempty"`
+		Error         *ErrorResponse `json:"Error,omitempty"`
+		Status        int            `json:"Status,omitempty"`
+		Versioned
+	}
+
+	// LogInResponse is the response to a successful second login request
+	// Users with a passkey are sent a Passkey ceremony to finish at PasskeyLogInFinishPath instead of a token
+	// RotationRequired is set when the user's secret is older than the server's rotation policy allows, and should be replaced at RotateSecretPath with the session
+	LogInResponse struct {
+		Token            string           `json:"Token"`
+		ExpiresAt        time.Time        `json:"ExpiresAt"`
+		Passkey          *PasskeyCeremony `json:"Passkey,omitempty"`
+		RotationRequired bool             `json:"RotationRequired,omitempty"`
+		Versioned
+	}
+
+	// SRPBeginRequest is a request to begin logging in a user who signed up with an SRP verifier, with the client's public key A,
+	// and any step-up and CAPTCHA tokens as a FirstLogInRequest's
+	SRPBeginRequest struct {
+		Username     string `json:"Username"`
+		PublicKey    []byte `json:"PublicKey"`
+		StepUpToken  string `json:"StepUpToken,omitempty"`
+		CaptchaToken string `json:"CaptchaToken,omitempty"`
+		Versioned
+	}
+
+	// SRPBeginResponse is the response to an SRP begin request, with the KDFParams of the user's verifier and the server's public key B,
+	// and the id of the login to finish at SRPLogInFinishPath
+	SRPBeginResponse struct {
+		CeremonyID string            `json:"CeremonyID"`
+		KDFParams  *crypto.KDFParams `json:"KDFParams"`
+		PublicKey  []byte            `json:"PublicKey"`
+		Versioned
+	}
+
+	// SRPFinishRequest is a request to finish an SRP login with the client's proof M1 that it knows the user's password
+	SRPFinishRequest struct {
+		Username   string `json:"Username"`
+		CeremonyID string `json:"CeremonyID"`
+		Proof      []byte `json:"Proof"`
+		Versioned
+	}
+
+	// SRPFinishResponse is the response to a successful SRP finish request, with the server's proof M2 that it holds the user's verifier
+	SRPFinishResponse struct {
+		Proof []byte `json:"Proof"`
+		LogInResponse
+		Versioned
+	}
+
+	// OPAQUEBeginRequest is a request to begin logging in a user who signed up with an OPAQUE record, with the client's first key exchange message KE1,
+	// and any step-up and CAPTCHA tokens as a FirstLogInRequest's
+	OPAQUEBeginRequest struct {
+		Username     string `json:"Username"`
+		KE1          []byte `json:"KE1"`
+		StepUpToken  string `json:"StepUpToken,omitempty"`
+		CaptchaToken string `json:"CaptchaToken,omitempty"`
+		Versioned
+	}
+
+	// OPAQUEBeginResponse is the response to an OPAQUE begin request, with the server's key exchange message KE2, the salt of the user's record,
+	// and the id of the login to finish at OPAQUELogInFinishPath
+	OPAQUEBeginResponse struct {
+		CeremonyID string `json:"CeremonyID"`
+		KE2        []byte `json:"KE2"`
+		Salt       []byte `json:"Salt"`
+		Versioned
+	}
+
+	// OPAQUEFinishRequest is a request to finish an OPAQUE login with the client's final key exchange message KE3, its proof that it knows the user's password
+	OPAQUEFinishRequest struct {
+		Username   string `json:"Username"`
+		CeremonyID string `json:"CeremonyID"`
+		KE3        []byte `json:"KE3"`
+		Versioned
+	}
+
+	// PasskeyBeginRequest is a request to begin registering or logging in with a passkey
+	// Registrations with a session's bearer token add a passkey to its user, and those without create the passwordless user named
+	PasskeyBeginRequest struct {
+		Username string `json:"Username"`
+		Email    string `json:"Email,omitempty"`
+		Versioned
+	}
+
+	// PasskeyCeremony is a WebAuthn ceremony for a client's authenticator, whose Options are passed to navigator.credentials.create or get
+	PasskeyCeremony struct {
+		CeremonyID string          `json:"CeremonyID"`
+		Options    json.RawMessage `json:"Options"`
+		Versioned
+	}
+
+	// PasskeyFinishRequest is a request to finish a WebAuthn ceremony with the authenticator's response, as the JSON of its PublicKeyCredential
+	PasskeyFinishRequest struct {
+		Username   string          `json:"Username"`
+		CeremonyID string          `json:"CeremonyID"`
+		Credential json.RawMessage `json:"Credential"`
+		Versioned
+	}
+
+	// VerifyEmailRequest is a request to verify a user's email address with the token mailed to it, where an empty token mails a fresh one
+	VerifyEmailRequest struct {
+		Username string `json:"Username"`
+		Token    string `json:"Token"`
+		Versioned
+	}
+
+	// ResetPasswordBeginRequest is a request to mail a user a token that resets their password
+	ResetPasswordBeginRequest struct {
+		Username string `json:"Username"`
+		Versioned
+	}
+
+	// ResetPasswordRequest is a request to replace a user's encrypted secret and its hash, or their SRP verifier or OPAQUE record, enrolled as a sign up request does,
+	// with a mailed reset token, or with no token and the bearer token of a session from a recovery login
+	ResetPasswordRequest struct {
+		Username        string            `json:"Username"`
+		Token           string            `json:"Token"`
+		KDFParams       *crypto.KDFParams `json:"KDFParams"`
+		EncryptedSecret gates.Ctxt        `json:"EncryptedSecret"`
+		Secret          []byte            `json:"Secret"`
+		SRP             *SRPEnrollment    `json:"SRP,omitempty"`
+		OPAQUE          *OPAQUEEnrollment `json:"OPAQUE,omitempty"`
+		Versioned
+	}
+
+	// SessionInfo is one of a user's active sessions, identified by the hash of its token, and whether it is the session of the request that listed it
+	SessionInfo struct {
+		ID        string    `json:"ID"`
+		Recovery  bool      `json:"Recovery,omitempty"`
+		AuthTime  time.Time `json:"AuthTime"`
+		IssuedAt  time.Time `json:"IssuedAt"`
+		ExpiresAt time.Time `json:"ExpiresAt"`
+		Current   bool      `json:"Current,omitempty"`
+	}
+
+	// SessionsResponse is the response to a request for a user's active sessions, ordered by when they were issued
+	SessionsResponse struct {
+		Sessions []SessionInfo `json:"Sessions"`
+		Versioned
+	}
+
+	// RevokeSessionRequest is a request to revoke one of a session's user's sessions by its ID
+	RevokeSessionRequest struct {
+		ID string `json:"ID"`
+		Versioned
+	}
+
+	// RotateSecretRequest is a request to replace a session's user's secret with a new one, enrolled as at sign up under their password stretched with fresh KDFParams
+	RotateSecretRequest struct {
+		KDFParams       *crypto.KDFParams `json:"KDFParams"`
+		EncryptedSecret gates.Ctxt        `json:"EncryptedSecret"`
+		Secret          []byte            `json:"Secret"`
+		Versioned
+	}
+
+	// RememberDeviceRequest is a request to remember the device a session is on under a name,
+	// bound to a fingerprint of the device, such as a hash of its hardware identifiers, which logins with its token must present, if one is set
+	RememberDeviceRequest struct {
+		Name        string `json:"Name"`
+		Fingerprint string `json:"Fingerprint,omitempty"`
+		Versioned
+	}
+
+	// DeviceToken is a long-lived token that logs a user in on a remembered device, and the ID the device is listed and revoked by
+	DeviceToken struct {
+		ID        string    `json:"ID"`
+		Token     string    `json:"Token"`
+		ExpiresAt time.Time `json:"ExpiresAt"`
+		Versioned
+	}
+
+	// DeviceInfo is one of a user's remembered devices, and whether its token is bound to a fingerprint
+	DeviceInfo struct {
+		ID         string    `json:"ID"`
+		Name       string    `json:"Name"`
+		Bound      bool      `json:"Bound,omitempty"`
+		CreatedAt  time.Time `json:"CreatedAt"`
+		LastUsedAt time.Time `json:"LastUsedAt"`
+		ExpiresAt  time.Time `json:"ExpiresAt"`
+	}
+
+	// DevicesResponse is the response to a request for a user's remembered devices, ordered by when they were remembered
+	DevicesResponse struct {
+		Devices []DeviceInfo `json:"Devices"`
+		Versioned
+	}
+
+	// RevokeDeviceRequest is a request to revoke one of a session's user's remembered devices by its ID
+	RevokeDeviceRequest struct {
+		ID string `json:"ID"`
+		Versioned
+	}
+
+	// DeviceLogInRequest is a request to log a user in with the token of a remembered device and the fingerprint it was bound to,
+	// and any step-up and CAPTCHA tokens as a FirstLogInRequest's
+	DeviceLogInRequest struct {
+		Username     string `json:"Username"`
+		Token        string `json:"Token"`
+		Fingerprint  string `json:"Fingerprint,omitempty"`
+		StepUpToken  string `json:"StepUpToken,omitempty"`
+		CaptchaToken string `json:"CaptchaToken,omitempty"`
+		Versioned
+	}
+
+	// CreateAPIKeyRequest is a request to issue a session's user an API key under a name, granting scopes, which expires at ExpiresAt, where nil never expires
+	CreateAPIKeyRequest struct {
+		Name      string     `json:"Name"`
+		Scopes    []string   `json:"Scopes,omitempty"`
+		ExpiresAt *time.Time `json:"ExpiresAt,omitempty"`
+		Versioned
+	}
+
+	// APIKey is an API key that authenticates a machine as its user, and the ID it is listed and revoked by
+	// Key is only ever returned when the API key is issued, since only its hash is stored
+	APIKey struct {
+		ID        string     `json:"ID"`
+		Key       string     `json:"Key"`
+		Name      string     `json:"Name"`
+		Scopes    []string   `json:"Scopes"`
+		ExpiresAt *time.Time `json:"ExpiresAt,omitempty"`
+		Versioned
+	}
+
+	// APIKeyInfo is one of a user's API keys, where a nil LastUsedAt was never used and a nil ExpiresAt never expires
+	APIKeyInfo struct {
+		ID         string     `json:"ID"`
+		Name       string     `json:"Name"`
+		Scopes     []string   `json:"Scopes"`
+		CreatedAt  time.Time  `json:"CreatedAt"`
+		LastUsedAt *time.Time `json:"LastUsedAt,omitempty"`
+		ExpiresAt  *time.Time `json:"ExpiresAt,omitempty"`
+	}
+
+	// APIKeysResponse is the response to a request for a user's API keys, ordered by when they were issued
+	APIKeysResponse struct {
+		APIKeys []APIKeyInfo `json:"APIKeys"`
+		Versioned
+	}
+
+	// RevokeAPIKeyRequest is a request to revoke one of a session's user's API keys by its ID
+	RevokeAPIKeyRequest struct {
+		ID string `json:"ID"`
+		Versioned
+	}
+
+	// ServerKeyResponse is the response to a request for a server's Ed25519 public key, which clients pin to verify its login challenges
+	ServerKeyResponse struct {
+		PublicKey []byte `json:"PublicKey"`
+		Versioned
+	}
+
+	// WhoAmIResponse is the response to a request with a valid session token
+	WhoAmIResponse struct {
+		Username string `json:"Username"`
+		Versioned
+	}
+
+	// ProfileResponse is the response to a request for a session's user's profile
+	// CreatedAt is when they signed up, LastLogInAt when they last logged in, and FailedLogIns the logins that failed since then, the last at LastFailedLogInAt,
+	// where times the server didn't record are omitted
+	// SecurityLevel is the security level of the parameter set their encrypted secret is encrypted under, omitted for users without one
+	ProfileResponse struct {
+		Username          string     `json:"Username"`
+		Email             string     `json:"Email,omitempty"`
+		CreatedAt         *time.Time `json:"CreatedAt,omitempty"`
+		LastLogInAt       *time.Time `json:"LastLogInAt,omitempty"`
+		FailedLogIns      int        `json:"FailedLogIns"`
+		LastFailedLogInAt *time.Time `json:"LastFailedLogInAt,omitempty"`
+		SecurityLevel     int        `json:"SecurityLevel,omitempty"`
+		Versioned
+	}
+
+	// LogInAttempt is a login attempt of a user, when it was made, the IP address it came from, whether it succeeded and was a recovery,
+	// and the id of the challenge or ceremony it answered, if it answered one
+	LogInAttempt struct {
+		At          time.Time `json:"At"`
+		IP          string    `json:"IP"`
+		Succeeded   bool      `json:"Succeeded"`
+		Recovery    bool      `json:"Recovery,omitempty"`
+		ChallengeID string    `json:"ChallengeID,omitempty"`
+	}
+
+	// LogInHistoryResponse is the response to a request for a user's recent login attempts, oldest first
+	LogInHistoryResponse struct {
+		Username string         `json:"Username"`
+		Attempts []LogInAttempt `json:"Attempts"`
+		Versioned
+	}
+
+	// AccountStatusRequest is an admin request that changes the status of a user's account to active, disabled, or deleted,
+	// where activating users who haven't verified their email address leaves them pending verification
+	AccountStatusRequest struct {
+		Username string        `json:"Username"`
+		Status   AccountStatus `json:"Status"`
+		Versioned
+	}
+
+	// AccountStatusResponse is the response to an admin request for, or that changed, the status of a user's account
+	AccountStatusResponse struct {
+		Username string        `json:"Username"`
+		Status   AccountStatus `json:"Status"`
+		Versioned
+	}
+
+	// UserClaims is the roles and custom claims of a user, which the ID tokens and userinfo responses issued for them carry alongside the standard claims,
+	// so services can authorize them from a token alone
+	// Claims are named by their JSON keys, which can't be the standard claims'
+	UserClaims struct {
+		Username string                     `json:"Username"`
+		Roles    []string                   `json:"Roles,omitempty"`
+		Claims   map[string]json.RawMessage `json:"Claims,omitempty"`
+		Versioned
+	}
+
+	// DataExport is everything held about a user, as of ExportedAt, with their profile's fields as ProfileResponse's
+	// SecretCreatedAt is when their encrypted secret was enrolled, and Credentials are the kinds of credential they log in with:
+	// password, recovery, srp, opaque, and passkey, which are described rather than included, since their hashes would only help guess them offline
+	DataExport struct {
+		Username          string                     `json:"Username"`
+		Email             string                     `json:"Email,omitempty"`
+		EmailVerified     bool                       `json:"EmailVerified,omitempty"`
+		Status            AccountStatus              `json:"Status"`
+		Roles             []string                   `json:"Roles,omitempty"`
+		Claims            map[string]json.RawMessage `json:"Claims,omitempty"`
+		CreatedAt         *time.Time                 `json:"CreatedAt,omitempty"`
+		LastLogInAt       *time.Time                 `json:"LastLogInAt,omitempty"`
+		FailedLogIns      int                        `json:"FailedLogIns"`
+		LastFailedLogInAt *time.Time                 `json:"LastFailedLogInAt,omitempty"`
+		SecretCreatedAt   *time.Time                 `json:"SecretCreatedAt,omitempty"`
+		SecurityLevel     int                        `json:"SecurityLevel,omitempty"`
+		Credentials       []string                   `json:"Credentials"`
+		Devices           []DeviceInfo               `json:"Devices"`
+		APIKeys           []APIKeyInfo               `json:"APIKeys"`
+		Sessions          []SessionInfo              `json:"Sessions"`
+		LogInHistory      []LogInAttempt             `json:"LogInHistory"`
+		ExportedAt        time.Time                  `json:"ExportedAt"`
+		Versioned
+	}
+
+	// EraseAccountRequest is a request to delete a session's user, which names them again to confirm it
+	EraseAccountRequest struct {
+		Username string `json:"Username"`
+		Versioned
+	}
+
+	// EraseAccountResponse is the response to a request that deleted a user, and when they were erased
+	EraseAccountResponse struct {
+		Username string    `json:"Username"`
+		ErasedAt time.Time `json:"ErasedAt"`
+		Versioned
+	}
+
+	// ChangePasswordRequest is a request to re-key a user's encrypted secret to a new password, proving the old one by answering a login challenge
+	ChangePasswordRequest struct {
+		Username     string            `json:"Username"`
+		Secret       []byte            `json:"Secret"`
+		ChallengeID  string            `json:"ChallengeID"`
+		Nonce        string            `json:"Nonce"`
+		Transcript   Transcript        `json:"Transcript"`
+		KDFParams    *crypto.KDFParams `json:"KDFParams"`
+		PublicKey    *crypto.PublicKey `json:"PublicKey"`
+		SwitchingKey *crypto.PublicKey `json:"SwitchingKey"`
+		ReMask       gates.Ctxt        `json:"ReMask"`
+		Versioned
+	}
+
+	// EvaluateRequest is a request to evaluate a circuit against a user's encrypted secret
+	EvaluateRequest struct {
+		Username  string                `json:"Username"`
+		PublicKey *crypto.PublicKey     `json:"PublicKey"`
+		Circuit   json.RawMessage       `json:"Circuit"`
+		Inputs    map[string]gates.Ctxt `json:"Inputs"`
+		Versioned
+	}
+
+	// ImportResponse is the response to an import request, counting the archive's users that were created,
+	// and those skipped because their username was taken or isn't allowed by the server's username policy
+	ImportResponse struct {
+		Imported int `json:"Imported"`
+		Skipped  int `json:"Skipped"`
+		Versioned
+	}
+
+	// EvaluateResponse is the response to an evaluate request
+	EvaluateResponse struct {
+		Outputs map[string]gates.Ctxt
+		Versioned
+	}
+)
+
+// WeakerThan returns whether any of a Negotiation's terms are weaker than another's
+func (n Negotiation) WeakerThan(other Negotiation) bool {
+	return n.ProtocolVersion < other.ProtocolVersion ||
+		n.SecurityLevel < other.SecurityLevel ||
+		challengeTypeStrength[n.ChallengeType] < challengeTypeStrength[other.ChallengeType]
+}
+
+// Strongest returns the strongest terms of two Negotiations
+func (n Negotiation) Strongest(other Negotiation) Negotiation {
+	result := Negotiation{
+		ProtocolVersion: max(n.ProtocolVersion, other.ProtocolVersion),
+		SecurityLevel:   max(n.SecurityLevel, other.SecurityLevel),
+		ChallengeType:   n.ChallengeType,
+	}
+	if challengeTypeStrength[other.ChallengeType] > challengeTypeStrength[n.ChallengeType] {
+		result.ChallengeType = other.ChallengeType
+	}
+
+	return result
+}
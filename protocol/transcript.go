@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"math"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+const (
+	// transcriptLabel starts every Transcript, so its hashes can't be mistaken for hashes of anything else
+	transcriptLabel = "hauth login transcript v1"
+	// challengeSignatureLabel prefixes the Transcripts a server signs, so its signatures can't be mistaken for signatures of anything else
+	challengeSignatureLabel = "hauth challenge signature v1"
+)
+
+// Transcript is the running hash of the messages of a login, which the client and server each keep as they exchange them
+// Each message is hashed into the previous hash, so the second login request proves which public key, challenge, and response
+// the client saw, and a man-in-the-middle can't splice a challenge from one login into another
+type Transcript []byte
+
+// NewTranscript returns the Transcript of a login of a user, by the username they logged in with and whether it is a recovery login
+func NewTranscript(username string, recovery bool) Transcript {
+	var flag byte
+	if recovery {
+		flag = 1
+	}
+
+	return Transcript(nil).with("start", []byte(transcriptLabel), []byte(username), []byte{flag})
+}
+
+// WithPublicKey returns a Transcript followed by the fingerprint of the public key a first login request was sent with
+func (t Transcript) WithPublicKey(publicKey *crypto.PublicKey) Transcript {
+	return t.with("public-key", publicKey.Fingerprint())
+}
+
+// WithChallenge returns a Transcript followed by a FirstLogInResponse, whose EncryptedMutatedSecret is hashed into samplesHash with HashSamples
+// as it is sent or received, so streamed challenges needn't be held whole
+func (t Transcript) WithChallenge(firstLogInResponse *FirstLogInResponse, samplesHash []byte) Transcript {
+	terms, _ := json.Marshal(&firstLogInResponse.Negotiation)
+	secretByteLen := binary.BigEndian.AppendUint64(nil, uint64(firstLogInResponse.SecretByteLen))
+	expiresAt := binary.BigEndian.AppendUint64(nil, uint64(firstLogInResponse.ExpiresAt.UnixNano()))
+	return t.with("challenge", terms, secretByteLen, []byte(firstLogInResponse.ChallengeID), []byte(firstLogInResponse.Nonce), expiresAt, samplesHash)
+}
+
+// Sign returns a server's signature of a Transcript up to and including its challenge, which covers the challenge's ciphertext, nonce, and expiry
+func (t Transcript) Sign(key ed25519.PrivateKey) []byte {
+	return ed25519.Sign(key, append([]byte(challengeSignatureLabel), t...))
+}
+
+// Verify returns whether a signature of a Transcript up to and including its challenge was made by the server with a public key
+func (t Transcript) Verify(key ed25519.PublicKey, signature []byte) bool {
+	return len(key) == ed25519.PublicKeySize && ed25519.Verify(key, append([]byte(challengeSignatureLabel), t...), signature)
+}
+
+// WithResponse returns a Transcript followed by the secret a second login request answers its challenge with
+func (t Transcript) WithResponse(secret []byte) Transcript {
+	return t.with("response", secret)
+}
+
+// with returns the hash of a Transcript followed by a labelled message, each of whose parts is prefixed by its length
+func (t Transcript) with(label string, parts ...[]byte) Transcript {
+	h := sha256.New()
+	h.Write(t)
+	writeLenPrefixed(h, []byte(label))
+	for _, part := range parts {
+		writeLenPrefixed(h, part)
+	}
+
+	return h.Sum(nil)
+}
+
+// HashSamples writes the samples of a challenge to a hash in order, so hashing a challenge in chunks gives the same hash as hashing it whole
+func HashSamples(h hash.Hash, samples gates.Ctxt) {
+	var buf []byte
+	for _, sample := range samples {
+		buf = binary.BigEndian.AppendUint64(buf[:0], uint64(len(sample.A)))
+		for _, a := range sample.A {
+			buf = binary.BigEndian.AppendUint32(buf, uint32(a))
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(sample.B))
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(sample.CurrentVariance))
+		h.Write(buf)
+	}
+}
+
+// writeLenPrefixed writes a part of a message to a hash, prefixed by its length
+func writeLenPrefixed(h hash.Hash, part []byte) {
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(part))))
+	h.Write(part)
+}
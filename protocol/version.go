@@ -0,0 +1,55 @@
+package protocol
+
+const (
+	// Version is the current version of the signup and login protocol
+	// Version 2 answers each login challenge once, by its id and nonce, with the transcript of the login's messages
+	Version = 2
+
+	// MinVersion is the oldest version of the protocol a server can speak
+	// Version 1 answers login challenges with only their secret, as messages without a Version did
+	MinVersion = 1
+)
+
+// Versioned is embedded in every request and response, holding the version of the protocol it was sent in
+// Messages without a Version were sent in MinVersion, before messages carried one
+type Versioned struct {
+	Version int `json:"Version,omitempty"`
+}
+
+// EffectiveVersion returns the version of the protocol a message was sent in
+func (v Versioned) EffectiveVersion() int {
+	if v.Version == 0 {
+		return MinVersion
+	}
+
+	return v.Version
+}
+
+// SetVersion sets the version of the protocol a message is sent in
+func (v *Versioned) SetVersion(version int) {
+	v.Version = version
+}
+
+// versioned returns the Versioned a message embeds
+func (v *Versioned) versioned() *Versioned {
+	return v
+}
+
+// StampVersion sets the Version of a message that embeds Versioned and has no Version to the current Version
+// Other messages are left alone
+func StampVersion(message any) {
+	if m, ok := message.(interface{ versioned() *Versioned }); ok && m.versioned().Version == 0 {
+		m.versioned().Version = Version
+	}
+}
+
+// NegotiateVersion returns the version of the protocol a login is run in, the newest both a client requesting a version and this package speak,
+// or ErrUnsupportedVersion if it is older than the oldest version a server accepts
+func NegotiateVersion(requested, oldest int) (int, error) {
+	version := min(max(requested, MinVersion), Version)
+	if version < oldest {
+		return 0, ErrUnsupportedVersion
+	}
+
+	return version, nil
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// requestIDByteLen is the length of a generated request ID before encoding
+	requestIDByteLen = 8
+	// maxRequestIDLen is the length of the longest request ID a request can send, beyond which it is replaced
+	maxRequestIDLen = 128
+	// maxLoggedBodyLen is the length of the longest request body an AccessLogPolicy logs, beyond which only its size is logged
+	maxLoggedBodyLen = 64 << 10
+	// redacted replaces the values of secret fields in logged bodies
+	redacted = "[REDACTED]"
+)
+
+// loggedFields are the lower cased names of the fields known to hold no secrets, whose values logged bodies keep, while every other field's value is redacted,
+// so fields added later, such as another login's verifier or record, aren't logged until they are known to be safe
+var loggedFields = []string{
+	"username", "version", "protocolversion", "recovery", "async", "challengeid", "ceremonyid", "challengetype",
+	"bits", "bound", "securitylevel", "secretbytelen", "id", "name", "status", "roles", "scopes", "scope", "expiresat", "redirecturi",
+}
+
+type (
+	// AccessLogPolicy is where a server logs each request it serves, with its method, path, status, latency, sizes, and request ID,
+	// and whether the request's body is logged too, for debugging, with its secret fields redacted
+	AccessLogPolicy struct {
+		// Logger is the logger requests are logged to, where nil is the standard logger
+		Logger *log.Logger
+		// Bodies logs the JSON body of each request, with the values of all but fields known to hold no secrets, such as Username and Version, redacted,
+		// and only the size of other bodies
+		Bodies bool
+	}
+
+	// countingReadCloser is an io.ReadCloser that counts the bytes read from it
+	countingReadCloser struct {
+		io.ReadCloser
+		n int64
+	}
+
+	// loggingResponseWriter is an http.ResponseWriter that keeps the status it writes and counts the bytes of the body
+	loggingResponseWriter struct {
+		http.ResponseWriter
+		status int
+		n      int64
+	}
+)
+
+// Read reads from a countingReadCloser, and counts the bytes read
+func (rc *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	rc.n += int64(n)
+	return n, err
+}
+
+// WriteHeader writes a status, and keeps it
+func (rw *loggingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes part of a body, and counts its bytes
+func (rw *loggingResponseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.n += int64(n)
+	return n, err
+}
+
+// Unwrap returns the http.ResponseWriter a loggingResponseWriter wraps, so WebSocket upgrades can hijack it
+func (rw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// requestID returns a request's ID from its protocol.RequestIDHeader, or a new one if it sent none or one that is too long
+func (s *Server) requestID(req *http.Request) string {
+	if id := req.Header.Get(protocol.RequestIDHeader); id != "" && len(id) <= maxRequestIDLen {
+		return id
+	}
+
+	id := make([]byte, requestIDByteLen)
+	if _, err := io.ReadFull(s.entropy, id); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// redactBody returns a request body to log, with the values of all but its fields known to hold no secrets redacted,
+// or its size if it is too long or isn't JSON, so its secrets can't be logged
+func redactBody(body []byte) string {
+	var v any
+	if len(body) > maxLoggedBodyLen || json.Unmarshal(body, &v) != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	logged, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	return string(logged)
+}
+
+// redactValue returns a decoded JSON value with the values of its objects' fields, at any depth, redacted unless they are known to hold no secrets
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for name, field := range v {
+			if redactedField(name) {
+				v[name] = redacted
+			} else {
+				v[name] = redactValue(field)
+			}
+		}
+	case []any:
+		for i, element := range v {
+			v[i] = redactValue(element)
+		}
+	}
+
+	return v
+}
+
+// redactedField returns whether the value of a field is redacted from logged bodies, which it is unless it is one of loggedFields
+func redactedField(name string) bool {
+	return !slices.Contains(loggedFields, strings.ToLower(name))
+}
+
+// withAccessLog returns a handler that logs each request after it is served, as the server's AccessLogPolicy sets,
+// and returns its request ID in a protocol.RequestIDHeader
+func (s *Server) withAccessLog(next http.Handler) http.Handler {
+	logger := s.accessLog.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		id := s.requestID(req)
+		w.Header().Set(protocol.RequestIDHeader, id)
+
+		var body string
+		if s.accessLog.Bodies && req.Body != nil {
+			read, err := io.ReadAll(req.Body)
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			body = " body=" + redactBody(read)
+			req.Body = io.NopCloser(bytes.NewReader(read))
+		}
+
+		counter := &countingReadCloser{ReadCloser: http.NoBody}
+		if req.Body != nil {
+			counter.ReadCloser = req.Body
+		}
+		req.Body = counter
+		recorder := &loggingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, req)
+
+		logger.Printf("request id=%s method=%s path=%q status=%d latency=%s in=%d out=%d%s",
+			id, req.Method, req.URL.Path, recorder.status, time.Since(start), counter.n, recorder.n, body)
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var (
+	errMissingPassphrase = errors.New("missing " + protocol.ArchivePassphraseHeader + " header")
+	errUnlistableStore   = errors.New("user store can't list its users")
+)
+
+// isAdmin returns whether a request's bearer token is the Server's admin token
+func (s *Server) isAdmin(req *http.Request) bool {
+	token, ok := bearerToken(req)
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// archivePassphrase returns the passphrase of an export or import request
+func archivePassphrase(req *http.Request) (string, bool) {
+	passphrase := req.Header.Get(protocol.ArchivePassphraseHeader)
+	return passphrase, passphrase != ""
+}
+
+// ExportHandler handles admin requests for every user, including their ciphertexts, in an archive encrypted with the request's passphrase
+// Authorized requests return the archive and a 2XX status
+// Requests without the admin token or a passphrase return a 4XX status
+// User stores that can't list their users, and storage errors, return a 5XX status
+func (s *Server) ExportHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.isAdmin(req) {
+		writeError(w, protocol.ErrNotAdmin, http.StatusUnauthorized)
+		return
+	}
+
+	passphrase, ok := archivePassphrase(req)
+	if !ok {
+		writeError(w, errMissingPassphrase, http.StatusBadRequest)
+		return
+	}
+
+	lister, ok := s.users.(UserLister)
+	if !ok {
+		writeError(w, errUnlistableStore, http.StatusNotImplemented)
+		return
+	}
+
+	users, err := lister.List()
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	SealArchive(w, s.entropy, users, passphrase)
+}
+
+// ImportHandler handles admin requests that create the users in an archive encrypted with the request's passphrase
+// Users whose username is taken or isn't allowed by the UsernamePolicy are skipped, so an import can be retried, and the counts of each return a 2XX status
+// Requests without the admin token or a passphrase, and malformed archives or wrong passphrases, return a 4XX status
+// Storage errors return a 5XX status, after importing the users before the failure
+func (s *Server) ImportHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.isAdmin(req) {
+		writeError(w, protocol.ErrNotAdmin, http.StatusUnauthorized)
+		return
+	}
+
+	passphrase, ok := archivePassphrase(req)
+	if !ok {
+		writeError(w, errMissingPassphrase, http.StatusBadRequest)
+		return
+	}
+
+	users, err := OpenArchive(req.Body, passphrase)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var importResponse protocol.ImportResponse
+	for _, user := range users {
+		err := s.users.Create(user)
+		if errors.Is(err, protocol.ErrUserExists) || errors.Is(err, protocol.ErrInvalidUsername) {
+			importResponse.Skipped++
+			continue
+		} else if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		importResponse.Imported++
+	}
+
+	writeJSON(w, http.StatusOK, &importResponse)
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// apiKeyByteLen is the length of the secret part of an API key before encoding
+	apiKeyByteLen = 32
+	// apiKeyIDByteLen is the length of an API key's ID before encoding
+	apiKeyIDByteLen = 12
+	// maxAPIKeys is how many unexpired API keys a user can have, past which issuing another is refused
+	maxAPIKeys = 32
+	// apiKeyUseInterval is how often an API key's LastUsedAt is recorded, so most requests bearing it don't write to the store
+	apiKeyUseInterval = time.Minute
+)
+
+var (
+	errAPIKeyRecovery  = errors.New("recovery sessions can't issue API keys")
+	errAPIKeyName      = errors.New("API keys must be named")
+	errAPIKeyExpiry    = errors.New("API key expiry must be in the future")
+	errInvalidScope    = errors.New("scopes must be nonempty and can't contain spaces, quotes, or backslashes")
+	errTooManyAPIKeys  = fmt.Errorf("users can't have more than %d API keys", maxAPIKeys)
+	errUnknownAPIKey   = errors.New("unknown API key")
+	errMalformedAPIKey = fmt.Errorf("%w: malformed", protocol.ErrInvalidAPIKey)
+)
+
+// expired returns whether an API key expired by a time
+func (k APIKey) expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// info returns the description of an API key that its user is shown
+func (k APIKey) info() protocol.APIKeyInfo {
+	return protocol.APIKeyInfo{
+		ID:         k.ID,
+		Name:       k.Name,
+		Scopes:     append([]string{}, k.Scopes...),
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: recordedTime(k.LastUsedAt),
+		ExpiresAt:  recordedTime(k.ExpiresAt),
+	}
+}
+
+// activeAPIKeys returns the API keys that haven't expired, ordered by when they were issued
+func activeAPIKeys(keys []APIKey) []APIKey {
+	now := time.Now()
+	active := make([]APIKey, 0, len(keys))
+	for _, key := range keys {
+		if !key.expired(now) {
+			active = append(active, key)
+		}
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.Before(active[j].CreatedAt)
+	})
+	return active
+}
+
+// validScope returns whether a scope is an RFC 6749 scope token, of printable ASCII other than spaces, quotes, and backslashes
+func validScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+
+	for _, r := range scope {
+		if r <= ' ' || r == '"' || r == '\\' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// formatAPIKey returns the API key of a user's key ID and secret, which names its user so it can be checked without a session
+func formatAPIKey(username, id, secret string) string {
+	return protocol.APIKeyPrefix + base64.RawURLEncoding.EncodeToString([]byte(username)) + "." + id + "." + secret
+}
+
+// parseAPIKey returns the username and key ID an API key names, or errMalformedAPIKey
+func parseAPIKey(key string) (string, string, error) {
+	rest, ok := strings.CutPrefix(key, protocol.APIKeyPrefix)
+	if !ok {
+		return "", "", errMalformedAPIKey
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", "", errMalformedAPIKey
+	}
+
+	username, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(username) == 0 {
+		return "", "", errMalformedAPIKey
+	}
+
+	return string(username), parts[1], nil
+}
+
+// lookupAPIKey returns the user of an unexpired API key and the key, recording its use,
+// or the status and error to return if it is malformed, unknown, expired, or revoked, or its user can't log in
+// Every key of the user is compared, so the time taken doesn't reveal which matched
+func (s *Server) lookupAPIKey(key string) (User, APIKey, int, error) {
+	username, id, err := parseAPIKey(key)
+	if err != nil {
+		return User{}, APIKey{}, http.StatusUnauthorized, err
+	}
+
+	user, err := s.users.Get(username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		return User{}, APIKey{}, http.StatusUnauthorized, protocol.ErrInvalidAPIKey
+	} else if err != nil {
+		return User{}, APIKey{}, http.StatusInternalServerError, err
+	} else if _, err := checkStatus(user); err != nil {
+		return User{}, APIKey{}, http.StatusUnauthorized, fmt.Errorf("%w: %v", protocol.ErrInvalidAPIKey, err)
+	}
+
+	keyHash := hashDeviceSecret(key)
+	now := time.Now()
+	match := -1
+	for i, apiKey := range user.APIKeys {
+		idMatches := subtle.ConstantTimeCompare([]byte(apiKey.ID), []byte(id)) == 1
+		keyMatches := subtle.ConstantTimeCompare(apiKey.KeyHash, keyHash) == 1
+		if idMatches && keyMatches && !apiKey.expired(now) {
+			match = i
+		}
+	}
+	if match < 0 {
+		return User{}, APIKey{}, http.StatusUnauthorized, protocol.ErrInvalidAPIKey
+	}
+
+	if now.Sub(user.APIKeys[match].LastUsedAt) > apiKeyUseInterval {
+		user.APIKeys[match].LastUsedAt = now
+		err := s.updateUser(user.Username, func(stored *User) error {
+			for i := range stored.APIKeys {
+				if stored.APIKeys[i].ID == id && stored.APIKeys[i].LastUsedAt.Before(now) {
+					stored.APIKeys[i].LastUsedAt = now
+				}
+			}
+			return nil
+		})
+		logUpdateError("recording an API key's use", user.Username, err)
+	}
+
+	return user, user.APIKeys[match], http.StatusOK, nil
+}
+
+// ValidateAPIKey returns the user of an unexpired API key the server issued and the scopes it grants,
+// so services in the same process can authenticate machines, such as with the middleware package
+// Malformed, unknown, expired, and revoked keys, and keys of users who can't log in, return protocol.ErrInvalidAPIKey
+func (s *Server) ValidateAPIKey(_ context.Context, key string) (string, []string, error) {
+	user, apiKey, _, err := s.lookupAPIKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return user.Username, apiKey.Scopes, nil
+}
+
+// CreateAPIKeyHandler handles requests that issue a session's user a named API key granting scopes,
+// which authenticates machines as the user, without a login, until it expires or is revoked
+// Unexpired sessions return the key, which isn't stored, only its hash, and a 2XX status
+// Malformed requests, unnamed keys, invalid scopes, expiries that passed, missing, unknown, and expired sessions, recovery sessions,
+// and users with too many API keys return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) CreateAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	var createRequest protocol.CreateAPIKeyRequest
+	if err := json.NewDecoder(req.Body).Decode(&createRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if createRequest.Name == "" {
+		writeError(w, errAPIKeyName, http.StatusBadRequest)
+		return
+	} else if createRequest.ExpiresAt != nil && !time.Now().Before(*createRequest.ExpiresAt) {
+		writeError(w, errAPIKeyExpiry, http.StatusBadRequest)
+		return
+	}
+	for _, scope := range createRequest.Scopes {
+		if !validScope(scope) {
+			writeError(w, fmt.Errorf("%w: %q", errInvalidScope, scope), http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, session, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	} else if session.Recovery {
+		writeError(w, errAPIKeyRecovery, http.StatusForbidden)
+		return
+	}
+
+	user.APIKeys = activeAPIKeys(user.APIKeys)
+	if len(user.APIKeys) >= maxAPIKeys {
+		writeError(w, errTooManyAPIKeys, http.StatusConflict)
+		return
+	}
+
+	id, secret := make([]byte, apiKeyIDByteLen), make([]byte, apiKeyByteLen)
+	if _, err := io.ReadFull(s.entropy, id); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if _, err := io.ReadFull(s.entropy, secret); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	scopes := slices.Clone(createRequest.Scopes)
+	slices.Sort(scopes)
+	apiKey := APIKey{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Name:      createRequest.Name,
+		Scopes:    slices.Compact(scopes),
+		CreatedAt: time.Now(),
+	}
+	if createRequest.ExpiresAt != nil {
+		apiKey.ExpiresAt = *createRequest.ExpiresAt
+	}
+	key := formatAPIKey(user.Username, apiKey.ID, base64.RawURLEncoding.EncodeToString(secret))
+	apiKey.KeyHash = hashDeviceSecret(key)
+
+	user.APIKeys = append(user.APIKeys, apiKey)
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	info := apiKey.info()
+	writeJSON(w, http.StatusOK, &protocol.APIKey{
+		ID:        info.ID,
+		Key:       key,
+		Name:      info.Name,
+		Scopes:    info.Scopes,
+		ExpiresAt: info.ExpiresAt,
+	})
+}
+
+// APIKeysHandler handles requests for the API keys of a session's user
+// Unexpired sessions return their user's unexpired API keys, without the keys themselves, and a 2XX status
+// Missing, unknown, and expired sessions return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) APIKeysHandler(w http.ResponseWriter, req *http.Request) {
+	user, _, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	apiKeys := activeAPIKeys(user.APIKeys)
+	apiKeysResponse := protocol.APIKeysResponse{APIKeys: make([]protocol.APIKeyInfo, len(apiKeys))}
+	for i, apiKey := range apiKeys {
+		apiKeysResponse.APIKeys[i] = apiKey.info()
+	}
+
+	writeJSON(w, http.StatusOK, &apiKeysResponse)
+}
+
+// RevokeAPIKeyHandler handles requests that revoke one of a session's user's API keys, which then no longer authenticates requests
+// API keys of the user are revoked and return a 2XX status
+// Malformed requests, missing, unknown, and expired sessions, and unknown API keys return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) RevokeAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	var revokeRequest protocol.RevokeAPIKeyRequest
+	if err := json.NewDecoder(req.Body).Decode(&revokeRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, _, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	apiKeys := activeAPIKeys(user.APIKeys)
+	kept := apiKeys[:0]
+	for _, apiKey := range apiKeys {
+		if apiKey.ID != revokeRequest.ID {
+			kept = append(kept, apiKey)
+		}
+	}
+	if len(kept) == len(apiKeys) {
+		writeError(w, errUnknownAPIKey, http.StatusNotFound)
+		return
+	}
+
+	user.APIKeys = kept
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
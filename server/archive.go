@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// archiveMagic begins every archive, naming its format, and is authenticated with its contents
+	archiveMagic = "hauthar1"
+	// archiveSaltByteLen is the length of the salt an archive's key is derived with
+	archiveSaltByteLen = 16
+	// archiveTime, archiveMemory, and archiveThreads are the Argon2id parameters that derive an archive's key from its passphrase
+	archiveTime    = 3
+	archiveMemory  = 64 * 1024
+	archiveThreads = 4
+)
+
+var ErrInvalidArchive = errors.New("invalid archive or passphrase")
+
+// archiveKey derives an archive's AES-256-GCM cipher from its passphrase and salt
+func archiveKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(argon2.IDKey([]byte(passphrase), salt, archiveTime, archiveMemory, archiveThreads, 32))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// SealArchive writes users to a writer as an archive encrypted with AES-256-GCM under a key derived from a passphrase
+// The archive is its format's magic, the key's salt, the nonce, then the sealed users in the format of a MemoryStore's snapshot
+func SealArchive(w io.Writer, entropy crypto.EntropySource, users []User, passphrase string) error {
+	var plaintext bytes.Buffer
+	if err := encodeSnapshot(&plaintext, users); err != nil {
+		return err
+	}
+
+	salt := make([]byte, archiveSaltByteLen)
+	if _, err := io.ReadFull(entropy, salt); err != nil {
+		return err
+	}
+	aead, err := archiveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(entropy, nonce); err != nil {
+		return err
+	}
+
+	archive := append([]byte(archiveMagic), salt...)
+	archive = append(archive, nonce...)
+	archive = aead.Seal(archive, nonce, plaintext.Bytes(), []byte(archiveMagic))
+	_, err = w.Write(archive)
+	return err
+}
+
+// OpenArchive returns the users in an archive written by SealArchive, migrated to the current schema version, or ErrInvalidArchive if it is malformed, altered, or the passphrase is wrong
+func OpenArchive(r io.Reader, passphrase string) ([]User, error) {
+	archive, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header, ok := bytes.CutPrefix(archive, []byte(archiveMagic))
+	if !ok || len(header) < archiveSaltByteLen {
+		return nil, ErrInvalidArchive
+	}
+	salt, sealed := header[:archiveSaltByteLen], header[archiveSaltByteLen:]
+
+	aead, err := archiveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidArchive
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(archiveMagic))
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	users, err := decodeSnapshot(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	return users, nil
+}
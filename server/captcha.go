@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// hCaptchaVerifyURL is where hCaptcha tokens are verified
+	hCaptchaVerifyURL = "https://api.hcaptcha.com/siteverify"
+	// reCaptchaVerifyURL is where reCAPTCHA tokens are verified
+	reCaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+)
+
+type (
+	// CaptchaVerifier verifies the CAPTCHA tokens that clients solve, such as hCaptcha's or reCAPTCHA's
+	CaptchaVerifier interface {
+		// Verify returns whether a token solved by a client address is valid, unless the context is done first
+		Verify(ctx context.Context, token, remoteAddr string) (bool, error)
+	}
+
+	// HCaptchaVerifier is a CaptchaVerifier for hCaptcha tokens, with a site's secret and optional site key
+	// URL and Client default to hCaptcha's siteverify endpoint and http.DefaultClient
+	HCaptchaVerifier struct {
+		Secret  string
+		SiteKey string
+		URL     string
+		Client  *http.Client
+	}
+
+	// ReCaptchaVerifier is a CaptchaVerifier for reCAPTCHA tokens, with a site's secret and, for reCAPTCHA v3, the minimum score accepted
+	// URL and Client default to reCAPTCHA's siteverify endpoint and http.DefaultClient
+	ReCaptchaVerifier struct {
+		Secret   string
+		MinScore float64
+		URL      string
+		Client   *http.Client
+	}
+
+	// siteVerifyResponse is the response of hCaptcha's and reCAPTCHA's siteverify endpoints
+	siteVerifyResponse struct {
+		Success    bool     `json:"success"`
+		Score      *float64 `json:"score"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+)
+
+// siteVerify posts a token and its form fields to a siteverify endpoint, defaulting to a URL and http.DefaultClient, and returns its response
+func siteVerify(ctx context.Context, client *http.Client, verifyURL, defaultURL string, form url.Values) (*siteVerifyResponse, error) {
+	if verifyURL == "" {
+		verifyURL = defaultURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("captcha verification returned %s", resp.Status)
+	}
+
+	var verified siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&verified); err != nil {
+		return nil, err
+	}
+
+	return &verified, nil
+}
+
+// Verify returns whether hCaptcha accepts a token solved by a client address
+func (hv *HCaptchaVerifier) Verify(ctx context.Context, token, remoteAddr string) (bool, error) {
+	form := url.Values{"secret": {hv.Secret}, "response": {token}, "remoteip": {clientHost(remoteAddr)}}
+	if hv.SiteKey != "" {
+		form.Set("sitekey", hv.SiteKey)
+	}
+
+	verified, err := siteVerify(ctx, hv.Client, hv.URL, hCaptchaVerifyURL, form)
+	if err != nil {
+		return false, err
+	}
+
+	return verified.Success, nil
+}
+
+// Verify returns whether reCAPTCHA accepts a token solved by a client address, with at least the minimum score if it is scored
+func (rv *ReCaptchaVerifier) Verify(ctx context.Context, token, remoteAddr string) (bool, error) {
+	form := url.Values{"secret": {rv.Secret}, "response": {token}, "remoteip": {clientHost(remoteAddr)}}
+
+	verified, err := siteVerify(ctx, rv.Client, rv.URL, reCaptchaVerifyURL, form)
+	if err != nil {
+		return false, err
+	}
+
+	return verified.Success && (verified.Score == nil || *verified.Score >= rv.MinScore), nil
+}
+
+// checkCaptcha verifies a CAPTCHA token solved by a client address, returning the status and error to refuse its request with
+func (s *Server) checkCaptcha(ctx context.Context, token, remoteAddr string) (int, error) {
+	if token == "" {
+		return http.StatusForbidden, protocol.ErrCaptchaRequired
+	}
+
+	ok, err := s.captcha.Verify(ctx, token, remoteAddr)
+	if err != nil {
+		return contextStatus(err, http.StatusInternalServerError), err
+	} else if !ok {
+		return http.StatusForbidden, fmt.Errorf("%w: token rejected", protocol.ErrCaptchaRequired)
+	}
+
+	return http.StatusOK, nil
+}
+
+// captchaLogIn returns whether a login by a user from a client address must solve a CAPTCHA,
+// which it must once either has failed to log in the server's number of times in the last window
+func (s *Server) captchaLogIn(username, remoteAddr string) bool {
+	if s.captcha == nil || s.captchaAfterFailures <= 0 {
+		return false
+	}
+
+	userFailures, _ := s.failures.recent("user:" + username)
+	addressFailures, _ := s.failures.recent("addr:" + clientHost(remoteAddr))
+	return max(userFailures, addressFailures) >= s.captchaAfterFailures
+}
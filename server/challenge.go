@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// challengeResultTTL is how long a computed asynchronous challenge waits for its client to poll for it
+	challengeResultTTL = time.Minute
+	// challengeIDByteLen is the length of an asynchronous challenge's id before encoding
+	challengeIDByteLen = 16
+	// challengePollInterval is how long clients are told to wait between polls for a pending challenge
+	challengePollInterval = time.Second
+	// defaultChallengeTTL is how long a login's challenge can be answered by its second login request, unless the server is built WithChallengeTTL
+	defaultChallengeTTL = 5 * time.Minute
+	// challengeNonceByteLen is the length of a challenge's nonce before encoding
+	challengeNonceByteLen = 16
+)
+
+var ErrUnsupportedChallengeStore = errors.New("unsupported challenge store")
+
+var (
+	errMissingNonce       = errors.New("second login request doesn't echo its challenge's id and nonce")
+	errTranscriptMismatch = errors.New("second login request's transcript doesn't match the login's messages")
+)
+
+type (
+	// Challenge is a login challenge a server issued and its second login request hasn't answered
+	// Its Nonce must be echoed by the second login request, which consumes it, so captured second login requests can't be replayed
+	Challenge struct {
+		ID       string
+		Nonce    string
+		Username string
+		Recovery bool
+		// Version is the protocol version negotiated for the login, which its second login request must be sent in
+		Version int
+		// KDFSalt is the salt of the KDFParams of the secret the challenge was computed from, which its second login request is verified against,
+		// even if the user's password changes in between, while that secret is retired rather than expired
+		KDFSalt []byte `json:",omitempty"`
+		// Transcript is the running hash of the login's messages up to and including the challenge
+		Transcript protocol.Transcript
+		ExpiresAt  time.Time
+	}
+
+	// ChallengeStore stores the login challenges a server issued until they are answered or expire, which replicas sharing a store all accept
+	ChallengeStore interface {
+		// Put stores a new challenge until it expires
+		Put(challenge Challenge) error
+		// Take removes and returns an unexpired challenge if check returns nil for it, or returns protocol.ErrUnknownChallenge or check's error,
+		// leaving challenges check rejects in place, so requests that don't match a challenge can't consume it
+		Take(id string, check func(Challenge) error) (Challenge, error)
+		// Purge removes the challenges that expired before a time
+		Purge(now time.Time) error
+	}
+
+	// MemoryChallengeStore is a ChallengeStore held in memory, whose challenges are lost when the process exits
+	MemoryChallengeStore struct {
+		challenges map[string]Challenge
+		mu         sync.Mutex
+	}
+
+	// pendingChallenge is a login challenge computed in the background
+	// Its result, error, and status are written before done is closed
+	pendingChallenge struct {
+		done      chan struct{}
+		response  *protocol.FirstLogInResponse
+		err       error
+		status    int
+		expiresAt time.Time
+	}
+
+	// challengeStore holds the asynchronous challenges a server is computing, or has computed and not yet returned
+	challengeStore struct {
+		challenges map[string]*pendingChallenge
+		mu         sync.Mutex
+	}
+)
+
+// NewMemoryChallengeStore returns an empty MemoryChallengeStore
+func NewMemoryChallengeStore() *MemoryChallengeStore {
+	return &MemoryChallengeStore{challenges: map[string]Challenge{}}
+}
+
+// OpenChallengeStore returns the ChallengeStore for a data source name, where "memory://" or an empty name is a new MemoryChallengeStore,
+// and redis:// and rediss:// URLs are RedisChallengeStores
+func OpenChallengeStore(dsn string) (ChallengeStore, error) {
+	scheme, _, _ := strings.Cut(dsn, "://")
+	switch scheme {
+	case "", "memory":
+		return NewMemoryChallengeStore(), nil
+	case "redis", "rediss":
+		return OpenRedisChallengeStore(dsn)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedChallengeStore, scheme)
+	}
+}
+
+// Put stores a new challenge in a MemoryChallengeStore
+func (ms *MemoryChallengeStore) Put(challenge Challenge) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.challenges[challenge.ID] = challenge
+	return nil
+}
+
+// Take removes and returns an unexpired challenge check accepts from a MemoryChallengeStore
+func (ms *MemoryChallengeStore) Take(id string, check func(Challenge) error) (Challenge, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	challenge, ok := ms.challenges[id]
+	if !ok {
+		return Challenge{}, protocol.ErrUnknownChallenge
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		delete(ms.challenges, id)
+		return Challenge{}, protocol.ErrUnknownChallenge
+	}
+	if err := check(challenge); err != nil {
+		return Challenge{}, err
+	}
+
+	delete(ms.challenges, id)
+	return challenge, nil
+}
+
+// Purge removes the challenges in a MemoryChallengeStore that expired before a time, such as those of abandoned logins
+func (ms *MemoryChallengeStore) Purge(now time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for id, challenge := range ms.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(ms.challenges, id)
+		}
+	}
+
+	return nil
+}
+
+// makeChallengeID returns a new random challenge id
+func makeChallengeID(entropy io.Reader) (string, error) {
+	return makeRandomString(entropy, challengeIDByteLen)
+}
+
+// makeRandomString returns byteLen random bytes encoded in base64url
+func makeRandomString(entropy io.Reader, byteLen int) (string, error) {
+	b := make([]byte, byteLen)
+	if _, err := io.ReadFull(entropy, b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// makeChallenge returns a new challenge of a first login request of a user's credential in a negotiated protocol version, with a fresh id and nonce, and an expiry the server's challenge TTL away,
+// and its transcript up to the request's public key, which isn't stored until it is computed
+func (s *Server) makeChallenge(user User, version int, firstLogInRequest *protocol.FirstLogInRequest) (Challenge, error) {
+	id, err := makeChallengeID(s.entropy)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	nonce, err := makeRandomString(s.entropy, challengeNonceByteLen)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	var kdfSalt []byte
+	if user.KDFParams != nil {
+		kdfSalt = user.KDFParams.Salt
+	}
+
+	return Challenge{
+		ID:         id,
+		Nonce:      nonce,
+		Username:   user.Username,
+		Recovery:   firstLogInRequest.Recovery,
+		Version:    version,
+		KDFSalt:    kdfSalt,
+		Transcript: protocol.NewTranscript(firstLogInRequest.Username, firstLogInRequest.Recovery).WithPublicKey(firstLogInRequest.PublicKey),
+		ExpiresAt:  time.Now().Add(s.challengeTTL),
+	}, nil
+}
+
+// takeChallenge removes and returns the challenge a second login request of a user answers from the store, so it can't be answered again,
+// or returns the status and error to return if the request doesn't echo its id and nonce, or it is unknown, expired, or was issued to another login or protocol version,
+// or the request's transcript isn't the server's transcript of the login followed by the request's secret
+// Challenges are only removed once the request's nonce, username, and version match, so requests that merely know a challenge's id can't burn another user's login
+func (s *Server) takeChallenge(username string, secondLogInRequest *protocol.SecondLogInRequest) (Challenge, int, error) {
+	if secondLogInRequest.ChallengeID == "" || secondLogInRequest.Nonce == "" {
+		return Challenge{}, http.StatusBadRequest, errMissingNonce
+	}
+
+	challenge, err := s.loginChallenges.Take(secondLogInRequest.ChallengeID, func(challenge Challenge) error {
+		if subtle.ConstantTimeCompare([]byte(challenge.Nonce), []byte(secondLogInRequest.Nonce)) != 1 {
+			return protocol.ErrUnknownChallenge
+		} else if challenge.Username != username || challenge.Recovery != secondLogInRequest.Recovery {
+			return errUsernameMismatch
+		} else if challenge.Version != secondLogInRequest.EffectiveVersion() {
+			return fmt.Errorf("%w: login negotiated version %d", protocol.ErrUnsupportedVersion, challenge.Version)
+		}
+
+		return nil
+	})
+	if errors.Is(err, protocol.ErrUnknownChallenge) || errors.Is(err, errUsernameMismatch) || errors.Is(err, protocol.ErrUnsupportedVersion) {
+		return Challenge{}, http.StatusBadRequest, err
+	} else if err != nil {
+		return Challenge{}, http.StatusInternalServerError, err
+	} else if subtle.ConstantTimeCompare(challenge.Transcript.WithResponse(secondLogInRequest.Secret), secondLogInRequest.Transcript) != 1 {
+		return Challenge{}, http.StatusBadRequest, errTranscriptMismatch
+	}
+
+	return challenge, http.StatusOK, nil
+}
+
+// PurgeChallengesEvery removes expired challenges from a Server's ChallengeStore, and asynchronous challenges whose clients never polled for them,
+// each interval until a context is done
+// Failed purges are passed to onError, if it isn't nil, and retried at the next interval
+func (s *Server) PurgeChallengesEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.pendingChallenges.mu.Lock()
+			s.pendingChallenges.prune(now)
+			s.pendingChallenges.mu.Unlock()
+
+			if err := s.loginChallenges.Purge(now); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// makeChallengeStore returns an empty challengeStore
+func makeChallengeStore() *challengeStore {
+	return &challengeStore{challenges: map[string]*pendingChallenge{}}
+}
+
+// start computes a challenge in the background, returning the id its client polls with
+// compute returns the challenge, or the status and error it fails with
+func (cs *challengeStore) start(entropy io.Reader, compute func() (*protocol.FirstLogInResponse, int, error)) (string, error) {
+	challengeID, err := makeChallengeID(entropy)
+	if err != nil {
+		return "", err
+	}
+
+	pending := &pendingChallenge{done: make(chan struct{})}
+	cs.mu.Lock()
+	cs.prune(time.Now())
+	cs.challenges[challengeID] = pending
+	cs.mu.Unlock()
+
+	go func() {
+		pending.response, pending.status, pending.err = compute()
+		pending.expiresAt = time.Now().Add(challengeResultTTL)
+		close(pending.done)
+	}()
+
+	return challengeID, nil
+}
+
+// take returns a challenge by id, and whether it exists
+// Computed challenges are removed, so each is returned once
+func (cs *challengeStore) take(challengeID string) (*pendingChallenge, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	pending, ok := cs.challenges[challengeID]
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-pending.done:
+		delete(cs.challenges, challengeID)
+		if time.Now().After(pending.expiresAt) {
+			return nil, false
+		}
+	default:
+	}
+
+	return pending, true
+}
+
+// prune removes computed challenges whose clients never polled for them
+// The caller must hold the lock
+func (cs *challengeStore) prune(now time.Time) {
+	for challengeID, pending := range cs.challenges {
+		select {
+		case <-pending.done:
+			if now.After(pending.expiresAt) {
+				delete(cs.challenges, challengeID)
+			}
+		default:
+		}
+	}
+}
+
+// ServerKeyHandler handles requests for the Ed25519 public key the server signs its login challenges with
+// Requests return the public key and a 2XX status
+func (s *Server) ServerKeyHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, &protocol.ServerKeyResponse{PublicKey: s.signingKey.Public().(ed25519.PublicKey)})
+}
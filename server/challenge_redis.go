@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// RedisChallengeStore is a ChallengeStore in Redis, which expires challenges itself, so a login can be answered by any replica pointed at the same Redis
+// Each challenge is a JSON value under its id, which taking it deletes in a transaction watching it
+type RedisChallengeStore struct {
+	client *redis.Client
+}
+
+// NewRedisChallengeStore returns a RedisChallengeStore using a Redis client
+func NewRedisChallengeStore(client *redis.Client) *RedisChallengeStore {
+	return &RedisChallengeStore{client: client}
+}
+
+// OpenRedisChallengeStore returns a RedisChallengeStore for a redis:// or rediss:// URL, such as redis://localhost:6379/0
+func OpenRedisChallengeStore(url string) (*RedisChallengeStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRedisChallengeStore(redis.NewClient(opts)), nil
+}
+
+// challengeKey returns the key a challenge is stored under
+func challengeKey(id string) string {
+	return redisKeyPrefix + "challenge:" + id
+}
+
+// Put stores a new challenge in a RedisChallengeStore, which expires it
+func (rs *RedisChallengeStore) Put(challenge Challenge) error {
+	data, err := json.Marshal(&challenge)
+	if err != nil {
+		return err
+	}
+
+	return rs.client.SetArgs(context.Background(), challengeKey(challenge.ID), data, redis.SetArgs{ExpireAt: challenge.ExpiresAt}).Err()
+}
+
+// Take removes and returns an unexpired challenge check accepts from a RedisChallengeStore
+// The challenge is watched while it is checked and deleted in a transaction, so replicas can't both take it
+func (rs *RedisChallengeStore) Take(id string, check func(Challenge) error) (Challenge, error) {
+	ctx, key := context.Background(), challengeKey(id)
+
+	var challenge Challenge
+	err := rs.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return protocol.ErrUnknownChallenge
+		} else if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(data, &challenge); err != nil {
+			return err
+		} else if time.Now().After(challenge.ExpiresAt) {
+			return protocol.ErrUnknownChallenge
+		} else if err := check(challenge); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return Challenge{}, protocol.ErrUnknownChallenge
+	} else if err != nil {
+		return Challenge{}, err
+	}
+
+	return challenge, nil
+}
+
+// Purge does nothing, as Redis expires challenges itself
+func (rs *RedisChallengeStore) Purge(time.Time) error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var (
+	errReservedClaim = errors.New("custom claims can't replace standard claims")
+	errInvalidRole   = errors.New("roles can't be empty")
+)
+
+// reservedClaims are the claims ID tokens and userinfo responses set themselves, which custom claims can't replace
+var reservedClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "auth_time", "nonce", "azp", "preferred_username", "email", "email_verified", "roles"}
+
+type (
+	// ClaimsProvider adds roles and custom claims to those stored for a user when tokens are issued for them,
+	// so operators can wire in the attributes another system holds
+	ClaimsProvider interface {
+		// Claims returns the roles and custom claims of a user, unless the context is done first
+		Claims(ctx context.Context, username string) (protocol.UserClaims, error)
+	}
+)
+
+// checkClaims returns an error if roles are empty or custom claims replace standard claims
+func checkClaims(roles []string, claims map[string]json.RawMessage) error {
+	if slices.Contains(roles, "") {
+		return errInvalidRole
+	}
+
+	for name := range claims {
+		if slices.Contains(reservedClaims, name) {
+			return fmt.Errorf("%w: %q", errReservedClaim, name)
+		}
+	}
+
+	return nil
+}
+
+// customClaims returns the roles and custom claims of a user, those stored for them followed by those the server's ClaimsProvider adds, if it has one,
+// where the provider's custom claims replace stored ones of the same name, and those that would replace standard claims are dropped
+func (s *Server) customClaims(ctx context.Context, user User) ([]string, map[string]json.RawMessage, error) {
+	roles, claims := slices.Clone(user.Roles), make(map[string]json.RawMessage, len(user.Claims))
+	for name, value := range user.Claims {
+		claims[name] = value
+	}
+
+	if s.claimsProvider != nil {
+		provided, err := s.claimsProvider.Claims(ctx, user.Username)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, role := range provided.Roles {
+			if role != "" && !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+		for name, value := range provided.Claims {
+			if !slices.Contains(reservedClaims, name) && json.Valid(value) {
+				claims[name] = value
+			}
+		}
+	}
+
+	if len(claims) == 0 {
+		claims = nil
+	}
+	return roles, claims, nil
+}
+
+// UserClaimsHandler handles admin requests for the roles and custom claims of the user named by the username query parameter, with GET,
+// or that replace them, with POST, which tokens issued for the user from then on carry
+// Authorized requests return the user's stored roles and custom claims and a 2XX status
+// Requests without the admin token, malformed requests, requests without a username, empty roles, custom claims that replace standard claims,
+// and nonexistent users return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) UserClaimsHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.isAdmin(req) {
+		writeError(w, protocol.ErrNotAdmin, http.StatusUnauthorized)
+		return
+	}
+
+	claimsRequest := protocol.UserClaims{Username: req.URL.Query().Get("username")}
+	if req.Method == http.MethodPost {
+		if err := json.NewDecoder(req.Body).Decode(&claimsRequest); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		} else if err := checkClaims(claimsRequest.Roles, claimsRequest.Claims); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if claimsRequest.Username == "" {
+		writeError(w, errMissingUsername, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.findUser(w, claimsRequest.Username)
+	if !ok {
+		return
+	}
+
+	if req.Method == http.MethodPost {
+		user.Roles, user.Claims = claimsRequest.Roles, claimsRequest.Claims
+		if len(user.Roles) == 0 {
+			user.Roles = nil
+		}
+		if len(user.Claims) == 0 {
+			user.Claims = nil
+		}
+		if err := s.users.Update(user); err != nil {
+			writeError(w, err, updateStatus(err))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &protocol.UserClaims{Username: user.Username, Roles: user.Roles, Claims: user.Claims})
+}
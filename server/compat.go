@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// challengeAnswerVersion is the first protocol version whose second login requests answer their challenge by its id, nonce, and transcript
+const challengeAnswerVersion = 2
+
+// negotiateVersion returns the protocol version of a login whose first login request was sent in a version,
+// or the status and error to return if it is older than the server accepts
+func (s *Server) negotiateVersion(requested int) (int, int, error) {
+	version, err := protocol.NegotiateVersion(requested, s.minProtocolVersion)
+	if err != nil {
+		return 0, http.StatusBadRequest, fmt.Errorf("%w: server accepts versions %d to %d", err, s.minProtocolVersion, protocol.Version)
+	}
+
+	return version, http.StatusOK, nil
+}
+
+// answersChallenge returns whether second login requests of a protocol version answer their challenge by its id,
+// so its challenge must be stored until they do
+func answersChallenge(version int) bool {
+	return version >= challengeAnswerVersion
+}
+
+// legacyChallengeID returns the id a version 1 login's challenge is stored under, which is its user's and whether it is a recovery,
+// since its second login request doesn't echo the challenge's id
+// Random challenge ids are base64url, so they never contain the dots of a legacy id
+func legacyChallengeID(username string, recovery bool) string {
+	return fmt.Sprintf("v1.%s.%t", base64.RawURLEncoding.EncodeToString([]byte(username)), recovery)
+}
+
+// storedChallenge returns a challenge as it is stored until its second login request answers it,
+// which is under its user's legacy id for version 1 logins, so a user's next version 1 login replaces it
+func storedChallenge(challenge Challenge) Challenge {
+	if !answersChallenge(challenge.Version) {
+		challenge.ID = legacyChallengeID(challenge.Username, challenge.Recovery)
+	}
+
+	return challenge
+}
+
+// checkAnswer checks that a second login request of a user was sent in a protocol version the server accepts,
+// and takes and returns the challenge it answers, or returns the status and error to return
+// Version 1 requests, from clients that don't send a version, answer their challenge with only its secret, as they did before challenges had nonces,
+// so they take the user's latest version 1 challenge, and each secret answers at most one first login request
+func (s *Server) checkAnswer(username string, secondLogInRequest *protocol.SecondLogInRequest) (Challenge, int, error) {
+	version := secondLogInRequest.EffectiveVersion()
+	if version < s.minProtocolVersion || version > protocol.Version {
+		return Challenge{}, http.StatusBadRequest, fmt.Errorf("%w: server accepts versions %d to %d", protocol.ErrUnsupportedVersion, s.minProtocolVersion, protocol.Version)
+	}
+	if answersChallenge(version) {
+		return s.takeChallenge(username, secondLogInRequest)
+	}
+
+	challenge, err := s.loginChallenges.Take(legacyChallengeID(username, secondLogInRequest.Recovery), func(challenge Challenge) error {
+		if challenge.Username != username || challenge.Recovery != secondLogInRequest.Recovery || challenge.Version != version {
+			return protocol.ErrUnknownChallenge
+		}
+
+		return nil
+	})
+	if errors.Is(err, protocol.ErrUnknownChallenge) {
+		return Challenge{}, http.StatusBadRequest, err
+	} else if err != nil {
+		return Challenge{}, http.StatusInternalServerError, err
+	}
+
+	return challenge, http.StatusOK, nil
+}
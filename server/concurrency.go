@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// busyRetryAfter is how long clients are told to wait before retrying when every slot is taken
+const busyRetryAfter = time.Second
+
+// semaphore bounds the number of requests doing encrypted work at once
+// Requests arriving when every slot is taken are rejected rather than queued, so in-flight requests keep their latency
+// A nil semaphore has unlimited slots
+type semaphore chan struct{}
+
+// makeSemaphore returns a semaphore with a number of slots
+func makeSemaphore(slots int) semaphore {
+	return make(semaphore, slots)
+}
+
+// tryAcquire takes a slot if one is free, and returns whether it did
+func (sem semaphore) tryAcquire() bool {
+	if sem == nil {
+		return true
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a slot taken by tryAcquire
+func (sem semaphore) release() {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// setRetryAfter sets the Retry-After header of a response to a whole number of seconds
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(d/time.Second)))
+}
+
+// writeBusy writes the error response for a request rejected because every slot is taken
+func writeBusy(w http.ResponseWriter) {
+	setRetryAfter(w, busyRetryAfter)
+	writeError(w, protocol.ErrBusy, http.StatusTooManyRequests)
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"regexp"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/zambozoo/homomorphic-authentication/config"
+	"github.com/zambozoo/homomorphic-authentication/crypto/circuit"
+	"github.com/zambozoo/homomorphic-authentication/crypto/opaque"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// NewFromConfig returns a Server configured by a Config, followed by any further options
+func NewFromConfig(c *config.Config, opts ...Option) (*Server, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	store, err := OpenStore(c.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := OpenSessionStore(c.Sessions.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	challenges, err := OpenChallengeStore(c.Challenges.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	var hasher Hasher = FNVHasher{}
+	if c.Hashing.Hasher == "argon2id" {
+		hasher = Argon2idHasher{
+			Time:    c.Hashing.Time,
+			Memory:  c.Hashing.Memory,
+			Threads: c.Hashing.Threads,
+		}
+	}
+
+	configured := []Option{
+		WithUserStore(store),
+		WithSessionStore(sessions),
+		WithChallengeStore(challenges),
+		WithChallengeTTL(c.Challenges.TTL),
+		WithHasher(hasher),
+		WithSaltByteLen(c.Hashing.SaltBytes),
+		WithSecretByteLens(c.Secrets.MinBytes, c.Secrets.MaxBytes),
+		WithSecretGracePeriod(c.Secrets.GracePeriod),
+		WithSecretMaxAge(c.Secrets.MaxAge),
+		WithMinSecurityLevel(c.Secrets.MinSecurityLevel),
+		WithLogInHistory(c.Sessions.LogInHistory),
+		WithRecoveryRateLimit(c.RateLimit.RecoveryPerHour/3600, c.RateLimit.RecoveryBurst),
+		WithCircuitLimits(circuit.Limits{
+			MaxGates:     c.Circuits.MaxGates,
+			MaxDepth:     c.Circuits.MaxDepth,
+			MaxInputBits: c.Circuits.MaxInputBits,
+		}),
+		WithMaxCiphertextBits(c.Circuits.MaxCiphertextBits),
+		WithMaxEvaluations(c.Circuits.MaxEvaluations),
+	}
+	if c.MasterKey != "" {
+		key, _ := base64.StdEncoding.DecodeString(c.MasterKey)
+		masterKey, err := NewMasterKey(key)
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, WithMasterKey(masterKey))
+	}
+	if c.OPAQUEKey != "" {
+		key, _ := base64.StdEncoding.DecodeString(c.OPAQUEKey)
+		setup, err := opaque.ParseServerSetup(key)
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, WithOPAQUE(setup))
+	}
+	if c.MinProtocolVersion > protocol.Version {
+		return nil, fmt.Errorf("%w: servers speak up to version %d", protocol.ErrUnsupportedVersion, protocol.Version)
+	}
+	configured = append(configured, WithMinProtocolVersion(c.MinProtocolVersion), WithIdempotencyTTL(c.IdempotencyTTL))
+	if len(c.CORS.Origins) > 0 {
+		configured = append(configured, WithCORS(CORSPolicy{
+			Origins:          c.CORS.Origins,
+			AllowCredentials: c.CORS.AllowCredentials,
+			MaxAge:           c.CORS.MaxAge,
+		}))
+	}
+	if c.SessionCookies.CSRF != "" {
+		mode, err := ParseCSRFMode(c.SessionCookies.CSRF)
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, WithSessionCookies(SessionCookiePolicy{
+			CSRF:     mode,
+			Domain:   c.SessionCookies.Domain,
+			Insecure: c.SessionCookies.Insecure,
+		}))
+	}
+	if c.AccessLog.Enabled || c.AccessLog.Bodies {
+		configured = append(configured, WithAccessLog(AccessLogPolicy{Bodies: c.AccessLog.Bodies}))
+	}
+	if c.Challenges.Mutator != "" {
+		mutator, err := ParseMutator(c.Challenges.Mutator)
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, WithMutator(mutator))
+	}
+	if c.SigningKey != "" {
+		seed, _ := base64.StdEncoding.DecodeString(c.SigningKey)
+		configured = append(configured, WithSigningKey(ed25519.NewKeyFromSeed(seed)))
+	}
+	if c.Hashing.Pepper != "" {
+		pepper, _ := base64.StdEncoding.DecodeString(c.Hashing.Pepper)
+		configured = append(configured, WithPepper(pepper))
+	}
+	if provider := keyProvider(c.Keys); provider != nil {
+		configured = append(configured, WithKeyProvider(NewCachingKeyProvider(provider, c.Keys.Refresh)))
+	}
+	if c.WebAuthn.RPID != "" {
+		w, err := webauthn.New(&webauthn.Config{
+			RPID:          c.WebAuthn.RPID,
+			RPDisplayName: c.WebAuthn.RPName,
+			RPOrigins:     c.WebAuthn.Origins,
+		})
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, WithWebAuthn(w))
+	}
+	if provider, err := oidcProvider(c.OIDC); err != nil {
+		return nil, err
+	} else if provider != nil {
+		configured = append(configured, WithOIDC(provider))
+	}
+	if mailer := mailer(c.Mail); mailer != nil {
+		configured = append(configured, WithMailer(mailer), WithVerifyURL(c.Mail.VerifyURL))
+	}
+	if c.Webhook.URL != "" {
+		configured = append(configured, WithNotifier(&WebhookNotifier{
+			URL:     c.Webhook.URL,
+			Secret:  []byte(os.Getenv("WEBHOOK_SECRET")),
+			Retries: c.Webhook.Retries,
+		}, func(err error) {
+			log.Printf("webhook failed: %v", err)
+		}))
+	}
+	if verifier := captchaVerifier(c.Captcha); verifier != nil {
+		configured = append(configured, WithCaptcha(verifier, c.Captcha.OnSignUp, c.Captcha.AfterFailures))
+	}
+	if policy := usernamePolicy(c.Usernames); policy != nil {
+		configured = append(configured, WithUsernamePolicy(policy))
+	}
+	if c.AdminToken != "" {
+		configured = append(configured, WithAdminToken(c.AdminToken))
+	}
+	if c.Sessions.MaxLifetime > 0 {
+		configured = append(configured, WithSlidingSessions(c.Sessions.MaxLifetime))
+	}
+	if c.Sessions.DeviceTokenTTL > 0 {
+		configured = append(configured, WithDeviceTokens(c.Sessions.DeviceTokenTTL))
+	}
+	if c.RequestTimeout > 0 {
+		configured = append(configured, WithRequestTimeout(c.RequestTimeout))
+	}
+	if c.RateLimit.MaxChallenges > 0 {
+		configured = append(configured, WithMaxChallenges(c.RateLimit.MaxChallenges))
+	}
+	if c.RateLimit.RequestsPerSecond > 0 {
+		configured = append(configured, WithRateLimit(c.RateLimit.RequestsPerSecond, c.RateLimit.Burst))
+	}
+
+	return New(append(configured, opts...)...), nil
+}
+
+// mailer returns the Mailer a MailConfig describes, or nil if it has no mailer
+func mailer(c config.MailConfig) Mailer {
+	switch c.Mailer {
+	case "smtp":
+		smtpMailer := &SMTPMailer{
+			Address: c.SMTPAddress,
+			From:    c.From,
+		}
+		if c.SMTPUsername != "" {
+			host, _, _ := net.SplitHostPort(c.SMTPAddress)
+			smtpMailer.Auth = smtp.PlainAuth("", c.SMTPUsername, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return smtpMailer
+	case "log":
+		return LogMailer{}
+	default:
+		return nil
+	}
+}
+
+// keyProvider returns the KeyProvider a KeysConfig describes, or nil if it has no provider
+func keyProvider(c config.KeysConfig) KeyProvider {
+	switch c.Provider {
+	case "vault":
+		return &VaultKeyProvider{
+			Address: c.VaultAddress,
+			Token:   os.Getenv("VAULT_TOKEN"),
+			Path:    c.VaultPath,
+		}
+	case "aws-kms":
+		return &AWSKMSKeyProvider{
+			Region:   c.AWSRegion,
+			Wrapped:  c.Wrapped,
+			Endpoint: c.Endpoint,
+		}
+	case "gcp-kms":
+		return &GCPKMSKeyProvider{
+			Key:      c.GCPKey,
+			Wrapped:  c.Wrapped,
+			Endpoint: c.Endpoint,
+		}
+	default:
+		return nil
+	}
+}
+
+// usernamePolicy returns the UsernamePolicy a UsernameConfig describes, or nil if it doesn't normalize usernames
+func usernamePolicy(c config.UsernameConfig) *UsernamePolicy {
+	if !c.Normalize {
+		return nil
+	}
+
+	policy := &UsernamePolicy{
+		MinLength:       c.MinLength,
+		MaxLength:       c.MaxLength,
+		CaseInsensitive: c.CaseInsensitive,
+	}
+	if c.Pattern != "" {
+		policy.Pattern = regexp.MustCompile(c.Pattern)
+	}
+
+	return policy
+}
+
+// captchaVerifier returns the CaptchaVerifier a CaptchaConfig describes, with the secret in CAPTCHA_SECRET, or nil if it has no provider
+func captchaVerifier(c config.CaptchaConfig) CaptchaVerifier {
+	switch c.Provider {
+	case "hcaptcha":
+		return &HCaptchaVerifier{Secret: os.Getenv("CAPTCHA_SECRET"), SiteKey: c.SiteKey}
+	case "recaptcha":
+		return &ReCaptchaVerifier{Secret: os.Getenv("CAPTCHA_SECRET"), MinScore: c.MinScore}
+	default:
+		return nil
+	}
+}
+
+var errOIDCKey = errors.New("oidc key file holds no RSA private key")
+
+// oidcProvider returns the OIDCProvider an OIDCConfig describes, with its clients, or nil if it has no issuer
+func oidcProvider(c config.OIDCConfig) (*OIDCProvider, error) {
+	if c.Issuer == "" {
+		return nil, nil
+	}
+
+	key, err := oidcKey(c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := NewOIDCProvider(c.Issuer, c.LoginURL, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range c.Clients {
+		if err := provider.AddClient(client.ID, client.Secret, client.Name, client.RedirectURIs); err != nil {
+			return nil, err
+		}
+	}
+
+	return provider, nil
+}
+
+// oidcKey returns the RSA private key in a PKCS #1 or PKCS #8 PEM file, or a new 2048 bit key if the file is empty
+func oidcKey(keyFile string) (*rsa.PrivateKey, error) {
+	if keyFile == "" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errOIDCKey
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if rsaKey, ok := key.(*rsa.PrivateKey); err == nil && ok {
+		return rsaKey, nil
+	}
+
+	return nil, errOIDCKey
+}
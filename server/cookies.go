@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// CSRFDoubleSubmit delivers a session's CSRF token in a cookie scripts on the client's pages can read, next to a SameSite=Lax session cookie
+	CSRFDoubleSubmit CSRFMode = "double-submit"
+	// CSRFSameSite delivers a session's CSRF token only in the login response's protocol.CSRFTokenHeader, next to a SameSite=Strict session cookie
+	CSRFSameSite CSRFMode = "same-site"
+)
+
+var (
+	ErrUnsupportedCSRFMode = errors.New("unsupported CSRF mode")
+	errCSRFTokenMismatch   = errors.New("missing or mismatched CSRF token")
+)
+
+// credentialPaths are the paths of the requests that authenticate by the credentials they carry, and never by a session,
+// so their session cookies are ignored, and clients that lost their CSRF token can still sign up and log in
+var credentialPaths = map[string]bool{
+	"/sign-up": true, "/kdf": true, "/login-1": true, "/login-2": true, "/change-password": true, protocol.LogInWebSocketPath: true,
+	protocol.SRPLogInBeginPath: true, protocol.SRPLogInFinishPath: true,
+	protocol.OPAQUERegisterPath: true, protocol.OPAQUELogInBeginPath: true, protocol.OPAQUELogInFinishPath: true,
+	protocol.PasskeyLogInBeginPath: true, protocol.PasskeyLogInFinishPath: true, protocol.DeviceLogInPath: true,
+	protocol.VerifyEmailPath: true, protocol.ResetPasswordBeginPath: true, protocol.OIDCTokenPath: true,
+}
+
+type (
+	// CSRFMode is how a server delivers the CSRF tokens of sessions it delivers as cookies
+	CSRFMode string
+
+	// SessionCookiePolicy is how a server delivers the sessions of HTTP logins as cookies, for browser clients that shouldn't hold tokens in script,
+	// and how requests authenticated by those cookies prove they came from the client's own pages
+	SessionCookiePolicy struct {
+		// CSRF is how a session's CSRF token is delivered, which requests that change state echo in protocol.CSRFTokenHeader
+		CSRF CSRFMode
+		// Domain is the domain the cookies are sent to, where empty sends them only to the server's host
+		Domain string
+		// Insecure lets browsers send the cookies over plain HTTP, such as to a server on localhost
+		Insecure bool
+	}
+)
+
+// ParseCSRFMode returns the CSRFMode of a name, double-submit or same-site
+func ParseCSRFMode(name string) (CSRFMode, error) {
+	switch mode := CSRFMode(name); mode {
+	case CSRFDoubleSubmit, CSRFSameSite:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedCSRFMode, name)
+	}
+}
+
+// csrfToken returns the CSRF token of a session token, which only pages that can read the token's cookies or login response know
+func csrfToken(sessionToken string) string {
+	sum := sha256.Sum256([]byte("csrf " + sessionToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// sameSite returns the SameSite attribute of a SessionCookiePolicy's session cookie
+func (cp *SessionCookiePolicy) sameSite() http.SameSite {
+	if cp.CSRF == CSRFSameSite {
+		return http.SameSiteStrictMode
+	}
+
+	return http.SameSiteLaxMode
+}
+
+// cookie returns a cookie of a SessionCookiePolicy, which expires at a time, or is deleted if the time is zero
+func (cp *SessionCookiePolicy) cookie(name, value string, expiresAt time.Time, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cp.Domain,
+		Expires:  expiresAt,
+		Secure:   !cp.Insecure,
+		HttpOnly: httpOnly,
+		SameSite: cp.sameSite(),
+	}
+	if expiresAt.IsZero() {
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
+
+// setSessionCookies delivers a login's session as cookies, with its CSRF token, if the server delivers sessions as cookies
+// The session's token stays in the response body for clients that send it as a bearer token
+func (s *Server) setSessionCookies(w http.ResponseWriter, logInResponse *protocol.LogInResponse) {
+	if s.sessionCookies == nil {
+		return
+	}
+
+	token := csrfToken(logInResponse.Token)
+	http.SetCookie(w, s.sessionCookies.cookie(protocol.SessionCookieName, logInResponse.Token, logInResponse.ExpiresAt, true))
+	if s.sessionCookies.CSRF == CSRFDoubleSubmit {
+		http.SetCookie(w, s.sessionCookies.cookie(protocol.CSRFCookieName, token, logInResponse.ExpiresAt, false))
+	}
+	w.Header().Set(protocol.CSRFTokenHeader, token)
+}
+
+// clearSessionCookies deletes a session's cookies, if the server delivers sessions as cookies
+func (s *Server) clearSessionCookies(w http.ResponseWriter) {
+	if s.sessionCookies == nil {
+		return
+	}
+
+	http.SetCookie(w, s.sessionCookies.cookie(protocol.SessionCookieName, "", time.Time{}, true))
+	if s.sessionCookies.CSRF == CSRFDoubleSubmit {
+		http.SetCookie(w, s.sessionCookies.cookie(protocol.CSRFCookieName, "", time.Time{}, false))
+	}
+}
+
+// withSessionCookies returns a handler that authenticates requests without an authorization header by their session cookie,
+// as though it were their bearer token
+// Requests to credentialPaths ignore their session cookie, and requests whose cookie's session was revoked or expired have its cookies cleared and are served as though they sent none
+// Requests with a live session's cookie that change state, with a method other than GET, HEAD, or OPTIONS, and don't echo its CSRF token return a 4XX status
+func (s *Server) withSessionCookies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cookie, err := req.Cookie(protocol.SessionCookieName)
+		if err != nil || cookie.Value == "" || req.Header.Get("Authorization") != "" || credentialPaths[req.URL.Path] {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if _, status, err := s.lookupSession(cookie.Value); err != nil && status < http.StatusInternalServerError {
+			s.clearSessionCookies(w)
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			echoed := req.Header.Get(protocol.CSRFTokenHeader)
+			if subtle.ConstantTimeCompare([]byte(echoed), []byte(csrfToken(cookie.Value))) != 1 {
+				writeError(w, errCSRFTokenMismatch, http.StatusForbidden)
+				return
+			}
+		}
+
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+cookie.Value)
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// corsAnyOrigin is the origin of a CORSPolicy that allows every origin
+const corsAnyOrigin = "*"
+
+var errOriginNotAllowed = errors.New("origin not allowed")
+
+// corsMethods are the methods the server's endpoints are called with
+var corsMethods = strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}, ", ")
+
+// corsExposedHeaders are the response headers browser clients read
+var corsExposedHeaders = strings.Join([]string{"Location", "Retry-After", "WWW-Authenticate", "Idempotent-Replayed", protocol.CSRFTokenHeader, protocol.RequestIDHeader}, ", ")
+
+// CORSPolicy is which origins may call a server's endpoints from a browser, such as the WASM client served from another origin
+type CORSPolicy struct {
+	// Origins are the allowed origins, such as https://app.example.com, where "*" allows every origin, but not with credentials
+	Origins []string
+	// AllowCredentials lets browsers send cookies with cross-origin requests and read their responses
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the result of a preflight request, where 0 leaves it to the browser
+	MaxAge time.Duration
+}
+
+// allows returns whether a CORSPolicy allows an origin
+func (cp *CORSPolicy) allows(origin string) bool {
+	return slices.Contains(cp.Origins, origin) || (!cp.AllowCredentials && slices.Contains(cp.Origins, corsAnyOrigin))
+}
+
+// wrap returns a handler that adds CORS headers to responses to the origins a CORSPolicy allows, and answers their preflight requests
+// Requests from other origins are served without CORS headers, so browsers don't expose their responses, and their preflight requests return a 4XX status
+func (cp *CORSPolicy) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+		if !cp.allows(origin) {
+			if preflight {
+				writeError(w, errOriginNotAllowed, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if cp.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+		if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		if cp.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cp.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// deviceTokenByteLen is the length of a device token before encoding
+	deviceTokenByteLen = 32
+	// deviceIDByteLen is the length of a device's ID before encoding
+	deviceIDByteLen = 12
+	// maxDevices is how many devices a user is remembered on, past which the least recently used is forgotten
+	maxDevices = 16
+)
+
+var (
+	errDeviceRecovery = errors.New("recovery sessions can't remember devices")
+	errUnknownDevice  = errors.New("unknown device")
+)
+
+// hashDeviceSecret returns the hash of a device token or fingerprint that is stored in its place
+func hashDeviceSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// activeDevices returns the devices whose tokens haven't expired, ordered by when they were remembered
+func activeDevices(devices []Device) []Device {
+	now := time.Now()
+	active := make([]Device, 0, len(devices))
+	for _, device := range devices {
+		if now.Before(device.ExpiresAt) {
+			active = append(active, device)
+		}
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.Before(active[j].CreatedAt)
+	})
+	return active
+}
+
+// matchDevice returns the index of the unexpired device a token belongs to, if the fingerprint is the one it is bound to, or -1
+// Every device's hash is compared, so the time taken doesn't reveal which matched
+func matchDevice(devices []Device, token, fingerprint string) int {
+	tokenHash, fingerprintHash := hashDeviceSecret(token), hashDeviceSecret(fingerprint)
+	now := time.Now()
+	match := -1
+	for i, device := range devices {
+		tokenMatches := subtle.ConstantTimeCompare(device.TokenHash, tokenHash) == 1
+		fingerprintMatches := len(device.FingerprintHash) == 0 || subtle.ConstantTimeCompare(device.FingerprintHash, fingerprintHash) == 1
+		if tokenMatches && fingerprintMatches && now.Before(device.ExpiresAt) {
+			match = i
+		}
+	}
+
+	return match
+}
+
+// sessionUser returns the user of a request's session, or the status and error to return if it has none
+func (s *Server) sessionUser(req *http.Request) (User, Session, int, error) {
+	token, ok := bearerToken(req)
+	if !ok {
+		return User{}, Session{}, http.StatusUnauthorized, protocol.ErrInvalidSession
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		return User{}, Session{}, status, err
+	}
+
+	user, err := s.users.Get(session.Username)
+	if err != nil {
+		return User{}, Session{}, http.StatusInternalServerError, err
+	} else if status, err := checkStatus(user); err != nil {
+		return User{}, Session{}, status, err
+	}
+
+	return user, session, http.StatusOK, nil
+}
+
+// RememberDeviceHandler handles requests that remember the device a session is on, issuing a token that logs its user in there until it expires
+// Unexpired sessions return the device's token and a 2XX status, forgetting the user's least recently used device if they have too many
+// Malformed requests, missing, unknown, and expired sessions, and recovery sessions return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) RememberDeviceHandler(w http.ResponseWriter, req *http.Request) {
+	var rememberRequest protocol.RememberDeviceRequest
+	if err := json.NewDecoder(req.Body).Decode(&rememberRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, session, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	} else if session.Recovery {
+		writeError(w, errDeviceRecovery, http.StatusForbidden)
+		return
+	}
+
+	id, token := make([]byte, deviceIDByteLen), make([]byte, deviceTokenByteLen)
+	if _, err := io.ReadFull(s.entropy, id); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if _, err := io.ReadFull(s.entropy, token); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	deviceToken := protocol.DeviceToken{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Token:     base64.RawURLEncoding.EncodeToString(token),
+		ExpiresAt: now.Add(s.deviceTokenTTL),
+	}
+	device := Device{
+		ID:         deviceToken.ID,
+		Name:       rememberRequest.Name,
+		TokenHash:  hashDeviceSecret(deviceToken.Token),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  deviceToken.ExpiresAt,
+	}
+	if rememberRequest.Fingerprint != "" {
+		device.FingerprintHash = hashDeviceSecret(rememberRequest.Fingerprint)
+	}
+
+	user.Devices = append(activeDevices(user.Devices), device)
+	if len(user.Devices) > maxDevices {
+		sort.Slice(user.Devices, func(i, j int) bool {
+			return user.Devices[i].LastUsedAt.After(user.Devices[j].LastUsedAt)
+		})
+		user.Devices = activeDevices(user.Devices[:maxDevices])
+	}
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &deviceToken)
+}
+
+// DevicesHandler handles requests for the devices a session's user is remembered on
+// Unexpired sessions return their user's unexpired devices and a 2XX status
+// Missing, unknown, and expired sessions return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) DevicesHandler(w http.ResponseWriter, req *http.Request) {
+	user, _, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	devices := activeDevices(user.Devices)
+	devicesResponse := protocol.DevicesResponse{Devices: make([]protocol.DeviceInfo, len(devices))}
+	for i, device := range devices {
+		devicesResponse.Devices[i] = protocol.DeviceInfo{
+			ID:         device.ID,
+			Name:       device.Name,
+			Bound:      len(device.FingerprintHash) > 0,
+			CreatedAt:  device.CreatedAt,
+			LastUsedAt: device.LastUsedAt,
+			ExpiresAt:  device.ExpiresAt,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &devicesResponse)
+}
+
+// RevokeDeviceHandler handles requests that forget one of a session's user's devices, whose token then no longer logs them in
+// Devices of the user are forgotten and return a 2XX status
+// Malformed requests, missing, unknown, and expired sessions, and unknown devices return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) RevokeDeviceHandler(w http.ResponseWriter, req *http.Request) {
+	var revokeRequest protocol.RevokeDeviceRequest
+	if err := json.NewDecoder(req.Body).Decode(&revokeRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, _, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	devices := activeDevices(user.Devices)
+	kept := devices[:0]
+	for _, device := range devices {
+		if device.ID != revokeRequest.ID {
+			kept = append(kept, device)
+		}
+	}
+	if len(kept) == len(devices) {
+		writeError(w, errUnknownDevice, http.StatusNotFound)
+		return
+	}
+
+	user.Devices = kept
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeviceLogInHandler handles requests that log a user in with the token of a device they are remembered on, in place of their password
+// Unexpired tokens, with the fingerprint their device is bound to, return a new session and a 2XX status, without a passkey ceremony
+// Malformed requests, nonexistent and unverified users, and unknown, expired, and mismatched tokens return a 4XX status,
+// as do logins that the RiskAssessor or CAPTCHA refuses
+// Store and entropy errors return a 5XX status
+func (s *Server) DeviceLogInHandler(w http.ResponseWriter, req *http.Request) {
+	var logInRequest protocol.DeviceLogInRequest
+	if err := json.NewDecoder(req.Body).Decode(&logInRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.users.Get(logInRequest.Username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	firstLogInRequest := protocol.FirstLogInRequest{
+		Username:     logInRequest.Username,
+		StepUpToken:  logInRequest.StepUpToken,
+		CaptchaToken: logInRequest.CaptchaToken,
+	}
+	if status, err := s.screenLogIn(req.Context(), req.RemoteAddr, user.Username, &firstLogInRequest); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	i := matchDevice(user.Devices, logInRequest.Token, logInRequest.Fingerprint)
+	if i < 0 {
+		s.logInFailed(user.Username, req.RemoteAddr, "", false)
+		writeError(w, protocol.ErrInvalidCredentials, http.StatusForbidden)
+		return
+	}
+
+	user.Devices[i].LastUsedAt = time.Now()
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	logInResponse, err := s.issue(user.Username, false)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.logInSucceeded(user.Username, req.RemoteAddr, "", false)
+
+	s.setSessionCookies(w, logInResponse)
+	writeJSON(w, http.StatusOK, logInResponse)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// writeError writes an ErrorResponse for an error with a status, or with a 413 status if the error is from reading a body past the server's limit
+func writeError(w http.ResponseWriter, err error, status int) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, status, &protocol.ErrorResponse{
+		Code:    protocol.ErrorCode(err, status),
+		Message: err.Error(),
+	})
+}
+
+// writeJSON writes a response body with a status, stamped with the current protocol version unless it was sent in another
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	protocol.StampVersion(body)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// contextStatus returns a 5XX status for errors from a request's context being done, and a fallback status for other errors
+func contextStatus(err error, fallback int) int {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable
+	}
+
+	return fallback
+}
+
+// updateStatus returns a 4XX status for users updated by another request while one handled them, which it can retry, and a 5XX status for other store errors
+func updateStatus(err error) int {
+	if errors.Is(err, protocol.ErrUserChanged) {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/peer"
+)
+
+type (
+	// jsonCodec is the gRPC codec named protocol.GRPCCodec, which carries messages as JSON
+	jsonCodec struct{}
+
+	// grpcConn is a protocol.MessageConn over a gRPC stream
+	grpcConn struct {
+		stream grpc.ServerStream
+	}
+)
+
+// logInServiceDesc describes the gRPC service whose bidirectional stream carries a login's messages, with no generated code
+var logInServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hauth.Login",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "LogIn",
+		Handler:       logInStreamHandler,
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// Marshal encodes a message as JSON
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes a JSON message into v
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name returns protocol.GRPCCodec
+func (jsonCodec) Name() string {
+	return protocol.GRPCCodec
+}
+
+// ReadMessage reads the next message of a gRPC stream into v, until the stream's context is done
+func (gc grpcConn) ReadMessage(_ context.Context, v any) error {
+	return gc.stream.RecvMsg(v)
+}
+
+// WriteMessage writes a message to a gRPC stream, until the stream's context is done
+func (gc grpcConn) WriteMessage(_ context.Context, v any) error {
+	return gc.stream.SendMsg(v)
+}
+
+// Close does nothing, as a gRPC stream ends when its handler returns
+func (gc grpcConn) Close() error {
+	return nil
+}
+
+// logInStreamHandler runs a login over a gRPC stream with ServeLogIn, ending the stream once the login's last message is sent
+func logInStreamHandler(srv any, stream grpc.ServerStream) error {
+	var remoteAddr string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	srv.(*Server).ServeLogIn(stream.Context(), grpcConn{stream: stream}, remoteAddr)
+	return nil
+}
+
+// RegisterGRPC registers a Server's logins with a gRPC server, as a bidirectional stream at protocol.GRPCLogInMethod that runs ServeLogIn,
+// whose messages are sent with the protocol.GRPCCodec codec
+func (s *Server) RegisterGRPC(registrar grpc.ServiceRegistrar) {
+	registrar.RegisterService(&logInServiceDesc, s)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// fnvHasherName names the FNVHasher
+	fnvHasherName = "fnv64"
+	// argon2idHasherPrefix prefixes the names of Argon2idHashers, which also encode their parameters
+	argon2idHasherPrefix = "argon2id"
+	// argon2idHashByteLen is the length of an Argon2idHasher's hashes
+	argon2idHashByteLen = 32
+)
+
+var ErrUnknownHasher = errors.New("unknown hasher")
+
+type (
+	// Hasher hashes a user's salted secret for storage
+	Hasher interface {
+		// Name identifies a Hasher and its parameters, so ParseHasher can verify hashes it made
+		Name() string
+		// Hash returns the hash of a salted secret
+		Hash(salt, secret []byte) ([]byte, error)
+	}
+
+	// FNVHasher is the legacy Hasher, a 64 bit FNV hash that is fast to brute force and kept only to verify old users
+	FNVHasher struct{}
+
+	// Argon2idHasher is a Hasher that stretches salted secrets with Argon2id
+	Argon2idHasher struct {
+		Time    uint32
+		Memory  uint32
+		Threads uint8
+	}
+)
+
+// ParseHasher returns the Hasher a name identifies, where an empty name is the FNVHasher
+func ParseHasher(name string) (Hasher, error) {
+	if name == "" || name == fnvHasherName {
+		return FNVHasher{}, nil
+	}
+
+	if params, ok := strings.CutPrefix(name, argon2idHasherPrefix+"$"); ok {
+		var h Argon2idHasher
+		if _, err := fmt.Sscanf(params, "t=%d,m=%d,p=%d", &h.Time, &h.Memory, &h.Threads); err != nil || h.Time == 0 || h.Threads == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownHasher, name)
+		}
+
+		return h, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownHasher, name)
+}
+
+// Name returns the FNVHasher's name
+func (FNVHasher) Name() string {
+	return fnvHasherName
+}
+
+// Hash returns the FNV hash of a salt followed by a secret
+func (FNVHasher) Hash(salt, secret []byte) ([]byte, error) {
+	hash64 := fnv.New64()
+	if _, err := hash64.Write(append(append([]byte(nil), salt...), secret...)); err != nil {
+		return nil, err
+	}
+
+	return hash64.Sum(nil), nil
+}
+
+// Name returns an Argon2idHasher's name, which encodes its parameters
+func (h Argon2idHasher) Name() string {
+	return fmt.Sprintf("%s$t=%d,m=%d,p=%d", argon2idHasherPrefix, h.Time, h.Memory, h.Threads)
+}
+
+// Hash returns the Argon2id hash of a secret with a salt
+func (h Argon2idHasher) Hash(salt, secret []byte) ([]byte, error) {
+	return argon2.IDKey(secret, salt, h.Time, h.Memory, h.Threads, argon2idHashByteLen), nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// defaultLogInHistory is how long a user's login attempts are kept in their login history, unless the server is built WithLogInHistory
+	defaultLogInHistory = 30 * 24 * time.Hour
+	// maxLogInHistory is the most login attempts a user's login history keeps, so attempts to guess their password can't grow their record without bound
+	maxLogInHistory = 100
+)
+
+var errMissingUsername = errors.New("missing username query parameter")
+
+// recordAttempt appends a login attempt to a user's login history and drops the attempts older than a retention before it, and the oldest beyond maxLogInHistory,
+// where a retention that isn't positive keeps none
+func (u *User) recordAttempt(attempt protocol.LogInAttempt, retention time.Duration) {
+	history := u.LogInHistory[:0:0]
+	if retention > 0 {
+		cutoff := attempt.At.Add(-retention)
+		for _, past := range u.LogInHistory {
+			if past.At.After(cutoff) {
+				history = append(history, past)
+			}
+		}
+		history = append(history, attempt)
+	}
+
+	if len(history) > maxLogInHistory {
+		history = history[len(history)-maxLogInHistory:]
+	} else if len(history) == 0 {
+		history = nil
+	}
+	u.LogInHistory = history
+}
+
+// logInHistoryResponse returns the response listing a user's login attempts within the server's login history retention
+func (s *Server) logInHistoryResponse(user User) *protocol.LogInHistoryResponse {
+	cutoff := time.Now().Add(-s.logInHistory)
+	attempts := []protocol.LogInAttempt{}
+	for _, attempt := range user.LogInHistory {
+		if attempt.At.After(cutoff) {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	return &protocol.LogInHistoryResponse{Username: user.Username, Attempts: attempts}
+}
+
+// LogInHistoryHandler handles requests for the recent login attempts of a session's user
+// Unexpired sessions return their user's login attempts within the server's login history retention, oldest first, and a 2XX status
+// Missing, unknown, and expired sessions, and sessions of users that no longer exist, return a 4XX status
+// Session and user store errors return a 5XX status
+func (s *Server) LogInHistoryHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	user, ok := s.findUser(w, session.Username)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.logInHistoryResponse(user))
+}
+
+// AdminLogInHistoryHandler handles admin requests for the recent login attempts of the user named by the username query parameter
+// Authorized requests return the user's login attempts within the server's login history retention, oldest first, and a 2XX status
+// Requests without the admin token or a username, and nonexistent users, return a 4XX status
+// User store errors return a 5XX status
+func (s *Server) AdminLogInHistoryHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.isAdmin(req) {
+		writeError(w, protocol.ErrNotAdmin, http.StatusUnauthorized)
+		return
+	}
+
+	username := req.URL.Query().Get("username")
+	if username == "" {
+		writeError(w, errMissingUsername, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.findUser(w, username)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.logInHistoryResponse(user))
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// defaultIdempotencyTTL is how long the outcome of a request with an idempotency key is returned to its retries, unless the server is built WithIdempotencyTTL
+	defaultIdempotencyTTL = 24 * time.Hour
+	// maxIdempotencyKeyLen is the length of the longest idempotency key a request can send
+	maxIdempotencyKeyLen = 255
+)
+
+var (
+	errIdempotencyKeyLength = errors.New("idempotency key is too long")
+	errIdempotencyKeyReused = errors.New("idempotency key was sent with another request")
+	errIdempotencyInFlight  = errors.New("request with this idempotency key is still in progress")
+)
+
+type (
+	// idempotentOutcome is the response to a request with an idempotency key, and the hash of the request it answers
+	// Its status is 0 while the request is in progress
+	idempotentOutcome struct {
+		fingerprint [sha256.Size]byte
+		status      int
+		body        []byte
+		expiresAt   time.Time
+	}
+
+	// idempotencyStore holds the outcomes of the requests with idempotency keys a server succeeded at, and those in progress, by path and key
+	idempotencyStore struct {
+		outcomes map[string]*idempotentOutcome
+		mu       sync.Mutex
+	}
+
+	// recordingResponseWriter is an http.ResponseWriter that keeps a copy of the status and body it writes
+	recordingResponseWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+// makeIdempotencyStore returns an empty idempotencyStore
+func makeIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{outcomes: map[string]*idempotentOutcome{}}
+}
+
+// begin claims a key for a request's fingerprint, returning the outcome of a completed request with the key,
+// or nil if the request should run, after which it must be finished
+// Keys sent with another request, or whose request is still in progress, return an error
+func (is *idempotencyStore) begin(key string, fingerprint [sha256.Size]byte, now time.Time) (*idempotentOutcome, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	is.prune(now)
+	outcome, ok := is.outcomes[key]
+	if !ok {
+		is.outcomes[key] = &idempotentOutcome{fingerprint: fingerprint}
+		return nil, nil
+	}
+
+	if outcome.fingerprint != fingerprint {
+		return nil, errIdempotencyKeyReused
+	} else if outcome.status == 0 {
+		return nil, errIdempotencyInFlight
+	}
+
+	return outcome, nil
+}
+
+// finish stores the outcome of a request that claimed a key until a TTL passes, if it succeeded,
+// or releases the key, so a failed request can be retried with it
+func (is *idempotencyStore) finish(key string, status int, body []byte, ttl time.Duration) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		delete(is.outcomes, key)
+		return
+	}
+
+	outcome := is.outcomes[key]
+	outcome.status = status
+	outcome.body = body
+	outcome.expiresAt = time.Now().Add(ttl)
+}
+
+// prune removes the outcomes whose TTL has passed
+// The caller must hold the lock
+func (is *idempotencyStore) prune(now time.Time) {
+	for key, outcome := range is.outcomes {
+		if outcome.status != 0 && now.After(outcome.expiresAt) {
+			delete(is.outcomes, key)
+		}
+	}
+}
+
+// WriteHeader writes a status, and keeps it
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes part of a body, and keeps a copy of it
+func (rw *recordingResponseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
+
+// idempotent returns a handler that runs a handler once per protocol.IdempotencyKeyHeader, returning the outcome of its first success to retries of the same request,
+// such as a sign up whose response timed out after the user was created, which would otherwise fail with protocol.ErrUserExists
+// Requests without a key always run, failures release their key, so the request can be retried with it,
+// and keys that are too long, sent with another request, or whose request is still in progress return a 4XX status
+func (s *Server) idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(protocol.IdempotencyKeyHeader)
+		if key == "" || s.idempotencyTTL <= 0 {
+			handler(w, req)
+			return
+		} else if len(key) > maxIdempotencyKeyLen {
+			writeError(w, errIdempotencyKeyLength, http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		key = req.URL.Path + " " + key
+		outcome, err := s.idempotency.begin(key, sha256.Sum256(body), time.Now())
+		if errors.Is(err, errIdempotencyInFlight) {
+			writeError(w, err, http.StatusConflict)
+			return
+		} else if err != nil {
+			writeError(w, err, http.StatusUnprocessableEntity)
+			return
+		} else if outcome != nil {
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(outcome.status)
+			w.Write(outcome.body)
+			return
+		}
+
+		recorder := &recordingResponseWriter{ResponseWriter: w}
+		defer func() {
+			s.idempotency.finish(key, recorder.status, recorder.body.Bytes(), s.idempotencyTTL)
+		}()
+		handler(recorder, req)
+	}
+}
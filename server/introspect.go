@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// tokenCaller returns the client id an introspection or revocation request authenticated with, or empty for the admin token,
+// or writes the error response and returns false if it is unauthenticated
+func (s *Server) tokenCaller(w http.ResponseWriter, req *http.Request) (string, bool) {
+	if s.adminToken != "" && s.isAdmin(req) {
+		return "", true
+	}
+
+	clientID, secret, basic := clientCredentials(req)
+	if s.oidc != nil && clientID != "" && s.oidc.authenticate(clientID, secret) {
+		return clientID, true
+	}
+
+	if basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="hauth"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeOIDCError(w, "invalid_client", "missing admin token, or unknown client or wrong secret", http.StatusUnauthorized)
+	return "", false
+}
+
+// postedToken parses the form of a posted introspection or revocation request, returning its token,
+// or writes the error response and returns false if it isn't posted or has no token
+func postedToken(w http.ResponseWriter, req *http.Request) (string, bool) {
+	if req.Method != http.MethodPost {
+		writeOIDCError(w, "invalid_request", "token requests are posted", http.StatusMethodNotAllowed)
+		return "", false
+	} else if err := req.ParseForm(); err != nil {
+		writeOIDCError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	token := req.PostForm.Get("token")
+	if token == "" {
+		writeOIDCError(w, "invalid_request", "missing token", http.StatusBadRequest)
+		return "", false
+	}
+
+	return token, true
+}
+
+// activeUser returns whether a user exists and can log in
+func (s *Server) activeUser(username string) (bool, error) {
+	user, err := s.users.Get(username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = checkStatus(user)
+	return err == nil, nil
+}
+
+// introspect returns whether a session token, API key, or access token is active, and what it grants if it is,
+// without extending sessions that slide
+func (s *Server) introspect(token string) (protocol.TokenIntrospection, error) {
+	if strings.HasPrefix(token, protocol.APIKeyPrefix) {
+		user, apiKey, status, err := s.lookupAPIKey(token)
+		if status == http.StatusInternalServerError {
+			return protocol.TokenIntrospection{}, err
+		} else if err != nil {
+			return protocol.TokenIntrospection{}, nil
+		}
+
+		introspection := protocol.TokenIntrospection{
+			Active:    true,
+			TokenType: protocol.TokenTypeAPIKey,
+			Scope:     strings.Join(apiKey.Scopes, " "),
+			Username:  user.Username,
+			Subject:   user.Username,
+			IssuedAt:  apiKey.CreatedAt.Unix(),
+		}
+		if !apiKey.ExpiresAt.IsZero() {
+			introspection.ExpiresAt = apiKey.ExpiresAt.Unix()
+		}
+		return introspection, nil
+	}
+
+	session, err := s.sessions.Get(sessionID(token))
+	if err == nil {
+		if active, err := s.activeUser(session.Username); !active {
+			return protocol.TokenIntrospection{}, err
+		}
+
+		return protocol.TokenIntrospection{
+			Active:    true,
+			TokenType: protocol.TokenTypeSession,
+			Username:  session.Username,
+			Subject:   session.Username,
+			ExpiresAt: session.ExpiresAt.Unix(),
+			IssuedAt:  session.IssuedAt.Unix(),
+		}, nil
+	} else if !errors.Is(err, protocol.ErrInvalidSession) {
+		return protocol.TokenIntrospection{}, err
+	}
+
+	if s.oidc != nil {
+		if g, ok := s.oidc.lookupAccessToken(token); ok {
+			if active, err := s.activeUser(g.username); !active {
+				return protocol.TokenIntrospection{}, err
+			}
+
+			return protocol.TokenIntrospection{
+				Active:    true,
+				TokenType: protocol.TokenTypeAccessToken,
+				Scope:     g.scope,
+				ClientID:  g.clientID,
+				Username:  g.username,
+				Subject:   g.username,
+				ExpiresAt: g.expiresAt.Unix(),
+				IssuedAt:  g.expiresAt.Add(-oidcTokenTTL).Unix(),
+			}, nil
+		}
+	}
+
+	return protocol.TokenIntrospection{}, nil
+}
+
+// IntrospectHandler handles posted requests from resource servers, authenticated with the admin token or an OIDC client's secret,
+// for whether the session token, API key, or access token in their form is active, and whose it is and what it grants if it is,
+// so they can check tokens without a session of their own; token type hints are ignored
+// Authenticated requests return the token's introspection, which is inactive for unknown, expired, and revoked tokens,
+// and tokens of users who can't log in, with a 2XX status
+// Unauthenticated requests, and requests without a token, return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) IntrospectHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := postedToken(w, req)
+	if !ok {
+		return
+	} else if _, ok := s.tokenCaller(w, req); !ok {
+		return
+	}
+
+	introspection, err := s.introspect(token)
+	if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&introspection)
+}
+
+// RevokeHandler handles posted requests from resource servers, authenticated with the admin token or an OIDC client's secret,
+// that revoke the session token, API key, or access token in their form, where clients only revoke the access tokens issued to them
+// Authenticated requests return a 2XX status, whether or not the token was active, so they don't reveal which tokens exist
+// Unauthenticated requests, and requests without a token, return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) RevokeHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := postedToken(w, req)
+	if !ok {
+		return
+	}
+	clientID, ok := s.tokenCaller(w, req)
+	if !ok {
+		return
+	}
+
+	if s.oidc != nil {
+		s.oidc.revokeAccessToken(token, clientID)
+	}
+	if clientID != "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if strings.HasPrefix(token, protocol.APIKeyPrefix) {
+		user, apiKey, status, err := s.lookupAPIKey(token)
+		if status == http.StatusInternalServerError {
+			writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+			return
+		} else if err == nil {
+			if err := s.updateUser(user.Username, func(user *User) error {
+				user.APIKeys = slices.DeleteFunc(user.APIKeys, func(k APIKey) bool { return k.ID == apiKey.ID })
+				return nil
+			}); err != nil {
+				writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	} else if err := s.sessions.Revoke(sessionID(token)); err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
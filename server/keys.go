@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MasterKeyName names the master key that a SealedStore seals users' data keys under
+const MasterKeyName = "master"
+
+var ErrUnknownKey = errors.New("unknown key")
+
+type (
+	// KeyProvider fetches named server key material, such as the master key, from wherever it is kept
+	KeyProvider interface {
+		// Keys returns the versions of a named key, current first, followed by those it replaced that may still be needed to open existing data
+		Keys(ctx context.Context, name string) ([][]byte, error)
+	}
+
+	// StaticKeyProvider is a KeyProvider of keys held in memory, by name
+	StaticKeyProvider map[string][][]byte
+
+	// cachedKeys are the versions of a key a CachingKeyProvider fetched, and when
+	cachedKeys struct {
+		keys      [][]byte
+		fetchedAt time.Time
+	}
+
+	// CachingKeyProvider is a KeyProvider that caches another's keys, fetching them again once they're older than a refresh interval,
+	// so keys rotated by the other KeyProvider are picked up without a restart
+	// If a refresh fails, the cached keys are kept until one succeeds, so an outage of a key management service doesn't stop logins
+	CachingKeyProvider struct {
+		provider KeyProvider
+		refresh  time.Duration
+		mu       sync.Mutex
+		cache    map[string]cachedKeys
+	}
+)
+
+// Keys returns the versions of a named key in a StaticKeyProvider
+func (skp StaticKeyProvider) Keys(ctx context.Context, name string) ([][]byte, error) {
+	keys, ok := skp[name]
+	if !ok || len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+	}
+
+	return keys, nil
+}
+
+// NewCachingKeyProvider returns a CachingKeyProvider in front of a KeyProvider that fetches each key at most once per refresh interval
+func NewCachingKeyProvider(provider KeyProvider, refresh time.Duration) *CachingKeyProvider {
+	return &CachingKeyProvider{
+		provider: provider,
+		refresh:  refresh,
+		cache:    map[string]cachedKeys{},
+	}
+}
+
+// Keys returns the versions of a named key, from a CachingKeyProvider's cache if they were fetched within its refresh interval
+func (ckp *CachingKeyProvider) Keys(ctx context.Context, name string) ([][]byte, error) {
+	ckp.mu.Lock()
+	defer ckp.mu.Unlock()
+
+	cached, ok := ckp.cache[name]
+	if ok && time.Since(cached.fetchedAt) < ckp.refresh {
+		return cached.keys, nil
+	}
+
+	keys, err := ckp.provider.Keys(ctx, name)
+	if err != nil {
+		if ok {
+			return cached.keys, nil
+		}
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+	}
+
+	ckp.cache[name] = cachedKeys{keys: keys, fetchedAt: time.Now()}
+	return keys, nil
+}
+
+// providedMasterKeys returns a function that returns the ciphers of the versions of a KeyProvider's master key, current first
+func providedMasterKeys(provider KeyProvider) func() ([]cipher.AEAD, error) {
+	return func() ([]cipher.AEAD, error) {
+		keys, err := provider.Keys(context.Background(), MasterKeyName)
+		if err != nil {
+			return nil, err
+		} else if len(keys) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, MasterKeyName)
+		}
+
+		masterKeys := make([]cipher.AEAD, len(keys))
+		for i, key := range keys {
+			if masterKeys[i], err = NewMasterKey(key); err != nil {
+				return nil, err
+			}
+		}
+
+		return masterKeys, nil
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// gcpMetadataTokenURL is where GCP workloads fetch their service account's access token
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// gcpKMSEndpoint is the default endpoint of GCP's Cloud KMS
+	gcpKMSEndpoint = "https://cloudkms.googleapis.com"
+)
+
+var errMissingCredentials = errors.New("missing credentials")
+
+type (
+	// AWSKMSKeyProvider is a KeyProvider of keys wrapped by AWS KMS, which it unwraps with KMS's Decrypt action
+	// Credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and optional AWS_SESSION_TOKEN environment variables
+	AWSKMSKeyProvider struct {
+		// Region is the KMS region, such as us-east-1
+		Region string
+		// Wrapped are the base64 KMS ciphertexts of each key's versions, current first
+		Wrapped map[string][]string
+		// Endpoint overrides the regional KMS endpoint, such as for a local emulator
+		Endpoint string
+		// HTTPClient calls KMS, defaulting to http.DefaultClient
+		HTTPClient *http.Client
+	}
+
+	// GCPKMSKeyProvider is a KeyProvider of keys wrapped by a GCP Cloud KMS key, which it unwraps with the key's decrypt method
+	// The access token is read from the GOOGLE_OAUTH_ACCESS_TOKEN environment variable, or else the metadata server of the GCP workload
+	GCPKMSKeyProvider struct {
+		// Key is the resource name of the KMS key, such as projects/p/locations/global/keyRings/r/cryptoKeys/k
+		Key string
+		// Wrapped are the base64 KMS ciphertexts of each key's versions, current first
+		Wrapped map[string][]string
+		// Endpoint overrides the Cloud KMS endpoint, such as for a local emulator
+		Endpoint string
+		// HTTPClient calls Cloud KMS and the metadata server, defaulting to http.DefaultClient
+		HTTPClient *http.Client
+	}
+)
+
+// Keys returns the versions of a named key, unwrapped by AWS KMS
+func (akp *AWSKMSKeyProvider) Keys(ctx context.Context, name string) ([][]byte, error) {
+	return decodeKeys(name, akp.Wrapped[name], func(wrapped []byte) ([]byte, error) {
+		return akp.decrypt(ctx, wrapped)
+	})
+}
+
+// decrypt unwraps a key with AWS KMS's Decrypt action
+func (akp *AWSKMSKeyProvider) decrypt(ctx context.Context, wrapped []byte) ([]byte, error) {
+	accessKeyID, secretAccessKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("aws kms: %w", errMissingCredentials)
+	}
+
+	endpoint := akp.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kms." + akp.Region + ".amazonaws.com"
+	}
+
+	body, err := json.Marshal(map[string][]byte{"CiphertextBlob": wrapped})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	if sessionToken := os.Getenv("AWS_SESSION_TOKEN"); sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	signAWSRequest(req, body, akp.Region, "kms", accessKeyID, secretAccessKey, time.Now())
+
+	var decrypted struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	if err := callKeyService(httpClientOrDefault(akp.HTTPClient), req, &decrypted); err != nil {
+		return nil, fmt.Errorf("aws kms: %w", err)
+	}
+
+	return decrypted.Plaintext, nil
+}
+
+// signAWSRequest signs a request to an AWS service with Signature Version 4, signing its host and X-Amz-* and Content-Type headers
+func signAWSRequest(req *http.Request, body []byte, region, service, accessKeyID, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		if lower := strings.ToLower(key); lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(key))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under a key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Keys returns the versions of a named key, unwrapped by GCP Cloud KMS
+func (gkp *GCPKMSKeyProvider) Keys(ctx context.Context, name string) ([][]byte, error) {
+	token, err := gkp.accessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcp kms: %w", err)
+	}
+
+	return decodeKeys(name, gkp.Wrapped[name], func(wrapped []byte) ([]byte, error) {
+		return gkp.decrypt(ctx, token, wrapped)
+	})
+}
+
+// accessToken returns the access token that authenticates to Cloud KMS
+func (gkp *GCPKMSKeyProvider) accessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := callKeyService(httpClientOrDefault(gkp.HTTPClient), req, &token); err != nil {
+		return "", fmt.Errorf("%w: %v", errMissingCredentials, err)
+	}
+
+	return token.AccessToken, nil
+}
+
+// decrypt unwraps a key with a Cloud KMS key's decrypt method
+func (gkp *GCPKMSKeyProvider) decrypt(ctx context.Context, token string, wrapped []byte) ([]byte, error) {
+	endpoint := gkp.Endpoint
+	if endpoint == "" {
+		endpoint = gcpKMSEndpoint
+	}
+
+	body, err := json.Marshal(map[string][]byte{"ciphertext": wrapped})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/v1/"+gkp.Key+":decrypt", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var decrypted struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := callKeyService(httpClientOrDefault(gkp.HTTPClient), req, &decrypted); err != nil {
+		return nil, fmt.Errorf("gcp kms: %w", err)
+	}
+
+	return decrypted.Plaintext, nil
+}
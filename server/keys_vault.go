@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// VaultKeyProvider is a KeyProvider of keys kept in a HashiCorp Vault KV secret, at either version of the KV secrets engine
+// Each key is a field of the secret holding its base64 versions, current first, as a list or a comma separated string
+type VaultKeyProvider struct {
+	// Address is the Vault server's url, such as https://vault.example.com:8200
+	Address string
+	// Token authenticates to Vault, such as the VAULT_TOKEN environment variable
+	Token string
+	// Path is the secret's API path after /v1/, such as secret/data/hauth for a KV version 2 engine mounted at secret
+	Path string
+	// HTTPClient calls Vault, defaulting to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Keys returns the versions of a named key in a VaultKeyProvider's secret
+func (vkp *VaultKeyProvider) Keys(ctx context.Context, name string) ([][]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(vkp.Address, "/")+"/v1/"+strings.TrimPrefix(vkp.Path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", vkp.Token)
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := callKeyService(httpClientOrDefault(vkp.HTTPClient), req, &secret); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+
+	// KV version 2 engines nest the secret's fields under data.data, along with its metadata
+	fields := secret.Data
+	if nested, ok := fields["data"]; ok {
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return nil, fmt.Errorf("vault: %w", err)
+		}
+	}
+
+	field, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+	}
+
+	var encoded []string
+	if err := json.Unmarshal(field, &encoded); err != nil {
+		var joined string
+		if err := json.Unmarshal(field, &joined); err != nil {
+			return nil, fmt.Errorf("vault: field %s isn't a string or list of strings", name)
+		}
+		encoded = strings.Split(joined, ",")
+	}
+
+	return decodeKeys(name, encoded, func(key []byte) ([]byte, error) {
+		return key, nil
+	})
+}
+
+// decodeKeys returns the base64 versions of a named key, each transformed by a function, such as one that unwraps it with a key management service
+func decodeKeys(name string, encoded []string, unwrap func(key []byte) ([]byte, error)) ([][]byte, error) {
+	if len(encoded) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+	}
+
+	keys := make([][]byte, len(encoded))
+	for i, e := range encoded {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(e))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+		if keys[i], err = unwrap(key); err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+	}
+
+	return keys, nil
+}
+
+// callKeyService sends a request to a key management service, decoding its JSON response into v
+func callKeyService(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// httpClientOrDefault returns an http.Client, or http.DefaultClient if it is nil
+func httpClientOrDefault(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
+	}
+
+	return client
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixPrefix prefixes the listen addresses of Unix domain sockets
+const unixPrefix = "unix:"
+
+var errSocketInUse = errors.New("unix socket is in use")
+
+// Listen returns a listener for an address, either host:port over TCP, where an empty host is every interface, or unix:path for a Unix domain socket
+// A socket file left at the path by a process that is no longer listening is replaced, and the file is removed when the listener closes
+// Requests over a Unix domain socket share one client address, so a rate limit applies to all of them together, such as everything from a reverse proxy
+func Listen(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %s", errSocketInUse, path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// ListenAll returns a listener for each address, as Listen does, closing those already opened if any fails
+func ListenAll(addresses []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		listener, err := Listen(address)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
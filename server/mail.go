@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// verificationTTL is how long a user has to verify their email address with the token sent to it
+	verificationTTL = 24 * time.Hour
+	// verificationTokenByteLen is the length of a mailed token before encoding
+	verificationTokenByteLen = 24
+)
+
+var (
+	errMissingEmail    = errors.New("a valid email address is required")
+	errAlreadyVerified = errors.New("email address is already verified")
+)
+
+type (
+	// Mailer sends email, such as the tokens that verify users' addresses
+	Mailer interface {
+		// Send sends a plain text message to an address
+		Send(ctx context.Context, to, subject, body string) error
+	}
+
+	// LogMailer is a Mailer that logs messages instead of sending them, for development
+	LogMailer struct {
+		Logger *log.Logger
+	}
+
+	// SMTPMailer is a Mailer that sends messages from an address through an SMTP server, at host:port, with optional authentication
+	SMTPMailer struct {
+		Address string
+		From    string
+		Auth    smtp.Auth
+	}
+
+	// Verification is a token mailed to a user, such as one verifying their address, held as its SHA-256 hash so stolen stores can't be used to verify
+	Verification struct {
+		TokenHash []byte
+		ExpiresAt time.Time
+	}
+)
+
+// Send logs a message to a LogMailer's Logger, or the standard logger if it is nil
+func (lm LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	logger := lm.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	logger.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// Send sends a message through an SMTPMailer's server, unless the context is done first
+func (sm *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	host, _, err := net.SplitHostPort(sm.Address)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", sm.From, to, subject, body)
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", sm.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if sm.Auth != nil {
+		if err := c.Auth(sm.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(sm.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// validEmail returns whether an address is a bare email address, without a display name
+func validEmail(address string) bool {
+	parsed, err := mail.ParseAddress(address)
+	return err == nil && parsed.Address == address
+}
+
+// mailedToken returns a fresh token to mail a user, and the Verification that checks it until a ttl passes
+func (s *Server) mailedToken(ttl time.Duration) (string, *Verification, error) {
+	token := make([]byte, verificationTokenByteLen)
+	if _, err := io.ReadFull(s.entropy, token); err != nil {
+		return "", nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+
+	tokenHash := sha256.Sum256([]byte(encoded))
+	return encoded, &Verification{
+		TokenHash: tokenHash[:],
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// check returns the status and error to return for a token that a Verification doesn't match, or that has expired
+func (v *Verification) check(token string) (int, error) {
+	tokenHash := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(tokenHash[:], v.TokenHash) != 1 {
+		return http.StatusForbidden, fmt.Errorf("%w: mailed token", protocol.ErrInvalidCredentials)
+	} else if time.Now().After(v.ExpiresAt) {
+		return http.StatusNotFound, protocol.ErrUnknownChallenge
+	}
+
+	return http.StatusOK, nil
+}
+
+// pendVerification marks a user's email address as unverified, returning the token that verifies it
+func (s *Server) pendVerification(user *User) (string, error) {
+	token, verification, err := s.mailedToken(verificationTTL)
+	if err != nil {
+		return "", err
+	}
+
+	user.Verification = verification
+	return token, nil
+}
+
+// sendVerification mails a user the token that verifies their email address, with a link to the server's verify URL if it has one
+func (s *Server) sendVerification(ctx context.Context, user User, token string) error {
+	body := fmt.Sprintf("Your verification code for %s is %s\nIt expires in %d hours.", user.Username, token, int(verificationTTL.Hours()))
+	if s.verifyURL != "" {
+		link, err := url.Parse(s.verifyURL)
+		if err != nil {
+			return err
+		}
+
+		query := link.Query()
+		query.Set("username", user.Username)
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		body += "\nVerify it at " + link.String()
+	}
+
+	return s.mailer.Send(ctx, user.Email, "Verify your email address", body)
+}
+
+// VerifyEmailHandler handles email verification requests, as a JSON body or username and token query parameters, such as a mailed link's
+// Requests with the token mailed to a pending user activate them, and those without one mail a fresh token, and return a 2XX status
+// Malformed requests, nonexistent and verified users, and invalid or expired tokens return a 4XX status
+// Store, entropy, and mail errors return a 5XX status
+func (s *Server) VerifyEmailHandler(w http.ResponseWriter, req *http.Request) {
+	var verifyRequest protocol.VerifyEmailRequest
+	if req.Method == http.MethodGet {
+		verifyRequest.Username, verifyRequest.Token = req.URL.Query().Get("username"), req.URL.Query().Get("token")
+	} else if err := json.NewDecoder(req.Body).Decode(&verifyRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.users.Get(verifyRequest.Username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if user.status() == protocol.AccountDeleted {
+		writeError(w, protocol.ErrUserDoesNotExist, http.StatusBadRequest)
+		return
+	} else if user.Verification == nil {
+		writeError(w, errAlreadyVerified, http.StatusBadRequest)
+		return
+	}
+
+	if verifyRequest.Token == "" {
+		token, err := s.pendVerification(&user)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+		if err := s.users.Update(user); err != nil {
+			writeError(w, err, updateStatus(err))
+			return
+		}
+		if err := s.sendVerification(req.Context(), user, token); err != nil {
+			writeError(w, err, contextStatus(err, http.StatusInternalServerError))
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if status, err := user.Verification.check(verifyRequest.Token); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	user.Verification = nil
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
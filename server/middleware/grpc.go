@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serverStream is a grpc.ServerStream whose context carries the username of a validated session
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream's context with the session's username
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// UnaryServerInterceptor returns an interceptor that serves unary calls whose authorization metadata bears a session token a Validator accepts,
+// with its username in their context
+// Missing and rejected tokens return codes.Unauthenticated, and tokens that couldn't be checked return codes.Unavailable
+func UnaryServerInterceptor(v Validator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that serves streams as UnaryServerInterceptor serves unary calls
+func StreamServerInterceptor(v Validator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), v)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate returns a call's context with the username of the session token in its authorization metadata, or a gRPC status error
+func authenticate(ctx context.Context, v Validator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, protocol.ErrInvalidSession.Error())
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return nil, status.Error(codes.Unauthenticated, protocol.ErrInvalidSession.Error())
+	}
+
+	username, err := v.ValidateSession(ctx, token)
+	switch {
+	case errors.Is(err, protocol.ErrInvalidSession):
+		return nil, status.Error(codes.Unauthenticated, protocol.ErrInvalidSession.Error())
+	case err != nil:
+		return nil, status.Error(codes.Unavailable, errUnavailable.Error())
+	}
+
+	return WithUsername(ctx, username), nil
+}
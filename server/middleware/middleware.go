@@ -0,0 +1,264 @@
+// Package middleware protects the handlers and gRPC services of other services with the session tokens and API keys a hauth server issues
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// errUnavailable is returned when a Validator can't reach the server that issued a token
+var errUnavailable = errors.New("session validation unavailable")
+
+type (
+	// Validator returns the user of a session token
+	// Tokens it rejects return an error wrapping protocol.ErrInvalidSession, and other errors mean the token couldn't be checked
+	// A *server.Server is a Validator for the sessions it issued, as is an IntrospectionValidator of one
+	Validator interface {
+		ValidateSession(ctx context.Context, token string) (string, error)
+	}
+
+	// RemoteValidator is a Validator that checks tokens with a hauth server's whoami endpoint, for services in another process than the server
+	RemoteValidator struct {
+		baseURL string
+		client  *http.Client
+	}
+
+	// IntrospectionValidator is a Validator and APIKeyValidator that checks tokens with a hauth server's introspection endpoint,
+	// authenticated as an OIDC client or with the admin token, for resource servers in another process than the server
+	IntrospectionValidator struct {
+		baseURL      string
+		clientID     string
+		clientSecret string
+		client       *http.Client
+	}
+
+	// APIKeyValidator returns the user of an API key and the scopes it grants
+	// Keys it rejects return an error wrapping protocol.ErrInvalidAPIKey, and other errors mean the key couldn't be checked
+	// A *server.Server is an APIKeyValidator for the API keys its users issued, as is an IntrospectionValidator of one
+	APIKeyValidator interface {
+		ValidateAPIKey(ctx context.Context, key string) (string, []string, error)
+	}
+
+	// usernameKey is the context key of the username a validated session belongs to
+	usernameKey struct{}
+
+	// scopesKey is the context key of the scopes a validated API key grants
+	scopesKey struct{}
+)
+
+// NewRemoteValidator returns a RemoteValidator for the hauth server at a base URL, which it requests with an http.Client, or http.DefaultClient if it is nil
+func NewRemoteValidator(baseURL string, client *http.Client) *RemoteValidator {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &RemoteValidator{baseURL: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+// ValidateSession returns the user the server recognizes a session token as
+func (rv *RemoteValidator) ValidateSession(ctx context.Context, token string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rv.baseURL+"/whoami", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := rv.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return "", protocol.ErrInvalidSession
+	default:
+		return "", fmt.Errorf("%w: %s", errUnavailable, resp.Status)
+	}
+
+	var whoAmIResponse protocol.WhoAmIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&whoAmIResponse); err != nil {
+		return "", fmt.Errorf("%w: %w", errUnavailable, err)
+	}
+
+	return whoAmIResponse.Username, nil
+}
+
+// NewIntrospectionValidator returns an IntrospectionValidator for the hauth server at a base URL, which it requests with an http.Client,
+// or http.DefaultClient if it is nil, authenticated as the OIDC client with an id and secret, or with the admin token as the secret if the id is empty
+func NewIntrospectionValidator(baseURL, clientID, clientSecret string, client *http.Client) *IntrospectionValidator {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &IntrospectionValidator{baseURL: strings.TrimSuffix(baseURL, "/"), clientID: clientID, clientSecret: clientSecret, client: client}
+}
+
+// introspect returns the server's introspection of a token
+func (iv *IntrospectionValidator) introspect(ctx context.Context, token string) (*protocol.TokenIntrospection, error) {
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, iv.baseURL+protocol.IntrospectPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if iv.clientID == "" {
+		req.Header.Set("Authorization", "Bearer "+iv.clientSecret)
+	} else {
+		req.SetBasicAuth(url.QueryEscape(iv.clientID), url.QueryEscape(iv.clientSecret))
+	}
+
+	resp, err := iv.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", errUnavailable, resp.Status)
+	}
+
+	var introspection protocol.TokenIntrospection
+	if err := json.NewDecoder(resp.Body).Decode(&introspection); err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnavailable, err)
+	}
+
+	return &introspection, nil
+}
+
+// ValidateSession returns the user of a session token the server introspects as active
+func (iv *IntrospectionValidator) ValidateSession(ctx context.Context, token string) (string, error) {
+	introspection, err := iv.introspect(ctx, token)
+	if err != nil {
+		return "", err
+	} else if !introspection.Active || introspection.TokenType != protocol.TokenTypeSession {
+		return "", protocol.ErrInvalidSession
+	}
+
+	return introspection.Username, nil
+}
+
+// ValidateAPIKey returns the user of an API key the server introspects as active, and the scopes it grants
+func (iv *IntrospectionValidator) ValidateAPIKey(ctx context.Context, key string) (string, []string, error) {
+	introspection, err := iv.introspect(ctx, key)
+	if err != nil {
+		return "", nil, err
+	} else if !introspection.Active || introspection.TokenType != protocol.TokenTypeAPIKey {
+		return "", nil, protocol.ErrInvalidAPIKey
+	}
+
+	return introspection.Username, strings.Fields(introspection.Scope), nil
+}
+
+// WithUsername returns a context carrying the username of a validated session
+func WithUsername(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, usernameKey{}, username)
+}
+
+// Username returns the username of the session a request was validated with, and whether it was
+func Username(ctx context.Context) (string, bool) {
+	username, ok := ctx.Value(usernameKey{}).(string)
+	return username, ok
+}
+
+// RequireSession returns middleware that serves requests bearing a session token a Validator accepts, with its username in their context
+// Missing and rejected tokens return a 4XX status, and tokens that couldn't be checked return a 5XX status, without calling the wrapped handler
+func RequireSession(v Validator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				writeUnauthorized(w)
+				return
+			}
+
+			username, err := v.ValidateSession(req.Context(), token)
+			switch {
+			case errors.Is(err, protocol.ErrInvalidSession):
+				writeUnauthorized(w)
+				return
+			case err != nil:
+				writeError(w, errUnavailable, http.StatusServiceUnavailable)
+				return
+			}
+
+			next.ServeHTTP(w, req.WithContext(WithUsername(req.Context(), username)))
+		})
+	}
+}
+
+// WithScopes returns a context carrying the scopes of a validated API key
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// Scopes returns the scopes of the API key a request was validated with, and whether it was
+func Scopes(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(scopesKey{}).([]string)
+	return scopes, ok
+}
+
+// RequireAPIKey returns middleware that serves requests bearing an API key an APIKeyValidator accepts, which grants every one of a set of scopes,
+// with its username and scopes in their context
+// Missing and rejected keys, and keys without a scope, return a 4XX status, and keys that couldn't be checked return a 5XX status,
+// without calling the wrapped handler
+func RequireAPIKey(v APIKeyValidator, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			key, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if !ok || !strings.HasPrefix(key, protocol.APIKeyPrefix) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, protocol.ErrInvalidAPIKey, http.StatusUnauthorized)
+				return
+			}
+
+			username, granted, err := v.ValidateAPIKey(req.Context(), key)
+			switch {
+			case errors.Is(err, protocol.ErrInvalidAPIKey):
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, protocol.ErrInvalidAPIKey, http.StatusUnauthorized)
+				return
+			case err != nil:
+				writeError(w, errUnavailable, http.StatusServiceUnavailable)
+				return
+			}
+
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+					writeError(w, fmt.Errorf("%w: %s", protocol.ErrInsufficientScope, scope), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, req.WithContext(WithScopes(WithUsername(req.Context(), username), granted)))
+		})
+	}
+}
+
+// writeUnauthorized writes the error response for a request without a valid session token
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+}
+
+// writeError writes an ErrorResponse for an error with a status, as the server does
+func writeError(w http.ResponseWriter, err error, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&protocol.ErrorResponse{
+		Code:      protocol.ErrorCode(err, status),
+		Message:   err.Error(),
+		Versioned: protocol.Versioned{Version: protocol.Version},
+	})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+// SchemaVersion is the version of the User record format that snapshots and archives are written in
+// Adding a field to User that older records lack, or changing what a field means, adds a migration and increments it
+const SchemaVersion = 8
+
+var ErrUnsupportedSchema = errors.New("unsupported user schema version")
+
+type (
+	// record is a stored User whose fields haven't been decoded, so migrations can change them before they are
+	record map[string]json.RawMessage
+
+	// migration upgrades a record by one schema version
+	migration func(r record) error
+)
+
+// migrations upgrade records from the schema version at their index to the next
+var migrations = [SchemaVersion]migration{
+	migrateHasherName,
+	migrateSealed,
+	migratePepper,
+	migratePasskeys,
+	migrateEmail,
+	migratePasswordReset,
+	migrateRecovery,
+	migrateSecretParams,
+}
+
+// migrateHasherName upgrades unversioned records, which name the legacy FNV hasher with an empty Hasher, to name it explicitly
+func migrateHasherName(r record) error {
+	var name string
+	if raw, ok := r["Hasher"]; ok {
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return err
+		}
+	}
+	if name != "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(fnvHasherName)
+	r["Hasher"] = raw
+	return err
+}
+
+// migrateSealed upgrades records from before SealedStores, which have no Sealed field and so are unsealed as they are
+// Servers that predate it refuse sealed records, rather than reading them as users without secrets
+func migrateSealed(r record) error {
+	return nil
+}
+
+// migratePepper upgrades records from before peppers, which have no Pepper field and so were hashed without one
+func migratePepper(r record) error {
+	return nil
+}
+
+// migratePasskeys upgrades records from before passkeys, which have no Passkeys field and so log in with their password alone
+func migratePasskeys(r record) error {
+	return nil
+}
+
+// migrateEmail upgrades records from before email verification, which have no Verification field and so are active
+func migrateEmail(r record) error {
+	return nil
+}
+
+// migratePasswordReset upgrades records from before password resets, which have no PasswordReset field and so have none pending
+func migratePasswordReset(r record) error {
+	return nil
+}
+
+// migrateRecovery upgrades records from before recovery secrets, which have no Recovery field and so have none
+func migrateRecovery(r record) error {
+	return nil
+}
+
+// migrateSecretParams upgrades records from before secret lengths and security levels were recorded, measuring them from the encrypted secret
+// Sealed records hide it, and are measured when they're opened instead
+func migrateSecretParams(r record) error {
+	var encryptedSecret gates.Ctxt
+	if raw, ok := r["EncryptedSecret"]; ok {
+		if err := json.Unmarshal(raw, &encryptedSecret); err != nil {
+			return err
+		}
+	}
+	if len(encryptedSecret) == 0 {
+		return nil
+	}
+
+	secretByteLen, err := json.Marshal(len(encryptedSecret) / 16)
+	if err != nil {
+		return err
+	}
+	securityLevel, err := json.Marshal(crypto.CtxtSecurityLevel(encryptedSecret))
+	if err != nil {
+		return err
+	}
+
+	r["SecretByteLen"], r["SecurityLevel"] = secretByteLen, securityLevel
+	return nil
+}
+
+// MigrateUser decodes a User stored in an earlier or the current schema version, upgrading it to the current version
+// Versions newer than SchemaVersion return ErrUnsupportedSchema rather than dropping fields this version doesn't know
+func MigrateUser(version int, data []byte) (User, error) {
+	if version < 0 || version > SchemaVersion {
+		return User{}, fmt.Errorf("%w: %d", ErrUnsupportedSchema, version)
+	}
+
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return User{}, err
+	}
+	for ; version < SchemaVersion; version++ {
+		if err := migrations[version](r); err != nil {
+			return User{}, fmt.Errorf("migrating user schema version %d: %w", version, err)
+		}
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return User{}, err
+	}
+
+	var user User
+	return user, json.Unmarshal(data, &user)
+}
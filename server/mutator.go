@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// mirroredMutatorName, padMutatorName, and additiveMutatorName name the Mutators ParseMutator returns
+	mirroredMutatorName = "mirrored"
+	padMutatorName      = "pad"
+	additiveMutatorName = "additive"
+)
+
+var (
+	ErrUnknownMutator = errors.New("unknown challenge mutator")
+	errNoAdder        = errors.New("scheme can't add encrypted integers")
+)
+
+type (
+	// Mutator constructs login challenges from a user's encrypted secret under the Scheme of their public key, without knowing the secret
+	// A challenge's halves must XOR to the XOR of the stored payload's halves, which is the secret, so clients solve every Mutator's challenges alike,
+	// while each login's challenge is freshly randomized, and the challenge type a Mutator reports is what clients pin against downgrades
+	Mutator interface {
+		// Mutate returns a Mutation of an encrypted payload of two halves
+		// It stops early with the context's error once the context is done
+		Mutate(ctx context.Context, entropy crypto.EntropySource, scheme crypto.Scheme, encryptedPayload gates.Ctxt) (Mutation, error)
+		// ChallengeType returns the protocol challenge type logins report for the Mutator's challenges
+		ChallengeType() string
+	}
+
+	// Mutation computes the bits of a challenge from a start to an end bit, so challenges can be sent a chunk at a time as they are computed
+	Mutation func(start, end int) gates.Ctxt
+
+	// MirroredMutator is the Mutator that negates or copies each pair of bits of the stored payload, a bit of either half at the same index,
+	// by an independent random decision, so every bit of the challenge depends on its bit of the stored payload
+	MirroredMutator struct{}
+
+	// PadMutator is the Mutator that XORs the stored payload with a random pad repeated in both halves
+	PadMutator struct{}
+
+	// AdditiveMutator is the Mutator that adds a random integer to the first half of the stored payload,
+	// and XORs both halves with the bits the addition changed, so the challenge's first half is the sum
+	// Its Schemes must add encrypted integers, as Packets and PlaintextSchemes do
+	AdditiveMutator struct{}
+
+	// adder is a Scheme that adds encrypted integers
+	adder interface {
+		Add(a, b gates.Ctxt) gates.Ctxt
+	}
+)
+
+// ParseMutator returns the Mutator a name identifies: mirrored, pad, or additive
+func ParseMutator(name string) (Mutator, error) {
+	switch name {
+	case mirroredMutatorName:
+		return MirroredMutator{}, nil
+	case padMutatorName:
+		return PadMutator{}, nil
+	case additiveMutatorName:
+		return AdditiveMutator{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMutator, name)
+	}
+}
+
+// Mutate returns a Mutation negating or copying each pair of bits of an encrypted payload by random bits
+func (MirroredMutator) Mutate(ctx context.Context, entropy crypto.EntropySource, scheme crypto.Scheme, encryptedPayload gates.Ctxt) (Mutation, error) {
+	half := len(encryptedPayload) / 2
+	negated, err := randomBits(entropy, half)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme = scheme.WithContext(ctx)
+	return func(start, end int) gates.Ctxt {
+		chunk := make(gates.Ctxt, 0, end-start)
+		for i := start; i < end; i++ {
+			f := scheme.Copy
+			if negated[i%half] {
+				f = scheme.Not
+			}
+
+			chunk = append(chunk, f(encryptedPayload[i:i+1])...)
+		}
+
+		return chunk
+	}, ctx.Err()
+}
+
+// ChallengeType returns protocol.ChallengeTypeMirroredXor
+func (MirroredMutator) ChallengeType() string {
+	return protocol.ChallengeTypeMirroredXor
+}
+
+// Mutate returns a Mutation XORing an encrypted payload with a random pad repeated in both halves
+func (PadMutator) Mutate(ctx context.Context, entropy crypto.EntropySource, scheme crypto.Scheme, encryptedPayload gates.Ctxt) (Mutation, error) {
+	pad, err := randomBits(entropy, len(encryptedPayload)/2)
+	if err != nil {
+		return nil, err
+	}
+
+	return xorMutation(scheme.WithContext(ctx), scheme.Constant(append(pad, pad...)), encryptedPayload), ctx.Err()
+}
+
+// ChallengeType returns protocol.ChallengeTypePadXor
+func (PadMutator) ChallengeType() string {
+	return protocol.ChallengeTypePadXor
+}
+
+// Mutate returns a Mutation XORing both halves of an encrypted payload with the bits adding a random integer to its first half changes
+func (AdditiveMutator) Mutate(ctx context.Context, entropy crypto.EntropySource, scheme crypto.Scheme, encryptedPayload gates.Ctxt) (Mutation, error) {
+	scheme = scheme.WithContext(ctx)
+	adder, ok := scheme.(adder)
+	if !ok {
+		return nil, errNoAdder
+	}
+
+	half := len(encryptedPayload) / 2
+	addend, err := randomBits(entropy, half)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := scheme.Xor(encryptedPayload[:half], adder.Add(encryptedPayload[:half], scheme.Constant(addend))[:half])
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return xorMutation(scheme, append(changed, changed...), encryptedPayload), nil
+}
+
+// ChallengeType returns protocol.ChallengeTypeAdditiveXor
+func (AdditiveMutator) ChallengeType() string {
+	return protocol.ChallengeTypeAdditiveXor
+}
+
+// xorMutation returns a Mutation XORing an encrypted payload with an encrypted mutation a chunk at a time
+func xorMutation(scheme crypto.Scheme, mutation, encryptedPayload gates.Ctxt) Mutation {
+	return func(start, end int) gates.Ctxt {
+		return scheme.Xor(encryptedPayload[start:end], mutation[start:end])
+	}
+}
+
+// randomBits returns a number of random bits from an entropy source, drawn a byte at a time, least significant bit first
+func randomBits(entropy crypto.EntropySource, bits int) ([]bool, error) {
+	randByteStream, err := crypto.MakeEntropyByteStream(entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	randBytes := randByteStream.NextBytes((bits + 7) / 8)
+	random := make([]bool, bits)
+	for i := range random {
+		random[i] = randBytes[i/8]>>(i%8)&1 == 1
+	}
+
+	return random, nil
+}
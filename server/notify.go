@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// EventLogInSucceeded is sent when a user is issued a session by a login
+	EventLogInSucceeded EventType = "login.succeeded"
+	// EventLogInFailed is sent when a user's login proves the wrong secret or passkey
+	EventLogInFailed EventType = "login.failed"
+	// EventLockout is sent when a user is refused further logins for a while, such as over their recovery rate limit
+	EventLockout EventType = "lockout"
+	// EventPasswordChanged is sent when a user's password is changed or reset
+	EventPasswordChanged EventType = "password.changed"
+	// EventSecretRotated is sent when a user's secret is replaced by a new enrollment under the same password
+	EventSecretRotated EventType = "secret.rotated"
+	// EventUserErased is sent when a user is deleted at their request, the tombstone that tells downstream systems to drop their records of the user
+	EventUserErased EventType = "user.erased"
+	// EventAccountEnabled, EventAccountDisabled, and EventAccountDeleted are sent when an admin changes a user's account to active, disabled, or deleted
+	EventAccountEnabled  EventType = "account.enabled"
+	EventAccountDisabled EventType = "account.disabled"
+	EventAccountDeleted  EventType = "account.deleted"
+
+	// WebhookSignatureHeader is the header holding the hex HMAC-SHA256 of a webhook's timestamp, a period, and its body
+	WebhookSignatureHeader = "X-Hauth-Signature"
+	// WebhookTimestampHeader is the header holding the unix time a webhook was signed at, so receivers can reject replays
+	WebhookTimestampHeader = "X-Hauth-Timestamp"
+
+	// notifyTimeout bounds how long a Notifier has to deliver an event, including its retries
+	notifyTimeout = time.Minute
+	// defaultWebhookBackoff is the delay before a webhook's first retry, which doubles with each one after
+	defaultWebhookBackoff = time.Second
+)
+
+type (
+	// EventType names an auth event
+	EventType string
+
+	// Event is an auth event about a user, and whether it came from a recovery login
+	Event struct {
+		Type     EventType `json:"type"`
+		Username string    `json:"username"`
+		Recovery bool      `json:"recovery,omitempty"`
+		Time     time.Time `json:"time"`
+	}
+
+	// Notifier is told of auth events, such as logins, so downstream systems can react to them
+	Notifier interface {
+		// Notify delivers an event, unless the context is done first
+		Notify(ctx context.Context, event Event) error
+	}
+
+	// WebhookNotifier is a Notifier that posts each event as JSON to a URL, signed with a secret, with an HTTP client that defaults to http.DefaultClient
+	// Failed deliveries, including 5XX and 429 statuses, are retried a number of times, with a backoff that doubles after each
+	WebhookNotifier struct {
+		URL     string
+		Secret  []byte
+		Client  *http.Client
+		Retries int
+		Backoff time.Duration
+	}
+)
+
+// SignWebhook returns the hex HMAC-SHA256 of a webhook's timestamp and body under a secret, which receivers compare to WebhookSignatureHeader
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify posts an event to a WebhookNotifier's URL until it is accepted with a 2XX status, its retries run out, or the context is done
+func (wn *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+
+	backoff := wn.Backoff
+	if backoff <= 0 {
+		backoff = defaultWebhookBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := wn.post(ctx, body)
+		if err == nil || !retry || attempt >= wn.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff << attempt):
+		}
+	}
+}
+
+// post posts a signed body to a WebhookNotifier's URL once, returning whether a failure may succeed if retried
+func (wn *WebhookNotifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(wn.Secret, timestamp, body))
+
+	client := wn.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return false, nil
+}
+
+// notify sends an event about a user to the server's Notifier in the background, if it has one, passing failures to its error handler
+func (s *Server) notify(eventType EventType, username string, recovery bool) {
+	if s.notifier == nil {
+		return
+	}
+
+	event := Event{
+		Type:     eventType,
+		Username: username,
+		Recovery: recovery,
+		Time:     time.Now().UTC(),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		if err := s.notifier.Notify(ctx, event); err != nil && s.onNotifyError != nil {
+			s.onNotifyError(err)
+		}
+	}()
+}
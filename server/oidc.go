@@ -0,0 +1,578 @@
+package server
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// oidcCodeTTL is how long an authorization code can be exchanged after it is issued
+	oidcCodeTTL = time.Minute
+	// oidcTokenTTL is how long ID tokens and access tokens are valid after they are issued
+	oidcTokenTTL = 15 * time.Minute
+	// oidcTokenByteLen is the length of authorization codes, access tokens, and client secrets before encoding
+	oidcTokenByteLen = 32
+	// oidcClientIDByteLen is the length of a registered client's id before encoding
+	oidcClientIDByteLen = 16
+)
+
+var (
+	errUnknownOIDCClient = errors.New("unknown oidc client or redirect uri")
+	errInvalidRedirect   = errors.New("redirect uris are absolute urls without fragments")
+	errOIDCRecovery      = errors.New("recovery sessions can't authorize apps")
+)
+
+type (
+	// OIDCProvider is the OpenID Connect provider a server fronts its logins with, so apps can log users in through it with the authorization code flow
+	// Users authorize an app with the session of a login, signed ID tokens carry their username as the subject, and apps are registered by admins
+	OIDCProvider struct {
+		issuer       string
+		loginURL     string
+		key          *rsa.PrivateKey
+		keyID        string
+		clients      map[string]oidcClient
+		codes        map[string]oidcGrant
+		accessTokens map[string]oidcGrant
+		mu           sync.Mutex
+	}
+
+	// oidcClient is an app registered with an OIDCProvider, with the SHA-256 of its secret and the redirect URIs codes may be sent to
+	oidcClient struct {
+		name         string
+		secretHash   []byte
+		redirectURIs []string
+	}
+
+	// oidcGrant is a user's authorization of an app, held by an authorization code until it is exchanged, and by an access token after
+	oidcGrant struct {
+		clientID      string
+		redirectURI   string
+		username      string
+		scope         string
+		nonce         string
+		codeChallenge string
+		authTime      time.Time
+		expiresAt     time.Time
+	}
+)
+
+// NewOIDCProvider returns an OIDCProvider for the issuer URL the server is reached at, which signs ID tokens with an RSA key,
+// and sends users without a session to a login page at loginURL, where empty refuses their authorizations with login_required
+// The login page logs the user in, then posts the authorization request's parameters to protocol.OIDCAuthorizePath with its session
+func NewOIDCProvider(issuer, loginURL string, key *rsa.PrivateKey) (*OIDCProvider, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID := sha256.Sum256(publicKey)
+
+	return &OIDCProvider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		loginURL:     loginURL,
+		key:          key,
+		keyID:        base64.RawURLEncoding.EncodeToString(keyID[:12]),
+		clients:      map[string]oidcClient{},
+		codes:        map[string]oidcGrant{},
+		accessTokens: map[string]oidcGrant{},
+	}, nil
+}
+
+// validRedirectURI returns whether a redirect URI is an absolute URL without a fragment
+func validRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	return err == nil && u.IsAbs() && u.Fragment == ""
+}
+
+// AddClient registers an app with a client id and secret of its own, such as ones from the configuration, and the redirect URIs codes may be sent to
+func (op *OIDCProvider) AddClient(id, secret, name string, redirectURIs []string) error {
+	if len(redirectURIs) == 0 || slices.ContainsFunc(redirectURIs, func(redirectURI string) bool { return !validRedirectURI(redirectURI) }) {
+		return errInvalidRedirect
+	}
+
+	secretHash := sha256.Sum256([]byte(secret))
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.clients[id] = oidcClient{name: name, secretHash: secretHash[:], redirectURIs: slices.Clone(redirectURIs)}
+	return nil
+}
+
+// registerClient registers an app with a random client id and secret, returning them
+func (op *OIDCProvider) registerClient(entropy io.Reader, name string, redirectURIs []string) (string, string, error) {
+	id, err := randomToken(entropy, oidcClientIDByteLen)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := randomToken(entropy, oidcTokenByteLen)
+	if err != nil {
+		return "", "", err
+	}
+
+	return id, secret, op.AddClient(id, secret, name, redirectURIs)
+}
+
+// randomToken returns a number of bytes from an entropy source, encoded in unpadded URL safe base64
+func randomToken(entropy io.Reader, byteLen int) (string, error) {
+	token := make([]byte, byteLen)
+	if _, err := io.ReadFull(entropy, token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// validRedirect returns whether a client exists and may be sent codes at a redirect URI
+func (op *OIDCProvider) validRedirect(clientID, redirectURI string) bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	client, ok := op.clients[clientID]
+	return ok && slices.Contains(client.redirectURIs, redirectURI)
+}
+
+// authenticate returns whether a client's secret is the one it was registered with
+func (op *OIDCProvider) authenticate(clientID, secret string) bool {
+	op.mu.Lock()
+	client, ok := op.clients[clientID]
+	op.mu.Unlock()
+
+	secretHash := sha256.Sum256([]byte(secret))
+	return ok && subtle.ConstantTimeCompare(secretHash[:], client.secretHash) == 1
+}
+
+// clientCredentials returns the client id and secret a posted request authenticates with, by HTTP basic authentication or in its form,
+// and whether it used basic authentication
+func clientCredentials(req *http.Request) (string, string, bool) {
+	clientID, secret, basic := req.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+
+	return clientID, secret, basic
+}
+
+// grant stores a grant in one of an OIDCProvider's maps under a random token, returning the token
+func (op *OIDCProvider) grant(entropy io.Reader, grants map[string]oidcGrant, g oidcGrant, ttl time.Duration) (string, error) {
+	token, err := randomToken(entropy, oidcTokenByteLen)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	g.expiresAt = now.Add(ttl)
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	for t, expired := range grants {
+		if now.After(expired.expiresAt) {
+			delete(grants, t)
+		}
+	}
+	grants[token] = g
+	return token, nil
+}
+
+// takeCode removes and returns the unexpired grant of an authorization code, so each is exchanged at most once
+func (op *OIDCProvider) takeCode(code string) (oidcGrant, bool) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	g, ok := op.codes[code]
+	delete(op.codes, code)
+	return g, ok && time.Now().Before(g.expiresAt)
+}
+
+// lookupAccessToken returns the unexpired grant of an access token
+func (op *OIDCProvider) lookupAccessToken(token string) (oidcGrant, bool) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	g, ok := op.accessTokens[token]
+	return g, ok && time.Now().Before(g.expiresAt)
+}
+
+// revokeAccessToken deletes an access token, if it was issued to a client, where an empty client id is any client
+func (op *OIDCProvider) revokeAccessToken(token, clientID string) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if g, ok := op.accessTokens[token]; ok && (clientID == "" || g.clientID == clientID) {
+		delete(op.accessTokens, token)
+	}
+}
+
+// hasScope returns whether a space separated scope includes a value
+func hasScope(scope, value string) bool {
+	return slices.Contains(strings.Fields(scope), value)
+}
+
+// userClaims returns the claims about a user that a grant's scope allows, where email addresses are verified if the server verifies them,
+// and their roles and custom claims, whatever the scope
+func (s *Server) userClaims(ctx context.Context, user User, scope string) (protocol.OIDCUserInfo, error) {
+	claims := protocol.OIDCUserInfo{Subject: user.Username}
+	if hasScope(scope, "profile") {
+		claims.PreferredUsername = user.Username
+	}
+	if hasScope(scope, "email") && user.Email != "" {
+		verified := s.mailer != nil && user.Verification == nil
+		claims.Email, claims.EmailVerified = user.Email, &verified
+	}
+
+	var err error
+	claims.Roles, claims.Claims, err = s.customClaims(ctx, user)
+	return claims, err
+}
+
+// idToken returns the signed ID token of a grant for its user
+func (op *OIDCProvider) idToken(g oidcGrant, claims protocol.OIDCUserInfo) (string, error) {
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":       op.issuer,
+		"sub":       claims.Subject,
+		"aud":       g.clientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(oidcTokenTTL).Unix(),
+		"auth_time": g.authTime.Unix(),
+	}
+	if g.nonce != "" {
+		idClaims["nonce"] = g.nonce
+	}
+	if claims.PreferredUsername != "" {
+		idClaims["preferred_username"] = claims.PreferredUsername
+	}
+	if claims.Email != "" {
+		idClaims["email"], idClaims["email_verified"] = claims.Email, *claims.EmailVerified
+	}
+	if len(claims.Roles) > 0 {
+		idClaims["roles"] = claims.Roles
+	}
+	for name, value := range claims.Claims {
+		if _, ok := idClaims[name]; !ok {
+			idClaims[name] = value
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	token.Header["kid"] = op.keyID
+	return token.SignedString(op.key)
+}
+
+// writeOIDCError writes an error as OAuth 2.0 formats it with a status
+func writeOIDCError(w http.ResponseWriter, code, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&protocol.OIDCError{Error: code, ErrorDescription: description})
+}
+
+// OIDCDiscoveryHandler handles requests for the OpenID Connect provider's metadata, returning it with a 2XX status
+func (s *Server) OIDCDiscoveryHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&protocol.OIDCDiscovery{
+		Issuer:                            s.oidc.issuer,
+		AuthorizationEndpoint:             s.oidc.issuer + protocol.OIDCAuthorizePath,
+		TokenEndpoint:                     s.oidc.issuer + protocol.OIDCTokenPath,
+		UserInfoEndpoint:                  s.oidc.issuer + protocol.OIDCUserInfoPath,
+		JWKSURI:                           s.oidc.issuer + protocol.OIDCJWKSPath,
+		RegistrationEndpoint:              s.oidc.issuer + protocol.OIDCRegisterPath,
+		IntrospectionEndpoint:             s.oidc.issuer + protocol.IntrospectPath,
+		RevocationEndpoint:                s.oidc.issuer + protocol.RevokePath,
+		ScopesSupported:                   []string{"openid", "profile", "email"},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "email", "email_verified", "roles"},
+	})
+}
+
+// OIDCJWKSHandler handles requests for the keys ID tokens are signed with, returning them with a 2XX status
+func (s *Server) OIDCJWKSHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&protocol.JWKS{Keys: []protocol.JWK{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		KeyID:     s.oidc.keyID,
+		Modulus:   base64.RawURLEncoding.EncodeToString(s.oidc.key.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.oidc.key.E)).Bytes()),
+	}}})
+}
+
+// OIDCAuthorizeHandler handles authorization code requests, from a user's browser, or posted by a client with the session of a login
+// Requests with an unexpired session redirect the user to the app's redirect URI with a code, or return that URI with a 2XX status when posted
+// Browser requests without a session are redirected to the provider's login page with the same parameters,
+// and requests the app made wrong, or that can't be authorized without a login, redirect the user to the app with an error
+// Unknown clients and redirect URIs, and posted requests without a session or with a recovery session, return a 4XX status
+// Entropy errors return a 5XX status
+func (s *Server) OIDCAuthorizeHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	params := req.Form
+	clientID, redirectURI := params.Get("client_id"), params.Get("redirect_uri")
+	if !s.oidc.validRedirect(clientID, redirectURI) {
+		writeError(w, errUnknownOIDCClient, http.StatusBadRequest)
+		return
+	}
+
+	posted := req.Method == http.MethodPost
+	respond := func(result url.Values) {
+		if state := params.Get("state"); state != "" {
+			result.Set("state", state)
+		}
+		u, _ := url.Parse(redirectURI)
+		query := u.Query()
+		for key, values := range result {
+			query[key] = values
+		}
+		u.RawQuery = query.Encode()
+
+		if posted {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(&protocol.OIDCAuthorizeResponse{RedirectURI: u.String()})
+		} else {
+			http.Redirect(w, req, u.String(), http.StatusFound)
+		}
+	}
+	fail := func(code, description string) {
+		respond(url.Values{"error": {code}, "error_description": {description}})
+	}
+
+	codeChallenge, method := params.Get("code_challenge"), params.Get("code_challenge_method")
+	switch {
+	case params.Get("response_type") != "code":
+		fail("unsupported_response_type", "only the authorization code flow is supported")
+		return
+	case !hasScope(params.Get("scope"), "openid"):
+		fail("invalid_scope", "the openid scope is required")
+		return
+	case (codeChallenge != "" || method != "") && (method != "S256" || codeChallenge == ""):
+		fail("invalid_request", "code challenges must use the S256 method")
+		return
+	}
+
+	token, _ := bearerToken(req)
+	session, status, err := s.lookupSession(token)
+	if status == http.StatusInternalServerError {
+		writeError(w, err, status)
+		return
+	}
+	ok := err == nil
+	if maxAge, err := strconv.Atoi(params.Get("max_age")); ok && err == nil && time.Since(session.AuthTime) > time.Duration(maxAge)*time.Second {
+		ok = false
+	}
+	switch {
+	case ok && session.Recovery:
+		writeError(w, errOIDCRecovery, http.StatusForbidden)
+		return
+	case !ok && posted:
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	case !ok && s.oidc.loginURL != "" && params.Get("prompt") != "none":
+		u, _ := url.Parse(s.oidc.loginURL)
+		query := u.Query()
+		for key, values := range params {
+			query[key] = values
+		}
+		u.RawQuery = query.Encode()
+		http.Redirect(w, req, u.String(), http.StatusFound)
+		return
+	case !ok:
+		fail("login_required", "the user must log in first")
+		return
+	}
+
+	code, err := s.oidc.grant(s.entropy, s.oidc.codes, oidcGrant{
+		clientID:      clientID,
+		redirectURI:   redirectURI,
+		username:      session.Username,
+		scope:         params.Get("scope"),
+		nonce:         params.Get("nonce"),
+		codeChallenge: codeChallenge,
+		authTime:      session.AuthTime,
+	}, oidcCodeTTL)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(url.Values{"code": {code}})
+}
+
+// OIDCTokenHandler handles requests from apps, authenticated with their client secret, to exchange an authorization code for an ID token and an access token
+// Valid codes return the tokens with a 2XX status
+// Unauthenticated clients, unsupported grant types, and unknown, expired, or mismatched codes and code verifiers return a 4XX status
+// Store, signing, and entropy errors return a 5XX status
+func (s *Server) OIDCTokenHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeOIDCError(w, "invalid_request", "token requests are posted", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		writeOIDCError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientID, secret, basic := clientCredentials(req)
+	if !s.oidc.authenticate(clientID, secret) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="hauth"`)
+		}
+		writeOIDCError(w, "invalid_client", "unknown client or wrong secret", http.StatusUnauthorized)
+		return
+	}
+	if grantType := req.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		writeOIDCError(w, "unsupported_grant_type", fmt.Sprintf("grant type %q isn't supported", grantType), http.StatusBadRequest)
+		return
+	}
+
+	g, ok := s.oidc.takeCode(req.PostForm.Get("code"))
+	if !ok || g.clientID != clientID || g.redirectURI != req.PostForm.Get("redirect_uri") {
+		writeOIDCError(w, "invalid_grant", "unknown, expired, or mismatched code", http.StatusBadRequest)
+		return
+	}
+	if g.codeChallenge != "" {
+		verifierHash := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(verifierHash[:]) != g.codeChallenge {
+			writeOIDCError(w, "invalid_grant", "code verifier doesn't match the code challenge", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, err := s.users.Get(g.username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeOIDCError(w, "invalid_grant", "user no longer exists", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	} else if _, err := checkStatus(user); err != nil {
+		writeOIDCError(w, "invalid_grant", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.userClaims(req.Context(), user, g.scope)
+	if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, err := s.oidc.idToken(g, claims)
+	if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := s.oidc.grant(s.entropy, s.oidc.accessTokens, g, oidcTokenTTL)
+	if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&protocol.OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oidcTokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       g.scope,
+	})
+}
+
+// OIDCUserInfoHandler handles requests bearing an access token for the claims its scope allows about its user
+// Unexpired access tokens return the claims with a 2XX status
+// Missing, unknown, and expired access tokens return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) OIDCUserInfoHandler(w http.ResponseWriter, req *http.Request) {
+	token, _ := bearerToken(req)
+	g, ok := s.oidc.lookupAccessToken(token)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOIDCError(w, "invalid_token", "unknown or expired access token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.users.Get(g.username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeOIDCError(w, "invalid_token", "user no longer exists", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	} else if _, err := checkStatus(user); err != nil {
+		writeOIDCError(w, "invalid_token", err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := s.userClaims(req.Context(), user, g.scope)
+	if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&claims)
+}
+
+// OIDCRegisterHandler handles admin requests to register an app as a client of the OpenID Connect provider
+// Authorized requests return the app's client id and secret with a 2XX status
+// Requests without the admin token, and malformed requests and redirect URIs, return a 4XX status
+// Entropy errors return a 5XX status
+func (s *Server) OIDCRegisterHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.isAdmin(req) {
+		writeError(w, protocol.ErrNotAdmin, http.StatusUnauthorized)
+		return
+	}
+
+	var registration protocol.OIDCClientRegistration
+	if err := json.NewDecoder(req.Body).Decode(&registration); err != nil {
+		writeOIDCError(w, "invalid_client_metadata", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientID, secret, err := s.oidc.registerClient(s.entropy, registration.ClientName, registration.RedirectURIs)
+	if errors.Is(err, errInvalidRedirect) {
+		writeOIDCError(w, "invalid_redirect_uri", err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeOIDCError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var neverExpires int64
+	registration.ClientID, registration.ClientSecret = clientID, secret
+	registration.ClientIDIssuedAt, registration.ClientSecretExpiresAt = time.Now().Unix(), &neverExpires
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&registration)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto/opaque"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// opaqueNonceByteLen is the length of the random nonce each OPAQUE record's OPRF key is derived under
+const opaqueNonceByteLen = 32
+
+var (
+	errMalformedOPAQUE = errors.New("malformed opaque enrollment")
+	errOPAQUERecovery  = errors.New("opaque users can't enroll a recovery secret")
+	errOPAQUEDisabled  = errors.New("server has no opaque keys")
+	errNotOPAQUEUser   = errors.New("user doesn't log in with OPAQUE")
+)
+
+// checkOPAQUEEnrollment returns an error unless the server has OPAQUE keys, and an OPAQUE enrollment's nonce, record, and salt are well formed
+func (s *Server) checkOPAQUEEnrollment(enrollment *protocol.OPAQUEEnrollment) error {
+	if s.opaque == nil {
+		return errOPAQUEDisabled
+	} else if len(enrollment.Nonce) != opaqueNonceByteLen {
+		return fmt.Errorf("%w: nonces are %d bytes", errMalformedOPAQUE, opaqueNonceByteLen)
+	} else if err := opaque.CheckRecord(enrollment.Record); err != nil {
+		return fmt.Errorf("%w: records are %d bytes holding a public key", errMalformedOPAQUE, opaque.RecordByteLen)
+	} else if len(enrollment.Salt) != opaque.KSFSaltByteLen {
+		return fmt.Errorf("%w: salts are %d bytes", errMalformedOPAQUE, opaque.KSFSaltByteLen)
+	}
+
+	return nil
+}
+
+// OPAQUERegisterHandler handles requests to evaluate a client's blinded password under the OPRF key of a random nonce, for the record it signs up or resets a password with
+// Well formed requests return the nonce and the registration response with a 2XX status
+// Malformed requests and blinded passwords return a 4XX status
+// Entropy errors return a 5XX status
+func (s *Server) OPAQUERegisterHandler(w http.ResponseWriter, req *http.Request) {
+	var registerRequest protocol.OPAQUERegisterRequest
+	if err := json.NewDecoder(req.Body).Decode(&registerRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	nonce := make([]byte, opaqueNonceByteLen)
+	if _, err := io.ReadFull(s.entropy, nonce); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response, err := s.opaque.RegistrationResponse(string(nonce), registerRequest.Request)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &protocol.OPAQUERegisterResponse{Nonce: nonce, Response: response})
+}
+
+// OPAQUELogInBeginHandler handles requests to begin logging in a user who signed up with an OPAQUE record
+// OPAQUE users return the server's key exchange message, the salt of their record, and the id of the login to finish at OPAQUELogInFinishHandler, with a 2XX status
+// Malformed requests and key exchange messages, nonexistent and unverified users, users without an OPAQUE record, requests the RiskAssessor denies or demands step-up for,
+// and requests without a valid CAPTCHA token once their user or address has failed to log in too often return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) OPAQUELogInBeginHandler(w http.ResponseWriter, req *http.Request) {
+	var beginRequest protocol.OPAQUEBeginRequest
+	if err := json.NewDecoder(req.Body).Decode(&beginRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.users.Get(beginRequest.Username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	} else if user.SRP != nil {
+		writeError(w, protocol.ErrSRPRequired, http.StatusBadRequest)
+		return
+	} else if user.OPAQUE == nil {
+		writeError(w, errNotOPAQUEUser, http.StatusBadRequest)
+		return
+	}
+
+	firstLogInRequest := protocol.FirstLogInRequest{
+		Username:     beginRequest.Username,
+		StepUpToken:  beginRequest.StepUpToken,
+		CaptchaToken: beginRequest.CaptchaToken,
+	}
+	if status, err := s.screenLogIn(req.Context(), req.RemoteAddr, user.Username, &firstLogInRequest); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	server, ke2, err := s.opaque.NewServerLogin(s.entropy, string(user.OPAQUE.Nonce), user.OPAQUE.Record, beginRequest.KE1)
+	if errors.Is(err, opaque.ErrMalformed) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ceremonyID, err := s.ceremonies.start(s.entropy, ceremony{username: user.Username, opaque: server})
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &protocol.OPAQUEBeginResponse{CeremonyID: ceremonyID, KE2: ke2, Salt: user.OPAQUE.Salt})
+}
+
+// OPAQUELogInFinishHandler handles requests to finish an OPAQUE login with the client's final key exchange message
+// Clients that found the password wrong finish with an empty message, so the failure is counted as any other login's
+// Valid messages return a session token, or a passkey ceremony for users with passkeys, and a 2XX status
+// Malformed requests, unknown or expired logins, and invalid messages return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) OPAQUELogInFinishHandler(w http.ResponseWriter, req *http.Request) {
+	var finishRequest protocol.OPAQUEFinishRequest
+	if err := json.NewDecoder(req.Body).Decode(&finishRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	c, ok := s.ceremonies.take(finishRequest.CeremonyID)
+	if !ok || c.opaque == nil || !s.sameUser(c.username, finishRequest.Username) {
+		writeError(w, protocol.ErrUnknownChallenge, http.StatusNotFound)
+		return
+	}
+
+	if _, err := c.opaque.Finish(finishRequest.KE3); err != nil {
+		s.logInFailed(c.username, req.RemoteAddr, finishRequest.CeremonyID, false)
+		writeError(w, protocol.ErrInvalidCredentials, http.StatusForbidden)
+		return
+	}
+
+	user, err := s.users.Get(c.username)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	logInResponse, err := s.completeLogIn(user, req.RemoteAddr, finishRequest.CeremonyID, false)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.setSessionCookies(w, logInResponse)
+	writeJSON(w, http.StatusOK, logInResponse)
+}
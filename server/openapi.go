@@ -0,0 +1,461 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// openAPIVersion is the version of the OpenAPI specification documents are written in
+	openAPIVersion = "3.0.3"
+
+	contentTypeJSON   = "application/json"
+	contentTypeForm   = "application/x-www-form-urlencoded"
+	contentTypeBinary = "application/octet-stream"
+)
+
+type (
+	// route documents an endpoint in a Server's OpenAPI document
+	// Requests and responses are described by the schema of a value's type, where nil means there is no body
+	route struct {
+		path            string
+		method          string
+		summary         string
+		auth            string
+		authOptional    bool
+		request         any
+		requestType     string
+		response        any
+		responseType    string
+		status          int
+		parameters      []any
+		served          func(s *Server) bool
+		noErrorResponse bool
+	}
+
+	// schemaBuilder builds the JSON schemas of the types messages are encoded from, collecting those of named structs as components
+	schemaBuilder struct {
+		components map[string]any
+	}
+
+	// jsonField is a field of a struct's JSON encoding
+	jsonField struct {
+		name     string
+		typ      reflect.Type
+		required bool
+		depth    int
+	}
+
+	// jsonTyper is implemented by types with custom JSON encodings, returning a value of the type they are encoded as
+	jsonTyper interface {
+		JSONType() any
+	}
+
+	// oidcAuthorizeParams are the query parameters, or posted form, of an OpenID Connect authorization request
+	oidcAuthorizeParams struct {
+		ClientID            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		ResponseType        string `json:"response_type"`
+		Scope               string `json:"scope"`
+		State               string `json:"state,omitempty"`
+		Nonce               string `json:"nonce,omitempty"`
+		Prompt              string `json:"prompt,omitempty"`
+		MaxAge              string `json:"max_age,omitempty"`
+		CodeChallenge       string `json:"code_challenge,omitempty"`
+		CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+	}
+
+	// verifyEmailQuery is the query of the link mailed to verify an email address
+	verifyEmailQuery struct {
+		Username string `json:"username"`
+		Token    string `json:"token"`
+	}
+
+	// usernameQuery is the query of an admin request about a user, such as for their login attempts or account status
+	usernameQuery struct {
+		Username string `json:"username"`
+	}
+
+	// tokenForm is the posted form of an introspection or revocation request, whose caller authenticates with the admin token as a bearer token,
+	// or as an OIDC client as a token request does
+	tokenForm struct {
+		Token         string `json:"token"`
+		TokenTypeHint string `json:"token_type_hint,omitempty"`
+		ClientID      string `json:"client_id,omitempty"`
+		ClientSecret  string `json:"client_secret,omitempty"`
+	}
+
+	// oidcTokenForm is the posted form of an OpenID Connect token request, whose client may authenticate with HTTP basic authentication instead
+	oidcTokenForm struct {
+		GrantType    string `json:"grant_type"`
+		Code         string `json:"code"`
+		RedirectURI  string `json:"redirect_uri"`
+		CodeVerifier string `json:"code_verifier,omitempty"`
+		ClientID     string `json:"client_id,omitempty"`
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	jsonTyperType  = reflect.TypeOf((*jsonTyper)(nil)).Elem()
+
+	// schemaDescriptions describe the components whose encodings aren't evident from their fields
+	schemaDescriptions = map[string]string{
+		"core.LweSample": "One encrypted bit. Encrypted payloads, such as encrypted secrets, challenges, and circuit inputs and outputs, are arrays of them, a bit at a time, " +
+			"whose masks A all have the dimension of their parameter set, 500 at 80 bits of security and 630 at 128, and B is the sample's body, " +
+			"both as 32 bit torus values",
+		"crypto.PublicKey": "A TFHE public key: its parameter set and its bootstrapping and key-switching keys, in the coefficient and Lagrange half complex domains, " +
+			"whose dimensions must match the parameter set's exactly. Keys of the plaintext test scheme only name their Scheme and KeyID",
+		"crypto._lagrangeHalfCPolynomial": "A polynomial in the Lagrange half complex domain, with half as many complex coefficients as its parameter set's degree",
+		"crypto.KDFParams":                "The Argon2id parameters that stretch a password into the seed of its keys",
+	}
+
+	// routes document every endpoint a Server can serve, and which of them it does
+	routes = []route{
+		{path: "/sign-up", method: http.MethodPut, summary: "Sign up a user with an encrypted secret, an SRP verifier, or an OPAQUE record",
+			request: protocol.SignUpRequest{}, parameters: []any{headerParameter(protocol.IdempotencyKeyHeader, "A key unique to the request, whose retries return the outcome of its first success")}},
+		{path: "/kdf", method: http.MethodPost, summary: "Get the parameters that stretch a user's password or recovery phrase",
+			request: protocol.KDFRequest{}, response: crypto.KDFParams{}},
+		{path: "/login-1", method: http.MethodPost, summary: "Start logging in, returning a challenge under the request's public key, or a pending challenge with a 202 status for asynchronous requests",
+			request: protocol.FirstLogInRequest{}, response: protocol.FirstLogInResponse{}},
+		{path: protocol.ChallengeResultPath + "{challengeID}", method: http.MethodGet, summary: "Poll for the challenge of an asynchronous first login request, which returns a pending challenge with a 202 status until it is computed",
+			response: protocol.FirstLogInResponse{}, parameters: []any{pathParameter("challengeID", "The id of the pending challenge")}},
+		{path: protocol.LogInWebSocketPath, method: http.MethodGet, summary: "Log in over a WebSocket, whose client sends a first and then a second login request, and whose server sends login stream messages",
+			response: protocol.LogInStreamMessage{}, status: http.StatusSwitchingProtocols},
+		{path: "/login-2", method: http.MethodPost, summary: "Finish logging in by answering a challenge",
+			request: protocol.SecondLogInRequest{}, response: protocol.LogInResponse{}},
+		{path: "/refresh", method: http.MethodPost, summary: "Exchange a session for a new one", auth: "bearer",
+			response: protocol.LogInResponse{}},
+		{path: "/whoami", method: http.MethodGet, summary: "Get the user of a session", auth: "bearer",
+			response: protocol.WhoAmIResponse{}},
+		{path: protocol.ProfilePath, method: http.MethodGet, summary: "Get the profile of a session's user", auth: "bearer",
+			response: protocol.ProfileResponse{}},
+		{path: protocol.LogInHistoryPath, method: http.MethodGet, summary: "List the recent login attempts of a session's user", auth: "bearer",
+			response: protocol.LogInHistoryResponse{}},
+		{path: protocol.ExportDataPath, method: http.MethodGet, summary: "Export everything held about a session's user", auth: "bearer",
+			response: protocol.DataExport{}},
+		{path: protocol.EraseAccountPath, method: http.MethodPost, summary: "Delete a session's user, who logged in recently, and everything held about them", auth: "bearer",
+			request: protocol.EraseAccountRequest{}, response: protocol.EraseAccountResponse{}},
+		{path: protocol.SessionsPath, method: http.MethodGet, summary: "List the active sessions of a session's user", auth: "bearer",
+			response: protocol.SessionsResponse{}},
+		{path: protocol.RevokeSessionPath, method: http.MethodPost, summary: "Revoke one of a session's user's sessions", auth: "bearer",
+			request: protocol.RevokeSessionRequest{}},
+		{path: "/change-password", method: http.MethodPost, summary: "Re-key a user's encrypted secret to a new password",
+			request: protocol.ChangePasswordRequest{}},
+		{path: protocol.RotateSecretPath, method: http.MethodPost, summary: "Replace a session's user's secret with a new enrollment under their password", auth: "bearer",
+			request: protocol.RotateSecretRequest{}},
+		{path: "/evaluate", method: http.MethodPost, summary: "Evaluate a crypto/circuit Circuit against a session's user's encrypted secret", auth: "bearer",
+			request: protocol.EvaluateRequest{}, response: protocol.EvaluateResponse{}},
+		{path: protocol.SRPLogInBeginPath, method: http.MethodPost, summary: "Begin logging in a user who signed up with an SRP verifier",
+			request: protocol.SRPBeginRequest{}, response: protocol.SRPBeginResponse{}},
+		{path: protocol.SRPLogInFinishPath, method: http.MethodPost, summary: "Finish an SRP login",
+			request: protocol.SRPFinishRequest{}, response: protocol.SRPFinishResponse{}},
+		{path: protocol.ServerKeyPath, method: http.MethodGet, summary: "Get the Ed25519 public key login challenges are signed with",
+			response: protocol.ServerKeyResponse{}, served: func(s *Server) bool { return s.signingKey != nil }},
+		{path: protocol.ExportPath, method: http.MethodGet, summary: "Export every user in an archive encrypted with a passphrase", auth: "bearer",
+			response: []byte(nil), responseType: contentTypeBinary, served: func(s *Server) bool { return s.adminToken != "" },
+			parameters: []any{headerParameter(protocol.ArchivePassphraseHeader, "The passphrase the archive is encrypted with")}},
+		{path: protocol.ImportPath, method: http.MethodPost, summary: "Create the users in an archive encrypted with a passphrase", auth: "bearer",
+			request: []byte(nil), requestType: contentTypeBinary, response: protocol.ImportResponse{}, served: func(s *Server) bool { return s.adminToken != "" },
+			parameters: []any{headerParameter(protocol.ArchivePassphraseHeader, "The passphrase the archive is encrypted with")}},
+		{path: protocol.AdminLogInHistoryPath, method: http.MethodGet, summary: "List the recent login attempts of a user", auth: "bearer",
+			response: protocol.LogInHistoryResponse{}, served: func(s *Server) bool { return s.adminToken != "" },
+			parameters: queryParameters(usernameQuery{})},
+		{path: protocol.AccountStatusPath, method: http.MethodGet, summary: "Get the status of a user's account", auth: "bearer",
+			response: protocol.AccountStatusResponse{}, served: func(s *Server) bool { return s.adminToken != "" },
+			parameters: queryParameters(usernameQuery{})},
+		{path: protocol.AccountStatusPath, method: http.MethodPost, summary: "Change the status of a user's account to active, disabled, or deleted", auth: "bearer",
+			request: protocol.AccountStatusRequest{}, response: protocol.AccountStatusResponse{}, served: func(s *Server) bool { return s.adminToken != "" }},
+		{path: protocol.UserClaimsPath, method: http.MethodGet, summary: "Get the roles and custom claims of a user", auth: "bearer",
+			response: protocol.UserClaims{}, served: func(s *Server) bool { return s.adminToken != "" },
+			parameters: queryParameters(usernameQuery{})},
+		{path: protocol.UserClaimsPath, method: http.MethodPost, summary: "Replace the roles and custom claims of a user, which the tokens issued for them carry", auth: "bearer",
+			request: protocol.UserClaims{}, response: protocol.UserClaims{}, served: func(s *Server) bool { return s.adminToken != "" }},
+		{path: protocol.VerifyEmailPath, method: http.MethodGet, summary: "Verify a user's email address from the link mailed to it",
+			parameters: queryParameters(verifyEmailQuery{}), served: func(s *Server) bool { return s.mailer != nil }},
+		{path: protocol.VerifyEmailPath, method: http.MethodPost, summary: "Verify a user's email address with the token mailed to it, or mail a fresh one with a 202 status when the token is empty",
+			request: protocol.VerifyEmailRequest{}, served: func(s *Server) bool { return s.mailer != nil }},
+		{path: protocol.ResetPasswordBeginPath, method: http.MethodPost, summary: "Mail a user a token that resets their password",
+			request: protocol.ResetPasswordBeginRequest{}, status: http.StatusAccepted, served: func(s *Server) bool { return s.mailer != nil }},
+		{path: protocol.ResetPasswordPath, method: http.MethodPost, summary: "Enroll a new password with a mailed reset token, or the session of a recovery login", auth: "bearer", authOptional: true,
+			request: protocol.ResetPasswordRequest{}},
+		{path: protocol.RememberDevicePath, method: http.MethodPost, summary: "Issue a session's user a token that logs them in on the device", auth: "bearer",
+			request: protocol.RememberDeviceRequest{}, response: protocol.DeviceToken{}, served: func(s *Server) bool { return s.deviceTokenTTL > 0 }},
+		{path: protocol.DevicesPath, method: http.MethodGet, summary: "List a session's user's remembered devices", auth: "bearer",
+			response: protocol.DevicesResponse{}, served: func(s *Server) bool { return s.deviceTokenTTL > 0 }},
+		{path: protocol.RevokeDevicePath, method: http.MethodPost, summary: "Revoke one of a session's user's remembered devices", auth: "bearer",
+			request: protocol.RevokeDeviceRequest{}, served: func(s *Server) bool { return s.deviceTokenTTL > 0 }},
+		{path: protocol.DeviceLogInPath, method: http.MethodPost, summary: "Log in with the token of a remembered device",
+			request: protocol.DeviceLogInRequest{}, response: protocol.LogInResponse{}, served: func(s *Server) bool { return s.deviceTokenTTL > 0 }},
+		{path: protocol.CreateAPIKeyPath, method: http.MethodPost, summary: "Issue a session's user a scoped API key that authenticates machines as them", auth: "bearer",
+			request: protocol.CreateAPIKeyRequest{}, response: protocol.APIKey{}},
+		{path: protocol.APIKeysPath, method: http.MethodGet, summary: "List a session's user's API keys", auth: "bearer",
+			response: protocol.APIKeysResponse{}},
+		{path: protocol.RevokeAPIKeyPath, method: http.MethodPost, summary: "Revoke one of a session's user's API keys", auth: "bearer",
+			request: protocol.RevokeAPIKeyRequest{}},
+		{path: protocol.OPAQUERegisterPath, method: http.MethodPost, summary: "Evaluate a blinded password for the OPAQUE record a user signs up or resets their password with",
+			request: protocol.OPAQUERegisterRequest{}, response: protocol.OPAQUERegisterResponse{}, served: func(s *Server) bool { return s.opaque != nil }},
+		{path: protocol.OPAQUELogInBeginPath, method: http.MethodPost, summary: "Begin logging in a user who signed up with an OPAQUE record",
+			request: protocol.OPAQUEBeginRequest{}, response: protocol.OPAQUEBeginResponse{}, served: func(s *Server) bool { return s.opaque != nil }},
+		{path: protocol.OPAQUELogInFinishPath, method: http.MethodPost, summary: "Finish an OPAQUE login",
+			request: protocol.OPAQUEFinishRequest{}, response: protocol.LogInResponse{}, served: func(s *Server) bool { return s.opaque != nil }},
+		{path: protocol.OIDCDiscoveryPath, method: http.MethodGet, summary: "Get the OpenID Connect provider's metadata",
+			response: protocol.OIDCDiscovery{}, served: func(s *Server) bool { return s.oidc != nil }, noErrorResponse: true},
+		{path: protocol.OIDCAuthorizePath, method: http.MethodGet, summary: "Request an authorization code from a user's browser, which is redirected to the app's redirect URI",
+			parameters: queryParameters(oidcAuthorizeParams{}), status: http.StatusFound, served: func(s *Server) bool { return s.oidc != nil }},
+		{path: protocol.OIDCAuthorizePath, method: http.MethodPost, summary: "Request an authorization code with the session of a login, returning the app's redirect URI", auth: "bearer",
+			request: oidcAuthorizeParams{}, requestType: contentTypeForm, response: protocol.OIDCAuthorizeResponse{}, served: func(s *Server) bool { return s.oidc != nil }},
+		{path: protocol.OIDCTokenPath, method: http.MethodPost, summary: "Exchange an authorization code for an ID token and an access token",
+			request: oidcTokenForm{}, requestType: contentTypeForm, response: protocol.OIDCTokenResponse{}, served: func(s *Server) bool { return s.oidc != nil }, noErrorResponse: true},
+		{path: protocol.OIDCUserInfoPath, method: http.MethodGet, summary: "Get the claims of an access token's user", auth: "bearer",
+			response: protocol.OIDCUserInfo{}, served: func(s *Server) bool { return s.oidc != nil }, noErrorResponse: true},
+		{path: protocol.OIDCJWKSPath, method: http.MethodGet, summary: "Get the keys ID tokens are signed with",
+			response: protocol.JWKS{}, served: func(s *Server) bool { return s.oidc != nil }, noErrorResponse: true},
+		{path: protocol.OIDCRegisterPath, method: http.MethodPost, summary: "Register an app as a client of the OpenID Connect provider", auth: "bearer",
+			request: protocol.OIDCClientRegistration{}, response: protocol.OIDCClientRegistration{}, status: http.StatusCreated, served: func(s *Server) bool { return s.oidc != nil }, noErrorResponse: true},
+		{path: protocol.IntrospectPath, method: http.MethodPost, summary: "Check whether a session token, API key, or access token is active, as RFC 7662 defines it", auth: "bearer", authOptional: true,
+			request: tokenForm{}, requestType: contentTypeForm, response: protocol.TokenIntrospection{}, served: func(s *Server) bool { return s.adminToken != "" || s.oidc != nil }, noErrorResponse: true},
+		{path: protocol.RevokePath, method: http.MethodPost, summary: "Revoke a session token, API key, or access token, as RFC 7009 defines it", auth: "bearer", authOptional: true,
+			request: tokenForm{}, requestType: contentTypeForm, served: func(s *Server) bool { return s.adminToken != "" || s.oidc != nil }, noErrorResponse: true},
+		{path: protocol.PasskeyRegisterBeginPath, method: http.MethodPost, summary: "Begin registering a passkey for a session's user, or for a new passwordless user without a session", auth: "bearer", authOptional: true,
+			request: protocol.PasskeyBeginRequest{}, response: protocol.PasskeyCeremony{}, served: func(s *Server) bool { return s.webAuthn != nil }},
+		{path: protocol.PasskeyRegisterFinishPath, method: http.MethodPost, summary: "Finish registering a passkey",
+			request: protocol.PasskeyFinishRequest{}, served: func(s *Server) bool { return s.webAuthn != nil }},
+		{path: protocol.PasskeyLogInBeginPath, method: http.MethodPost, summary: "Begin logging in a passwordless user with a passkey",
+			request: protocol.PasskeyBeginRequest{}, response: protocol.PasskeyCeremony{}, served: func(s *Server) bool { return s.webAuthn != nil }},
+		{path: protocol.PasskeyLogInFinishPath, method: http.MethodPost, summary: "Finish logging in with a passkey",
+			request: protocol.PasskeyFinishRequest{}, response: protocol.LogInResponse{}, served: func(s *Server) bool { return s.webAuthn != nil }},
+		{path: protocol.OpenAPIPath, method: http.MethodGet, summary: "Get this document", noErrorResponse: true},
+	}
+)
+
+// OpenAPIHandler handles requests for the OpenAPI document describing the endpoints the server serves, and the encodings of their messages,
+// returning it with a 2XX status
+func (s *Server) OpenAPIHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.openAPI)
+}
+
+// openAPIDocument returns the OpenAPI document of the endpoints a Server serves
+func (s *Server) openAPIDocument() map[string]any {
+	builder := &schemaBuilder{components: map[string]any{}}
+	errorSchema := builder.schema(reflect.TypeOf(protocol.ErrorResponse{}))
+
+	paths := map[string]any{}
+	for _, r := range routes {
+		if r.served != nil && !r.served(s) {
+			continue
+		}
+
+		status := r.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]any{"description": http.StatusText(status)}
+		if r.response != nil {
+			response["content"] = builder.content(r.response, r.responseType)
+		}
+		responses := map[string]any{strconv.Itoa(status): response}
+		if !r.noErrorResponse {
+			responses["default"] = map[string]any{
+				"description": "An error, whose code clients can act on",
+				"content":     map[string]any{contentTypeJSON: map[string]any{"schema": errorSchema}},
+			}
+		}
+
+		operation := map[string]any{"summary": r.summary, "responses": responses}
+		if r.request != nil {
+			operation["requestBody"] = map[string]any{"required": true, "content": builder.content(r.request, r.requestType)}
+		}
+		if len(r.parameters) > 0 {
+			operation["parameters"] = r.parameters
+		}
+		if r.auth != "" {
+			security := []any{map[string]any{r.auth: []any{}}}
+			if r.authOptional {
+				security = append(security, map[string]any{})
+			}
+			operation["security"] = security
+		}
+
+		operations, ok := paths[r.path].(map[string]any)
+		if !ok {
+			operations = map[string]any{}
+			paths[r.path] = operations
+		}
+		operations[strings.ToLower(r.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "Homomorphic authentication",
+			"version": strconv.Itoa(protocol.Version),
+			"description": "Requests and responses carry the version of the protocol they were sent in. " +
+				"Byte strings, such as secrets, are encoded in standard base64, and encrypted payloads as arrays of LWE samples, a bit at a time",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": builder.components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer", "description": "A session token, or the admin token of admin endpoints"},
+			},
+		},
+	}
+}
+
+// headerParameter returns an OpenAPI parameter of a request header
+func headerParameter(name, description string) any {
+	return map[string]any{"name": name, "in": "header", "description": description, "schema": map[string]any{"type": "string"}}
+}
+
+// pathParameter returns an OpenAPI parameter of a segment of a request's path
+func pathParameter(name, description string) any {
+	return map[string]any{"name": name, "in": "path", "required": true, "description": description, "schema": map[string]any{"type": "string"}}
+}
+
+// queryParameters returns the OpenAPI parameters of a request's query, one per field of a struct
+func queryParameters(params any) []any {
+	var parameters []any
+	for _, f := range jsonFields(reflect.TypeOf(params)) {
+		parameters = append(parameters, map[string]any{"name": f.name, "in": "query", "required": f.required, "schema": map[string]any{"type": "string"}})
+	}
+
+	return parameters
+}
+
+// content returns the OpenAPI content of a body of a value's type, encoded as JSON unless a content type is given
+func (b *schemaBuilder) content(body any, contentType string) map[string]any {
+	if contentType == contentTypeBinary {
+		return map[string]any{contentType: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+	} else if contentType == "" {
+		contentType = contentTypeJSON
+	}
+
+	return map[string]any{contentType: map[string]any{"schema": b.schema(reflect.TypeOf(body))}}
+}
+
+// schema returns the JSON schema of the encoding of a type, referring to the components of named structs
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]any{"description": "Any JSON value"}
+	case t.Implements(jsonTyperType):
+		return b.schema(reflect.TypeOf(reflect.Zero(t).Interface().(jsonTyper).JSONType()))
+	case t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(jsonTyperType):
+		return b.schema(reflect.PointerTo(t))
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = nil
+			b.components[name] = b.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the JSON schema of a struct's encoding, whose fields not omitted when empty are required
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	for _, f := range jsonFields(t) {
+		properties[f.name] = b.schema(f.typ)
+		if f.required {
+			required = append(required, f.name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if description, ok := schemaDescriptions[path.Base(t.PkgPath())+"."+t.Name()]; ok {
+		schema["description"] = description
+	}
+
+	return schema
+}
+
+// jsonFields returns the fields of a struct's JSON encoding, promoting those of embedded structs as encoding/json does,
+// where shallower fields hide deeper fields of the same name
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	index := map[string]int{}
+	var walk func(t reflect.Type, depth int)
+	walk = func(t reflect.Type, depth int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+				walk(fieldType, depth+1)
+				continue
+			} else if !field.IsExported() {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+			f := jsonField{name: name, typ: field.Type, required: !strings.Contains(options, "omitempty"), depth: depth}
+			if i, ok := index[name]; !ok {
+				index[name] = len(fields)
+				fields = append(fields, f)
+			} else if depth < fields[i].depth {
+				fields[i] = f
+			}
+		}
+	}
+	walk(t, 0)
+
+	return fields
+}
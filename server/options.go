@@ -0,0 +1,353 @@
+package server
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/crypto/circuit"
+	"github.com/zambozoo/homomorphic-authentication/crypto/opaque"
+)
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithEntropySource sets the source of salts, session tokens, and challenge randomness, which tests may replace with a deterministic source
+func WithEntropySource(entropy crypto.EntropySource) Option {
+	return func(s *Server) {
+		s.entropy = entropy
+	}
+}
+
+// WithBackend sets the Backend that rebuilds users' public keys, which tests may replace with crypto.MakePlaintextBackend
+// Public keys of other backends are rejected, so a server with the plaintext backend accepts no TFHE clients, and vice versa
+func WithBackend(backend crypto.Backend) Option {
+	return func(s *Server) {
+		s.backend = backend
+	}
+}
+
+// WithSaltByteLen sets the length of the salt stored with each user's secret hash
+func WithSaltByteLen(saltByteLen int) Option {
+	return func(s *Server) {
+		s.saltByteLen = saltByteLen
+	}
+}
+
+// WithCircuitLimits sets the bounds on the circuits a Server evaluates
+func WithCircuitLimits(limits circuit.Limits) Option {
+	return func(s *Server) {
+		s.circuitLimits = limits
+	}
+}
+
+// WithUserStore sets where a Server stores users' profiles
+func WithUserStore(users UserStore) Option {
+	return func(s *Server) {
+		s.users = users
+	}
+}
+
+// WithHasher sets the Hasher for new secret hashes, while existing hashes are verified with the Hasher that made them
+func WithHasher(hasher Hasher) Option {
+	return func(s *Server) {
+		s.hasher = hasher
+	}
+}
+
+// WithRequestTimeout sets a deadline for each request, after which its encrypted work is cancelled and it returns a 5XX status
+// Work is also cancelled when a request's client disconnects, with or without a deadline
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.requestTimeout = timeout
+	}
+}
+
+// WithMaxChallenges bounds the number of login challenges computed at once
+// Further logins return a 4XX status with a Retry-After header until a challenge finishes, protecting the latency of those in flight
+func WithMaxChallenges(maxChallenges int) Option {
+	return func(s *Server) {
+		s.challenges = makeSemaphore(maxChallenges)
+	}
+}
+
+// WithMaxEvaluations bounds the number of circuits evaluated at once, where 0 is unlimited
+// Further evaluations return a 4XX status with a Retry-After header until one finishes
+func WithMaxEvaluations(maxEvaluations int) Option {
+	return func(s *Server) {
+		s.evaluations = nil
+		if maxEvaluations > 0 {
+			s.evaluations = makeSemaphore(maxEvaluations)
+		}
+	}
+}
+
+// WithRateLimit limits each client address to a number of requests per second with a burst
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(s *Server) {
+		s.rateLimiter = makeRateLimiter(requestsPerSecond, burst)
+	}
+}
+
+// WithAdminToken serves the admin export and import endpoints to requests bearing a token, which are otherwise not served
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithMasterKey seals users' secrets under a master key from NewMasterKey before they reach the UserStore, through a SealedStore
+// The SealedStore wraps whichever UserStore the other options set, and users stored before it are sealed when they're next updated
+func WithMasterKey(masterKey cipher.AEAD) Option {
+	return func(s *Server) {
+		s.masterKey = masterKey
+	}
+}
+
+// WithKeyProvider fetches server key material from a KeyProvider, sealing users' secrets under its master key as WithMasterKey does,
+// and mixing its pepper, if it has one, into secrets as WithPepper does
+// The KeyProvider is asked for keys as they're used, so it should cache them, as a CachingKeyProvider does
+// WithMasterKey and WithPepper take precedence over the KeyProvider's keys
+func WithKeyProvider(provider KeyProvider) Option {
+	return func(s *Server) {
+		s.keyProvider = provider
+	}
+}
+
+// WithPepper mixes a pepper into new users' secrets before they're hashed, so hashes stolen without it can't be brute forced
+// Existing hashes still verify with the pepper they were made with, if any, and are rehashed with this one at their user's next login
+// WithPepper takes precedence over a KeyProvider's pepper
+func WithPepper(pepper []byte) Option {
+	return func(s *Server) {
+		s.pepper = pepper
+	}
+}
+
+// WithWebAuthn serves the passkey endpoints, which register passkeys and log in with them, with a relying party's configuration
+// Users with a password and passkeys finish each login with a passkey, and users registered with a passkey have no password
+func WithWebAuthn(w *webauthn.WebAuthn) Option {
+	return func(s *Server) {
+		s.webAuthn = w
+	}
+}
+
+// WithMailer requires new users to give an email address, and mails them a token they verify it with at protocol.VerifyEmailPath before they can log in
+// Users stored before it are active without one
+// Users with a verified address can also be mailed a token that resets their password, at protocol.ResetPasswordBeginPath
+func WithMailer(mailer Mailer) Option {
+	return func(s *Server) {
+		s.mailer = mailer
+	}
+}
+
+// WithVerifyURL links verification mail to a page that verifies the address, by adding username and token query parameters to a URL
+// A URL of the server's own protocol.VerifyEmailPath verifies it when the link is opened
+func WithVerifyURL(verifyURL string) Option {
+	return func(s *Server) {
+		s.verifyURL = verifyURL
+	}
+}
+
+// WithRecoveryRateLimit limits each user to a number of recovery logins per second with a burst, whichever addresses they come from,
+// in place of the default of one every ten minutes with a burst of three
+func WithRecoveryRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(s *Server) {
+		s.recoveryLimiter = makeRateLimiter(requestsPerSecond, burst)
+	}
+}
+
+// WithNotifier sends auth events, such as logins, lockouts, and password changes, to a Notifier in the background,
+// passing the errors of failed deliveries to onError, if it isn't nil
+func WithNotifier(notifier Notifier, onError func(error)) Option {
+	return func(s *Server) {
+		s.notifier, s.onNotifyError = notifier, onError
+	}
+}
+
+// WithRiskAssessor asks a RiskAssessor about each login, with its client address and the recent failed logins of its user and address,
+// before its challenge is computed, so it can delay the login, deny it, or demand a step-up token
+func WithRiskAssessor(assessor RiskAssessor) Option {
+	return func(s *Server) {
+		s.riskAssessor = assessor
+	}
+}
+
+// WithCaptcha requires a CAPTCHA token that a CaptchaVerifier accepts on every signup if onSignUp is set,
+// and on logins once their user or address has failed to log in a number of times in the last 15 minutes, where 0 never requires one
+func WithCaptcha(verifier CaptchaVerifier, onSignUp bool, afterFailures int) Option {
+	return func(s *Server) {
+		s.captcha, s.captchaSignUp, s.captchaAfterFailures = verifier, onSignUp, afterFailures
+	}
+}
+
+// WithUsernamePolicy normalizes usernames under a UsernamePolicy before users are stored or looked up, refusing signups of usernames it doesn't allow
+func WithUsernamePolicy(policy *UsernamePolicy) Option {
+	return func(s *Server) {
+		s.usernamePolicy = policy
+	}
+}
+
+// WithOPAQUE serves the OPAQUE endpoints under a ServerSetup's keys, which sign users up with an OPAQUE record in place of an encrypted secret
+// and log them in with the OPAQUE-3DH key exchange, into the same sessions as every other user
+// The setup must be kept secret and stable, since users' records can't be logged in with under another
+func WithOPAQUE(setup *opaque.ServerSetup) Option {
+	return func(s *Server) {
+		s.opaque = setup
+	}
+}
+
+// WithOIDC serves an OpenID Connect provider in front of the server's logins, so apps registered with it can log users in with the authorization code flow
+// Apps are registered at protocol.OIDCRegisterPath with the admin token, or with the provider's AddClient
+func WithOIDC(provider *OIDCProvider) Option {
+	return func(s *Server) {
+		s.oidc = provider
+	}
+}
+
+// WithSessionStore stores sessions in a SessionStore, such as a RedisSessionStore that replicas share, in place of a MemorySessionStore
+func WithSessionStore(store SessionStore) Option {
+	return func(s *Server) {
+		s.sessions = store
+	}
+}
+
+// WithSlidingSessions slides each session's expiry as it is used, so sessions in use don't expire,
+// up to a maximum lifetime after their user logged in, after which they must log in again
+func WithSlidingSessions(maxLifetime time.Duration) Option {
+	return func(s *Server) {
+		s.sessionMaxLifetime = maxLifetime
+	}
+}
+
+// WithDeviceTokens serves the device endpoints, which remember the devices users log in on with tokens that log them in there,
+// without their password or passkeys, until they expire a TTL after they were issued
+func WithDeviceTokens(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.deviceTokenTTL = ttl
+	}
+}
+
+// WithChallengeStore stores the login challenges awaiting second login requests in a ChallengeStore, such as a RedisChallengeStore that replicas share,
+// in place of a MemoryChallengeStore
+func WithChallengeStore(store ChallengeStore) Option {
+	return func(s *Server) {
+		s.loginChallenges = store
+	}
+}
+
+// WithChallengeTTL sets how long a login's challenge, and the nonce its second login request echoes, can be answered after it is issued
+func WithChallengeTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.challengeTTL = ttl
+	}
+}
+
+// WithSigningKey signs each login challenge, with its nonce and expiry, under the server's long-term Ed25519 key,
+// and serves its public key at protocol.ServerKeyPath, so clients pinning the key can detect a spoofed server
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(s *Server) {
+		s.signingKey = key
+	}
+}
+
+// WithMinProtocolVersion refuses logins in protocol versions older than a version, which must be at most protocol.Version
+// Servers accept only protocol.Version by default; lowering the minimum to protocol.MinVersion lets clients that don't send a version keep logging in while they are upgraded,
+// but version 1 second login requests answer the user's latest challenge with only its secret, without its nonce or transcript,
+// so anyone holding a captured secret can log in by sending a first login request of their own until the minimum is raised again
+func WithMinProtocolVersion(version int) Option {
+	return func(s *Server) {
+		s.minProtocolVersion = version
+	}
+}
+
+// WithIdempotencyTTL sets how long the outcome of a sign up request with an idempotency key is returned to its retries, where 0 ignores idempotency keys
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.idempotencyTTL = ttl
+	}
+}
+
+// WithCORS lets browsers call the server's endpoints from the origins a CORSPolicy allows, such as the page serving the WASM client,
+// answering their preflight requests before rate limits apply
+func WithCORS(policy CORSPolicy) Option {
+	return func(s *Server) {
+		s.cors = &policy
+	}
+}
+
+// WithSessionCookies delivers the sessions of HTTP logins as cookies too, which authenticate requests without an authorization header,
+// where requests that change state echo the session's CSRF token, delivered as a SessionCookiePolicy sets
+func WithSessionCookies(policy SessionCookiePolicy) Option {
+	return func(s *Server) {
+		s.sessionCookies = &policy
+	}
+}
+
+// WithAccessLog logs each request the server serves, including those rate limits and CORS reject, as an AccessLogPolicy sets
+func WithAccessLog(policy AccessLogPolicy) Option {
+	return func(s *Server) {
+		s.accessLog = &policy
+	}
+}
+
+// WithMaxCiphertextBits sets the most bits of the encrypted secrets and circuit inputs a Server accepts, which bounds the CPU and memory a request can consume,
+// and the length of the request bodies it reads
+func WithMaxCiphertextBits(bits int) Option {
+	return func(s *Server) {
+		s.maxCiphertextBits = bits
+	}
+}
+
+// WithSecretByteLens sets the lengths of the shortest and longest secrets a Server's users can enroll, within which clients choose their secret's length,
+// and from which logins derive where challenges split
+func WithSecretByteLens(minByteLen, maxByteLen int) Option {
+	return func(s *Server) {
+		s.minSecretByteLen, s.maxSecretByteLen = minByteLen, maxByteLen
+	}
+}
+
+// WithMinSecurityLevel refuses enrollments and logins under parameter sets estimated at fewer bits of security than a level, such as 128,
+// which logins report to clients, who pin it; the default of 0 accepts every parameter set, including the PlaintextSchemes of tests
+func WithMinSecurityLevel(level int) Option {
+	return func(s *Server) {
+		s.minSecurityLevel = level
+	}
+}
+
+// WithMutator sets how a Server constructs login challenges from users' encrypted secrets
+func WithMutator(mutator Mutator) Option {
+	return func(s *Server) {
+		s.mutator = mutator
+	}
+}
+
+// WithSecretGracePeriod sets how long a secret replaced by a password change or rotation still logs its user in, so logins begun before the change can finish,
+// where zero retires none
+func WithSecretGracePeriod(gracePeriod time.Duration) Option {
+	return func(s *Server) {
+		s.secretGracePeriod = gracePeriod
+	}
+}
+
+// WithSecretMaxAge sets how long after a secret is enrolled its user's logins are marked as requiring its rotation, where zero never requires it
+func WithSecretMaxAge(maxAge time.Duration) Option {
+	return func(s *Server) {
+		s.secretMaxAge = maxAge
+	}
+}
+
+// WithLogInHistory sets how long users' login attempts are kept in their login history, where zero keeps none
+func WithLogInHistory(retention time.Duration) Option {
+	return func(s *Server) {
+		s.logInHistory = retention
+	}
+}
+
+// WithClaimsProvider adds the roles and custom claims a ClaimsProvider returns to those stored for each user in the tokens issued for them
+func WithClaimsProvider(provider ClaimsProvider) Option {
+	return func(s *Server) {
+		s.claimsProvider = provider
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+const (
+	// defaultMinSecretByteLen and defaultMaxSecretByteLen are the default lengths of the shortest and longest secrets a user can enroll
+	defaultMinSecretByteLen = 1
+	defaultMaxSecretByteLen = 64
+	// defaultMaxCiphertextBits is the default length of the longest encrypted payload a server accepts, that of the longest encrypted secret
+	defaultMaxCiphertextBits = 16 * defaultMaxSecretByteLen
+	// maxBodyPublicKeys and maxBodyCiphertexts are the most public keys and encrypted payloads of the longest length a request body is read with room for,
+	// and maxBodyFieldsLen the room for its other fields
+	maxBodyPublicKeys  = 2
+	maxBodyCiphertexts = 4
+	maxBodyFieldsLen   = 64 << 10
+)
+
+// keyBodyPaths are the paths of the requests that carry public keys, whose bodies are read up to the longer limit of bodyLimits
+var keyBodyPaths = map[string]bool{"/login-1": true, "/change-password": true, "/evaluate": true}
+
+var (
+	errSecretLength      = errors.New("secret is the wrong length")
+	errSecurityLevel     = errors.New("public key's security level doesn't match the user's")
+	errWeakParameters    = errors.New("parameter set is weaker than the server accepts")
+	errCiphertextTooLong = errors.New("encrypted payload is too long")
+)
+
+// secretByteLen returns the length of a user's secret, measured from their encrypted secret if it wasn't recorded at signup
+func (u User) secretByteLen() int {
+	if u.SecretByteLen > 0 {
+		return u.SecretByteLen
+	}
+
+	return len(u.EncryptedSecret) / 16
+}
+
+// securityLevel returns the security level of a user's parameter set, judged by their encrypted secret if it wasn't recorded at signup
+func (u User) securityLevel() int {
+	if u.SecretByteLen > 0 {
+		return u.SecurityLevel
+	}
+
+	return crypto.CtxtSecurityLevel(u.EncryptedSecret)
+}
+
+// bodyLimits returns the lengths of the longest request bodies a server reads, derived from the longest encrypted payload it accepts,
+// first of requests without public keys, then of requests with them, which are given room for public keys of the largest parameter set
+func (s *Server) bodyLimits() (int64, int64) {
+	limit := maxBodyFieldsLen + maxBodyCiphertexts*crypto.MaxCtxtJSONLen(s.maxCiphertextBits)
+
+	return limit, limit + maxBodyPublicKeys*crypto.MaxPublicKeyJSONLen()
+}
+
+// checkEnrollment returns the secret length and security level of an enrolled secret and its encrypted, masked payload,
+// where the secret's length is the client's choice within the server's range, and the payload's two halves must each have a bit per bit of the secret,
+// and it must be no longer than the server accepts
+func (s *Server) checkEnrollment(encryptedSecret gates.Ctxt, secret []byte) (int, int, error) {
+	if len(secret) < max(s.minSecretByteLen, 1) || len(secret) > s.maxSecretByteLen {
+		return 0, 0, fmt.Errorf("%w: secrets are %d to %d bytes", errSecretLength, max(s.minSecretByteLen, 1), s.maxSecretByteLen)
+	}
+	if len(encryptedSecret) > s.maxCiphertextBits {
+		return 0, 0, fmt.Errorf("%w: %d bits, at most %d", errCiphertextTooLong, len(encryptedSecret), s.maxCiphertextBits)
+	}
+	if err := crypto.CheckCtxt(encryptedSecret, 16*len(secret)); err != nil {
+		return 0, 0, err
+	}
+	securityLevel := crypto.CtxtSecurityLevel(encryptedSecret)
+	if securityLevel < s.minSecurityLevel {
+		return 0, 0, fmt.Errorf("%w: security level %d, at least %d", errWeakParameters, securityLevel, s.minSecurityLevel)
+	}
+
+	return len(secret), securityLevel, nil
+}
+
+// checkCiphertext checks that an uploaded encrypted payload is no longer than the server accepts,
+// and that its samples have the mask dimension of a user's encrypted secret
+func (s *Server) checkCiphertext(user User, encryptedPayload gates.Ctxt) error {
+	if len(encryptedPayload) > s.maxCiphertextBits {
+		return fmt.Errorf("%w: %d bits, at most %d", errCiphertextTooLong, len(encryptedPayload), s.maxCiphertextBits)
+	}
+	if err := crypto.CheckCtxt(encryptedPayload, len(encryptedPayload)); err != nil {
+		return err
+	}
+	if len(encryptedPayload) > 0 && len(user.EncryptedSecret) > 0 && len(encryptedPayload[0].A) != len(user.EncryptedSecret[0].A) {
+		return fmt.Errorf("%w: mask dimension %d, expected %d", crypto.ErrMalformedSample, len(encryptedPayload[0].A), len(user.EncryptedSecret[0].A))
+	}
+
+	return nil
+}
+
+// checkPublicKey checks that a public key is of the same parameter set as a user's encrypted secret, and no weaker than the server accepts,
+// so users enrolled before the server's minimum security level was raised must reset their password to log in again
+func (s *Server) checkPublicKey(user User, publicKey *crypto.PublicKey) error {
+	level := publicKey.SecurityLevel()
+	if level != user.securityLevel() {
+		return fmt.Errorf("%w: %d, expected %d", errSecurityLevel, level, user.securityLevel())
+	}
+	if level < s.minSecurityLevel {
+		return fmt.Errorf("%w: security level %d, at least %d", errWeakParameters, level, s.minSecurityLevel)
+	}
+
+	return nil
+}
@@ -0,0 +1,429 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	webauthnprotocol "github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/zambozoo/homomorphic-authentication/crypto/opaque"
+	"github.com/zambozoo/homomorphic-authentication/crypto/srp"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// ceremonyTTL is how long a client has to finish a WebAuthn ceremony after beginning it
+	ceremonyTTL = 5 * time.Minute
+	// ceremonyIDByteLen is the length of a ceremony's id before encoding
+	ceremonyIDByteLen = 16
+	// passkeyHandleByteLen is the length of the random WebAuthn user handle a user's passkeys are registered under
+	passkeyHandleByteLen = 32
+)
+
+var (
+	errPasswordless  = errors.New("user logs in with a passkey")
+	errPasswordUser  = errors.New("user logs in with a password before their passkey")
+	errNoPasskeys    = errors.New("user has no passkeys")
+	errClonedPasskey = errors.New("passkey's signature counter went backwards, so it may be cloned")
+)
+
+type (
+	// ceremony is a WebAuthn ceremony, or an SRP or OPAQUE login, a client has begun and not yet finished
+	ceremony struct {
+		username string
+		// register is whether the ceremony registers a passkey, rather than logging in with one
+		register bool
+		// user is the passwordless user a registration creates, or nil if it adds a passkey to an existing user
+		user *User
+		// recovery is whether a login ceremony follows a recovery login, so its session can reset the user's password
+		recovery bool
+		session  webauthn.SessionData
+		// srp is the server's half of an SRP login, which has no WebAuthn session
+		srp *srp.Server
+		// opaque is the server's half of an OPAQUE login, which likewise has no WebAuthn session
+		opaque    *opaque.ServerLogin
+		expiresAt time.Time
+	}
+
+	// ceremonyStore holds the WebAuthn ceremonies a server has begun
+	ceremonyStore struct {
+		ceremonies map[string]ceremony
+		mu         sync.Mutex
+	}
+
+	// webAuthnUser is a User as the webauthn package sees it
+	webAuthnUser User
+)
+
+// makeCeremonyStore returns an empty ceremonyStore
+func makeCeremonyStore() *ceremonyStore {
+	return &ceremonyStore{ceremonies: map[string]ceremony{}}
+}
+
+// start stores a ceremony, returning the id its client finishes it with
+func (cs *ceremonyStore) start(entropy io.Reader, c ceremony) (string, error) {
+	id := make([]byte, ceremonyIDByteLen)
+	if _, err := io.ReadFull(entropy, id); err != nil {
+		return "", err
+	}
+	ceremonyID := base64.RawURLEncoding.EncodeToString(id)
+
+	c.expiresAt = time.Now().Add(ceremonyTTL)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.prune(time.Now())
+	cs.ceremonies[ceremonyID] = c
+	return ceremonyID, nil
+}
+
+// take removes and returns an unexpired ceremony by id, so each is finished at most once
+func (cs *ceremonyStore) take(ceremonyID string) (ceremony, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c, ok := cs.ceremonies[ceremonyID]
+	delete(cs.ceremonies, ceremonyID)
+	if !ok || time.Now().After(c.expiresAt) {
+		return ceremony{}, false
+	}
+
+	return c, true
+}
+
+// prune removes expired ceremonies
+// The caller must hold the lock
+func (cs *ceremonyStore) prune(now time.Time) {
+	for ceremonyID, c := range cs.ceremonies {
+		if now.After(c.expiresAt) {
+			delete(cs.ceremonies, ceremonyID)
+		}
+	}
+}
+
+// WebAuthnID returns a user's random handle, which unlike their username reveals nothing to authenticators
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.PasskeyHandle
+}
+
+// WebAuthnName returns a user's username
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.Username
+}
+
+// WebAuthnDisplayName returns a user's username, since users have no other name
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.Username
+}
+
+// WebAuthnIcon returns no icon
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+// WebAuthnCredentials returns a user's passkeys
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.Passkeys
+}
+
+// passkeyCeremony stores a ceremony and returns it with its options for the client's authenticator
+func (s *Server) passkeyCeremony(c ceremony, options any) (*protocol.PasskeyCeremony, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	ceremonyID, err := s.ceremonies.start(s.entropy, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.PasskeyCeremony{CeremonyID: ceremonyID, Options: encoded}, nil
+}
+
+// beginPasskeyLogIn begins a ceremony that logs a user in with one of their passkeys, after a recovery login if recovery is set
+func (s *Server) beginPasskeyLogIn(user User, recovery bool) (*protocol.PasskeyCeremony, error) {
+	assertion, session, err := s.webAuthn.BeginLogin((*webAuthnUser)(&user))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.passkeyCeremony(ceremony{username: user.Username, recovery: recovery, session: *session}, assertion)
+}
+
+// takeCeremony returns the ceremony a finish request names, or false if it doesn't exist, has expired, or is of another kind or user
+func (s *Server) takeCeremony(finishRequest *protocol.PasskeyFinishRequest, register bool) (ceremony, bool) {
+	c, ok := s.ceremonies.take(finishRequest.CeremonyID)
+	return c, ok && c.srp == nil && c.opaque == nil && c.register == register && s.sameUser(c.username, finishRequest.Username)
+}
+
+// PasskeyRegisterBeginHandler handles requests to begin registering a passkey
+// Requests bearing a session add a passkey to its user, and those without create the passwordless user named
+// Either returns the ceremony's options for the client's authenticator and a 2XX status
+// Malformed requests, invalid sessions, taken usernames or those the UsernamePolicy doesn't allow, and new users missing a required email address return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) PasskeyRegisterBeginHandler(w http.ResponseWriter, req *http.Request) {
+	var beginRequest protocol.PasskeyBeginRequest
+	if err := json.NewDecoder(req.Body).Decode(&beginRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	c := ceremony{register: true}
+	var user User
+	if token, ok := bearerToken(req); ok {
+		session, status, err := s.lookupSession(token)
+		if err != nil {
+			writeError(w, err, status)
+			return
+		}
+
+		if user, err = s.users.Get(session.Username); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		} else if status, err := checkStatus(user); err != nil {
+			writeError(w, err, status)
+			return
+		}
+	} else {
+		if beginRequest.Username == "" {
+			writeError(w, protocol.ErrBadRequest, http.StatusBadRequest)
+			return
+		} else if (s.mailer != nil || beginRequest.Email != "") && !validEmail(beginRequest.Email) {
+			writeError(w, errMissingEmail, http.StatusBadRequest)
+			return
+		}
+
+		username, err := s.normalizeUsername(beginRequest.Username)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if _, err := s.users.Get(username); err == nil {
+			writeError(w, protocol.ErrUserExists, http.StatusBadRequest)
+			return
+		} else if !errors.Is(err, protocol.ErrUserDoesNotExist) {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		user = User{Username: username, Email: beginRequest.Email, Hasher: s.hasher.Name(), CreatedAt: time.Now()}
+		c.user = &user
+	}
+
+	if user.PasskeyHandle == nil {
+		user.PasskeyHandle = make([]byte, passkeyHandleByteLen)
+		if _, err := io.ReadFull(s.entropy, user.PasskeyHandle); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	c.username = user.Username
+
+	exclusions := make([]webauthnprotocol.CredentialDescriptor, len(user.Passkeys))
+	for i, passkey := range user.Passkeys {
+		exclusions[i] = passkey.Descriptor()
+	}
+	creation, session, err := s.webAuthn.BeginRegistration((*webAuthnUser)(&user), webauthn.WithExclusions(exclusions))
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	c.session = *session
+
+	passkeyCeremony, err := s.passkeyCeremony(c, creation)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, passkeyCeremony)
+}
+
+// PasskeyRegisterFinishHandler handles requests to finish registering a passkey with the authenticator's attestation
+// Valid attestations store the passkey, creating its user if the ceremony began without a session, and return a 2XX status
+// New users are mailed a verification token if the server has a Mailer
+// Malformed requests, unknown or expired ceremonies, invalid attestations, and usernames taken since the ceremony began return a 4XX status
+// Store and mail errors return a 5XX status
+func (s *Server) PasskeyRegisterFinishHandler(w http.ResponseWriter, req *http.Request) {
+	var finishRequest protocol.PasskeyFinishRequest
+	if err := json.NewDecoder(req.Body).Decode(&finishRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	c, ok := s.takeCeremony(&finishRequest, true)
+	if !ok {
+		writeError(w, protocol.ErrUnknownChallenge, http.StatusNotFound)
+		return
+	}
+
+	parsed, err := webauthnprotocol.ParseCredentialCreationResponseBody(bytes.NewReader(finishRequest.Credential))
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var user User
+	if c.user != nil {
+		user = *c.user
+	} else if user, err = s.users.Get(c.username); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	}
+	if user.PasskeyHandle == nil {
+		user.PasskeyHandle = c.session.UserID
+	}
+
+	credential, err := s.webAuthn.CreateCredential((*webAuthnUser)(&user), c.session, parsed)
+	if err != nil {
+		writeError(w, protocol.ErrInvalidCredentials, http.StatusForbidden)
+		return
+	}
+	user.Passkeys = append(user.Passkeys, *credential)
+
+	var token string
+	if c.user != nil && s.mailer != nil {
+		if token, err = s.pendVerification(&user); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if c.user != nil {
+		err = s.users.Create(user)
+	} else {
+		err = s.users.Update(user)
+	}
+	if errors.Is(err, protocol.ErrUserExists) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	if token != "" {
+		if err := s.sendVerification(req.Context(), user, token); err != nil {
+			writeError(w, err, contextStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// PasskeyLogInBeginHandler handles requests to begin logging a passwordless user in with a passkey
+// Passwordless users return the ceremony's options for the client's authenticator and a 2XX status
+// Malformed requests, nonexistent and unverified users, and users with a password or without passkeys return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) PasskeyLogInBeginHandler(w http.ResponseWriter, req *http.Request) {
+	var beginRequest protocol.PasskeyBeginRequest
+	if err := json.NewDecoder(req.Body).Decode(&beginRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.users.Get(beginRequest.Username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	if user.EncryptedSecret != nil || user.SRP != nil || user.OPAQUE != nil {
+		writeError(w, errPasswordUser, http.StatusBadRequest)
+		return
+	} else if len(user.Passkeys) == 0 {
+		writeError(w, errNoPasskeys, http.StatusBadRequest)
+		return
+	}
+
+	passkeyCeremony, err := s.beginPasskeyLogIn(user, false)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, passkeyCeremony)
+}
+
+// PasskeyLogInFinishHandler handles requests to finish logging in with the authenticator's assertion
+// Ceremonies are begun at PasskeyLogInBeginPath by passwordless users, and by second login requests for users with a password and passkeys
+// Valid assertions return a session token and a 2XX status
+// Malformed requests, unknown or expired ceremonies, invalid assertions, and passkeys that may be cloned return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) PasskeyLogInFinishHandler(w http.ResponseWriter, req *http.Request) {
+	var finishRequest protocol.PasskeyFinishRequest
+	if err := json.NewDecoder(req.Body).Decode(&finishRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	c, ok := s.takeCeremony(&finishRequest, false)
+	if !ok {
+		writeError(w, protocol.ErrUnknownChallenge, http.StatusNotFound)
+		return
+	}
+
+	parsed, err := webauthnprotocol.ParseCredentialRequestResponseBody(bytes.NewReader(finishRequest.Credential))
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.users.Get(c.username)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	credential, err := s.webAuthn.ValidateLogin((*webAuthnUser)(&user), c.session, parsed)
+	if err != nil {
+		s.logInFailed(user.Username, req.RemoteAddr, finishRequest.CeremonyID, c.recovery)
+		writeError(w, protocol.ErrInvalidCredentials, http.StatusForbidden)
+		return
+	}
+	if credential.Authenticator.CloneWarning {
+		s.logInFailed(user.Username, req.RemoteAddr, finishRequest.CeremonyID, c.recovery)
+		writeError(w, errClonedPasskey, http.StatusForbidden)
+		return
+	}
+
+	for i := range user.Passkeys {
+		if bytes.Equal(user.Passkeys[i].ID, credential.ID) {
+			user.Passkeys[i].Authenticator.SignCount = credential.Authenticator.SignCount
+		}
+	}
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+
+	logInResponse, err := s.issue(user.Username, c.recovery)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.logInSucceeded(user.Username, req.RemoteAddr, finishRequest.CeremonyID, c.recovery)
+
+	s.setSessionCookies(w, logInResponse)
+	writeJSON(w, http.StatusOK, logInResponse)
+}
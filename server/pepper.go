@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// PepperKeyName names the pepper mixed into secrets before they're hashed
+	PepperKeyName = "pepper"
+	// pepperIDByteLen is the length of the ids that record which pepper a hash was made with
+	pepperIDByteLen = 8
+)
+
+var errUnknownPepper = errors.New("secret hash made with an unknown pepper")
+
+// pepperID returns the id that records a pepper in users' profiles, which is a truncated hash that doesn't reveal it
+func pepperID(pepper []byte) string {
+	id := sha256.Sum256(append([]byte("hauth pepper id\x00"), pepper...))
+	return base64.RawStdEncoding.EncodeToString(id[:pepperIDByteLen])
+}
+
+// applyPepper returns a secret mixed with a pepper by HMAC-SHA256, to be hashed in its place
+func applyPepper(pepper, secret []byte) []byte {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// peppers returns the versions of a Server's pepper, current first, or none if it has no pepper
+// A KeyProvider without a pepper leaves secrets unpeppered, while any other failure to fetch it is returned
+func (s *Server) peppers() ([][]byte, error) {
+	if s.pepper != nil {
+		return [][]byte{s.pepper}, nil
+	}
+	if s.keyProvider == nil {
+		return nil, nil
+	}
+
+	peppers, err := s.keyProvider.Keys(context.Background(), PepperKeyName)
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, nil
+	}
+
+	return peppers, err
+}
+
+// hashSecret returns the hash of a salted secret mixed with a Server's current pepper, if it has one, and the pepper's id
+func (s *Server) hashSecret(salt, secret []byte) ([]byte, string, error) {
+	peppers, err := s.peppers()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var id string
+	if len(peppers) > 0 {
+		id, secret = pepperID(peppers[0]), applyPepper(peppers[0], secret)
+	}
+
+	hash, err := s.hasher.Hash(salt, secret)
+	return hash, id, err
+}
+
+// verifySecret returns whether a secret matches a user's salted hash, using the Hasher and version of the pepper that made it
+func (s *Server) verifySecret(user User, secret []byte) (bool, error) {
+	hasher, err := ParseHasher(user.Hasher)
+	if err != nil {
+		return false, err
+	}
+
+	if user.Pepper != "" {
+		peppers, err := s.peppers()
+		if err != nil {
+			return false, err
+		}
+
+		found := false
+		for _, pepper := range peppers {
+			if pepperID(pepper) == user.Pepper {
+				secret, found = applyPepper(pepper, secret), true
+				break
+			}
+		}
+		if !found {
+			return false, fmt.Errorf("%w: %s", errUnknownPepper, user.Username)
+		}
+	}
+
+	hash, err := hasher.Hash(user.Salt, secret)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(hash, user.SecretHash) == 1, nil
+}
+
+// rehashed returns a fresh salt and hash of a verified secret, and the id of the pepper it was mixed with,
+// if its hash wasn't made with the Server's current Hasher and pepper, or false if it was or rehashing fails
+func (s *Server) rehashed(hasherName, pepperName string, secret []byte) ([]byte, []byte, string, bool) {
+	peppers, err := s.peppers()
+	if err != nil {
+		return nil, nil, "", false
+	}
+
+	var currentPepper string
+	if len(peppers) > 0 {
+		currentPepper = pepperID(peppers[0])
+	}
+	if hasherName == s.hasher.Name() && pepperName == currentPepper {
+		return nil, nil, "", false
+	}
+
+	salt := make([]byte, s.saltByteLen)
+	if _, err := io.ReadFull(s.entropy, salt); err != nil {
+		return nil, nil, "", false
+	}
+	hash, pepper, err := s.hashSecret(salt, secret)
+	if err != nil {
+		return nil, nil, "", false
+	}
+
+	return hash, salt, pepper, true
+}
+
+// rehashSecret replaces a verified user's secret hash if it wasn't made with the Server's current Hasher and pepper,
+// so rotated peppers and legacy hashes are upgraded as users log in
+// It is best effort, since the old hash still verifies if the upgrade fails, and is skipped if the secret was changed since it was verified
+func (s *Server) rehashSecret(user User, secret []byte) {
+	hash, salt, pepper, ok := s.rehashed(user.Hasher, user.Pepper, secret)
+	if !ok {
+		return
+	}
+
+	err := s.updateUser(user.Username, func(stored *User) error {
+		if !bytes.Equal(stored.SecretHash, user.SecretHash) {
+			return protocol.ErrUserChanged
+		}
+
+		stored.SecretHash, stored.Salt, stored.Hasher, stored.Pepper = hash, salt, s.hasher.Name(), pepper
+		return nil
+	})
+	if !errors.Is(err, protocol.ErrUserChanged) {
+		logUpdateError("rehashing the secret", user.Username, err)
+	}
+}
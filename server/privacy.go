@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// erasureMaxAuthAge is how recently a session's user must have logged in for it to erase them, so sessions left logged in can't
+const erasureMaxAuthAge = 10 * time.Minute
+
+var (
+	errUnerasableStore   = errors.New("user store can't erase its users")
+	errErasureMismatch   = errors.New("erasure request doesn't name the session's user")
+	errErasureUnverified = errors.New("erased user is still stored")
+)
+
+// credentialKinds returns the kinds of credential a user logs in with, as DataExport lists them
+func credentialKinds(user User) []string {
+	kinds := []string{}
+	if user.EncryptedSecret != nil {
+		kinds = append(kinds, "password")
+	}
+	if user.Recovery != nil {
+		kinds = append(kinds, "recovery")
+	}
+	if user.SRP != nil {
+		kinds = append(kinds, "srp")
+	}
+	if user.OPAQUE != nil {
+		kinds = append(kinds, "opaque")
+	}
+	if len(user.Passkeys) > 0 {
+		kinds = append(kinds, "passkey")
+	}
+
+	return kinds
+}
+
+// ExportDataHandler handles requests for everything held about a session's user, in a DataExport
+// Unexpired sessions return their user's profile, credentials, remembered devices, API keys, active sessions, and login history, and a 2XX status
+// Missing, unknown, and expired sessions return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) ExportDataHandler(w http.ResponseWriter, req *http.Request) {
+	user, session, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	sessions, err := s.sessions.List(user.Username)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	dataExport := protocol.DataExport{
+		Username:          user.Username,
+		Email:             user.Email,
+		EmailVerified:     user.Email != "" && user.Verification == nil,
+		Status:            user.status(),
+		Roles:             user.Roles,
+		Claims:            user.Claims,
+		CreatedAt:         recordedTime(user.CreatedAt),
+		LastLogInAt:       recordedTime(user.LastLogInAt),
+		FailedLogIns:      user.FailedLogIns,
+		LastFailedLogInAt: recordedTime(user.LastFailedLogInAt),
+		Credentials:       credentialKinds(user),
+		Devices:           []protocol.DeviceInfo{},
+		APIKeys:           []protocol.APIKeyInfo{},
+		Sessions:          make([]protocol.SessionInfo, len(sessions)),
+		LogInHistory:      s.logInHistoryResponse(user).Attempts,
+		ExportedAt:        time.Now(),
+	}
+	if user.EncryptedSecret != nil {
+		dataExport.SecretCreatedAt = recordedTime(user.SecretCreatedAt)
+		dataExport.SecurityLevel = user.securityLevel()
+	}
+	for _, device := range activeDevices(user.Devices) {
+		dataExport.Devices = append(dataExport.Devices, protocol.DeviceInfo{
+			ID:         device.ID,
+			Name:       device.Name,
+			Bound:      len(device.FingerprintHash) > 0,
+			CreatedAt:  device.CreatedAt,
+			LastUsedAt: device.LastUsedAt,
+			ExpiresAt:  device.ExpiresAt,
+		})
+	}
+	for _, apiKey := range activeAPIKeys(user.APIKeys) {
+		dataExport.APIKeys = append(dataExport.APIKeys, apiKey.info())
+	}
+	for i, listed := range sessions {
+		dataExport.Sessions[i] = protocol.SessionInfo{
+			ID:        listed.ID,
+			Recovery:  listed.Recovery,
+			AuthTime:  listed.AuthTime,
+			IssuedAt:  listed.IssuedAt,
+			ExpiresAt: listed.ExpiresAt,
+			Current:   listed.ID == session.ID,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &dataExport)
+}
+
+// EraseAccountHandler handles requests that delete a session's user, which must name them again and come from a login within erasureMaxAuthAge
+// Their record, including their ciphertexts, credentials, devices, API keys, and login history, is deleted and checked to be gone, and their sessions are revoked,
+// then an EventUserErased is sent as the tombstone that tells audit trails downstream to drop the user's records, and a 2XX status is returned
+// Malformed requests, requests naming another user, missing, unknown, and expired sessions, and sessions whose login is too old return a 4XX status
+// User stores that can't erase their users, and store errors, return a 5XX status
+func (s *Server) EraseAccountHandler(w http.ResponseWriter, req *http.Request) {
+	var eraseRequest protocol.EraseAccountRequest
+	if err := json.NewDecoder(req.Body).Decode(&eraseRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, session, status, err := s.sessionUser(req)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	} else if !s.sameUser(user.Username, eraseRequest.Username) {
+		writeError(w, errErasureMismatch, http.StatusBadRequest)
+		return
+	} else if time.Since(session.AuthTime) > erasureMaxAuthAge {
+		writeError(w, protocol.ErrLogInRequired, http.StatusForbidden)
+		return
+	}
+
+	eraser, ok := s.users.(UserEraser)
+	if !ok {
+		writeError(w, errUnerasableStore, http.StatusNotImplemented)
+		return
+	}
+
+	if err := eraser.Erase(user.Username); errors.Is(err, errUnerasableStore) {
+		writeError(w, err, http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if err := s.sessions.RevokeUser(user.Username); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if _, err := s.users.Get(user.Username); !errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, errErasureUnverified, http.StatusInternalServerError)
+		return
+	}
+	s.notify(EventUserErased, user.Username, session.Recovery)
+
+	writeJSON(w, http.StatusOK, &protocol.EraseAccountResponse{Username: user.Username, ErasedAt: time.Now()})
+}
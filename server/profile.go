@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// userUpdateAttempts is how many times updateUser reads and updates a user other requests keep updating before it gives up
+const userUpdateAttempts = 3
+
+// recordLogIn records a login attempt of a user on their profile and in their login history, resetting their failed logins if it succeeded, or counting it if it failed
+// It is best effort, since the login's outcome doesn't depend on it, and only changes the fields it records on the stored user, so it can't undo other updates
+func (s *Server) recordLogIn(username string, attempt protocol.LogInAttempt) {
+	attempt.At = time.Now()
+	err := s.updateUser(username, func(user *User) error {
+		if attempt.Succeeded {
+			user.LastLogInAt, user.FailedLogIns = attempt.At, 0
+		} else {
+			user.LastFailedLogInAt, user.FailedLogIns = attempt.At, user.FailedLogIns+1
+		}
+		user.recordAttempt(attempt, s.logInHistory)
+		return nil
+	})
+	logUpdateError("recording a login", username, err)
+}
+
+// logUpdateError logs the error of a best effort update of a user, which the request making it doesn't fail on, unless the user no longer exists
+func logUpdateError(what, username string, err error) {
+	if err != nil && !errors.Is(err, protocol.ErrUserDoesNotExist) {
+		log.Printf("%s of %s failed: %v", what, username, err)
+	}
+}
+
+// updateUser applies a change to the stored user of a username, re-reading and re-applying it while other requests update the user in between, up to userUpdateAttempts times
+// Changes return an error to abandon the update, such as protocol.ErrUserChanged if the user no longer has what the change was computed from
+func (s *Server) updateUser(username string, change func(*User) error) error {
+	for attempt := 1; ; attempt++ {
+		user, err := s.users.Get(username)
+		if err != nil {
+			return err
+		}
+		if err := change(&user); err != nil {
+			return err
+		}
+
+		if err := s.users.Update(user); !errors.Is(err, protocol.ErrUserChanged) || attempt == userUpdateAttempts {
+			return err
+		}
+	}
+}
+
+// recordedTime returns a time, or nil if it is zero and so wasn't recorded
+func recordedTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// findUser returns a user whichever way they log in, or writes the error response and returns false if they don't exist or can't be read
+func (s *Server) findUser(w http.ResponseWriter, username string) (User, bool) {
+	user, err := s.users.Get(username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, err, http.StatusBadRequest)
+		return User{}, false
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// ProfileHandler handles requests for the profile of a session's user
+// Unexpired sessions return their user's username, email address, signup and login times, failed logins, and security level, and a 2XX status
+// Missing, unknown, and expired sessions, and sessions of users that no longer exist, return a 4XX status
+// Session and user store errors return a 5XX status
+func (s *Server) ProfileHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	user, ok := s.findUser(w, session.Username)
+	if !ok {
+		return
+	}
+
+	profile := &protocol.ProfileResponse{
+		Username:          user.Username,
+		Email:             user.Email,
+		CreatedAt:         recordedTime(user.CreatedAt),
+		LastLogInAt:       recordedTime(user.LastLogInAt),
+		FailedLogIns:      user.FailedLogIns,
+		LastFailedLogInAt: recordedTime(user.LastFailedLogInAt),
+	}
+	if user.EncryptedSecret != nil {
+		profile.SecurityLevel = user.securityLevel()
+	}
+
+	writeJSON(w, http.StatusOK, profile)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxRateLimitedClients is the number of clients tracked before idle ones are forgotten
+	maxRateLimitedClients = 1 << 14
+	// rateLimitIdleTime is how long a client must be idle before it can be forgotten
+	rateLimitIdleTime = 10 * time.Minute
+)
+
+type (
+	// clientLimiter is a client's token bucket, when it last made a request, and whether that request was refused
+	clientLimiter struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+		refused  bool
+	}
+
+	// rateLimiter limits each client address, or other key, to a rate of requests with a burst
+	rateLimiter struct {
+		limit   rate.Limit
+		burst   int
+		clients map[string]*clientLimiter
+		mu      sync.Mutex
+	}
+)
+
+// makeRateLimiter returns a rateLimiter allowing each client a number of requests per second with a burst
+func makeRateLimiter(requestsPerSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Limit(requestsPerSecond),
+		burst:   burst,
+		clients: map[string]*clientLimiter{},
+	}
+}
+
+// clientHost returns the host of a client address, or the address itself if it has no port
+func clientHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// allow returns whether a client address may make a request now
+func (rl *rateLimiter) allow(addr string) bool {
+	return rl.allowKey(clientHost(addr))
+}
+
+// allowKey returns whether a key, such as a client's host, may make a request now
+func (rl *rateLimiter) allowKey(key string) bool {
+	allowed, _ := rl.take(key)
+	return allowed
+}
+
+// take returns whether a key may make a request now, and whether it is refused for the first time since its last allowed request
+func (rl *rateLimiter) take(key string) (bool, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if len(rl.clients) >= maxRateLimitedClients {
+		for h, c := range rl.clients {
+			if now.Sub(c.lastSeen) > rateLimitIdleTime {
+				delete(rl.clients, h)
+			}
+		}
+	}
+
+	c, ok := rl.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[key] = c
+	}
+	c.lastSeen = now
+
+	allowed := c.limiter.AllowN(now, 1)
+	lockedOut := !allowed && !c.refused
+	c.refused = !allowed
+	return allowed, lockedOut
+}
+
+// wrap returns a handler that rejects requests over a client's rate with a 4XX status
+func (rl *rateLimiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !rl.allow(req.RemoteAddr) {
+			writeError(w, errRateLimited, http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errPanicked = errors.New("request panicked")
+
+// Panics returns how many requests panicked while the server served them, over HTTP or any other transport,
+// which monitoring can export as a metric
+func (s *Server) Panics() uint64 {
+	return s.panics.Load()
+}
+
+// recovered logs a panic a request raised with its stack, counts it, and returns it as an error
+func (s *Server) recovered(r any, what string) error {
+	s.panics.Add(1)
+	log.Printf("panic serving %s: %v\n%s", what, r, debug.Stack())
+	return fmt.Errorf("%w: %v", errPanicked, r)
+}
+
+// withRecovery returns a handler that recovers panics raised serving requests, such as by crypto operations given hostile input,
+// which are logged with their stack and counted, and return a 5XX status, so they don't crash the server
+// Requests that panic after their response started are aborted instead
+func (s *Server) withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		recorder := &loggingResponseWriter{ResponseWriter: w}
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			} else if r == http.ErrAbortHandler {
+				panic(r)
+			}
+
+			s.recovered(r, req.Method+" "+req.URL.Path)
+			if recorder.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(w, protocol.ErrServer, http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(recorder, req)
+	})
+}
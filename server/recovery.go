@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// defaultRecoveryRequestsPerSecond is the rate of recovery logins allowed per user, one every ten minutes, whoever makes them
+	defaultRecoveryRequestsPerSecond = 1.0 / 600
+	// defaultRecoveryBurst is the number of recovery logins allowed per user in a burst
+	defaultRecoveryBurst = 3
+)
+
+var errNoRecovery = errors.New("user has no recovery secret")
+
+// credential returns the user itself, or with its recovery secret in place of its encrypted secret and hash if recovery is set,
+// so the login steps check either in the same way
+func (u User) credential(recovery bool) (User, error) {
+	if !recovery {
+		return u, nil
+	} else if u.Recovery == nil {
+		return User{}, errNoRecovery
+	}
+
+	u.KDFParams, u.EncryptedSecret = u.Recovery.KDFParams, u.Recovery.EncryptedSecret
+	u.SecretHash, u.Salt, u.Hasher, u.Pepper = u.Recovery.SecretHash, u.Recovery.Salt, u.Recovery.Hasher, u.Recovery.Pepper
+	u.SecretByteLen, u.SecurityLevel = u.Recovery.SecretByteLen, u.Recovery.SecurityLevel
+	u.Recovery, u.RetiredSecrets = nil, nil
+	return u, nil
+}
+
+// lookupCredential returns a user's credential, as lookupUser returns the user, or the status and error to return if it can't be found
+func (s *Server) lookupCredential(username string, recovery bool) (User, int, error) {
+	user, status, err := s.lookupUser(username)
+	if err != nil {
+		return User{}, status, err
+	}
+
+	credential, err := user.credential(recovery)
+	if err != nil {
+		return User{}, http.StatusBadRequest, err
+	}
+
+	return credential, http.StatusOK, nil
+}
+
+// getCredential writes the error response and returns false if a user's credential can't be found
+func (s *Server) getCredential(w http.ResponseWriter, username string, recovery bool) (User, bool) {
+	credential, status, err := s.lookupCredential(username, recovery)
+	if err != nil {
+		writeError(w, err, status)
+		return User{}, false
+	}
+
+	return credential, true
+}
+
+// allowRecovery returns whether a user may start a recovery login now, which is limited per user rather than per client address,
+// so recovery phrases can't be guessed from many addresses
+// The first refusal after an allowed login sends an EventLockout
+func (s *Server) allowRecovery(username string) bool {
+	if s.recoveryLimiter == nil {
+		return true
+	}
+
+	allowed, lockedOut := s.recoveryLimiter.take(username)
+	if lockedOut {
+		s.notify(EventLockout, username, true)
+	}
+
+	return allowed
+}
+
+// rehashRecovery replaces a verified user's recovery secret hash if it wasn't made with the Server's current Hasher and pepper, as rehashSecret does
+func (s *Server) rehashRecovery(user User, secret []byte) {
+	hash, salt, pepper, ok := s.rehashed(user.Recovery.Hasher, user.Recovery.Pepper, secret)
+	if !ok {
+		return
+	}
+
+	err := s.updateUser(user.Username, func(stored *User) error {
+		if stored.Recovery == nil || !bytes.Equal(stored.Recovery.SecretHash, user.Recovery.SecretHash) {
+			return protocol.ErrUserChanged
+		}
+
+		recovery := *stored.Recovery
+		recovery.SecretHash, recovery.Salt, recovery.Hasher, recovery.Pepper = hash, salt, s.hasher.Name(), pepper
+		stored.Recovery = &recovery
+		return nil
+	})
+	if !errors.Is(err, protocol.ErrUserChanged) {
+		logUpdateError("rehashing the recovery secret", user.Username, err)
+	}
+}
+
+// enrollRecovery returns the RecoverySecret of an enrollment, with its secret salted and hashed, or the status and error to return
+func (s *Server) enrollRecovery(enrollment *protocol.RecoveryEnrollment) (*RecoverySecret, int, error) {
+	if err := enrollment.KDFParams.Check(); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	secretByteLen, securityLevel, err := s.checkEnrollment(enrollment.EncryptedSecret, enrollment.Secret)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	salt := make([]byte, s.saltByteLen)
+	if _, err := io.ReadFull(s.entropy, salt); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	secretHash, pepper, err := s.hashSecret(salt, enrollment.Secret)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return &RecoverySecret{
+		KDFParams:       enrollment.KDFParams,
+		EncryptedSecret: enrollment.EncryptedSecret,
+		SecretHash:      secretHash,
+		Salt:            salt,
+		Hasher:          s.hasher.Name(),
+		Pepper:          pepper,
+		SecretByteLen:   secretByteLen,
+		SecurityLevel:   securityLevel,
+	}, http.StatusOK, nil
+}
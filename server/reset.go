@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// passwordResetTTL is how long a user has to reset their password with the token mailed to them
+const passwordResetTTL = time.Hour
+
+// errNoReset abandons the update of a user who isn't mailed a password reset token, which ResetPasswordBeginHandler doesn't reveal
+var errNoReset = errors.New("user isn't mailed a password reset")
+
+// sendPasswordReset mails a user the token that resets their password
+func (s *Server) sendPasswordReset(ctx context.Context, user User, token string) error {
+	body := fmt.Sprintf("Your password reset code for %s is %s\nIt expires in %d minutes. If you didn't ask to reset your password, ignore this message.",
+		user.Username, token, int(passwordResetTTL.Minutes()))
+
+	return s.mailer.Send(ctx, user.Email, "Reset your password", body)
+}
+
+// ResetPasswordBeginHandler handles requests to mail a user a token that resets their password
+// Well-formed requests return a 2XX status whether or not their user exists or is mailed a token, so they don't reveal which accounts exist
+// Users who can log in with a verified email address are mailed a token, unless a token mailed to them is still pending,
+// as often as the recovery rate limit allows each username, and store, entropy, and mail errors are logged instead of returned
+// Malformed requests return a 4XX status
+func (s *Server) ResetPasswordBeginHandler(w http.ResponseWriter, req *http.Request) {
+	var beginRequest protocol.ResetPasswordBeginRequest
+	if err := json.NewDecoder(req.Body).Decode(&beginRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if s.allowRecovery(beginRequest.Username) {
+		logUpdateError("password reset", beginRequest.Username, s.beginPasswordReset(req.Context(), beginRequest.Username))
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// beginPasswordReset mails a user a token that resets their password, unless they can't log in, have no email address, or have a pending token
+// Tokens that can't be mailed are dropped again, so the user can ask for another
+func (s *Server) beginPasswordReset(ctx context.Context, username string) error {
+	var user User
+	var token string
+	err := s.updateUser(username, func(stored *User) error {
+		if _, err := checkStatus(*stored); err != nil || stored.Email == "" {
+			return errNoReset
+		} else if stored.PasswordReset != nil && time.Now().Before(stored.PasswordReset.ExpiresAt) {
+			return errNoReset
+		}
+
+		var err error
+		token, stored.PasswordReset, err = s.mailedToken(passwordResetTTL)
+		user = *stored
+		return err
+	})
+	if errors.Is(err, errNoReset) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.sendPasswordReset(ctx, user, token); err != nil {
+		logUpdateError("removal of an unsent password reset", username, s.updateUser(username, func(stored *User) error {
+			if stored.PasswordReset == nil || !bytes.Equal(stored.PasswordReset.TokenHash, user.PasswordReset.TokenHash) {
+				return protocol.ErrUserChanged
+			}
+
+			stored.PasswordReset = nil
+			return nil
+		}))
+		return err
+	}
+
+	return nil
+}
+
+// ResetPasswordHandler handles requests to enroll a new password with a mailed reset token, or bearing the session of a recovery login
+// The user's encrypted secret, its hash, and their KDF parameters are replaced in one update, or their SRP verifier or OPAQUE record is if the request enrolls one,
+// which also drops any recovery secret, every retired secret, session, and remembered device of the user is revoked, and a 2XX status is returned
+// Malformed requests, nonexistent users, users without a pending reset, invalid or expired tokens, sessions of other users or logins,
+// and tokens another request used while this one was hashed return a 4XX status
+// Store, hashing, and entropy errors return a 5XX status
+func (s *Server) ResetPasswordHandler(w http.ResponseWriter, req *http.Request) {
+	var resetRequest protocol.ResetPasswordRequest
+	if err := json.NewDecoder(req.Body).Decode(&resetRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var secretByteLen, securityLevel int
+	var err error
+	if resetRequest.SRP != nil {
+		err = checkSRPEnrollment(resetRequest.SRP)
+	} else if resetRequest.OPAQUE != nil {
+		err = s.checkOPAQUEEnrollment(resetRequest.OPAQUE)
+	} else if err = resetRequest.KDFParams.Check(); err == nil {
+		secretByteLen, securityLevel, err = s.checkEnrollment(resetRequest.EncryptedSecret, resetRequest.Secret)
+	}
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.users.Get(resetRequest.Username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	if token, ok := bearerToken(req); ok && resetRequest.Token == "" {
+		session, status, err := s.lookupSession(token)
+		if err != nil {
+			writeError(w, err, status)
+			return
+		} else if !session.Recovery || session.Username != user.Username {
+			writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+			return
+		}
+	} else if user.PasswordReset == nil {
+		writeError(w, protocol.ErrUnknownChallenge, http.StatusNotFound)
+		return
+	} else if status, err := user.PasswordReset.check(resetRequest.Token); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	var salt, secretHash []byte
+	var pepper string
+	if resetRequest.SRP == nil && resetRequest.OPAQUE == nil {
+		salt = make([]byte, s.saltByteLen)
+		if _, err := io.ReadFull(s.entropy, salt); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if secretHash, pepper, err = s.hashSecret(salt, resetRequest.Secret); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := s.updateUser(user.Username, func(stored *User) error {
+		if resetRequest.Token != "" && (stored.PasswordReset == nil || !bytes.Equal(stored.PasswordReset.TokenHash, user.PasswordReset.TokenHash)) {
+			return protocol.ErrUserChanged
+		}
+
+		if resetRequest.SRP != nil {
+			stored.KDFParams, stored.EncryptedSecret, stored.SecretHash, stored.Salt, stored.Recovery = nil, nil, nil, nil, nil
+			stored.SRP, stored.OPAQUE = &SRPVerifier{KDFParams: resetRequest.SRP.KDFParams, Verifier: resetRequest.SRP.Verifier}, nil
+		} else if resetRequest.OPAQUE != nil {
+			stored.KDFParams, stored.EncryptedSecret, stored.SecretHash, stored.Salt, stored.Recovery = nil, nil, nil, nil, nil
+			stored.SRP, stored.OPAQUE = nil, &OPAQUERecord{Nonce: resetRequest.OPAQUE.Nonce, Record: resetRequest.OPAQUE.Record, Salt: resetRequest.OPAQUE.Salt}
+		} else {
+			stored.KDFParams, stored.EncryptedSecret = resetRequest.KDFParams, resetRequest.EncryptedSecret
+			stored.SecretByteLen, stored.SecurityLevel = secretByteLen, securityLevel
+			stored.SecretHash, stored.Salt, stored.Hasher, stored.Pepper = secretHash, salt, s.hasher.Name(), pepper
+			stored.SecretCreatedAt, stored.SRP, stored.OPAQUE = time.Now(), nil, nil
+		}
+		stored.PasswordReset, stored.Devices, stored.APIKeys, stored.RetiredSecrets = nil, nil, nil, nil
+		return nil
+	}); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+	if err := s.sessions.RevokeUser(user.Username); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.notify(EventPasswordChanged, user.Username, resetRequest.Token == "")
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// RiskAllow lets a login go ahead
+	RiskAllow RiskDecision = iota
+	// RiskStepUp refuses a login until it is retried with a step-up token that the RiskAssessor accepts
+	RiskStepUp
+	// RiskDeny refuses a login
+	RiskDeny
+)
+
+// failureWindow is how long failed logins count towards a user's or address's recent failures after the last one
+const failureWindow = 15 * time.Minute
+
+type (
+	// RiskDecision is what a RiskAssessor decides to do with a login
+	RiskDecision int
+
+	// LogInAttempt is a first login request, the client address it came from, and the failed logins of its user and address in the last window
+	LogInAttempt struct {
+		RemoteAddr      string
+		Username        string
+		Recovery        bool
+		StepUpToken     string
+		UserFailures    int
+		AddressFailures int
+		LastFailure     time.Time
+	}
+
+	// RiskAssessment is a RiskAssessor's decision about a login, and how long to delay the login before acting on it
+	RiskAssessment struct {
+		Decision RiskDecision
+		Delay    time.Duration
+	}
+
+	// RiskAssessor assesses each login before its challenge is computed, so operators can wire in their fraud systems
+	RiskAssessor interface {
+		// Assess returns the assessment of a login attempt, unless the context is done first
+		Assess(ctx context.Context, attempt LogInAttempt) (RiskAssessment, error)
+	}
+
+	// failureCount is the number of failed logins since they were last reset, and when the last one was
+	failureCount struct {
+		count int
+		last  time.Time
+	}
+
+	// failureLog counts recent failed logins by key, such as a username or client host
+	failureLog struct {
+		failures map[string]*failureCount
+		mu       sync.Mutex
+	}
+)
+
+// makeFailureLog returns an empty failureLog
+func makeFailureLog() *failureLog {
+	return &failureLog{failures: map[string]*failureCount{}}
+}
+
+// record counts a failed login for a key, restarting its count if its last failure is outside the window
+func (fl *failureLog) record(key string) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	now := time.Now()
+	if len(fl.failures) >= maxRateLimitedClients {
+		for k, f := range fl.failures {
+			if now.Sub(f.last) > failureWindow {
+				delete(fl.failures, k)
+			}
+		}
+	}
+
+	f, ok := fl.failures[key]
+	if !ok || now.Sub(f.last) > failureWindow {
+		f = &failureCount{}
+		fl.failures[key] = f
+	}
+	f.count++
+	f.last = now
+}
+
+// recent returns the number of a key's failed logins in the window, and when the last one was
+func (fl *failureLog) recent(key string) (int, time.Time) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	f, ok := fl.failures[key]
+	if !ok || time.Since(f.last) > failureWindow {
+		return 0, time.Time{}
+	}
+
+	return f.count, f.last
+}
+
+// logInFailed records a failed login of a user from a client address, answering a challenge or ceremony if its id isn't empty, also on their profile,
+// and sends an EventLogInFailed
+func (s *Server) logInFailed(username, remoteAddr, challengeID string, recovery bool) {
+	s.failures.record("user:" + username)
+	s.failures.record("addr:" + clientHost(remoteAddr))
+	s.recordLogIn(username, protocol.LogInAttempt{IP: clientHost(remoteAddr), Recovery: recovery, ChallengeID: challengeID})
+	s.notify(EventLogInFailed, username, recovery)
+}
+
+// logInSucceeded records a successful login of a user from a client address, answering a challenge or ceremony if its id isn't empty, on their profile,
+// and sends an EventLogInSucceeded
+func (s *Server) logInSucceeded(username, remoteAddr, challengeID string, recovery bool) {
+	s.recordLogIn(username, protocol.LogInAttempt{IP: clientHost(remoteAddr), Succeeded: true, Recovery: recovery, ChallengeID: challengeID})
+	s.notify(EventLogInSucceeded, username, recovery)
+}
+
+// assessRisk asks the server's RiskAssessor, if it has one, about a first login request from a client address for the user stored under a username,
+// waiting out any delay it asks for,
+// and returns the status and error to refuse the login with
+func (s *Server) assessRisk(ctx context.Context, remoteAddr, username string, firstLogInRequest *protocol.FirstLogInRequest) (int, error) {
+	if s.riskAssessor == nil {
+		return http.StatusOK, nil
+	}
+
+	attempt := LogInAttempt{
+		RemoteAddr:  remoteAddr,
+		Username:    username,
+		Recovery:    firstLogInRequest.Recovery,
+		StepUpToken: firstLogInRequest.StepUpToken,
+	}
+	attempt.UserFailures, attempt.LastFailure = s.failures.recent("user:" + username)
+	attempt.AddressFailures, _ = s.failures.recent("addr:" + clientHost(remoteAddr))
+
+	assessment, err := s.riskAssessor.Assess(ctx, attempt)
+	if err != nil {
+		return contextStatus(err, http.StatusInternalServerError), err
+	}
+
+	if assessment.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return http.StatusServiceUnavailable, ctx.Err()
+		case <-time.After(assessment.Delay):
+		}
+	}
+
+	switch assessment.Decision {
+	case RiskStepUp:
+		return http.StatusForbidden, protocol.ErrStepUpRequired
+	case RiskDeny:
+		return http.StatusForbidden, protocol.ErrDenied
+	}
+
+	return http.StatusOK, nil
+}
+
+// screenLogIn assesses the risk of a first login request from a client address for the user stored under a username, then checks its CAPTCHA token if the login must solve one,
+// returning the status and error to refuse the login with
+func (s *Server) screenLogIn(ctx context.Context, remoteAddr, username string, firstLogInRequest *protocol.FirstLogInRequest) (int, error) {
+	if status, err := s.assessRisk(ctx, remoteAddr, username, firstLogInRequest); err != nil {
+		return status, err
+	}
+
+	if s.captchaLogIn(username, remoteAddr) {
+		return s.checkCaptcha(ctx, firstLogInRequest.CaptchaToken, remoteAddr)
+	}
+
+	return http.StatusOK, nil
+}
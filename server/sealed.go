@@ -0,0 +1,257 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+)
+
+// masterKeyByteLen is the length of master keys and the data keys they seal
+const masterKeyByteLen = 32
+
+var ErrSealedUser = errors.New("can't open sealed user")
+
+type (
+	// SealedFields are a user's SecretHash, Salt, EncryptedSecret, Recovery, and RetiredSecrets sealed with AES-256-GCM under a data key of their own,
+	// and that data key sealed under a master key, each nonce first and bound to the username
+	SealedFields struct {
+		DataKey []byte `json:"DataKey"`
+		Fields  []byte `json:"Fields"`
+	}
+
+	// sealedFields are the fields of a User a SealedStore seals
+	sealedFields struct {
+		EncryptedSecret gates.Ctxt
+		SecretHash      []byte
+		Salt            []byte
+		Recovery        *RecoverySecret `json:",omitempty"`
+		RetiredSecrets  []RetiredSecret `json:",omitempty"`
+		SRP             *SRPVerifier    `json:",omitempty"`
+		OPAQUE          *OPAQUERecord   `json:",omitempty"`
+	}
+
+	// SealedStore is a UserStore that seals users' SecretHash, Salt, EncryptedSecret, Recovery, RetiredSecrets, SRP verifier, and OPAQUE record under a master key before storing them in another UserStore,
+	// so the other store's contents are useless without the master key
+	// Users stored before sealing are returned as they are, and sealed when they're next updated
+	// Users are sealed under the current master key, and opened with whichever version of it they were sealed under
+	SealedStore struct {
+		store      UserStore
+		masterKeys func() ([]cipher.AEAD, error)
+		entropy    crypto.EntropySource
+	}
+)
+
+// NewMasterKey returns the AES-256-GCM cipher of a 32 byte master key
+func NewMasterKey(key []byte) (cipher.AEAD, error) {
+	if len(key) != masterKeyByteLen {
+		return nil, fmt.Errorf("master keys are %d bytes, not %d", masterKeyByteLen, len(key))
+	}
+
+	return newGCM(key)
+}
+
+// newGCM returns the AES-GCM cipher of a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// NewSealedStore returns a SealedStore in front of a UserStore that seals users under a master key, with data keys and nonces from an EntropySource
+func NewSealedStore(store UserStore, master cipher.AEAD, entropy crypto.EntropySource) *SealedStore {
+	return &SealedStore{
+		store: store,
+		masterKeys: func() ([]cipher.AEAD, error) {
+			return []cipher.AEAD{master}, nil
+		},
+		entropy: entropy,
+	}
+}
+
+// NewProvidedSealedStore returns a SealedStore in front of a UserStore that seals users under the master key of a KeyProvider,
+// with data keys and nonces from an EntropySource
+// The KeyProvider is asked for the master key on every call, so it should cache it, as a CachingKeyProvider does
+func NewProvidedSealedStore(store UserStore, provider KeyProvider, entropy crypto.EntropySource) *SealedStore {
+	return &SealedStore{
+		store:      store,
+		masterKeys: providedMasterKeys(provider),
+		entropy:    entropy,
+	}
+}
+
+// seal returns a plaintext sealed under an AEAD with a fresh nonce, which it is prefixed with
+func (ss *SealedStore) seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(ss.entropy, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open returns the plaintext of a ciphertext sealed by seal
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrSealedUser
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrSealedUser
+	}
+
+	return plaintext, nil
+}
+
+// sealUser returns a user with its SecretHash, Salt, EncryptedSecret, Recovery, RetiredSecrets, SRP verifier, and OPAQUE record replaced by their SealedFields
+func (ss *SealedStore) sealUser(user User) (User, error) {
+	fields, err := json.Marshal(&sealedFields{
+		EncryptedSecret: user.EncryptedSecret,
+		SecretHash:      user.SecretHash,
+		Salt:            user.Salt,
+		Recovery:        user.Recovery,
+		RetiredSecrets:  user.RetiredSecrets,
+		SRP:             user.SRP,
+		OPAQUE:          user.OPAQUE,
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	key := make([]byte, masterKeyByteLen)
+	if _, err := io.ReadFull(ss.entropy, key); err != nil {
+		return User{}, err
+	}
+	dataKey, err := newGCM(key)
+	if err != nil {
+		return User{}, err
+	}
+
+	masterKeys, err := ss.masterKeys()
+	if err != nil {
+		return User{}, err
+	}
+
+	username := []byte(user.Username)
+	sealed := &SealedFields{}
+	if sealed.DataKey, err = ss.seal(masterKeys[0], key, username); err != nil {
+		return User{}, err
+	}
+	if sealed.Fields, err = ss.seal(dataKey, fields, username); err != nil {
+		return User{}, err
+	}
+
+	user.EncryptedSecret, user.SecretHash, user.Salt, user.Recovery, user.SRP, user.OPAQUE, user.Sealed = nil, nil, nil, nil, nil, nil, sealed
+	user.RetiredSecrets = nil
+	return user, nil
+}
+
+// openUser returns a user with its SealedFields opened, or unchanged if it isn't sealed
+func (ss *SealedStore) openUser(user User) (User, error) {
+	if user.Sealed == nil {
+		return user, nil
+	}
+
+	masterKeys, err := ss.masterKeys()
+	if err != nil {
+		return User{}, err
+	}
+
+	username := []byte(user.Username)
+	var key []byte
+	for _, masterKey := range masterKeys {
+		if key, err = open(masterKey, user.Sealed.DataKey, username); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("%w: %s", err, user.Username)
+	}
+	dataKey, err := newGCM(key)
+	if err != nil {
+		return User{}, err
+	}
+	fields, err := open(dataKey, user.Sealed.Fields, username)
+	if err != nil {
+		return User{}, fmt.Errorf("%w: %s", err, user.Username)
+	}
+
+	var opened sealedFields
+	if err := json.Unmarshal(fields, &opened); err != nil {
+		return User{}, err
+	}
+
+	user.EncryptedSecret, user.SecretHash, user.Salt, user.Recovery, user.SRP, user.OPAQUE, user.Sealed = opened.EncryptedSecret, opened.SecretHash, opened.Salt, opened.Recovery, opened.SRP, opened.OPAQUE, nil
+	user.RetiredSecrets = opened.RetiredSecrets
+	return user, nil
+}
+
+// Create seals a new user and stores it in a SealedStore's UserStore
+func (ss *SealedStore) Create(user User) error {
+	sealed, err := ss.sealUser(user)
+	if err != nil {
+		return err
+	}
+
+	return ss.store.Create(sealed)
+}
+
+// Get returns a user from a SealedStore's UserStore, opening its SealedFields
+func (ss *SealedStore) Get(username string) (User, error) {
+	user, err := ss.store.Get(username)
+	if err != nil {
+		return User{}, err
+	}
+
+	return ss.openUser(user)
+}
+
+// Update seals a user and replaces it in a SealedStore's UserStore
+func (ss *SealedStore) Update(user User) error {
+	sealed, err := ss.sealUser(user)
+	if err != nil {
+		return err
+	}
+
+	return ss.store.Update(sealed)
+}
+
+// Erase deletes a user from a SealedStore's UserStore, if the UserStore is a UserEraser
+func (ss *SealedStore) Erase(username string) error {
+	eraser, ok := ss.store.(UserEraser)
+	if !ok {
+		return errUnerasableStore
+	}
+
+	return eraser.Erase(username)
+}
+
+// List returns every user in a SealedStore's UserStore, opened, if the UserStore is a UserLister
+func (ss *SealedStore) List() ([]User, error) {
+	lister, ok := ss.store.(UserLister)
+	if !ok {
+		return nil, errUnlistableStore
+	}
+
+	users, err := lister.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if users[i], err = ss.openUser(users[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// defaultSecretGracePeriod is how long a replaced secret still logs its user in, unless the server is built WithSecretGracePeriod
+const defaultSecretGracePeriod = 10 * time.Minute
+
+// withSecret returns a user with the retired secret whose KDFParams have a salt in place of their current secret, and true, if it hasn't expired by a time,
+// or the user itself and false if the salt is empty, their current KDFParams', or no unexpired retired secret's,
+// so logins begun with the KDFParams of a password that has since changed can finish until its secret expires
+func (u User) withSecret(kdfSalt []byte, now time.Time) (User, bool) {
+	if len(kdfSalt) == 0 || u.KDFParams != nil && bytes.Equal(kdfSalt, u.KDFParams.Salt) {
+		return u, false
+	}
+
+	for _, retired := range u.RetiredSecrets {
+		if retired.KDFParams == nil || !bytes.Equal(kdfSalt, retired.KDFParams.Salt) || !now.Before(retired.ExpiresAt) {
+			continue
+		}
+
+		u.KDFParams, u.EncryptedSecret = retired.KDFParams, retired.EncryptedSecret
+		u.SecretHash, u.Salt, u.Hasher, u.Pepper = retired.SecretHash, retired.Salt, retired.Hasher, retired.Pepper
+		u.SecretByteLen, u.SecurityLevel = retired.SecretByteLen, retired.SecurityLevel
+		return u, true
+	}
+
+	return u, false
+}
+
+// retireSecret keeps a user's current secret among their RetiredSecrets for a grace period from a time, before it is replaced, and drops those that expired,
+// where a grace period that isn't positive keeps none
+func (u *User) retireSecret(now time.Time, gracePeriod time.Duration) {
+	retired := u.RetiredSecrets[:0:0]
+	for _, secret := range u.RetiredSecrets {
+		if now.Before(secret.ExpiresAt) {
+			retired = append(retired, secret)
+		}
+	}
+
+	if gracePeriod > 0 && u.EncryptedSecret != nil {
+		retired = append(retired, RetiredSecret{
+			KDFParams:       u.KDFParams,
+			EncryptedSecret: u.EncryptedSecret,
+			SecretHash:      u.SecretHash,
+			Salt:            u.Salt,
+			Hasher:          u.Hasher,
+			Pepper:          u.Pepper,
+			SecretByteLen:   u.secretByteLen(),
+			SecurityLevel:   u.securityLevel(),
+			RetiredAt:       now,
+			ExpiresAt:       now.Add(gracePeriod),
+		})
+	}
+
+	if len(retired) == 0 {
+		retired = nil
+	}
+	u.RetiredSecrets = retired
+}
+
+// rotationRequired returns whether a user's secret is older than the server's secret max age at a time, where a max age of zero never requires rotation
+func (s *Server) rotationRequired(user User, now time.Time) bool {
+	return s.secretMaxAge > 0 && user.EncryptedSecret != nil && !now.Before(user.SecretCreatedAt.Add(s.secretMaxAge))
+}
+
+// RotateSecretHandler handles requests that replace a session's user's secret with a new enrollment, as at sign up, under their password stretched with fresh KDF parameters
+// The old secret is retired for the server's secret grace period, so logins begun with it can finish, and a 2XX status is returned
+// Missing, unknown, expired, and recovery sessions, malformed requests, invalid enrollments, and users without an encrypted secret return a 4XX status
+// Store, hashing, and entropy errors return a 5XX status
+func (s *Server) RotateSecretHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	} else if session.Recovery {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	var rotateRequest protocol.RotateSecretRequest
+	if err := json.NewDecoder(req.Body).Decode(&rotateRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := rotateRequest.KDFParams.Check(); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	secretByteLen, securityLevel, err := s.checkEnrollment(rotateRequest.EncryptedSecret, rotateRequest.Secret)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.getUser(w, session.Username)
+	if !ok {
+		return
+	}
+
+	salt := make([]byte, s.saltByteLen)
+	if _, err := io.ReadFull(s.entropy, salt); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	secretHash, pepper, err := s.hashSecret(salt, rotateRequest.Secret)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	user.retireSecret(now, s.secretGracePeriod)
+	user.KDFParams, user.EncryptedSecret = rotateRequest.KDFParams, rotateRequest.EncryptedSecret
+	user.SecretByteLen, user.SecurityLevel = secretByteLen, securityLevel
+	user.SecretHash, user.Salt, user.Hasher, user.Pepper = secretHash, salt, s.hasher.Name(), pepper
+	user.SecretCreatedAt = now
+	if err := s.users.Update(user); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+	s.notify(EventSecretRotated, user.Username, false)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,978 @@
+// Package server implements the signup and login service as an http.Handler
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/crypto/circuit"
+	"github.com/zambozoo/homomorphic-authentication/crypto/opaque"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// defaultSaltByteLen is the default length of the salt stored with each user's secret hash
+const defaultSaltByteLen = 16
+
+// defaultMaxEvaluations is the default number of circuits a server evaluates at once
+const defaultMaxEvaluations = 2
+
+var (
+	errEvaluateMismatch = errors.New("evaluate request doesn't name the session's user")
+	errNotPosted        = errors.New("request must be posted")
+)
+
+var (
+	// defaultCircuitLimits bounds the circuits a server evaluates, where each bootstrapped gate takes tens of milliseconds of CPU
+	defaultCircuitLimits = circuit.Limits{
+		MaxGates:     1 << 8,
+		MaxDepth:     8,
+		MaxInputBits: 1 << 14,
+	}
+
+	// defaultBackend rebuilds the TFHE Packets of users' public keys
+	defaultBackend = crypto.MakeTFHEBackend(gates.DefaultGateBootstrappingParameters(128))
+
+	// defaultHasher hashes new users' secrets
+	defaultHasher = Argon2idHasher{
+		Time:    1,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}
+)
+
+var (
+	errReservedInput   = errors.New("circuit input " + protocol.SecretInputName + " is reserved")
+	errMalformedReMask = errors.New("re-mask doesn't match the encrypted secret")
+	errRateLimited     = errors.New("too many requests")
+)
+
+// Server is an http.Handler for the signup and login service
+type Server struct {
+	entropy              crypto.EntropySource
+	backend              crypto.Backend
+	saltByteLen          int
+	circuitLimits        circuit.Limits
+	minSecretByteLen     int
+	maxSecretByteLen     int
+	minSecurityLevel     int
+	secretGracePeriod    time.Duration
+	secretMaxAge         time.Duration
+	logInHistory         time.Duration
+	claimsProvider       ClaimsProvider
+	maxCiphertextBits    int
+	maxBodyLen           int64
+	maxKeyBodyLen        int64
+	mutator              Mutator
+	users                UserStore
+	hasher               Hasher
+	sessions             SessionStore
+	sessionMaxLifetime   time.Duration
+	deviceTokenTTL       time.Duration
+	rateLimiter          *rateLimiter
+	challenges           semaphore
+	evaluations          semaphore
+	pendingChallenges    *challengeStore
+	loginChallenges      ChallengeStore
+	challengeTTL         time.Duration
+	signingKey           ed25519.PrivateKey
+	minProtocolVersion   int
+	idempotency          *idempotencyStore
+	idempotencyTTL       time.Duration
+	cors                 *CORSPolicy
+	sessionCookies       *SessionCookiePolicy
+	accessLog            *AccessLogPolicy
+	openAPI              []byte
+	panics               atomic.Uint64
+	requestTimeout       time.Duration
+	adminToken           string
+	masterKey            cipher.AEAD
+	pepper               []byte
+	keyProvider          KeyProvider
+	webAuthn             *webauthn.WebAuthn
+	opaque               *opaque.ServerSetup
+	oidc                 *OIDCProvider
+	ceremonies           *ceremonyStore
+	recoveryLimiter      *rateLimiter
+	mailer               Mailer
+	verifyURL            string
+	notifier             Notifier
+	riskAssessor         RiskAssessor
+	captcha              CaptchaVerifier
+	captchaSignUp        bool
+	captchaAfterFailures int
+	usernamePolicy       *UsernamePolicy
+	failures             *failureLog
+	onNotifyError        func(error)
+	handler              http.Handler
+}
+
+// New returns a Server with options, which defaults to a MemoryStore, Argon2id secret hashes, TFHE public keys, and no rate limit
+func New(opts ...Option) *Server {
+	s := &Server{
+		entropy:            crypto.DefaultEntropySource,
+		backend:            defaultBackend,
+		saltByteLen:        defaultSaltByteLen,
+		circuitLimits:      defaultCircuitLimits,
+		minSecretByteLen:   defaultMinSecretByteLen,
+		maxSecretByteLen:   defaultMaxSecretByteLen,
+		secretGracePeriod:  defaultSecretGracePeriod,
+		logInHistory:       defaultLogInHistory,
+		maxCiphertextBits:  defaultMaxCiphertextBits,
+		mutator:            MirroredMutator{},
+		users:              NewMemoryStore(),
+		hasher:             defaultHasher,
+		sessions:           NewMemorySessionStore(),
+		pendingChallenges:  makeChallengeStore(),
+		loginChallenges:    NewMemoryChallengeStore(),
+		challengeTTL:       defaultChallengeTTL,
+		evaluations:        makeSemaphore(defaultMaxEvaluations),
+		minProtocolVersion: protocol.Version,
+		idempotency:        makeIdempotencyStore(),
+		idempotencyTTL:     defaultIdempotencyTTL,
+		ceremonies:         makeCeremonyStore(),
+		failures:           makeFailureLog(),
+		recoveryLimiter:    makeRateLimiter(defaultRecoveryRequestsPerSecond, defaultRecoveryBurst),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.masterKey != nil {
+		s.users = NewSealedStore(s.users, s.masterKey, s.entropy)
+	} else if s.keyProvider != nil {
+		s.users = NewProvidedSealedStore(s.users, s.keyProvider, s.entropy)
+	}
+	if s.usernamePolicy != nil {
+		s.users = NewNormalizedStore(s.users, s.usernamePolicy)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sign-up", s.idempotent(s.SignUpHandler))
+	mux.HandleFunc("/kdf", s.KDFHandler)
+	mux.HandleFunc("/login-1", s.FirstLoginHandler)
+	mux.HandleFunc(protocol.ChallengeResultPath, s.ChallengeResultHandler)
+	mux.HandleFunc(protocol.LogInWebSocketPath, s.LogInWebSocketHandler)
+	mux.HandleFunc("/login-2", s.SecondLoginHandler)
+	mux.HandleFunc("/refresh", s.RefreshHandler)
+	mux.HandleFunc("/whoami", s.WhoAmIHandler)
+	mux.HandleFunc(protocol.ProfilePath, s.ProfileHandler)
+	mux.HandleFunc(protocol.LogInHistoryPath, s.LogInHistoryHandler)
+	mux.HandleFunc(protocol.ExportDataPath, s.ExportDataHandler)
+	mux.HandleFunc(protocol.EraseAccountPath, s.EraseAccountHandler)
+	mux.HandleFunc(protocol.SessionsPath, s.SessionsHandler)
+	mux.HandleFunc(protocol.RevokeSessionPath, s.RevokeSessionHandler)
+	mux.HandleFunc(protocol.CreateAPIKeyPath, s.CreateAPIKeyHandler)
+	mux.HandleFunc(protocol.APIKeysPath, s.APIKeysHandler)
+	mux.HandleFunc(protocol.RevokeAPIKeyPath, s.RevokeAPIKeyHandler)
+	mux.HandleFunc("/change-password", s.ChangePasswordHandler)
+	mux.HandleFunc(protocol.RotateSecretPath, s.RotateSecretHandler)
+	mux.HandleFunc("/evaluate", s.EvaluateHandler)
+	mux.HandleFunc(protocol.SRPLogInBeginPath, s.SRPLogInBeginHandler)
+	mux.HandleFunc(protocol.SRPLogInFinishPath, s.SRPLogInFinishHandler)
+	mux.HandleFunc(protocol.OpenAPIPath, s.OpenAPIHandler)
+	if s.signingKey != nil {
+		mux.HandleFunc(protocol.ServerKeyPath, s.ServerKeyHandler)
+	}
+	if s.adminToken != "" {
+		mux.HandleFunc(protocol.ExportPath, s.ExportHandler)
+		mux.HandleFunc(protocol.ImportPath, s.ImportHandler)
+		mux.HandleFunc(protocol.AdminLogInHistoryPath, s.AdminLogInHistoryHandler)
+		mux.HandleFunc(protocol.AccountStatusPath, s.AccountStatusHandler)
+		mux.HandleFunc(protocol.UserClaimsPath, s.UserClaimsHandler)
+	}
+	if s.mailer != nil {
+		mux.HandleFunc(protocol.VerifyEmailPath, s.VerifyEmailHandler)
+		mux.HandleFunc(protocol.ResetPasswordBeginPath, s.ResetPasswordBeginHandler)
+	}
+	mux.HandleFunc(protocol.ResetPasswordPath, s.ResetPasswordHandler)
+	if s.deviceTokenTTL > 0 {
+		mux.HandleFunc(protocol.RememberDevicePath, s.RememberDeviceHandler)
+		mux.HandleFunc(protocol.DevicesPath, s.DevicesHandler)
+		mux.HandleFunc(protocol.RevokeDevicePath, s.RevokeDeviceHandler)
+		mux.HandleFunc(protocol.DeviceLogInPath, s.DeviceLogInHandler)
+	}
+	if s.opaque != nil {
+		mux.HandleFunc(protocol.OPAQUERegisterPath, s.OPAQUERegisterHandler)
+		mux.HandleFunc(protocol.OPAQUELogInBeginPath, s.OPAQUELogInBeginHandler)
+		mux.HandleFunc(protocol.OPAQUELogInFinishPath, s.OPAQUELogInFinishHandler)
+	}
+	if s.oidc != nil {
+		mux.HandleFunc(protocol.OIDCDiscoveryPath, s.OIDCDiscoveryHandler)
+		mux.HandleFunc(protocol.OIDCAuthorizePath, s.OIDCAuthorizeHandler)
+		mux.HandleFunc(protocol.OIDCTokenPath, s.OIDCTokenHandler)
+		mux.HandleFunc(protocol.OIDCUserInfoPath, s.OIDCUserInfoHandler)
+		mux.HandleFunc(protocol.OIDCJWKSPath, s.OIDCJWKSHandler)
+		mux.HandleFunc(protocol.OIDCRegisterPath, s.OIDCRegisterHandler)
+	}
+	if s.adminToken != "" || s.oidc != nil {
+		mux.HandleFunc(protocol.IntrospectPath, s.IntrospectHandler)
+		mux.HandleFunc(protocol.RevokePath, s.RevokeHandler)
+	}
+	if s.webAuthn != nil {
+		mux.HandleFunc(protocol.PasskeyRegisterBeginPath, s.PasskeyRegisterBeginHandler)
+		mux.HandleFunc(protocol.PasskeyRegisterFinishPath, s.PasskeyRegisterFinishHandler)
+		mux.HandleFunc(protocol.PasskeyLogInBeginPath, s.PasskeyLogInBeginHandler)
+		mux.HandleFunc(protocol.PasskeyLogInFinishPath, s.PasskeyLogInFinishHandler)
+	}
+
+	s.openAPI, _ = json.Marshal(s.openAPIDocument())
+	s.maxBodyLen, s.maxKeyBodyLen = s.bodyLimits()
+	s.handler = mux
+	if s.sessionCookies != nil {
+		s.handler = s.withSessionCookies(s.handler)
+	}
+	if s.requestTimeout > 0 {
+		s.handler = withTimeout(s.handler, s.requestTimeout)
+	}
+	if s.rateLimiter != nil {
+		s.handler = s.rateLimiter.wrap(s.handler)
+	}
+	if s.cors != nil {
+		s.handler = s.cors.wrap(s.handler)
+	}
+	s.handler = s.withRecovery(s.handler)
+	if s.accessLog != nil {
+		s.handler = s.withAccessLog(s.handler)
+	}
+	s.handler = s.withBodyLimit(s.handler)
+
+	return s
+}
+
+// withBodyLimit returns a handler that reads no more of a request's body than the server's limit for its path, past which requests fail with a 4XX status
+// Admin imports, which are authenticated before their archive is read, aren't limited
+func (s *Server) withBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Body != nil && req.URL.Path != protocol.ImportPath {
+			limit := s.maxBodyLen
+			if keyBodyPaths[req.URL.Path] {
+				limit = s.maxKeyBodyLen
+			}
+			req.Body = http.MaxBytesReader(w, req.Body, limit)
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// withTimeout returns a handler whose requests' contexts have a deadline
+func withTimeout(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// ServeHTTP serves a request to the signup and login service
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(w, req)
+}
+
+// lookupUser returns a user who logs in with a password, or the status and error to return if they can't be found
+func (s *Server) lookupUser(username string) (User, int, error) {
+	user, err := s.users.Get(username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		return User{}, http.StatusBadRequest, err
+	} else if err != nil {
+		return User{}, http.StatusInternalServerError, err
+	} else if status, err := checkStatus(user); err != nil {
+		return User{}, status, err
+	} else if user.SRP != nil {
+		return User{}, http.StatusBadRequest, protocol.ErrSRPRequired
+	} else if user.OPAQUE != nil {
+		return User{}, http.StatusBadRequest, protocol.ErrOPAQUERequired
+	} else if user.EncryptedSecret == nil {
+		return User{}, http.StatusBadRequest, errPasswordless
+	}
+
+	return user, http.StatusOK, nil
+}
+
+// getUser writes the error response and returns false if a user can't be found
+func (s *Server) getUser(w http.ResponseWriter, username string) (User, bool) {
+	user, status, err := s.lookupUser(username)
+	if err != nil {
+		writeError(w, err, status)
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// SignUpHandler handles sign up requests
+// New users are registered, with a recovery secret if they enroll one, or with an SRP verifier or OPAQUE record in place of an encrypted secret, and return a 2XX status,
+// and are mailed a verification token if the server has a Mailer
+// Malformed requests, usernames the UsernamePolicy doesn't allow, secrets whose length doesn't match their encrypted payload's, encrypted payloads longer than the server accepts, missing email addresses, missing or rejected CAPTCHA tokens when signups must solve one, and existing users return a 4XX status
+// Hashing, mail, and CAPTCHA verification errors return a 5XX status
+// Retries of a successful request with the same protocol.IdempotencyKeyHeader return its outcome rather than protocol.ErrUserExists
+func (s *Server) SignUpHandler(w http.ResponseWriter, req *http.Request) {
+	var signUpRequest protocol.SignUpRequest
+	if err := json.NewDecoder(req.Body).Decode(&signUpRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	username, err := s.normalizeUsername(signUpRequest.Username)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	var secretByteLen, securityLevel int
+	if signUpRequest.SRP != nil && signUpRequest.Recovery != nil {
+		err = errSRPRecovery
+	} else if signUpRequest.OPAQUE != nil && signUpRequest.Recovery != nil {
+		err = errOPAQUERecovery
+	} else if signUpRequest.SRP != nil {
+		err = checkSRPEnrollment(signUpRequest.SRP)
+	} else if signUpRequest.OPAQUE != nil {
+		err = s.checkOPAQUEEnrollment(signUpRequest.OPAQUE)
+	} else if err = signUpRequest.KDFParams.Check(); err == nil {
+		secretByteLen, securityLevel, err = s.checkEnrollment(signUpRequest.EncryptedSecret, signUpRequest.Secret)
+	}
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if (s.mailer != nil || signUpRequest.Email != "") && !validEmail(signUpRequest.Email) {
+		writeError(w, errMissingEmail, http.StatusBadRequest)
+		return
+	}
+	if s.captcha != nil && s.captchaSignUp {
+		if status, err := s.checkCaptcha(req.Context(), signUpRequest.CaptchaToken, req.RemoteAddr); err != nil {
+			writeError(w, err, status)
+			return
+		}
+	}
+
+	var user User
+	if signUpRequest.SRP != nil {
+		user = User{
+			Username: username,
+			Email:    signUpRequest.Email,
+			SRP:      &SRPVerifier{KDFParams: signUpRequest.SRP.KDFParams, Verifier: signUpRequest.SRP.Verifier},
+		}
+	} else if signUpRequest.OPAQUE != nil {
+		user = User{
+			Username: username,
+			Email:    signUpRequest.Email,
+			OPAQUE:   &OPAQUERecord{Nonce: signUpRequest.OPAQUE.Nonce, Record: signUpRequest.OPAQUE.Record, Salt: signUpRequest.OPAQUE.Salt},
+		}
+	} else {
+		salt := make([]byte, s.saltByteLen)
+		if _, err := io.ReadFull(s.entropy, salt); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		secretHash, pepper, err := s.hashSecret(salt, signUpRequest.Secret)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		user = User{
+			Username:        username,
+			Email:           signUpRequest.Email,
+			KDFParams:       signUpRequest.KDFParams,
+			EncryptedSecret: signUpRequest.EncryptedSecret,
+			SecretHash:      secretHash,
+			Salt:            salt,
+			Hasher:          s.hasher.Name(),
+			Pepper:          pepper,
+			SecretByteLen:   secretByteLen,
+			SecurityLevel:   securityLevel,
+			SecretCreatedAt: time.Now(),
+		}
+		if signUpRequest.Recovery != nil {
+			var status int
+			if user.Recovery, status, err = s.enrollRecovery(signUpRequest.Recovery); err != nil {
+				writeError(w, err, status)
+				return
+			}
+		}
+	}
+	user.CreatedAt = time.Now()
+
+	var token string
+	if s.mailer != nil {
+		if token, err = s.pendVerification(&user); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = s.users.Create(user)
+	if errors.Is(err, protocol.ErrUserExists) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if s.mailer != nil {
+		if err := s.sendVerification(req.Context(), user, token); err != nil {
+			writeError(w, err, contextStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// KDFHandler handles requests for the parameters that stretch a user's password, or their recovery phrase
+// Existing users return their parameters and a 2XX status
+// Malformed requests, nonexistent users, and recovery requests for users without a recovery secret return a 4XX status
+func (s *Server) KDFHandler(w http.ResponseWriter, req *http.Request) {
+	var kdfRequest protocol.KDFRequest
+	if err := json.NewDecoder(req.Body).Decode(&kdfRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.getCredential(w, kdfRequest.Username, kdfRequest.Recovery)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user.KDFParams)
+}
+
+// negotiation returns the terms of a login in a protocol version, the server's minimum security level and its Mutator's challenge type,
+// which are the server's policy rather than anything the client's request chose
+func (s *Server) negotiation(version int) protocol.Negotiation {
+	return protocol.Negotiation{
+		ProtocolVersion: version,
+		SecurityLevel:   s.minSecurityLevel,
+		ChallengeType:   s.mutator.ChallengeType(),
+	}
+}
+
+// streamChallenge computes a challenge of a user's encrypted secret with the server's Mutator under a Scheme made from their public key, chunkBits bits at a time,
+// passing each chunk to emit in order as soon as it is computed, and stores the challenge, with its transcript up to the response whose other fields are in header,
+// until its second login request answers it
+// Servers with a signing key return their signature of the transcript, which covers the challenge's ciphertext, nonce, and expiry
+// Failures return the status they are returned with, which is a 5XX status for entropy and challenge store errors and cancelled contexts
+func (s *Server) streamChallenge(ctx context.Context, user User, challenge Challenge, header *protocol.FirstLogInResponse, serverScheme crypto.Scheme, chunkBits int, emit func(chunk gates.Ctxt) error) ([]byte, int, error) {
+	serverScheme = serverScheme.WithContext(ctx)
+	mutation, err := s.mutator.Mutate(ctx, s.entropy, serverScheme, user.EncryptedSecret)
+	if err != nil {
+		return nil, contextStatus(err, http.StatusInternalServerError), err
+	}
+
+	samplesHash := sha256.New()
+	for start := 0; start < len(user.EncryptedSecret); start += chunkBits {
+		end := min(start+chunkBits, len(user.EncryptedSecret))
+		chunk := mutation(start, end)
+		if err := ctx.Err(); err != nil {
+			return nil, http.StatusServiceUnavailable, err
+		}
+
+		protocol.HashSamples(samplesHash, chunk)
+		if err := emit(chunk); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	challenge.Transcript = challenge.Transcript.WithChallenge(header, samplesHash.Sum(nil))
+	if err := s.loginChallenges.Put(storedChallenge(challenge)); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if s.signingKey == nil {
+		return nil, http.StatusOK, nil
+	}
+	return challenge.Transcript.Sign(s.signingKey), http.StatusOK, nil
+}
+
+// challengeHeader returns the fields of a challenge's FirstLogInResponse other than its samples and signature
+func (s *Server) challengeHeader(user User, challenge Challenge) *protocol.FirstLogInResponse {
+	return &protocol.FirstLogInResponse{
+		SecretByteLen: user.secretByteLen(),
+		ChallengeID:   challenge.ID,
+		Nonce:         challenge.Nonce,
+		ExpiresAt:     challenge.ExpiresAt,
+		Negotiation:   s.negotiation(challenge.Version),
+		Versioned:     protocol.Versioned{Version: challenge.Version},
+	}
+}
+
+// computeChallenge returns a challenge of a user's login, for their encrypted secret under a Scheme made from their public key
+// Failures return the status they are returned with, as streamChallenge does
+func (s *Server) computeChallenge(ctx context.Context, user User, challenge Challenge, serverScheme crypto.Scheme) (*protocol.FirstLogInResponse, int, error) {
+	firstLogInResponse := s.challengeHeader(user, challenge)
+	signature, status, err := s.streamChallenge(ctx, user, challenge, firstLogInResponse, serverScheme, max(len(user.EncryptedSecret), 1), func(chunk gates.Ctxt) error {
+		firstLogInResponse.EncryptedMutatedSecret = chunk
+		return nil
+	})
+	if err != nil {
+		return nil, status, err
+	}
+
+	firstLogInResponse.Signature = signature
+	return firstLogInResponse, status, nil
+}
+
+// FirstLoginHandler handles first login requests
+// Existing users return the cryptographic challenge, with the length of their secret and the newest protocol version both sides speak, and a 2XX status
+// Async requests return a challenge id to poll ChallengeResultHandler with and a 2XX status, while the challenge is computed in the background
+// Malformed requests, requests in protocol versions older than the server accepts, nonexistent users, and public keys of another parameter set than the user's return a 4XX status, as do requests while the server is computing its maximum number of challenges,
+// recovery requests for users without a recovery secret or over its rate limit, requests the RiskAssessor denies or demands step-up for,
+// and requests without a valid CAPTCHA token once their user or address has failed to log in too often
+// Entropy errors and cancelled requests return a 5XX status
+func (s *Server) FirstLoginHandler(w http.ResponseWriter, req *http.Request) {
+	var firstLogInRequest protocol.FirstLogInRequest
+	if err := json.NewDecoder(req.Body).Decode(&firstLogInRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	version, status, err := s.negotiateVersion(firstLogInRequest.EffectiveVersion())
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	user, ok := s.getCredential(w, firstLogInRequest.Username, firstLogInRequest.Recovery)
+	if !ok {
+		return
+	}
+	user, _ = user.withSecret(firstLogInRequest.KDFSalt, time.Now())
+	if firstLogInRequest.Recovery && !s.allowRecovery(user.Username) {
+		writeError(w, errRateLimited, http.StatusTooManyRequests)
+		return
+	}
+	if status, err := s.screenLogIn(req.Context(), req.RemoteAddr, user.Username, &firstLogInRequest); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	if err := s.checkPublicKey(user, firstLogInRequest.PublicKey); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	serverScheme, err := s.backend.MakePublicScheme(firstLogInRequest.PublicKey)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := s.makeChallenge(user, version, &firstLogInRequest)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !s.challenges.tryAcquire() {
+		writeBusy(w)
+		return
+	}
+
+	if firstLogInRequest.Async {
+		s.startChallenge(w, user, challenge, serverScheme)
+		return
+	}
+	defer s.challenges.release()
+
+	firstLogInResponse, status, err := s.computeChallenge(req.Context(), user, challenge, serverScheme)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, firstLogInResponse)
+}
+
+// startChallenge computes a challenge in the background, holding an acquired challenge slot until it is computed, and writes its id
+// Background challenges outlive their requests, so they are only cancelled by the server's request timeout
+func (s *Server) startChallenge(w http.ResponseWriter, user User, challenge Challenge, serverScheme crypto.Scheme) {
+	challengeID, err := s.pendingChallenges.start(s.entropy, func() (*protocol.FirstLogInResponse, int, error) {
+		defer s.challenges.release()
+
+		ctx := context.Background()
+		if s.requestTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+			defer cancel()
+		}
+
+		return s.computeChallenge(ctx, user, challenge, serverScheme)
+	})
+	if err != nil {
+		s.challenges.release()
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", protocol.ChallengeResultPath+challengeID)
+	setRetryAfter(w, challengePollInterval)
+	writeJSON(w, http.StatusAccepted, &protocol.PendingChallenge{ChallengeID: challengeID, Versioned: protocol.Versioned{Version: challenge.Version}})
+}
+
+// ChallengeResultHandler handles polls for the challenges of asynchronous first login requests, by the id at the end of their path
+// Computed challenges return the cryptographic challenge and a 2XX status, once
+// Pending challenges return their id, a Retry-After header, and a 2XX status
+// Unknown and expired challenges return a 4XX status
+// Challenges that failed return the status of their failure, such as a 5XX status for entropy errors
+func (s *Server) ChallengeResultHandler(w http.ResponseWriter, req *http.Request) {
+	challengeID := strings.TrimPrefix(req.URL.Path, protocol.ChallengeResultPath)
+	pending, ok := s.pendingChallenges.take(challengeID)
+	if !ok {
+		writeError(w, protocol.ErrUnknownChallenge, http.StatusNotFound)
+		return
+	}
+
+	select {
+	case <-pending.done:
+	default:
+		setRetryAfter(w, challengePollInterval)
+		writeJSON(w, http.StatusAccepted, &protocol.PendingChallenge{ChallengeID: challengeID})
+		return
+	}
+
+	if pending.err != nil {
+		writeError(w, pending.err, pending.status)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pending.response)
+}
+
+// finishLogIn verifies the secret of a second login request from a client address and issues a session, or returns the status and error to return
+// The secret is verified against the one its challenge was computed from, which may have been retired since,
+// and sessions of users whose secret is older than the server's secret max age are marked as requiring its rotation
+// Users with passkeys are sent a ceremony to finish at protocol.PasskeyLogInFinishPath in place of a session
+func (s *Server) finishLogIn(secondLogInRequest *protocol.SecondLogInRequest, remoteAddr string) (*protocol.LogInResponse, int, error) {
+	user, status, err := s.lookupUser(secondLogInRequest.Username)
+	if err != nil {
+		return nil, status, err
+	}
+	credential, err := user.credential(secondLogInRequest.Recovery)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	challenge, status, err := s.checkAnswer(user.Username, secondLogInRequest)
+	if err != nil {
+		return nil, status, err
+	}
+	credential, retired := credential.withSecret(challenge.KDFSalt, time.Now())
+	if len(secondLogInRequest.Secret) != credential.secretByteLen() {
+		return nil, http.StatusBadRequest, errSecretLength
+	}
+
+	if ok, err := s.verifySecret(credential, secondLogInRequest.Secret); err != nil {
+		return nil, http.StatusInternalServerError, err
+	} else if !ok {
+		s.logInFailed(user.Username, remoteAddr, challenge.ID, secondLogInRequest.Recovery)
+		return nil, http.StatusForbidden, protocol.ErrInvalidCredentials
+	}
+	if secondLogInRequest.Recovery {
+		s.rehashRecovery(user, secondLogInRequest.Secret)
+	} else if !retired {
+		s.rehashSecret(user, secondLogInRequest.Secret)
+	}
+
+	logInResponse, err := s.completeLogIn(user, remoteAddr, challenge.ID, secondLogInRequest.Recovery)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	logInResponse.RotationRequired = !secondLogInRequest.Recovery && logInResponse.Passkey == nil && s.rotationRequired(user, time.Now())
+
+	return logInResponse, http.StatusOK, nil
+}
+
+// completeLogIn returns the response to a user who proved their password, or recovery phrase if recovery is set, from a client address by answering a challenge or ceremony,
+// which is a passkey ceremony for users with passkeys, or else a new session
+func (s *Server) completeLogIn(user User, remoteAddr, challengeID string, recovery bool) (*protocol.LogInResponse, error) {
+	if s.webAuthn != nil && len(user.Passkeys) > 0 {
+		passkeyCeremony, err := s.beginPasskeyLogIn(user, recovery)
+		if err != nil {
+			return nil, err
+		}
+
+		return &protocol.LogInResponse{Passkey: passkeyCeremony}, nil
+	}
+
+	logInResponse, err := s.issue(user.Username, recovery)
+	if err != nil {
+		return nil, err
+	}
+	s.logInSucceeded(user.Username, remoteAddr, challengeID, recovery)
+
+	return logInResponse, nil
+}
+
+// SecondLoginHandler handles second login requests
+// Successful authentications return a session token, or a passkey ceremony for users with passkeys, and a 2XX status
+// Malformed requests, secrets of the wrong length, nonexistent users, requests in another protocol version than their login negotiated or older than the server accepts,
+// requests without their challenge's id and nonce or with another transcript than the server's, unknown, expired, and answered challenges, and authenticaiton failures return a 4XX status
+// Hashing, entropy, and challenge store errors return a 5XX status
+func (s *Server) SecondLoginHandler(w http.ResponseWriter, req *http.Request) {
+	var secondLogInRequest protocol.SecondLogInRequest
+	if err := json.NewDecoder(req.Body).Decode(&secondLogInRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	logInResponse, status, err := s.finishLogIn(&secondLogInRequest, req.RemoteAddr)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	logInResponse.SetVersion(secondLogInRequest.EffectiveVersion())
+	s.setSessionCookies(w, logInResponse)
+	writeJSON(w, http.StatusOK, logInResponse)
+}
+
+// RefreshHandler handles session refresh requests, which are posted, so requests authenticated by a session cookie must echo its CSRF token
+// Unexpired sessions are replaced by a new session, and return its token and a 2XX status
+// Requests that aren't posted, and missing, unknown, and expired sessions return a 4XX status
+// Entropy and session store errors return a 5XX status
+func (s *Server) RefreshHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, errNotPosted, http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	logInResponse, err := s.issueSession(session)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if err := s.sessions.Revoke(session.ID); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.setSessionCookies(w, logInResponse)
+	writeJSON(w, http.StatusOK, logInResponse)
+}
+
+// WhoAmIHandler handles requests for the user of a session
+// Unexpired sessions return their username and a 2XX status
+// Missing, unknown, and expired sessions return a 4XX status
+// Session store errors return a 5XX status
+func (s *Server) WhoAmIHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &protocol.WhoAmIResponse{Username: session.Username})
+}
+
+// EvaluateHandler handles evaluate requests of a session's user
+// Circuits are evaluated with the user's encrypted secret bound to the "secret" input, and return their encrypted outputs and a 2XX status
+// Missing, unknown, and expired sessions, requests naming another user than the session's, malformed requests, oversized circuits or inputs,
+// inputs of another mask dimension than the user's encrypted secret, nonexistent users, and public keys of another parameter set than the user's return a 4XX status,
+// as do requests arriving while the server evaluates as many circuits as it allows at once
+// Cancelled requests return a 5XX status
+func (s *Server) EvaluateHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	var evaluateRequest protocol.EvaluateRequest
+	if err := json.NewDecoder(req.Body).Decode(&evaluateRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	cir, err := circuit.Decode(evaluateRequest.Circuit, s.circuitLimits)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := evaluateRequest.Inputs[protocol.SecretInputName]; ok {
+		writeError(w, errReservedInput, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.getUser(w, evaluateRequest.Username)
+	if !ok {
+		return
+	} else if user.Username != session.Username {
+		writeError(w, errEvaluateMismatch, http.StatusForbidden)
+		return
+	}
+
+	inputs := make(map[string]gates.Ctxt, len(evaluateRequest.Inputs)+1)
+	for name, input := range evaluateRequest.Inputs {
+		if err := s.checkCiphertext(user, input); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		inputs[name] = input
+	}
+	inputs[protocol.SecretInputName] = user.EncryptedSecret
+
+	if err := s.checkPublicKey(user, evaluateRequest.PublicKey); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	serverScheme, err := s.backend.MakePublicScheme(evaluateRequest.PublicKey)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !s.evaluations.tryAcquire() {
+		writeBusy(w)
+		return
+	}
+	defer s.evaluations.release()
+
+	outputs, err := cir.EvaluateCtx(req.Context(), serverScheme, inputs)
+	if err != nil {
+		writeError(w, err, contextStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &protocol.EvaluateResponse{Outputs: outputs})
+}
+
+// ChangePasswordHandler handles change password requests
+// Users proving their secret by answering a login challenge, which the request consumes, have their encrypted secret re-keyed and re-masked, and return a 2XX status
+// Users may move to another parameter set with their new public key, which their secret's later challenges are then encrypted under
+// The old password still logs in, for logins begun before the change, until the server's secret grace period passes,
+// while the user's remembered devices and API keys are forgotten and their sessions revoked, except the one the request is authenticated by, as a reset does
+// Malformed requests, secrets of the wrong length, mismatched keys, nonexistent users, requests without their challenge's id and nonce or with another transcript than the server's,
+// unknown, expired, and answered challenges, and authentication failures, which count toward the user's failed logins, return a 4XX status,
+// as do users changed by another request while the password was changed
+// Hashing, challenge store, and session store errors and cancelled requests return a 5XX status
+func (s *Server) ChangePasswordHandler(w http.ResponseWriter, req *http.Request) {
+	var changePasswordRequest protocol.ChangePasswordRequest
+	if err := json.NewDecoder(req.Body).Decode(&changePasswordRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.getUser(w, changePasswordRequest.Username)
+	if !ok {
+		return
+	}
+
+	challenge, status, err := s.checkAnswer(user.Username, &protocol.SecondLogInRequest{
+		Username:    user.Username,
+		Secret:      changePasswordRequest.Secret,
+		ChallengeID: changePasswordRequest.ChallengeID,
+		Nonce:       changePasswordRequest.Nonce,
+		Transcript:  changePasswordRequest.Transcript,
+		Versioned:   changePasswordRequest.Versioned,
+	})
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+	if len(changePasswordRequest.Secret) != user.secretByteLen() {
+		writeError(w, errSecretLength, http.StatusBadRequest)
+		return
+	}
+	if ok, err := s.verifySecret(user, changePasswordRequest.Secret); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if !ok {
+		s.logInFailed(user.Username, req.RemoteAddr, challenge.ID, false)
+		writeError(w, protocol.ErrInvalidCredentials, http.StatusForbidden)
+		return
+	}
+
+	if err := changePasswordRequest.KDFParams.Check(); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := crypto.CheckCtxt(changePasswordRequest.ReMask, len(user.EncryptedSecret)); err != nil ||
+		crypto.CtxtSecurityLevel(changePasswordRequest.ReMask) != changePasswordRequest.PublicKey.SecurityLevel() {
+		writeError(w, errMalformedReMask, http.StatusBadRequest)
+		return
+	}
+
+	switchingScheme, err := s.backend.MakePublicScheme(changePasswordRequest.SwitchingKey)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	newScheme, err := s.backend.MakePublicScheme(changePasswordRequest.PublicKey)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	switchedSecret, err := switchingScheme.WithContext(req.Context()).SwitchKey(user.EncryptedSecret, changePasswordRequest.PublicKey)
+	if err != nil {
+		writeError(w, err, contextStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	reKeyedSecret := newScheme.WithContext(req.Context()).Xor(switchedSecret, changePasswordRequest.ReMask)
+	if err := req.Context().Err(); err != nil {
+		writeError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	if err := s.updateUser(user.Username, func(stored *User) error {
+		if stored.KDFParams == nil || user.KDFParams == nil || !bytes.Equal(stored.KDFParams.Salt, user.KDFParams.Salt) {
+			return protocol.ErrUserChanged
+		}
+
+		stored.retireSecret(time.Now(), s.secretGracePeriod)
+		stored.EncryptedSecret, stored.KDFParams = reKeyedSecret, changePasswordRequest.KDFParams
+		stored.SecretByteLen, stored.SecurityLevel = stored.secretByteLen(), changePasswordRequest.PublicKey.SecurityLevel()
+		stored.Devices, stored.APIKeys = nil, nil
+		return nil
+	}); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+	if err := s.revokeOtherSessions(user.Username, req); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.notify(EventPasswordChanged, user.Username, false)
+
+	w.WriteHeader(http.StatusOK)
+}
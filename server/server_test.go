@@ -0,0 +1,310 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/client"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+	"github.com/zambozoo/homomorphic-authentication/server"
+	"github.com/zambozoo/homomorphic-authentication/server/servertest"
+)
+
+const (
+	testUsername = "alice"
+	testEmail    = "alice@example.com"
+	testPassword = "correct horse battery staple"
+	newPassword  = "tr0ub4dor & three more words"
+)
+
+// testMailer keeps the messages a Server sends
+type testMailer struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+// Send keeps a message's body
+func (tm *testMailer) Send(_ context.Context, _, _, body string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.sent = append(tm.sent, body)
+	return nil
+}
+
+// token returns the code in the last message a testMailer kept, which follows "is" on its first line
+func (tm *testMailer) token(t *testing.T) string {
+	t.Helper()
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if len(tm.sent) == 0 {
+		t.Fatal("no mail was sent")
+	}
+
+	line, _, _ := strings.Cut(tm.sent[len(tm.sent)-1], "\n")
+	_, token, found := strings.Cut(line, " is ")
+	if !found {
+		t.Fatalf("mail %q has no code", line)
+	}
+
+	return token
+}
+
+// testPinStore pins the same terms for every service, failing to load them with its err if it has one
+type testPinStore struct {
+	mu  sync.Mutex
+	pin *protocol.Negotiation
+	err error
+}
+
+// LoadPin returns the testPinStore's pin or err
+func (ps *testPinStore) LoadPin(string) (*protocol.Negotiation, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.pin, ps.err
+}
+
+// SavePin replaces the testPinStore's pin
+func (ps *testPinStore) SavePin(_ string, pin protocol.Negotiation) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.pin = &pin
+	return nil
+}
+
+func TestSignUpLogIn(t *testing.T) {
+	s, c := servertest.New(t)
+	ctx := context.Background()
+
+	if _, err := c.SignUpCtx(ctx, testUsername, testPassword); err != nil {
+		t.Fatalf("SignUpCtx: %v", err)
+	}
+	if _, err := c.SignUpCtx(ctx, testUsername, testPassword); !errors.Is(err, protocol.ErrUserExists) {
+		t.Fatalf("SignUpCtx of an existing user: got %v, want %v", err, protocol.ErrUserExists)
+	}
+
+	session, err := c.LogInCtx(ctx, testUsername, testPassword)
+	if err != nil {
+		t.Fatalf("LogInCtx: %v", err)
+	}
+	if username, err := session.WhoAmI(ctx); err != nil || username != testUsername {
+		t.Fatalf("WhoAmI: got %q, %v, want %q", username, err, testUsername)
+	}
+
+	token := session.Token()
+	get := httptest.NewRequest(http.MethodGet, "/refresh", nil)
+	get.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, get)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /refresh: got status %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+	if _, err := session.WhoAmI(ctx); err != nil {
+		t.Fatalf("WhoAmI after GET /refresh: %v", err)
+	}
+	if err := session.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if session.Token() == token {
+		t.Fatal("Refresh didn't rotate the session token")
+	}
+	if username, err := session.WhoAmI(ctx); err != nil || username != testUsername {
+		t.Fatalf("WhoAmI after Refresh: got %q, %v, want %q", username, err, testUsername)
+	}
+
+	if _, err := c.LogInCtx(ctx, testUsername, newPassword); !errors.Is(err, protocol.ErrInvalidCredentials) {
+		t.Fatalf("LogInCtx with the wrong password: got %v, want %v", err, protocol.ErrInvalidCredentials)
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	_, c := servertest.New(t, server.WithMutator(server.PadMutator{}))
+	ctx := context.Background()
+
+	if _, err := c.SignUpCtx(ctx, testUsername, testPassword); err != nil {
+		t.Fatalf("SignUpCtx: %v", err)
+	}
+	if _, err := c.LogInCtx(ctx, testUsername, testPassword); err != nil {
+		t.Fatalf("LogInCtx: %v", err)
+	}
+
+	want := protocol.Negotiation{ProtocolVersion: protocol.Version, ChallengeType: protocol.ChallengeTypePadXor}
+	if pinned, ok := c.Pinned(); !ok || pinned != want {
+		t.Fatalf("Pinned: got %+v, %t, want %+v", pinned, ok, want)
+	}
+
+	for name, tc := range map[string]struct {
+		pins    *testPinStore
+		wantErr bool
+	}{
+		"unpinned":   {pins: &testPinStore{}},
+		"downgraded": {pins: &testPinStore{pin: &protocol.Negotiation{ProtocolVersion: protocol.Version, SecurityLevel: 128, ChallengeType: protocol.ChallengeTypePadXor}}, wantErr: true},
+		"unreadable": {pins: &testPinStore{err: errors.New("corrupt pin")}, wantErr: true},
+	} {
+		_, pinned := servertest.New(t, server.WithMutator(server.PadMutator{}))
+		client.WithPinStore(tc.pins)(pinned)
+		if _, err := pinned.SignUpCtx(ctx, testUsername, testPassword); err != nil {
+			t.Fatalf("%s: SignUpCtx: %v", name, err)
+		}
+
+		_, err := pinned.LogInCtx(ctx, testUsername, testPassword)
+		if tc.wantErr != (err != nil) {
+			t.Fatalf("%s: LogInCtx: got %v, want error %t", name, err, tc.wantErr)
+		}
+		var downgrade *client.DowngradeError
+		if errors.As(err, &downgrade) != (name == "downgraded") {
+			t.Fatalf("%s: LogInCtx: got %v, want a DowngradeError only when downgraded", name, err)
+		}
+		if !tc.wantErr && (tc.pins.pin == nil || *tc.pins.pin != want) {
+			t.Fatalf("%s: saved pin %+v, want %+v", name, tc.pins.pin, want)
+		}
+	}
+
+	_, strict := servertest.New(t, server.WithMinSecurityLevel(128))
+	if _, err := strict.SignUpCtx(ctx, testUsername, testPassword); err == nil {
+		t.Fatal("SignUpCtx under a parameter set weaker than the server accepts succeeded")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	_, c := servertest.New(t)
+	ctx := context.Background()
+
+	if _, err := c.SignUpCtx(ctx, testUsername, testPassword); err != nil {
+		t.Fatalf("SignUpCtx: %v", err)
+	}
+	session, err := c.LogInCtx(ctx, testUsername, testPassword)
+	if err != nil {
+		t.Fatalf("LogInCtx: %v", err)
+	}
+
+	if _, err := c.ChangePasswordCtx(ctx, testUsername, testPassword, newPassword); err != nil {
+		t.Fatalf("ChangePasswordCtx: %v", err)
+	}
+
+	if _, err := session.WhoAmI(ctx); err == nil {
+		t.Fatal("WhoAmI succeeded with a session from before the password changed")
+	}
+	if _, err := c.LogInCtx(ctx, testUsername, testPassword); !errors.Is(err, protocol.ErrInvalidCredentials) {
+		t.Fatalf("LogInCtx with the old password: got %v, want %v", err, protocol.ErrInvalidCredentials)
+	}
+	if _, err := c.LogInCtx(ctx, testUsername, newPassword); err != nil {
+		t.Fatalf("LogInCtx with the new password: %v", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	mailer := &testMailer{}
+	_, c := servertest.New(t, server.WithMailer(mailer))
+	ctx := context.Background()
+
+	if _, err := c.SignUpWithEmailCtx(ctx, testUsername, testEmail, testPassword); err != nil {
+		t.Fatalf("SignUpWithEmailCtx: %v", err)
+	}
+	if err := c.VerifyEmail(ctx, testUsername, mailer.token(t)); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+
+	if err := c.RequestPasswordReset(ctx, testUsername); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := mailer.token(t)
+	if err := c.RequestPasswordReset(ctx, testUsername); err != nil {
+		t.Fatalf("RequestPasswordReset while a token is pending: %v", err)
+	}
+	if err := c.RequestPasswordReset(ctx, "mallory"); err != nil {
+		t.Fatalf("RequestPasswordReset of a nonexistent user: %v", err)
+	}
+	mailer.mu.Lock()
+	sent := len(mailer.sent)
+	mailer.mu.Unlock()
+	if sent != 2 {
+		t.Fatalf("sent %d messages, want the verification and one reset", sent)
+	}
+	if err := c.ResetPassword(ctx, testUsername, token+"0", newPassword); err == nil {
+		t.Fatal("ResetPassword succeeded with the wrong token")
+	}
+	if err := c.ResetPassword(ctx, testUsername, token, newPassword); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := c.ResetPassword(ctx, testUsername, token, testPassword); err == nil {
+		t.Fatal("ResetPassword succeeded with a token that was already used")
+	}
+
+	if _, err := c.LogInCtx(ctx, testUsername, testPassword); !errors.Is(err, protocol.ErrInvalidCredentials) {
+		t.Fatalf("LogInCtx with the old password: got %v, want %v", err, protocol.ErrInvalidCredentials)
+	}
+	if _, err := c.LogInCtx(ctx, testUsername, newPassword); err != nil {
+		t.Fatalf("LogInCtx with the new password: %v", err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	s, c := servertest.New(t)
+	ctx := context.Background()
+
+	if _, err := c.SignUpCtx(ctx, testUsername, testPassword); err != nil {
+		t.Fatalf("SignUpCtx: %v", err)
+	}
+	session, err := c.LogInCtx(ctx, testUsername, testPassword)
+	if err != nil {
+		t.Fatalf("LogInCtx: %v", err)
+	}
+
+	apiKey, err := session.CreateAPIKey(ctx, "ci", []string{"read"}, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	username, scopes, err := s.ValidateAPIKey(ctx, apiKey.Key)
+	if err != nil || username != testUsername || len(scopes) != 1 || scopes[0] != "read" {
+		t.Fatalf("ValidateAPIKey: got %q, %v, %v, want %q, [read]", username, scopes, err, testUsername)
+	}
+
+	apiKeys, err := session.APIKeys(ctx)
+	if err != nil {
+		t.Fatalf("APIKeys: %v", err)
+	}
+	if len(apiKeys) != 1 || apiKeys[0].ID != apiKey.ID || apiKeys[0].Name != "ci" {
+		t.Fatalf("APIKeys: got %+v, want the %q key", apiKeys, apiKey.ID)
+	}
+
+	if err := session.RevokeAPIKey(ctx, apiKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, _, err := s.ValidateAPIKey(ctx, apiKey.Key); err == nil {
+		t.Fatal("ValidateAPIKey accepted a revoked key")
+	}
+	if apiKeys, err := session.APIKeys(ctx); err != nil || len(apiKeys) != 0 {
+		t.Fatalf("APIKeys after RevokeAPIKey: got %+v, %v, want none", apiKeys, err)
+	}
+}
+
+func TestChallengeStoreTake(t *testing.T) {
+	challenges := server.NewMemoryChallengeStore()
+	challenge := server.Challenge{ID: "id", Nonce: "nonce", Username: testUsername, ExpiresAt: time.Now().Add(time.Minute)}
+	if err := challenges.Put(challenge); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	mismatch := errors.New("nonce mismatch")
+	if _, err := challenges.Take(challenge.ID, func(server.Challenge) error { return mismatch }); !errors.Is(err, mismatch) {
+		t.Fatalf("Take of a rejected challenge: got %v, want %v", err, mismatch)
+	}
+	if taken, err := challenges.Take(challenge.ID, func(server.Challenge) error { return nil }); err != nil || taken.Nonce != challenge.Nonce {
+		t.Fatalf("Take after a rejected Take: got %+v, %v, want %+v", taken, err, challenge)
+	}
+	if _, err := challenges.Take(challenge.ID, func(server.Challenge) error { return nil }); !errors.Is(err, protocol.ErrUnknownChallenge) {
+		t.Fatalf("Take of a taken challenge: got %v, want %v", err, protocol.ErrUnknownChallenge)
+	}
+}
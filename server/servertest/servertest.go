@@ -0,0 +1,36 @@
+// Package servertest serves a server.Server for tests of the client and server packages
+package servertest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zambozoo/homomorphic-authentication/client"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/server"
+)
+
+// MessageByteLen is the secret length of the Client returned by New
+const MessageByteLen = 8
+
+// New serves a Server with options on an httptest.Server until the test ends, returning the Server and a Client configured to call it
+// The Server keeps users in a MemoryStore and uses FNV hashes, and both use the plaintext Backend so tests stay quick
+// Options must not replace the Backend, or the Client and Server won't agree on it
+func New(t testing.TB, opts ...server.Option) (*server.Server, *client.Client) {
+	t.Helper()
+
+	backend := crypto.MakePlaintextBackend()
+	s := server.New(append([]server.Option{
+		server.WithBackend(backend),
+		server.WithHasher(server.FNVHasher{}),
+	}, opts...)...)
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	return s, client.New(MessageByteLen, 0,
+		client.WithBaseURL(ts.URL),
+		client.WithHTTPClient(ts.Client()),
+		client.WithBackend(backend),
+	)
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+const (
+	// sessionTTL is how long a session token is valid after it is issued, or after it was last used if sessions slide
+	sessionTTL = 15 * time.Minute
+	// sessionTokenByteLen is the length of a session token before encoding
+	sessionTokenByteLen = 32
+)
+
+var ErrUnsupportedSessionStore = errors.New("unsupported session store")
+
+type (
+	// Session is a session issued to a user, and whether it was issued by a recovery login, which can reset the user's password
+	Session struct {
+		// ID is the hash of the session's token, which sessions are stored and listed under so their tokens aren't
+		ID       string
+		Username string
+		Recovery bool
+		// AuthTime is when the user logged in, which refreshes keep
+		AuthTime time.Time
+		// IssuedAt is when the session's token was issued
+		IssuedAt  time.Time
+		ExpiresAt time.Time
+	}
+
+	// SessionStore stores the sessions a server issued, which replicas sharing a store all accept
+	SessionStore interface {
+		// Create stores a new session until it expires
+		Create(session Session) error
+		// Get returns an unexpired session, or protocol.ErrInvalidSession
+		Get(id string) (Session, error)
+		// Extend moves an unexpired session's expiry, or returns protocol.ErrInvalidSession
+		Extend(id string, expiresAt time.Time) error
+		// Revoke deletes a session, if it exists
+		Revoke(id string) error
+		// RevokeUser deletes every session of a user
+		RevokeUser(username string) error
+		// List returns a user's unexpired sessions, ordered by when they were issued
+		List(username string) ([]Session, error)
+	}
+
+	// MemorySessionStore is a SessionStore held in memory, whose sessions are lost when the process exits
+	MemorySessionStore struct {
+		sessions map[string]Session
+		mu       sync.Mutex
+	}
+)
+
+// NewMemorySessionStore returns an empty MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}}
+}
+
+// OpenSessionStore returns the SessionStore for a data source name, where "memory://" or an empty name is a new MemorySessionStore,
+// and redis:// and rediss:// URLs are RedisSessionStores
+func OpenSessionStore(dsn string) (SessionStore, error) {
+	scheme, _, _ := strings.Cut(dsn, "://")
+	switch scheme {
+	case "", "memory":
+		return NewMemorySessionStore(), nil
+	case "redis", "rediss":
+		return OpenRedisSessionStore(dsn)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSessionStore, scheme)
+	}
+}
+
+// Create stores a new session in a MemorySessionStore
+func (ms *MemorySessionStore) Create(session Session) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.sessions[session.ID] = session
+	return nil
+}
+
+// Get returns an unexpired session from a MemorySessionStore, deleting it if it expired
+func (ms *MemorySessionStore) Get(id string) (Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	session, ok := ms.sessions[id]
+	if !ok {
+		return Session{}, protocol.ErrInvalidSession
+	} else if time.Now().After(session.ExpiresAt) {
+		delete(ms.sessions, id)
+		return Session{}, protocol.ErrInvalidSession
+	}
+
+	return session, nil
+}
+
+// Extend moves the expiry of an unexpired session in a MemorySessionStore
+func (ms *MemorySessionStore) Extend(id string, expiresAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	session, ok := ms.sessions[id]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return protocol.ErrInvalidSession
+	}
+
+	session.ExpiresAt = expiresAt
+	ms.sessions[id] = session
+	return nil
+}
+
+// Revoke deletes a session from a MemorySessionStore
+func (ms *MemorySessionStore) Revoke(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.sessions, id)
+	return nil
+}
+
+// RevokeUser deletes every session of a user from a MemorySessionStore
+func (ms *MemorySessionStore) RevokeUser(username string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for id, session := range ms.sessions {
+		if session.Username == username {
+			delete(ms.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// List returns a user's unexpired sessions in a MemorySessionStore, deleting any that expired
+func (ms *MemorySessionStore) List(username string) ([]Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	var sessions []Session
+	for id, session := range ms.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(ms.sessions, id)
+		} else if session.Username == username {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// sortSessions orders sessions by when they were issued
+func sortSessions(sessions []Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].IssuedAt.Before(sessions[j].IssuedAt)
+	})
+}
+
+// sessionID returns the id a session token's session is stored under
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// issueSession stores a session under a new token, and returns the token and its expiry
+func (s *Server) issueSession(session Session) (*protocol.LogInResponse, error) {
+	token := make([]byte, sessionTokenByteLen)
+	if _, err := io.ReadFull(s.entropy, token); err != nil {
+		return nil, err
+	}
+
+	resp := &protocol.LogInResponse{
+		Token:     base64.RawURLEncoding.EncodeToString(token),
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+
+	session.ID = sessionID(resp.Token)
+	session.IssuedAt = time.Now()
+	session.ExpiresAt = resp.ExpiresAt
+	if err := s.sessions.Create(session); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// issue returns a new session token for a user who just logged in and its expiry
+func (s *Server) issue(username string, recovery bool) (*protocol.LogInResponse, error) {
+	return s.issueSession(Session{Username: username, Recovery: recovery, AuthTime: time.Now()})
+}
+
+// lookupSession returns the unexpired session of a token, which slides its expiry if sessions slide,
+// or the status and error to return if it has none
+func (s *Server) lookupSession(token string) (Session, int, error) {
+	session, err := s.sessions.Get(sessionID(token))
+	if errors.Is(err, protocol.ErrInvalidSession) {
+		return Session{}, http.StatusUnauthorized, err
+	} else if err != nil {
+		return Session{}, http.StatusInternalServerError, err
+	}
+
+	if s.sessionMaxLifetime > 0 {
+		expiresAt := time.Now().Add(sessionTTL)
+		if limit := session.AuthTime.Add(s.sessionMaxLifetime); expiresAt.After(limit) {
+			expiresAt = limit
+		}
+
+		// Sessions only slide once half their TTL is used, so most requests don't write to the store
+		if expiresAt.Sub(session.ExpiresAt) > sessionTTL/2 {
+			if err := s.sessions.Extend(session.ID, expiresAt); err == nil {
+				session.ExpiresAt = expiresAt
+			}
+		}
+	}
+
+	return session, http.StatusOK, nil
+}
+
+// revokeOtherSessions deletes every session of a user but the one a request is authenticated by, if it is one of theirs
+func (s *Server) revokeOtherSessions(username string, req *http.Request) error {
+	token, ok := bearerToken(req)
+	if !ok {
+		return s.sessions.RevokeUser(username)
+	}
+	current, err := s.sessions.Get(sessionID(token))
+	if err != nil || current.Username != username {
+		return s.sessions.RevokeUser(username)
+	}
+
+	sessions, err := s.sessions.List(username)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.ID == current.ID {
+			continue
+		}
+		if err := s.sessions.Revoke(session.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateSession returns the user of an unexpired session token the server issued, so services in the same process can check sessions,
+// such as with the middleware package
+// Unknown and expired tokens return protocol.ErrInvalidSession
+func (s *Server) ValidateSession(_ context.Context, token string) (string, error) {
+	session, _, err := s.lookupSession(token)
+	if err != nil {
+		return "", err
+	}
+
+	return session.Username, nil
+}
+
+// SessionsHandler handles requests for the active sessions of a session's user
+// Unexpired sessions return their user's sessions, marking the requesting one, and a 2XX status
+// Missing, unknown, and expired sessions return a 4XX status
+// Session store errors return a 5XX status
+func (s *Server) SessionsHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	sessions, err := s.sessions.List(session.Username)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	sessionsResponse := protocol.SessionsResponse{Sessions: make([]protocol.SessionInfo, len(sessions))}
+	for i, listed := range sessions {
+		sessionsResponse.Sessions[i] = protocol.SessionInfo{
+			ID:        listed.ID,
+			Recovery:  listed.Recovery,
+			AuthTime:  listed.AuthTime,
+			IssuedAt:  listed.IssuedAt,
+			ExpiresAt: listed.ExpiresAt,
+			Current:   listed.ID == session.ID,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &sessionsResponse)
+}
+
+// RevokeSessionHandler handles requests that revoke one of a session's user's sessions, such as one left logged in on another device
+// Sessions of the user, including the requesting one, are revoked and return a 2XX status
+// Malformed requests, missing, unknown, and expired sessions, and sessions of other users return a 4XX status
+// Session store errors return a 5XX status
+func (s *Server) RevokeSessionHandler(w http.ResponseWriter, req *http.Request) {
+	token, ok := bearerToken(req)
+	if !ok {
+		writeError(w, protocol.ErrInvalidSession, http.StatusUnauthorized)
+		return
+	}
+
+	var revokeRequest protocol.RevokeSessionRequest
+	if err := json.NewDecoder(req.Body).Decode(&revokeRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	session, status, err := s.lookupSession(token)
+	if err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	revoked, err := s.sessions.Get(revokeRequest.ID)
+	if errors.Is(err, protocol.ErrInvalidSession) || (err == nil && revoked.Username != session.Username) {
+		writeError(w, protocol.ErrInvalidSession, http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.sessions.Revoke(revoked.ID); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if revoked.ID == session.ID {
+		s.clearSessionCookies(w)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// bearerToken returns the token in a request's bearer authorization header
+func bearerToken(req *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// redisKeyPrefix is the prefix of the keys a RedisSessionStore writes
+const redisKeyPrefix = "hauth:"
+
+// RedisSessionStore is a SessionStore in Redis, which expires sessions itself, so replicas pointed at the same Redis share sessions
+// Each session is a JSON value under its id, and each user's session ids are a sorted set scored by their expiries, which listing trims
+type RedisSessionStore struct {
+	client *redis.Client
+}
+
+// NewRedisSessionStore returns a RedisSessionStore using a Redis client
+func NewRedisSessionStore(client *redis.Client) *RedisSessionStore {
+	return &RedisSessionStore{client: client}
+}
+
+// OpenRedisSessionStore returns a RedisSessionStore for a redis:// or rediss:// URL, such as redis://localhost:6379/0
+func OpenRedisSessionStore(url string) (*RedisSessionStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRedisSessionStore(redis.NewClient(opts)), nil
+}
+
+// sessionKey returns the key a session is stored under
+func sessionKey(id string) string {
+	return redisKeyPrefix + "session:" + id
+}
+
+// userSessionsKey returns the key of the sorted set of a user's session ids
+func userSessionsKey(username string) string {
+	return redisKeyPrefix + "user-sessions:" + username
+}
+
+// Create stores a new session in a RedisSessionStore, which expires it
+func (rs *RedisSessionStore) Create(session Session) error {
+	data, err := json.Marshal(&session)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetArgs(ctx, sessionKey(session.ID), data, redis.SetArgs{ExpireAt: session.ExpiresAt})
+		pipe.ZAdd(ctx, userSessionsKey(session.Username), redis.Z{Score: expiryScore(session.ExpiresAt), Member: session.ID})
+		return nil
+	})
+	return err
+}
+
+// Get returns an unexpired session from a RedisSessionStore
+func (rs *RedisSessionStore) Get(id string) (Session, error) {
+	data, err := rs.client.Get(context.Background(), sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Session{}, protocol.ErrInvalidSession
+	} else if err != nil {
+		return Session{}, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return Session{}, err
+	} else if time.Now().After(session.ExpiresAt) {
+		return Session{}, protocol.ErrInvalidSession
+	}
+
+	return session, nil
+}
+
+// Extend moves the expiry of an unexpired session in a RedisSessionStore
+// The session is only rewritten while it still exists, so a session revoked meanwhile isn't restored
+func (rs *RedisSessionStore) Extend(id string, expiresAt time.Time) error {
+	session, err := rs.Get(id)
+	if err != nil {
+		return err
+	}
+
+	session.ExpiresAt = expiresAt
+	data, err := json.Marshal(&session)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	ok, err := rs.client.SetArgs(ctx, sessionKey(id), data, redis.SetArgs{Mode: "XX", ExpireAt: expiresAt}).Result()
+	if errors.Is(err, redis.Nil) || (err == nil && ok != "OK") {
+		return protocol.ErrInvalidSession
+	} else if err != nil {
+		return err
+	}
+
+	return rs.client.ZAddXX(ctx, userSessionsKey(session.Username), redis.Z{Score: expiryScore(expiresAt), Member: id}).Err()
+}
+
+// Revoke deletes a session from a RedisSessionStore
+func (rs *RedisSessionStore) Revoke(id string) error {
+	session, err := rs.Get(id)
+	if errors.Is(err, protocol.ErrInvalidSession) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(id))
+		pipe.ZRem(ctx, userSessionsKey(session.Username), id)
+		return nil
+	})
+	return err
+}
+
+// RevokeUser deletes every session of a user from a RedisSessionStore
+func (rs *RedisSessionStore) RevokeUser(username string) error {
+	ctx := context.Background()
+	ids, err := rs.client.ZRange(ctx, userSessionsKey(username), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userSessionsKey(username)}
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+
+	return rs.client.Del(ctx, keys...).Err()
+}
+
+// List returns a user's unexpired sessions in a RedisSessionStore, trimming the ids of expired ones from their set
+func (rs *RedisSessionStore) List(username string) ([]Session, error) {
+	ctx := context.Background()
+	now := strconv.FormatFloat(expiryScore(time.Now()), 'f', -1, 64)
+	if err := rs.client.ZRemRangeByScore(ctx, userSessionsKey(username), "-inf", "("+now).Err(); err != nil {
+		return nil, err
+	}
+
+	ids, err := rs.client.ZRange(ctx, userSessionsKey(username), 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	values, err := rs.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var session Session
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// expiryScore returns the sorted set score of an expiry, in milliseconds since the epoch
+func expiryScore(expiresAt time.Time) float64 {
+	return float64(expiresAt.UnixMilli())
+}
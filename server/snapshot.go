@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrInvalidSnapshot = errors.New("invalid user store snapshot")
+
+type (
+	// snapshot is the file format of a MemoryStore's snapshot, whose users are in the format of a schema version
+	snapshot struct {
+		Version int
+		Users   []User
+	}
+
+	// storedSnapshot is a snapshot whose users haven't been decoded, so they can be migrated from its schema version first
+	storedSnapshot struct {
+		Version int
+		Users   []json.RawMessage
+	}
+)
+
+// encodeSnapshot writes users to a writer as a snapshot in the current schema version
+func encodeSnapshot(w io.Writer, users []User) error {
+	return json.NewEncoder(w).Encode(&snapshot{Version: SchemaVersion, Users: users})
+}
+
+// decodeSnapshot returns the users in a snapshot, migrated from its schema version to the current one
+// Snapshots written before schema versions were recorded are version 0
+func decodeSnapshot(data []byte) ([]User, error) {
+	var s storedSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	users := make([]User, len(s.Users))
+	for i, data := range s.Users {
+		user, err := MigrateUser(s.Version, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+		users[i] = user
+	}
+
+	return users, nil
+}
+
+// Snapshot writes every user in a MemoryStore to a writer as JSON, which Restore reads back
+func (ms *MemoryStore) Snapshot(w io.Writer) error {
+	_, err := ms.snapshot(w)
+	return err
+}
+
+// snapshot writes a MemoryStore's snapshot to a writer, returning the version of the MemoryStore it captured
+func (ms *MemoryStore) snapshot(w io.Writer) (uint64, error) {
+	users, version := ms.list()
+	return version, encodeSnapshot(w, users)
+}
+
+// Restore replaces every user in a MemoryStore with those in a snapshot read from a reader, migrating them from the snapshot's schema version
+func (ms *MemoryStore) Restore(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	restored, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]User, len(restored))
+	for _, user := range restored {
+		users[user.Username] = user
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.users = users
+	ms.version++
+	return nil
+}
+
+// LoadSnapshot restores a MemoryStore from a snapshot file, leaving it unchanged if the file doesn't exist
+func (ms *MemoryStore) LoadSnapshot(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ms.Restore(file)
+}
+
+// SaveSnapshot atomically replaces a snapshot file with a MemoryStore's users
+// The snapshot is written to a temporary file in the same directory, synced, then renamed over the file,
+// so a crash leaves either the previous snapshot or the new one
+func (ms *MemoryStore) SaveSnapshot(path string) error {
+	_, err := ms.saveSnapshot(path)
+	return err
+}
+
+// saveSnapshot atomically replaces a snapshot file, returning the version of the MemoryStore it captured
+func (ms *MemoryStore) saveSnapshot(path string) (uint64, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+
+	version, err := ms.snapshot(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return version, os.Rename(file.Name(), path)
+}
+
+// SnapshotEvery saves a MemoryStore to a snapshot file each interval it has changed, until a context is done,
+// then saves it a last time and returns that save's error
+// Failed saves are passed to onError, if it isn't nil, and retried at the next interval
+func (ms *MemoryStore) SnapshotEvery(ctx context.Context, path string, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ms.mu.Lock()
+	saved := ms.version
+	ms.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ms.SaveSnapshot(path)
+		case <-ticker.C:
+		}
+
+		ms.mu.Lock()
+		changed := ms.version != saved
+		ms.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		version, err := ms.saveSnapshot(path)
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+		saved = version
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/crypto/srp"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var (
+	errMalformedSRP   = errors.New("malformed srp enrollment")
+	errSRPRecovery    = errors.New("srp users can't enroll a recovery secret")
+	errNotSRPUser     = errors.New("user doesn't log in with SRP")
+	errUnstretchedSRP = errors.New("user's srp verifier wasn't stretched, so their password must be reset")
+)
+
+// checkSRPEnrollment returns an error unless an SRP enrollment's verifier is of the group's length and its KDFParams pass Check
+func checkSRPEnrollment(enrollment *protocol.SRPEnrollment) error {
+	if err := enrollment.KDFParams.Check(); err != nil {
+		return fmt.Errorf("%w: %w", errMalformedSRP, err)
+	} else if len(enrollment.Verifier) != srp.VerifierByteLen {
+		return fmt.Errorf("%w: verifiers are %d bytes", errMalformedSRP, srp.VerifierByteLen)
+	}
+
+	return nil
+}
+
+// SRPLogInBeginHandler handles requests to begin logging in a user who signed up with an SRP verifier
+// SRP users return the KDFParams of their verifier, the server's public key, and the id of the login to finish at SRPLogInFinishHandler, with a 2XX status
+// Malformed requests and public keys, nonexistent and unverified users, users without an SRP verifier or whose verifier has no KDFParams, requests the RiskAssessor denies or demands step-up for,
+// and requests without a valid CAPTCHA token once their user or address has failed to log in too often return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) SRPLogInBeginHandler(w http.ResponseWriter, req *http.Request) {
+	var beginRequest protocol.SRPBeginRequest
+	if err := json.NewDecoder(req.Body).Decode(&beginRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.users.Get(beginRequest.Username)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	} else if user.OPAQUE != nil {
+		writeError(w, protocol.ErrOPAQUERequired, http.StatusBadRequest)
+		return
+	} else if user.SRP == nil {
+		writeError(w, errNotSRPUser, http.StatusBadRequest)
+		return
+	} else if user.SRP.KDFParams == nil {
+		writeError(w, errUnstretchedSRP, http.StatusBadRequest)
+		return
+	}
+
+	firstLogInRequest := protocol.FirstLogInRequest{
+		Username:     beginRequest.Username,
+		StepUpToken:  beginRequest.StepUpToken,
+		CaptchaToken: beginRequest.CaptchaToken,
+	}
+	if status, err := s.screenLogIn(req.Context(), req.RemoteAddr, user.Username, &firstLogInRequest); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	server, err := srp.NewServer(s.entropy, beginRequest.Username, user.SRP.KDFParams.Salt, user.SRP.Verifier, beginRequest.PublicKey)
+	if errors.Is(err, srp.ErrMalformed) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ceremonyID, err := s.ceremonies.start(s.entropy, ceremony{username: user.Username, srp: server})
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &protocol.SRPBeginResponse{
+		CeremonyID: ceremonyID,
+		KDFParams:  user.SRP.KDFParams,
+		PublicKey:  server.PublicKey(),
+	})
+}
+
+// SRPLogInFinishHandler handles requests to finish an SRP login with the client's proof that it knows the user's password
+// Valid proofs return the server's proof and a session token, or a passkey ceremony for users with passkeys, and a 2XX status
+// Malformed requests, unknown or expired logins, and invalid proofs return a 4XX status
+// Store and entropy errors return a 5XX status
+func (s *Server) SRPLogInFinishHandler(w http.ResponseWriter, req *http.Request) {
+	var finishRequest protocol.SRPFinishRequest
+	if err := json.NewDecoder(req.Body).Decode(&finishRequest); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	c, ok := s.ceremonies.take(finishRequest.CeremonyID)
+	if !ok || c.srp == nil || !s.sameUser(c.username, finishRequest.Username) {
+		writeError(w, protocol.ErrUnknownChallenge, http.StatusNotFound)
+		return
+	}
+
+	serverProof, err := c.srp.Verify(finishRequest.Proof)
+	if err != nil {
+		s.logInFailed(c.username, req.RemoteAddr, finishRequest.CeremonyID, false)
+		writeError(w, protocol.ErrInvalidCredentials, http.StatusForbidden)
+		return
+	}
+
+	user, err := s.users.Get(c.username)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if status, err := checkStatus(user); err != nil {
+		writeError(w, err, status)
+		return
+	}
+
+	logInResponse, err := s.completeLogIn(user, req.RemoteAddr, finishRequest.CeremonyID, false)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.setSessionCookies(w, logInResponse)
+	writeJSON(w, http.StatusOK, &protocol.SRPFinishResponse{Proof: serverProof, LogInResponse: *logInResponse})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errInvalidStatus = errors.New("account status must be active, disabled, or deleted")
+
+// statusEvents are the events sent when an admin changes a user's account to each status
+var statusEvents = map[protocol.AccountStatus]EventType{
+	protocol.AccountActive:   EventAccountEnabled,
+	protocol.AccountDisabled: EventAccountDisabled,
+	protocol.AccountDeleted:  EventAccountDeleted,
+}
+
+// status returns the status of a user's account, which is pending verification while an active user's email address is unverified
+func (u User) status() protocol.AccountStatus {
+	switch {
+	case u.Status == protocol.AccountDisabled || u.Status == protocol.AccountDeleted:
+		return u.Status
+	case u.Verification != nil:
+		return protocol.AccountPendingVerification
+	default:
+		return protocol.AccountActive
+	}
+}
+
+// checkStatus returns the status and error to return for a user whose account isn't active,
+// where deleted users are as nonexistent ones, disabled users are refused, and unverified users must verify their email address first
+func checkStatus(user User) (int, error) {
+	switch user.status() {
+	case protocol.AccountDeleted:
+		return http.StatusBadRequest, protocol.ErrUserDoesNotExist
+	case protocol.AccountDisabled:
+		return http.StatusForbidden, protocol.ErrAccountDisabled
+	case protocol.AccountPendingVerification:
+		return http.StatusForbidden, protocol.ErrUnverified
+	default:
+		return http.StatusOK, nil
+	}
+}
+
+// storedStatus returns the status an admin last set for a user, which is active if none was set
+func storedStatus(user User) protocol.AccountStatus {
+	if user.Status == "" {
+		return protocol.AccountActive
+	}
+
+	return user.Status
+}
+
+// AccountStatusHandler handles admin requests for the status of the account of the user named by the username query parameter, with GET,
+// or that change it to active, disabled, or deleted, with POST, where disabling or deleting a user revokes their sessions
+// Authorized requests return the account's status, and send an EventAccountEnabled, EventAccountDisabled, or EventAccountDeleted if it changed, and a 2XX status
+// Requests without the admin token, malformed requests, requests without a username, invalid statuses, and nonexistent users return a 4XX status
+// Store errors return a 5XX status
+func (s *Server) AccountStatusHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.isAdmin(req) {
+		writeError(w, protocol.ErrNotAdmin, http.StatusUnauthorized)
+		return
+	}
+
+	statusRequest := protocol.AccountStatusRequest{Username: req.URL.Query().Get("username")}
+	if req.Method == http.MethodPost {
+		if err := json.NewDecoder(req.Body).Decode(&statusRequest); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		} else if _, ok := statusEvents[statusRequest.Status]; !ok {
+			writeError(w, fmt.Errorf("%w: %q", errInvalidStatus, statusRequest.Status), http.StatusBadRequest)
+			return
+		}
+	}
+	if statusRequest.Username == "" {
+		writeError(w, errMissingUsername, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.findUser(w, statusRequest.Username)
+	if !ok {
+		return
+	}
+
+	if statusRequest.Status != "" && statusRequest.Status != storedStatus(user) {
+		changed := false
+		if err := s.updateUser(user.Username, func(stored *User) error {
+			changed = statusRequest.Status != storedStatus(*stored)
+			stored.Status = statusRequest.Status
+			user = *stored
+			return nil
+		}); err != nil {
+			writeError(w, err, updateStatus(err))
+			return
+		}
+		if changed {
+			s.notify(statusEvents[user.Status], user.Username, false)
+		}
+	}
+	if statusRequest.Status == protocol.AccountDisabled || statusRequest.Status == protocol.AccountDeleted {
+		if err := s.sessions.RevokeUser(user.Username); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &protocol.AccountStatusResponse{Username: user.Username, Status: user.status()})
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var ErrUnsupportedStore = errors.New("unsupported user store")
+
+type (
+	// User is a user's profile for logging in
+	User struct {
+		Username string
+		// Revision counts the updates stored of a user, so updating a user read before another update was stored is rejected rather than undoing it
+		Revision        uint64 `json:",omitempty"`
+		KDFParams       *crypto.KDFParams
+		EncryptedSecret gates.Ctxt
+		SecretHash      []byte
+		Salt            []byte
+		// Hasher is the name of the Hasher that made SecretHash, where empty names the legacy FNV hasher
+		Hasher string
+		// SecretByteLen is the length of the secret enrolled at signup, where 0 wasn't recorded and is measured from EncryptedSecret
+		SecretByteLen int `json:",omitempty"`
+		// SecurityLevel is the security level of the parameter set EncryptedSecret is encrypted under, recorded with SecretByteLen
+		SecurityLevel int `json:",omitempty"`
+		// SecretCreatedAt is when the secret was enrolled, at signup, reset, or rotation, where zero wasn't recorded and is due for rotation under any policy
+		SecretCreatedAt time.Time
+		// Pepper is the id of the pepper mixed into the secret before SecretHash was made, where empty is none
+		Pepper string `json:",omitempty"`
+		// Sealed holds EncryptedSecret, SecretHash, Salt, Recovery, RetiredSecrets, SRP, and OPAQUE in place of those fields while a SealedStore stores the user
+		Sealed *SealedFields `json:",omitempty"`
+		// Email is the address a user's mail is sent to, where empty is none
+		Email string `json:",omitempty"`
+		// Verification is pending while Email is unverified, and the user can't log in until it is
+		Verification *Verification `json:",omitempty"`
+		// Status is the account's status an admin set, protocol.AccountActive, AccountDisabled, or AccountDeleted, where empty is active
+		Status protocol.AccountStatus `json:",omitempty"`
+		// Roles and Claims are the roles and custom claims an admin attached to the user, which the tokens issued for them carry
+		Roles  []string                   `json:",omitempty"`
+		Claims map[string]json.RawMessage `json:",omitempty"`
+		// PasswordReset is pending while a mailed token can reset a user's password
+		PasswordReset *Verification `json:",omitempty"`
+		// Recovery is a second secret a user logs in with when their password is lost, where nil is none
+		Recovery *RecoverySecret `json:",omitempty"`
+		// RetiredSecrets are the secrets a user's password changes replaced, which logins begun with their KDFParams can still finish with until they expire
+		RetiredSecrets []RetiredSecret `json:",omitempty"`
+		// PasskeyHandle is the random WebAuthn user handle Passkeys are registered under
+		PasskeyHandle []byte `json:",omitempty"`
+		// Passkeys are the WebAuthn credentials a user logs in with after their password, or in place of one if EncryptedSecret, SRP, and OPAQUE are empty
+		Passkeys []webauthn.Credential `json:",omitempty"`
+		// SRP is the verifier of a user who signed up to log in with SRP-6a, in place of an EncryptedSecret, where nil is none
+		SRP *SRPVerifier `json:",omitempty"`
+		// OPAQUE is the registration record of a user who signed up to log in with OPAQUE, in place of an EncryptedSecret, where nil is none
+		OPAQUE *OPAQUERecord `json:",omitempty"`
+		// Devices are the devices a user is remembered on, whose tokens log them in without their password until they expire
+		Devices []Device `json:",omitempty"`
+		// APIKeys are the API keys a user issued, which authenticate machines as them until they expire or are revoked
+		APIKeys []APIKey `json:",omitempty"`
+		// CreatedAt is when the user signed up, LastLogInAt when they last logged in, by any method,
+		// and FailedLogIns the logins that failed since then, the last of which was at LastFailedLogInAt, where zero times weren't recorded
+		CreatedAt         time.Time
+		LastLogInAt       time.Time
+		FailedLogIns      int `json:",omitempty"`
+		LastFailedLogInAt time.Time
+		// LogInHistory is the user's login attempts within the server's login history retention, oldest first
+		LogInHistory []protocol.LogInAttempt `json:",omitempty"`
+	}
+
+	// Device is a device a user is remembered on, with hashes of its token and of the fingerprint it is bound to, where an empty hash is unbound
+	Device struct {
+		ID              string
+		Name            string
+		TokenHash       []byte
+		FingerprintHash []byte `json:",omitempty"`
+		CreatedAt       time.Time
+		LastUsedAt      time.Time
+		ExpiresAt       time.Time
+	}
+
+	// APIKey is an API key a user issued, with the hash of its key and the scopes it grants, where a zero ExpiresAt never expires
+	// LastUsedAt is when it last authenticated a request, to within apiKeyUseInterval, where zero was never
+	APIKey struct {
+		ID         string
+		Name       string
+		Scopes     []string `json:",omitempty"`
+		KeyHash    []byte
+		CreatedAt  time.Time
+		LastUsedAt time.Time
+		ExpiresAt  time.Time
+	}
+
+	// RecoverySecret is a user's second secret, encrypted under the keys of a recovery phrase, and its salted hash, with fields as User's
+	RecoverySecret struct {
+		KDFParams       *crypto.KDFParams
+		EncryptedSecret gates.Ctxt
+		SecretHash      []byte
+		Salt            []byte
+		Hasher          string
+		Pepper          string `json:",omitempty"`
+		SecretByteLen   int    `json:",omitempty"`
+		SecurityLevel   int    `json:",omitempty"`
+	}
+
+	// RetiredSecret is a user's replaced secret, with fields as User's, which is valid from when it was retired until it expires
+	RetiredSecret struct {
+		KDFParams       *crypto.KDFParams
+		EncryptedSecret gates.Ctxt
+		SecretHash      []byte
+		Salt            []byte
+		Hasher          string
+		Pepper          string `json:",omitempty"`
+		SecretByteLen   int    `json:",omitempty"`
+		SecurityLevel   int    `json:",omitempty"`
+		RetiredAt       time.Time
+		ExpiresAt       time.Time
+	}
+
+	// SRPVerifier is the SRP-6a verifier of a user's password and the KDFParams it was stretched with
+	SRPVerifier struct {
+		KDFParams *crypto.KDFParams
+		Verifier  []byte
+	}
+
+	// OPAQUERecord is the OPAQUE registration record of a user's password, the nonce its OPRF key is derived under, and the salt its OPRF output is stretched under
+	OPAQUERecord struct {
+		Nonce  []byte
+		Record []byte
+		Salt   []byte
+	}
+
+	// UserStore stores users' profiles
+	UserStore interface {
+		// Create stores a new user, returning protocol.ErrUserExists if the username is taken
+		Create(user User) error
+		// Get returns a user, or protocol.ErrUserDoesNotExist
+		Get(username string) (User, error)
+		// Update replaces an existing user read at its stored Revision, advancing the Revision,
+		// or returns protocol.ErrUserDoesNotExist, or protocol.ErrUserChanged if another update was stored since it was read
+		Update(user User) error
+	}
+
+	// UserLister is a UserStore that can list every user, which exports need
+	UserLister interface {
+		// List returns every user, ordered by username
+		List() ([]User, error)
+	}
+
+	// UserEraser is a UserStore that can delete users, which erasure requests need
+	UserEraser interface {
+		// Erase deletes an existing user, including their ciphertexts, or returns protocol.ErrUserDoesNotExist
+		Erase(username string) error
+	}
+
+	// MemoryStore is a UserStore held in memory, which is lost when the process exits unless it is snapshotted to a file
+	MemoryStore struct {
+		users map[string]User
+		// version counts changes to users, so unchanged stores aren't snapshotted again
+		version uint64
+		mu      sync.Mutex
+	}
+)
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: map[string]User{}}
+}
+
+// OpenStore returns the UserStore for a data source name, where "memory://" or an empty name is a new MemoryStore
+func OpenStore(dsn string) (UserStore, error) {
+	scheme, _, _ := strings.Cut(dsn, "://")
+	switch scheme {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedStore, scheme)
+	}
+}
+
+// Create stores a new user in a MemoryStore
+func (ms *MemoryStore) Create(user User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[user.Username]; ok {
+		return protocol.ErrUserExists
+	}
+
+	ms.users[user.Username] = user
+	ms.version++
+	return nil
+}
+
+// Get returns a user from a MemoryStore
+func (ms *MemoryStore) Get(username string) (User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[username]
+	if !ok {
+		return User{}, protocol.ErrUserDoesNotExist
+	}
+
+	return user, nil
+}
+
+// Update replaces an existing user in a MemoryStore, if it was read at its stored Revision
+func (ms *MemoryStore) Update(user User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stored, ok := ms.users[user.Username]
+	if !ok {
+		return protocol.ErrUserDoesNotExist
+	} else if stored.Revision != user.Revision {
+		return protocol.ErrUserChanged
+	}
+
+	user.Revision++
+	ms.users[user.Username] = user
+	ms.version++
+	return nil
+}
+
+// Erase deletes an existing user from a MemoryStore
+func (ms *MemoryStore) Erase(username string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[username]; !ok {
+		return protocol.ErrUserDoesNotExist
+	}
+
+	delete(ms.users, username)
+	ms.version++
+	return nil
+}
+
+// List returns every user in a MemoryStore, ordered by username
+func (ms *MemoryStore) List() ([]User, error) {
+	users, _ := ms.list()
+	return users, nil
+}
+
+// list returns every user in a MemoryStore ordered by username, and the version of the MemoryStore it captured
+func (ms *MemoryStore) list() ([]User, uint64) {
+	ms.mu.Lock()
+	users := make([]User, 0, len(ms.users))
+	for _, user := range ms.users {
+		users = append(users, user)
+	}
+	version := ms.version
+	ms.mu.Unlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users, version
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/thedonutfactory/go-tfhe/gates"
+	"github.com/zambozoo/homomorphic-authentication/crypto"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+var errUsernameMismatch = errors.New("second login request is for another user")
+
+// ServeLogIn runs a login over a MessageConn from a client address, running both steps on one connection, whatever transport carries it
+// The challenge is streamed as it is computed, a chunk of bits per processor at a time, rather than after it is complete
+// Failures that FirstLoginHandler and SecondLoginHandler return as statuses end the login with an Error message holding that status, which is also returned
+func (s *Server) ServeLogIn(ctx context.Context, conn protocol.MessageConn, remoteAddr string) error {
+	status, err := s.recoverLogInStream(ctx, conn, remoteAddr)
+	if err == nil {
+		return nil
+	}
+
+	sent := err
+	if errors.Is(err, errPanicked) {
+		sent = protocol.ErrServer
+	}
+	conn.WriteMessage(ctx, &protocol.LogInStreamMessage{
+		Error: &protocol.ErrorResponse{
+			Code:      protocol.ErrorCode(sent, status),
+			Message:   sent.Error(),
+			Versioned: protocol.Versioned{Version: protocol.Version},
+		},
+		Status:    status,
+		Versioned: protocol.Versioned{Version: protocol.Version},
+	})
+	return err
+}
+
+// recoverLogInStream is logInStream that recovers panics, which are logged with their stack and counted, and return a 5XX status
+func (s *Server) recoverLogInStream(ctx context.Context, conn protocol.MessageConn, remoteAddr string) (status int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			status, err = http.StatusInternalServerError, s.recovered(r, "login stream from "+remoteAddr)
+		}
+	}()
+
+	return s.logInStream(ctx, conn, remoteAddr)
+}
+
+// sendChallenge streams a challenge of a user's login over a MessageConn, holding a challenge slot only while it is computed, followed by its signature
+func (s *Server) sendChallenge(ctx context.Context, conn protocol.MessageConn, user User, challenge Challenge, serverScheme crypto.Scheme) (int, error) {
+	if !s.challenges.tryAcquire() {
+		return http.StatusTooManyRequests, protocol.ErrBusy
+	}
+	defer s.challenges.release()
+
+	header := s.challengeHeader(user, challenge)
+	if err := conn.WriteMessage(ctx, &protocol.LogInStreamMessage{
+		Negotiation:   &header.Negotiation,
+		Bits:          len(user.EncryptedSecret),
+		SecretByteLen: header.SecretByteLen,
+		ChallengeID:   header.ChallengeID,
+		Nonce:         header.Nonce,
+		ExpiresAt:     &header.ExpiresAt,
+		Versioned:     header.Versioned,
+	}); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	signature, status, err := s.streamChallenge(ctx, user, challenge, header, serverScheme, runtime.GOMAXPROCS(0), func(chunk gates.Ctxt) error {
+		return conn.WriteMessage(ctx, &protocol.LogInStreamMessage{Samples: chunk, Versioned: header.Versioned})
+	})
+	if err != nil {
+		return status, err
+	}
+
+	if err := conn.WriteMessage(ctx, &protocol.LogInStreamMessage{Signature: signature, Versioned: header.Versioned}); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// logInStream runs both login steps over a MessageConn from a client address, returning the status and error that ended a failed login
+func (s *Server) logInStream(ctx context.Context, conn protocol.MessageConn, remoteAddr string) (int, error) {
+	var firstLogInRequest protocol.FirstLogInRequest
+	if err := conn.ReadMessage(ctx, &firstLogInRequest); err != nil {
+		return http.StatusBadRequest, err
+	}
+	version, status, err := s.negotiateVersion(firstLogInRequest.EffectiveVersion())
+	if err != nil {
+		return status, err
+	}
+
+	user, status, err := s.lookupCredential(firstLogInRequest.Username, firstLogInRequest.Recovery)
+	if err != nil {
+		return status, err
+	}
+	user, _ = user.withSecret(firstLogInRequest.KDFSalt, time.Now())
+	if firstLogInRequest.Recovery && !s.allowRecovery(user.Username) {
+		return http.StatusTooManyRequests, errRateLimited
+	}
+	if status, err := s.screenLogIn(ctx, remoteAddr, user.Username, &firstLogInRequest); err != nil {
+		return status, err
+	}
+
+	if err := s.checkPublicKey(user, firstLogInRequest.PublicKey); err != nil {
+		return http.StatusBadRequest, err
+	}
+	serverScheme, err := s.backend.MakePublicScheme(firstLogInRequest.PublicKey)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	challenge, err := s.makeChallenge(user, version, &firstLogInRequest)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if status, err := s.sendChallenge(ctx, conn, user, challenge, serverScheme); err != nil {
+		return status, err
+	}
+
+	var secondLogInRequest protocol.SecondLogInRequest
+	if err := conn.ReadMessage(ctx, &secondLogInRequest); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if secondLogInRequest.Username != firstLogInRequest.Username || secondLogInRequest.Recovery != firstLogInRequest.Recovery {
+		return http.StatusBadRequest, errUsernameMismatch
+	} else if secondLogInRequest.EffectiveVersion() != challenge.Version {
+		return http.StatusBadRequest, fmt.Errorf("%w: login negotiated version %d", protocol.ErrUnsupportedVersion, challenge.Version)
+	} else if answersChallenge(challenge.Version) && secondLogInRequest.ChallengeID != challenge.ID {
+		return http.StatusBadRequest, protocol.ErrUnknownChallenge
+	}
+
+	logInResponse, status, err := s.finishLogIn(&secondLogInRequest, remoteAddr)
+	if err != nil {
+		return status, err
+	}
+
+	return http.StatusOK, conn.WriteMessage(ctx, &protocol.LogInStreamMessage{LogIn: logInResponse, Versioned: protocol.Versioned{Version: challenge.Version}})
+}
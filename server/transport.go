@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/quic-go/quic-go"
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+)
+
+// limitedStream is a byte stream read through a Reader that limits how much of it is read
+type limitedStream struct {
+	io.Reader
+	io.ReadWriteCloser
+}
+
+// Read reads from a limitedStream's Reader
+func (ls limitedStream) Read(p []byte) (int, error) {
+	return ls.Reader.Read(p)
+}
+
+// ServeStreams runs a login with ServeLogIn on each connection a listener accepts, such as a raw TCP listener, a Unix domain socket from Listen,
+// or a TLS listener wrapping either, carrying its messages as JSON values, until the listener is closed, returning the error that closed it
+// Each connection carries one login, for devices that can open a socket but not speak HTTP
+func (s *Server) ServeStreams(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveStream(conn, conn.RemoteAddr().String())
+	}
+}
+
+// ServeQUIC runs a login with ServeLogIn on each stream clients open on the connections a QUIC listener accepts,
+// which must negotiate protocol.QUICNextProto, until the listener is closed, returning the error that closed it
+func (s *Server) ServeQUIC(listener *quic.Listener) error {
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+
+				go s.serveStream(stream, conn.RemoteAddr().String())
+			}
+		}()
+	}
+}
+
+// serveStream runs a login over a byte stream from a client address, and closes it
+// Streams carry no request, so their logins are only cancelled by the server's request timeout, and no more of them is read than a request carrying a public key
+func (s *Server) serveStream(rwc io.ReadWriteCloser, remoteAddr string) {
+	conn := protocol.NewStreamConn(limitedStream{Reader: io.LimitReader(rwc, s.maxKeyBodyLen), ReadWriteCloser: rwc})
+	defer conn.Close()
+
+	ctx := context.Background()
+	if s.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+	}
+
+	s.ServeLogIn(ctx, conn, remoteAddr)
+}
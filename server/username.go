@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/zambozoo/homomorphic-authentication/protocol"
+	"golang.org/x/text/secure/precis"
+	"golang.org/x/text/unicode/norm"
+)
+
+type (
+	// UsernamePolicy is how usernames are normalized and which of them are allowed
+	// Usernames are NFKC normalized, so compatibility variants such as fullwidth or ligature letters equal their plain forms,
+	// then enforced with the PRECIS UsernameCasePreserved profile, or UsernameCaseMapped if CaseInsensitive is set
+	// MinLength and MaxLength count the runes of the normalized username, where a MaxLength of 0 is unlimited,
+	// and Pattern, if set, must match it, such as ^[a-z0-9._-]+$ to shut out homoglyphs from other scripts
+	UsernamePolicy struct {
+		MinLength       int
+		MaxLength       int
+		Pattern         *regexp.Regexp
+		CaseInsensitive bool
+	}
+
+	// NormalizedStore is a UserStore that normalizes usernames under a UsernamePolicy before storing or looking up users in another UserStore,
+	// so every spelling the policy equates names the same user
+	// Users stored before the policy are still found by their exact username
+	NormalizedStore struct {
+		store  UserStore
+		policy *UsernamePolicy
+	}
+)
+
+// Normalize returns the form of a username that users are stored and looked up by, or protocol.ErrInvalidUsername if the policy doesn't allow it
+func (up *UsernamePolicy) Normalize(username string) (string, error) {
+	profile := precis.UsernameCasePreserved
+	if up.CaseInsensitive {
+		profile = precis.UsernameCaseMapped
+	}
+
+	normalized, err := profile.String(norm.NFKC.String(username))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", protocol.ErrInvalidUsername, err)
+	}
+
+	if length := utf8.RuneCountInString(normalized); length < up.MinLength {
+		return "", fmt.Errorf("%w: usernames are at least %d characters", protocol.ErrInvalidUsername, up.MinLength)
+	} else if up.MaxLength > 0 && length > up.MaxLength {
+		return "", fmt.Errorf("%w: usernames are at most %d characters", protocol.ErrInvalidUsername, up.MaxLength)
+	} else if up.Pattern != nil && !up.Pattern.MatchString(normalized) {
+		return "", fmt.Errorf("%w: usernames must match %s", protocol.ErrInvalidUsername, up.Pattern)
+	}
+
+	return normalized, nil
+}
+
+// NewNormalizedStore returns a NormalizedStore that normalizes usernames under a policy for a UserStore
+func NewNormalizedStore(store UserStore, policy *UsernamePolicy) *NormalizedStore {
+	return &NormalizedStore{store: store, policy: policy}
+}
+
+// Create stores a new user under their normalized username in a NormalizedStore's UserStore
+func (ns *NormalizedStore) Create(user User) error {
+	normalized, err := ns.policy.Normalize(user.Username)
+	if err != nil {
+		return err
+	}
+	user.Username = normalized
+
+	return ns.store.Create(user)
+}
+
+// Get returns the user a username normalizes to from a NormalizedStore's UserStore, or the user stored under the exact username before the policy
+func (ns *NormalizedStore) Get(username string) (User, error) {
+	normalized, err := ns.policy.Normalize(username)
+	if err != nil {
+		return ns.store.Get(username)
+	}
+
+	user, err := ns.store.Get(normalized)
+	if errors.Is(err, protocol.ErrUserDoesNotExist) && normalized != username {
+		return ns.store.Get(username)
+	}
+
+	return user, err
+}
+
+// Update replaces a user in a NormalizedStore's UserStore, whose username is already the one they are stored under
+func (ns *NormalizedStore) Update(user User) error {
+	return ns.store.Update(user)
+}
+
+// Erase deletes a user from a NormalizedStore's UserStore, whose username is already the one they are stored under, if the UserStore is a UserEraser
+func (ns *NormalizedStore) Erase(username string) error {
+	eraser, ok := ns.store.(UserEraser)
+	if !ok {
+		return errUnerasableStore
+	}
+
+	return eraser.Erase(username)
+}
+
+// List returns every user in a NormalizedStore's UserStore, if the UserStore is a UserLister
+func (ns *NormalizedStore) List() ([]User, error) {
+	lister, ok := ns.store.(UserLister)
+	if !ok {
+		return nil, errUnlistableStore
+	}
+
+	return lister.List()
+}
+
+// normalizeUsername returns the form of a username that users are stored and looked up by under the server's UsernamePolicy, if it has one
+func (s *Server) normalizeUsername(username string) (string, error) {
+	if s.usernamePolicy == nil {
+		return username, nil
+	}
+
+	return s.usernamePolicy.Normalize(username)
+}
+
+// sameUser returns whether a username names the user stored under another
+func (s *Server) sameUser(stored, username string) bool {
+	if stored == username {
+		return true
+	}
+
+	normalized, err := s.normalizeUsername(username)
+	return err == nil && normalized == stored
+}
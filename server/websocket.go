@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// webSocketConn is a protocol.MessageConn over a WebSocket, carrying each message as a JSON text message
+type webSocketConn struct {
+	conn *websocket.Conn
+}
+
+// ReadMessage reads the next message of a WebSocket into v
+func (wc webSocketConn) ReadMessage(ctx context.Context, v any) error {
+	return wsjson.Read(ctx, wc.conn, v)
+}
+
+// WriteMessage writes a message to a WebSocket
+func (wc webSocketConn) WriteMessage(ctx context.Context, v any) error {
+	return wsjson.Write(ctx, wc.conn, v)
+}
+
+// Close closes a WebSocket normally
+func (wc webSocketConn) Close() error {
+	return wc.conn.Close(websocket.StatusNormalClosure, "")
+}
+
+// LogInWebSocketHandler handles logins over a WebSocket, running both steps on one connection with ServeLogIn
+// Failures that FirstLoginHandler and SecondLoginHandler return as statuses end the login with an Error message holding that status
+func (s *Server) LogInWebSocketHandler(w http.ResponseWriter, req *http.Request) {
+	conn, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(s.maxKeyBodyLen)
+
+	wc := webSocketConn{conn: conn}
+	s.ServeLogIn(req.Context(), wc, req.RemoteAddr)
+	wc.Close()
+}